@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"themis-cli/internal/projectlink"
+	"themis-cli/internal/state"
+	"themis-cli/internal/themis"
+)
+
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+// cookieExpiryWarnWindow is how close to expiry a cookie must be before doctor warns.
+const cookieExpiryWarnWindow = 48 * time.Hour
+
+type doctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Hint   string `json:"hint,omitempty"`
+	Data   any    `json:"data,omitempty"`
+}
+
+type doctorReport struct {
+	Status string        `json:"status"`
+	Checks []doctorCheck `json:"checks"`
+}
+
+func runDoctor(args []string) {
+	jsonRequested := wantsJSON(args)
+	fs := newFlagSet("doctor")
+	common := addCommonFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		fail(err, jsonRequested, "")
+	}
+
+	ctx, cancel := common.commandContext()
+	defer cancel()
+
+	report := doctorReport{Status: "ok", Checks: make([]doctorCheck, 0, 8)}
+	add := func(c doctorCheck) {
+		report.Checks = append(report.Checks, c)
+		if c.Status == checkFail {
+			report.Status = "error"
+		}
+	}
+
+	baseURL, baseErr := themis.NormalizeBaseURL(common.baseURL)
+	session, sessionErr := (*themis.Session)(nil), error(nil)
+	if baseErr == nil {
+		session, sessionErr = newSession(*common, baseURL)
+	}
+
+	add(checkBaseURL(ctx, *common, baseURL, baseErr, session))
+	add(checkCookieSources(*common))
+	add(checkAuthentication(ctx, session, baseErr, sessionErr))
+	add(checkCookieExpiry(ctx, session, baseErr, sessionErr))
+	if session != nil {
+		if err := closeSession(session, nil); err != nil {
+			add(doctorCheck{Name: "cookie_persist", Status: checkFail, Detail: err.Error(), Hint: "make the cookie file writable or drop --persist-cookies"})
+		}
+	}
+
+	store, err := openMaintenanceStore(*common)
+	if err != nil {
+		add(doctorCheck{Name: "state_file", Status: checkFail, Detail: err.Error(), Hint: "ensure $HOME is set and --state-backend is json or log"})
+	} else {
+		add(checkStateLock(store.Location()))
+		var stateCheck doctorCheck
+		var st *state.State
+		if store.Backend() == state.BackendJSON {
+			stateCheck, st = checkStateFile(store.Location())
+		} else {
+			stateCheck, st = checkStateStore(store)
+		}
+		add(stateCheck)
+		add(checkProjectLink(st))
+	}
+
+	if common.jsonOutput {
+		writeJSON(report)
+	} else {
+		printDoctorReport(report)
+	}
+	if report.Status != "ok" {
+		os.Exit(1)
+	}
+}
+
+func checkBaseURL(ctx context.Context, common commonFlags, baseURL string, baseErr error, session *themis.Session) doctorCheck {
+	c := doctorCheck{Name: "base_url"}
+	if baseErr != nil {
+		c.Status = checkFail
+		c.Detail = baseErr.Error()
+		c.Hint = "pass a valid --base-url or THEMIS_BASE_URL (for example https://themis.housing.rug.nl)"
+		return c
+	}
+	probe := session
+	if probe == nil {
+		probe = &themis.Session{BaseURL: baseURL, Client: &http.Client{Timeout: common.timeout}}
+	}
+	if err := probe.CheckBaseURLAccessContext(ctx); err != nil {
+		c.Status = checkFail
+		c.Detail = err.Error()
+		c.Hint = "check network/VPN access to " + baseURL
+		return c
+	}
+	c.Status = checkOK
+	c.Detail = baseURL + " reachable"
+	return c
+}
+
+func checkCookieSources(common commonFlags) doctorCheck {
+	c := doctorCheck{Name: "cookie_source"}
+	reports := themis.InspectCookieSources(common.authConfig())
+	c.Data = reports
+
+	for _, r := range reports {
+		if !r.Selected {
+			continue
+		}
+		c.Status = checkOK
+		c.Detail = fmt.Sprintf("using %s", r.Source)
+		if r.Location != "" {
+			c.Detail += fmt.Sprintf(" (%s)", r.Location)
+		}
+		if r.Encrypted {
+			c.Detail += ", encrypted"
+		}
+		return c
+	}
+
+	c.Status = checkFail
+	parts := make([]string, 0, len(reports))
+	for _, r := range reports {
+		if r.Configured {
+			parts = append(parts, fmt.Sprintf("%s: %s", r.Source, r.Error))
+		}
+	}
+	c.Detail = "no valid cookie source"
+	if len(parts) > 0 {
+		c.Detail += ": " + strings.Join(parts, "; ")
+	}
+	c.Hint = "copy your Themis session cookie into " + common.defaultCookiePath + " or pass --cookie-file / --cookie-env"
+	return c
+}
+
+func checkAuthentication(ctx context.Context, session *themis.Session, baseErr error, sessionErr error) doctorCheck {
+	c := doctorCheck{Name: "authentication"}
+	if baseErr != nil || sessionErr != nil {
+		c.Status = checkSkip
+		c.Detail = "no session available"
+		if sessionErr != nil {
+			c.Detail = sessionErr.Error()
+		}
+		return c
+	}
+	user, err := session.ValidateAuthenticationContext(ctx)
+	if err != nil {
+		c.Status = checkFail
+		c.Detail = err.Error()
+		c.Hint = "log in to Themis in a browser and refresh the cookie file; the session has likely expired"
+		return c
+	}
+	c.Status = checkOK
+	c.Detail = fmt.Sprintf("authenticated as %s (%s)", user.FullName, user.Email)
+	return c
+}
+
+func checkCookieExpiry(ctx context.Context, session *themis.Session, baseErr error, sessionErr error) doctorCheck {
+	c := doctorCheck{Name: "cookie_expiry"}
+	if baseErr != nil || sessionErr != nil {
+		c.Status = checkSkip
+		c.Detail = "no session available"
+		return c
+	}
+	expiries, err := session.CookieExpiryContext(ctx)
+	if err != nil {
+		c.Status = checkWarn
+		c.Detail = err.Error()
+		return c
+	}
+	c.Data = expiries
+
+	var earliest *themis.CookieExpiry
+	for i := range expiries {
+		if expiries[i].ExpiresAt == nil {
+			continue
+		}
+		if earliest == nil || expiries[i].ExpiresAt.Before(*earliest.ExpiresAt) {
+			earliest = &expiries[i]
+		}
+	}
+	if earliest == nil {
+		c.Status = checkOK
+		c.Detail = "server did not advertise a cookie expiry"
+		if source, path := session.CookieSource(); path != "" {
+			if info, err := os.Stat(path); err == nil {
+				c.Detail += fmt.Sprintf("; %s last updated %s ago", source, time.Since(info.ModTime()).Round(time.Minute))
+			}
+		}
+		return c
+	}
+
+	remaining := time.Until(*earliest.ExpiresAt)
+	switch {
+	case remaining <= 0:
+		c.Status = checkFail
+		c.Detail = fmt.Sprintf("cookie %s expired at %s", earliest.Name, earliest.ExpiresAt.Format(time.RFC3339))
+		c.Hint = "refresh the cookie file from a browser session"
+	case remaining < cookieExpiryWarnWindow:
+		c.Status = checkWarn
+		c.Detail = fmt.Sprintf("cookie %s expires in %s", earliest.Name, remaining.Round(time.Minute))
+		c.Hint = "use --persist-cookies to keep rotated cookies, or refresh the cookie file soon"
+	default:
+		c.Status = checkOK
+		c.Detail = fmt.Sprintf("cookie %s expires %s", earliest.Name, earliest.ExpiresAt.Format(time.RFC3339))
+	}
+	return c
+}
+
+func checkStateLock(statePath string) doctorCheck {
+	c := doctorCheck{Name: "state_lock"}
+	status, err := state.ProbeLock(statePath)
+	if err != nil {
+		c.Status = checkWarn
+		c.Detail = err.Error()
+		return c
+	}
+	c.Data = status
+	switch {
+	case status.HeldExclusive:
+		c.Status = checkWarn
+		c.Detail = status.Path + " is held by another themis process"
+		c.Hint = "wait for the other command (or TUI refresh) to finish; kill it if it is hung"
+	case len(status.StaleTempFiles) > 0:
+		c.Status = checkWarn
+		c.Detail = fmt.Sprintf("%d leftover temp file(s) from interrupted saves", len(status.StaleTempFiles))
+		c.Hint = "remove " + strings.Join(status.StaleTempFiles, ", ")
+	default:
+		c.Status = checkOK
+		c.Detail = "no lock contention"
+	}
+	return c
+}
+
+func checkStateFile(statePath string) (doctorCheck, *state.State) {
+	c := doctorCheck{Name: "state_file"}
+	raw, err := os.ReadFile(statePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			c.Status = checkWarn
+			c.Detail = statePath + " does not exist yet"
+			c.Hint = "run `themis list --discover --root-url <url>` to populate the cache"
+			return c, nil
+		}
+		c.Status = checkFail
+		c.Detail = err.Error()
+		return c, nil
+	}
+
+	var st state.State
+	if err := json.Unmarshal(raw, &st); err != nil {
+		c.Status = checkFail
+		c.Detail = fmt.Sprintf("decode %s: %v", statePath, err)
+		c.Hint = "restore " + statePath + ".bak or remove the file to start over"
+		return c, nil
+	}
+
+	c.Data = map[string]any{
+		"path":           statePath,
+		"schema_version": st.SchemaVersion,
+		"nodes":          len(st.Nodes),
+		"roots":          len(st.Roots),
+	}
+	switch {
+	case st.SchemaVersion > state.CurrentSchemaVersion:
+		c.Status = checkFail
+		c.Detail = fmt.Sprintf("schema_version %d is newer than supported %d", st.SchemaVersion, state.CurrentSchemaVersion)
+		c.Hint = "upgrade themis"
+	case st.SchemaVersion < state.CurrentSchemaVersion:
+		c.Status = checkWarn
+		c.Detail = fmt.Sprintf("schema_version %d is older than %d", st.SchemaVersion, state.CurrentSchemaVersion)
+		c.Hint = "run `themis state migrate` (it is also upgraded on the next save)"
+	default:
+		c.Status = checkOK
+		c.Detail = fmt.Sprintf("schema_version %d, %d nodes, %d roots", st.SchemaVersion, len(st.Nodes), len(st.Roots))
+	}
+	return c, &st
+}
+
+func checkStateStore(store state.Store) (doctorCheck, *state.State) {
+	c := doctorCheck{Name: "state_file"}
+	if _, err := os.Stat(store.Location()); errors.Is(err, os.ErrNotExist) {
+		c.Status = checkWarn
+		c.Detail = store.Location() + " does not exist yet"
+		c.Hint = "run `themis list --discover --root-url <url>` or `themis state convert --to " + store.Backend() + "`"
+		return c, nil
+	}
+	st, err := store.Load()
+	if err != nil {
+		c.Status = checkFail
+		c.Detail = err.Error()
+		c.Hint = "rebuild it with `themis state convert --to " + store.Backend() + " --force`"
+		return c, nil
+	}
+	c.Status = checkOK
+	c.Detail = fmt.Sprintf("%s backend, %d nodes, %d roots", store.Backend(), len(st.Nodes), len(st.Roots))
+	c.Data = map[string]any{
+		"path":           store.Location(),
+		"backend":        store.Backend(),
+		"schema_version": st.SchemaVersion,
+		"nodes":          len(st.Nodes),
+		"roots":          len(st.Roots),
+	}
+	return c, &st
+}
+
+func checkProjectLink(st *state.State) doctorCheck {
+	c := doctorCheck{Name: "project_link"}
+	cfg, cfgPath, err := projectlink.ResolveByCWD(".")
+	if err != nil {
+		if errors.Is(err, projectlink.ErrNotLinked) {
+			c.Status = checkSkip
+			c.Detail = "no .themis/project.json found from the current directory"
+			c.Hint = "run `themis project link --root-url <url>` to link this repository"
+			return c
+		}
+		c.Status = checkFail
+		c.Detail = err.Error()
+		c.Hint = "fix or delete the invalid .themis/project.json and re-run `themis project link`"
+		return c
+	}
+
+	rootID := strings.TrimSpace(cfg.LinkedRootNodeID)
+	if rootID == "" {
+		rootID = state.NodeIDFromCanonicalURL(cfg.LinkedRootURL)
+	}
+	c.Data = map[string]any{
+		"path":                cfgPath,
+		"linked_root_url":     cfg.LinkedRootURL,
+		"linked_root_node_id": rootID,
+	}
+	if _, err := state.CanonicalizeURL(cfg.LinkedRootURL); err != nil {
+		c.Status = checkFail
+		c.Detail = fmt.Sprintf("%s: invalid linked_root_url: %v", cfgPath, err)
+		c.Hint = "re-run `themis project link --root-url <url>`"
+		return c
+	}
+	if st == nil {
+		c.Status = checkWarn
+		c.Detail = fmt.Sprintf("%s links %s but local state is unavailable", cfgPath, cfg.LinkedRootURL)
+		return c
+	}
+	if _, ok := st.Nodes[rootID]; !ok {
+		c.Status = checkWarn
+		c.Detail = fmt.Sprintf("linked root %s is not in local state", cfg.LinkedRootURL)
+		c.Hint = "run `themis list --discover --refresh-url " + cfg.LinkedRootURL + "`"
+		return c
+	}
+	c.Status = checkOK
+	c.Detail = fmt.Sprintf("%s linked to %s", cfgPath, cfg.LinkedRootURL)
+	return c
+}
+
+func printDoctorReport(report doctorReport) {
+	for _, c := range report.Checks {
+		fmt.Printf("[%-4s] %-15s %s\n", c.Status, c.Name, c.Detail)
+		if c.Hint != "" && c.Status != checkOK {
+			fmt.Printf("       %-15s hint: %s\n", "", c.Hint)
+		}
+	}
+	if report.Status == "ok" {
+		fmt.Println("All checks passed.")
+	} else {
+		fmt.Println("Some checks failed.")
+	}
+}
@@ -1,20 +1,26 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 	"themis-cli/internal/discovery"
 	"themis-cli/internal/projectlink"
 	"themis-cli/internal/state"
 	"themis-cli/internal/themis"
 	tuiapp "themis-cli/internal/tui/app"
 	"time"
+
+	"golang.org/x/term"
 )
 
 const defaultBaseURL = "https://themis.housing.rug.nl"
@@ -24,9 +30,26 @@ type commonFlags struct {
 	cookieFile        string
 	cookieEnv         string
 	defaultCookiePath string
+	cookieKeyFile     string
+	persistCookies    bool
+	recordDir         string
+	replayDir         string
+	timeout           time.Duration
+	deadline          time.Duration
+	proxyURL          string
+	caBundle          string
+	userAgent         string
+	strictState       bool
+	stateBackend      string
+	statePath         string
+	backupKeep        int
+	backupMaxAge      time.Duration
 	jsonOutput        bool
 }
 
+// rootCtx is cancelled on SIGINT/SIGTERM so in-flight requests stop promptly.
+var rootCtx = context.Background()
+
 type commandResult struct {
 	Status        string `json:"status"`
 	BaseURL       string `json:"base_url,omitempty"`
@@ -50,15 +73,34 @@ func main() {
 		fail(fmt.Errorf("missing subcommand"), wantsJSON(os.Args[1:]), "")
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	rootCtx = ctx
+	go func() {
+		// Restore default signal handling so a second Ctrl-C exits immediately.
+		<-ctx.Done()
+		stop()
+	}()
+
 	switch os.Args[1] {
 	case "check":
 		runCheck(os.Args[2:])
+	case "doctor":
+		runDoctor(os.Args[2:])
 	case "list":
 		runList(os.Args[2:])
 	case "fetch":
 		runFetch(os.Args[2:])
 	case "project":
 		runProject(os.Args[2:])
+	case "state":
+		runState(os.Args[2:])
+	case "cookie":
+		runCookie(os.Args[2:])
+	case "query":
+		runQuery(os.Args[2:])
+	case "show":
+		runShow(os.Args[2:])
 	case "tui":
 		runTUI(os.Args[2:])
 	case "-h", "--help", "help":
@@ -76,21 +118,20 @@ func runCheck(args []string) {
 		fail(err, jsonRequested, "")
 	}
 
-	session, err := themis.NewSessionWithAuthConfig(common.baseURL, themis.AuthConfig{
-		CookieFile:        common.cookieFile,
-		CookieEnv:         common.cookieEnv,
-		DefaultCookiePath: common.defaultCookiePath,
-	})
+	ctx, cancel := common.commandContext()
+	defer cancel()
+
+	session, err := newSession(*common, common.baseURL)
 	if err != nil {
 		fail(err, common.jsonOutput, common.baseURL)
 	}
 
-	if err := session.CheckBaseURLAccess(); err != nil {
-		fail(err, common.jsonOutput, session.BaseURL)
+	if err := session.CheckBaseURLAccessContext(ctx); err != nil {
+		failSession(session, err, common.jsonOutput)
 	}
 
-	userData, err := session.ValidateAuthentication()
-	if err != nil {
+	userData, err := session.ValidateAuthenticationContext(ctx)
+	if err := closeSession(session, err); err != nil {
 		fail(err, common.jsonOutput, session.BaseURL)
 	}
 
@@ -122,6 +163,8 @@ func runList(args []string) {
 	refreshDepth := fs.Int("refresh-depth", 1, "Depth used with --refresh-url (used with --discover)")
 	fullRefresh := fs.Bool("full-refresh", false, "Refresh catalog root before reading from state (used with --discover)")
 	fromStateOnly := fs.Bool("from-state-only", false, "Read discovery results only from local state; skip network refresh")
+	noRevalidate := fs.Bool("no-revalidate", false, "With --discover, skip refreshing stale nodes after printing when the linked project has auto_refresh_on_open")
+	dryRun := fs.Bool("dry-run", false, "With --full-refresh or --refresh-url, estimate the pages the refresh would fetch from cached state and exit")
 	start := fs.Int("start", 1, "First test index to probe")
 	max := fs.Int("max", 200, "Maximum number of indices to probe")
 	maxMisses := fs.Int("max-misses", 5, "Stop after this many consecutive missing indices")
@@ -141,9 +184,26 @@ func runList(args []string) {
 	if *discover && *refreshDepth < 0 {
 		fail(fmt.Errorf("--refresh-depth must be >= 0"), common.jsonOutput, "")
 	}
+	if *dryRun && (!*discover || (!*fullRefresh && strings.TrimSpace(*refreshURL) == "")) {
+		fail(fmt.Errorf("--dry-run requires --discover with --full-refresh or --refresh-url"), common.jsonOutput, "")
+	}
+
+	ctx, cancel := common.commandContext()
+	defer cancel()
+
+	if *discover && *dryRun {
+		runDiscoverDryRun(discoverOptions{
+			common:        *common,
+			discoverDepth: *discoverDepth,
+			refreshURL:    *refreshURL,
+			refreshDepth:  *refreshDepth,
+			fullRefresh:   *fullRefresh,
+		})
+		return
+	}
 
 	if *discover {
-		result, entries, err := runDiscoverStateFirst(discoverOptions{
+		result, entries, err := runDiscoverStateFirst(ctx, discoverOptions{
 			common:        *common,
 			rootURL:       *rootURL,
 			discoverDepth: *discoverDepth,
@@ -165,33 +225,32 @@ func runList(args []string) {
 		fmt.Printf("Discovered %d assignment URLs from %s (%s mode)\n", len(entries), result.RootURL, result.Mode)
 		for _, entry := range entries {
 			indent := strings.Repeat("  ", entry.Depth-1)
-			fmt.Printf("%s- %s: %s\n", indent, entry.Name, entry.URL)
+			fmt.Printf("%s- %s: %s%s\n", indent, entry.Name, entry.URL, freshnessSuffix(entry))
 		}
 		if !result.Refreshed {
 			fmt.Println("Returned from cached state (no refresh).")
 		}
+		if !*fromStateOnly && !*noRevalidate && !result.Refreshed {
+			revalidateOnOpen(ctx, *common)
+		}
 		return
 	}
 
-	session, err := themis.NewSessionWithAuthConfig(common.baseURL, themis.AuthConfig{
-		CookieFile:        common.cookieFile,
-		CookieEnv:         common.cookieEnv,
-		DefaultCookiePath: common.defaultCookiePath,
-	})
+	session, err := newSession(*common, common.baseURL)
 	if err != nil {
 		fail(err, common.jsonOutput, common.baseURL)
 	}
 
-	if _, err := session.ValidateAuthentication(); err != nil {
-		fail(err, common.jsonOutput, session.BaseURL)
+	if _, err := session.ValidateAuthenticationContext(ctx); err != nil {
+		failSession(session, err, common.jsonOutput)
 	}
 
-	baseTestsURL, testCases, err := discovery.ListTestCasesWithOptions(session.Client, *testsURL, discovery.ListOptions{
+	baseTestsURL, testCases, err := discovery.ListTestCasesContext(ctx, session.Client, *testsURL, discovery.ListOptions{
 		Start:     *start,
 		Max:       *max,
 		MaxMisses: *maxMisses,
 	})
-	if err != nil {
+	if err := closeSession(session, err); err != nil {
 		fail(err, common.jsonOutput, session.BaseURL)
 	}
 	testNumbers := discovery.ListTestNumbers(testCases)
@@ -230,26 +289,25 @@ func runFetch(args []string) {
 		fail(fmt.Errorf("missing required --tests-url"), common.jsonOutput, "")
 	}
 
-	session, err := themis.NewSessionWithAuthConfig(common.baseURL, themis.AuthConfig{
-		CookieFile:        common.cookieFile,
-		CookieEnv:         common.cookieEnv,
-		DefaultCookiePath: common.defaultCookiePath,
-	})
+	ctx, cancel := common.commandContext()
+	defer cancel()
+
+	session, err := newSession(*common, common.baseURL)
 	if err != nil {
 		fail(err, common.jsonOutput, common.baseURL)
 	}
 
-	if _, err := session.ValidateAuthentication(); err != nil {
-		fail(err, common.jsonOutput, session.BaseURL)
+	if _, err := session.ValidateAuthenticationContext(ctx); err != nil {
+		failSession(session, err, common.jsonOutput)
 	}
 
 	resolvedOutDir, err := resolveOutputDir(*outDir, *targetDir)
 	if err != nil {
-		fail(err, common.jsonOutput, session.BaseURL)
+		failSession(session, err, common.jsonOutput)
 	}
 
-	baseTestsURL, downloaded, err := discovery.FetchTestCases(session.Client, *testsURL, resolvedOutDir)
-	if err != nil {
+	baseTestsURL, downloaded, err := discovery.FetchTestCasesContext(ctx, session.Client, *testsURL, resolvedOutDir)
+	if err := closeSession(session, err); err != nil {
 		fail(err, common.jsonOutput, session.BaseURL)
 	}
 
@@ -279,12 +337,23 @@ type discoverOptions struct {
 	fromStateOnly bool
 }
 
-func runDiscoverStateFirst(opts discoverOptions) (commandResult, []discovery.AssignmentEntry, error) {
-	statePath, err := state.DefaultStatePath()
+// freshnessSuffix renders " [status, age]" for entries listed from state.
+func freshnessSuffix(entry discovery.AssignmentEntry) string {
+	if entry.Status == "" {
+		return ""
+	}
+	if entry.AgeSeconds == nil {
+		return " [" + entry.Status + "]"
+	}
+	return fmt.Sprintf(" [%s, %s]", entry.Status, state.FormatAge(time.Duration(*entry.AgeSeconds)*time.Second))
+}
+
+func runDiscoverStateFirst(ctx context.Context, opts discoverOptions) (_ commandResult, _ []discovery.AssignmentEntry, err error) {
+	store, err := opts.common.openStore()
 	if err != nil {
 		return commandResult{}, nil, err
 	}
-	st, err := state.Load(statePath)
+	st, err := store.Load()
 	if err != nil {
 		return commandResult{}, nil, err
 	}
@@ -318,34 +387,42 @@ func runDiscoverStateFirst(opts discoverOptions) (commandResult, []discovery.Ass
 		}
 
 		if opts.fullRefresh || strings.TrimSpace(opts.refreshURL) != "" || needBootstrap {
-			session, err := themis.NewSessionWithAuthConfig(baseURL, themis.AuthConfig{
-				CookieFile:        opts.common.cookieFile,
-				CookieEnv:         opts.common.cookieEnv,
-				DefaultCookiePath: opts.common.defaultCookiePath,
-			})
-			if err != nil {
-				return commandResult{}, nil, err
+			session, sessionErr := newSession(opts.common, baseURL)
+			if sessionErr != nil {
+				return commandResult{}, nil, sessionErr
 			}
-			if _, err := session.ValidateAuthentication(); err != nil {
+			defer func() { err = closeSession(session, err) }()
+			if _, err := session.ValidateAuthenticationContext(ctx); err != nil {
 				return commandResult{}, nil, err
 			}
 
 			service := discovery.NewService(session.BaseURL)
+			service.Store = store
+			if rootErr == nil {
+				// The root reference is saved in the same write as the
+				// refreshed nodes, once its node exists.
+				service.OnPersist = func(cur *state.State) bool {
+					if _, ok := cur.Nodes[rootID]; !ok {
+						return false
+					}
+					return upsertRootRef(cur, rootID, effectiveRootURL)
+				}
+			}
 			switch {
 			case opts.fullRefresh:
-				if _, err := service.RefreshCatalog(session.Client, &st, opts.discoverDepth); err != nil {
+				if _, err := service.RefreshCatalogContext(ctx, session.Client, &st, opts.discoverDepth); err != nil {
 					return commandResult{}, nil, err
 				}
 				refreshed = true
 				refreshScope = "catalog"
 			case strings.TrimSpace(opts.refreshURL) != "":
-				if _, err := service.RefreshNode(session.Client, &st, opts.refreshURL, opts.refreshDepth); err != nil {
+				if _, err := service.RefreshNodeContext(ctx, session.Client, &st, opts.refreshURL, opts.refreshDepth); err != nil {
 					return commandResult{}, nil, err
 				}
 				refreshed = true
 				refreshScope = "subtree"
 			case needBootstrap:
-				if _, err := service.RefreshNode(session.Client, &st, effectiveRootURL, opts.discoverDepth); err != nil {
+				if _, err := service.RefreshNodeContext(ctx, session.Client, &st, effectiveRootURL, opts.discoverDepth); err != nil {
 					return commandResult{}, nil, err
 				}
 				refreshed = true
@@ -371,13 +448,37 @@ func runDiscoverStateFirst(opts discoverOptions) (commandResult, []discovery.Ass
 		}
 	}
 
-	if refreshed {
-		if err := state.SaveAtomic(statePath, st, true); err != nil {
+	// A refresh has already saved its nodes, the catalog metadata and the
+	// root reference; without one only a changed root reference is written.
+	if refreshScope == "metadata" {
+		err := store.Update(func(cur *state.State) (bool, error) {
+			changed := upsertRootRef(cur, rootID, effectiveRootURL)
+			if cur.BaseURL == "" {
+				cur.BaseURL = st.BaseURL
+				changed = true
+			}
+			if cur.CatalogRootURL == "" {
+				cur.CatalogRootURL = st.CatalogRootURL
+				changed = true
+			}
+			return changed, nil
+		})
+		if err != nil {
 			return commandResult{}, nil, err
 		}
 	}
 
-	entries := collectAssignmentsFromState(st, rootID, opts.discoverDepth)
+	// Staleness is evaluated on a copy after saving so that changing a TTL
+	// never rewrites stored state.
+	policy, err := resolveStalePolicy()
+	if err != nil {
+		return commandResult{}, nil, err
+	}
+	now := time.Now()
+	if _, err := state.ApplyStalePolicyByKind(&st, now, policy); err != nil {
+		return commandResult{}, nil, err
+	}
+	entries := collectAssignmentsFromState(st, rootID, opts.discoverDepth, now)
 	return commandResult{
 		Status:       "ok",
 		BaseURL:      baseURL,
@@ -392,6 +493,65 @@ func runDiscoverStateFirst(opts discoverOptions) (commandResult, []discovery.Ass
 	}, entries, nil
 }
 
+// runDiscoverDryRun prints the pages a --full-refresh or --refresh-url run
+// would fetch, estimated from cached state without any network access.
+func runDiscoverDryRun(opts discoverOptions) {
+	store, err := opts.common.openStore()
+	if err != nil {
+		fail(err, opts.common.jsonOutput, "")
+	}
+	st, err := store.Load()
+	if err != nil {
+		fail(err, opts.common.jsonOutput, "")
+	}
+	baseURL, err := themis.NormalizeBaseURL(opts.common.baseURL)
+	if err != nil {
+		fail(err, opts.common.jsonOutput, "")
+	}
+
+	scope := "subtree"
+	targetURL := strings.TrimSpace(opts.refreshURL)
+	depth := opts.refreshDepth
+	if opts.fullRefresh {
+		scope = "catalog"
+		targetURL = strings.TrimSpace(st.CatalogRootURL)
+		if targetURL == "" {
+			targetURL = strings.TrimRight(baseURL, "/") + "/course"
+		}
+		depth = opts.discoverDepth
+	}
+	targetID, canonicalURL, err := state.NodeIDFromURL(targetURL)
+	if err != nil {
+		fail(err, opts.common.jsonOutput, baseURL)
+	}
+	est := state.EstimateRefresh(st, targetID, depth)
+
+	if opts.common.jsonOutput {
+		writeJSON(map[string]any{
+			"status":        "ok",
+			"base_url":      baseURL,
+			"dry_run":       true,
+			"refresh_scope": scope,
+			"root_url":      canonicalURL,
+			"depth":         depth,
+			"requests":      est.Requests(),
+			"estimate":      est,
+		})
+		return
+	}
+
+	byDepth := make([]string, 0, len(est.ByDepth))
+	for d, n := range est.ByDepth {
+		byDepth = append(byDepth, fmt.Sprintf("%d:%d", d, n))
+	}
+	fmt.Printf("Refreshing %s (%s, depth %d) would make about %d request(s): %d page(s) + %d stats page(s)\n", canonicalURL, scope, depth, est.Requests(), est.Pages, est.StatsPages)
+	fmt.Printf("Pages by depth: %s\n", strings.Join(byDepth, " "))
+	if est.Unexplored > 0 {
+		fmt.Printf("%d node(s) in range were never fetched; the refresh may find more pages below them.\n", est.Unexplored)
+	}
+	fmt.Println("Estimated from cached state; nothing was fetched.")
+}
+
 func resolveDiscoverRootURL(rootURLFlag string, st state.State) (string, error) {
 	if rootURLFlag != "" {
 		return state.CanonicalizeURL(rootURLFlag)
@@ -410,6 +570,26 @@ func resolveDiscoverRootURL(rootURLFlag string, st state.State) (string, error)
 	return "", fmt.Errorf("missing --root-url and no linked project found; run `themis project link --root-url <url>`")
 }
 
+// resolveStalePolicy layers the user profile and the linked project, if any,
+// over the built-in staleness TTLs.
+func resolveStalePolicy() (state.StalePolicy, error) {
+	profilePath, err := projectlink.DefaultProfilePath()
+	if err != nil {
+		return state.StalePolicy{}, err
+	}
+	profile, err := projectlink.LoadProfile(profilePath)
+	if err != nil {
+		return state.StalePolicy{}, err
+	}
+	var project *projectlink.Config
+	if cfg, _, err := projectlink.ResolveByCWD("."); err == nil {
+		project = &cfg
+	} else if !errors.Is(err, projectlink.ErrNotLinked) {
+		return state.StalePolicy{}, err
+	}
+	return projectlink.ResolveStalePolicy(profile, project), nil
+}
+
 func upsertRootRef(st *state.State, rootID string, canonicalRootURL string) bool {
 	now := time.Now().UTC()
 	for i := range st.Roots {
@@ -437,7 +617,7 @@ func upsertRootRef(st *state.State, rootID string, canonicalRootURL string) bool
 	return true
 }
 
-func collectAssignmentsFromState(st state.State, rootID string, maxDepth int) []discovery.AssignmentEntry {
+func collectAssignmentsFromState(st state.State, rootID string, maxDepth int, now time.Time) []discovery.AssignmentEntry {
 	if maxDepth < 0 {
 		maxDepth = 0
 	}
@@ -465,12 +645,20 @@ func collectAssignmentsFromState(st state.State, rootID string, maxDepth int) []
 			if name == "" {
 				name = child.CanonicalURL
 			}
-			entries = append(entries, discovery.AssignmentEntry{
+			entry := discovery.AssignmentEntry{
 				Name:      name,
 				URL:       child.CanonicalURL,
 				Depth:     depth + 1,
 				ParentURL: node.CanonicalURL,
-			})
+				Kind:      child.Kind,
+				Status:    string(child.Status),
+				Stale:     child.Status == state.StatusStale,
+			}
+			if age, ok := state.NodeAge(child, now); ok {
+				seconds := int64(age / time.Second)
+				entry.AgeSeconds = &seconds
+			}
+			entries = append(entries, entry)
 
 			if !visited[childID] {
 				visited[childID] = true
@@ -506,7 +694,8 @@ func runProjectLink(args []string) {
 	lastOpenNodeID := fs.String("last-open-node-id", "", "Optional last opened node id")
 	defaultRefreshDepth := fs.Int("default-refresh-depth", 1, "Default refresh depth for linked project")
 	autoRefreshOnOpen := fs.Bool("auto-refresh-on-open", false, "Auto refresh when opening TUI in this project")
-	showStaleWarning := fs.Int("show-stale-warning-after-minutes", 120, "Minutes before stale warning appears")
+	showStaleWarning := fs.Int("show-stale-warning-after-minutes", 0, "Minutes before stale warning appears (0 inherits the profile default, else 120)")
+	staleTTLs := fs.String("stale-ttl", "", "Per-kind stale TTLs overriding the default, e.g. course=24h,assignment=30m (kinds: "+strings.Join(state.NodeKinds, ", ")+")")
 	if err := fs.Parse(args); err != nil {
 		fail(err, jsonRequested, "")
 	}
@@ -517,8 +706,12 @@ func runProjectLink(args []string) {
 	if *defaultRefreshDepth < 1 {
 		fail(fmt.Errorf("--default-refresh-depth must be >= 1"), common.jsonOutput, "")
 	}
-	if *showStaleWarning < 1 {
-		fail(fmt.Errorf("--show-stale-warning-after-minutes must be >= 1"), common.jsonOutput, "")
+	if *showStaleWarning < 0 {
+		fail(fmt.Errorf("--show-stale-warning-after-minutes must be >= 0"), common.jsonOutput, "")
+	}
+	staleByKind, err := projectlink.ParseStaleTTLs(*staleTTLs)
+	if err != nil {
+		fail(fmt.Errorf("--stale-ttl: %w", err), common.jsonOutput, "")
 	}
 
 	repoRoot, err := findRepoRoot(".")
@@ -541,6 +734,7 @@ func runProjectLink(args []string) {
 			DefaultRefreshDepth:          *defaultRefreshDepth,
 			AutoRefreshOnOpen:            *autoRefreshOnOpen,
 			ShowStaleWarningAfterMinutes: *showStaleWarning,
+			StaleAfterMinutesByKind:      staleByKind,
 		},
 	}
 
@@ -566,23 +760,119 @@ func runProjectLink(args []string) {
 	fmt.Printf("Saved project config at %s\n", cfgPath)
 }
 
+func runCookie(args []string) {
+	if len(args) == 0 {
+		fail(fmt.Errorf("missing cookie subcommand"), wantsJSON(args), "")
+	}
+
+	switch args[0] {
+	case "encrypt":
+		runCookieEncrypt(args[1:])
+	case "keygen":
+		runCookieKeygen(args[1:])
+	default:
+		fail(fmt.Errorf("unknown cookie subcommand: %s", args[0]), wantsJSON(args[1:]), "")
+	}
+}
+
+func runCookieEncrypt(args []string) {
+	jsonRequested := wantsJSON(args)
+	fs := newFlagSet("cookie encrypt")
+	common := addCommonFlags(fs)
+	inPath := fs.String("in", "", "Plaintext cookie file to encrypt (default: --cookie-file or default cookie path)")
+	outPath := fs.String("out", "", "Destination for the encrypted cookie file (default: overwrite --in)")
+	if err := fs.Parse(args); err != nil {
+		fail(err, jsonRequested, "")
+	}
+
+	source := strings.TrimSpace(*inPath)
+	if source == "" {
+		source = strings.TrimSpace(common.cookieFile)
+	}
+	if source == "" {
+		source = common.defaultCookiePath
+	}
+	target := strings.TrimSpace(*outPath)
+	if target == "" {
+		target = source
+	}
+
+	if err := themis.EncryptCookieFile(source, target, common.cookieEncryption()); err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+
+	method := "passphrase"
+	if strings.TrimSpace(common.cookieKeyFile) != "" {
+		method = "key-file"
+	}
+	if common.jsonOutput {
+		writeJSON(map[string]any{
+			"status": "ok",
+			"in":     source,
+			"out":    target,
+			"method": method,
+		})
+		return
+	}
+
+	fmt.Printf("Encrypted cookie file %s -> %s (%s)\n", source, target, method)
+}
+
+func runCookieKeygen(args []string) {
+	jsonRequested := wantsJSON(args)
+	fs := newFlagSet("cookie keygen")
+	common := addCommonFlags(fs)
+	outPath := fs.String("out", "", "Path for the new key file (default: --cookie-key-file)")
+	if err := fs.Parse(args); err != nil {
+		fail(err, jsonRequested, "")
+	}
+
+	target := strings.TrimSpace(*outPath)
+	if target == "" {
+		target = strings.TrimSpace(common.cookieKeyFile)
+	}
+	if target == "" {
+		fail(fmt.Errorf("missing required --out (or --cookie-key-file)"), common.jsonOutput, "")
+	}
+
+	if err := themis.GenerateCookieKeyFile(target); err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+
+	if common.jsonOutput {
+		writeJSON(map[string]any{
+			"status":   "ok",
+			"key_file": target,
+		})
+		return
+	}
+
+	fmt.Printf("Wrote cookie key file %s\n", target)
+}
+
 func runTUI(args []string) {
 	jsonRequested := wantsJSON(args)
 	fs := newFlagSet("tui")
 	common := addCommonFlags(fs)
 	rootURL := fs.String("root-url", "", "Optional root URL to focus in TUI")
+	downloadConcurrency := fs.Int("download-concurrency", defaultIntFromEnv("THEMIS_DOWNLOAD_CONCURRENCY", tuiapp.DefaultDownloadConcurrency), "Files downloaded in parallel from the TUI")
+	opener := fs.String("opener", defaultFromEnv("THEMIS_OPENER", tuiapp.DefaultOpenerCommand()), "Command that opens URLs from the TUI (the URL is appended)")
+	keyProfile := fs.String("key-profile", defaultFromEnv("THEMIS_KEY_PROFILE", ""), "Key profile: default, vim or arrows (default: keys.profile in the user profile)")
 	if err := fs.Parse(args); err != nil {
 		fail(err, jsonRequested, "")
 	}
 	if jsonRequested {
 		fail(fmt.Errorf("--json is not supported for interactive tui"), false, "")
 	}
+	if *downloadConcurrency < 1 {
+		fail(fmt.Errorf("--download-concurrency must be >= 1"), false, "")
+	}
 
-	statePath, err := state.DefaultStatePath()
+	store, err := common.openStore()
 	if err != nil {
 		fail(err, false, "")
 	}
-	st, err := state.Load(statePath)
+	st, err := store.Load()
 	if err != nil {
 		fail(err, false, "")
 	}
@@ -596,11 +886,23 @@ func runTUI(args []string) {
 		rootNodeID = id
 	}
 
+	stalePolicy, err := resolveStalePolicy()
+	if err != nil {
+		fail(err, false, "")
+	}
+	keyMap, err := resolveKeyMap(*keyProfile)
+	if err != nil {
+		fail(err, false, "")
+	}
+
 	linkedRootNodeID := ""
+	autoRefreshOnOpen := false
 	subtreeRefreshDepth := 1
 	downloadDir := "."
 	recentChoices := map[string][]string{}
 	var persistChoices tuiapp.PersistChoicesFunc
+	var session *tuiapp.Session
+	var saveSession tuiapp.SaveSessionFunc
 	if cfg, cfgPath, err := projectlink.ResolveByCWD("."); err == nil {
 		projectRootID := strings.TrimSpace(cfg.LinkedRootNodeID)
 		if projectRootID == "" {
@@ -610,6 +912,7 @@ func runTUI(args []string) {
 			rootNodeID = projectRootID
 		}
 		linkedRootNodeID = projectRootID
+		autoRefreshOnOpen = cfg.Preferences.AutoRefreshOnOpen
 		if cfg.Preferences.DefaultRefreshDepth > 0 {
 			subtreeRefreshDepth = cfg.Preferences.DefaultRefreshDepth
 		}
@@ -619,6 +922,23 @@ func runTUI(args []string) {
 		for nodeID, urls := range cfg.RecentAssetChoices {
 			recentChoices[nodeID] = append([]string(nil), urls...)
 		}
+		session = &tuiapp.Session{SelectedNodeID: strings.TrimSpace(cfg.LastOpenNodeID)}
+		if cfg.TUISession != nil {
+			session.ExpandedNodeIDs = append([]string(nil), cfg.TUISession.ExpandedNodeIDs...)
+			session.ScrollOffset = cfg.TUISession.ScrollOffset
+		}
+		saveSession = func(s tuiapp.Session) error {
+			latest, err := projectlink.Load(cfgPath)
+			if err != nil {
+				return err
+			}
+			latest.LastOpenNodeID = s.SelectedNodeID
+			latest.TUISession = &projectlink.TUISession{
+				ExpandedNodeIDs: s.ExpandedNodeIDs,
+				ScrollOffset:    s.ScrollOffset,
+			}
+			return projectlink.Save(cfgPath, latest)
+		}
 		persistChoices = func(nodeID string, assetURLs []string, targetDir string) error {
 			latest, err := projectlink.Load(cfgPath)
 			if err != nil {
@@ -633,46 +953,64 @@ func runTUI(args []string) {
 		}
 	}
 
-	refreshExec := func(current state.State, req tuiapp.RefreshRequest) tuiapp.RefreshOutcome {
+	// One session serves every refresh and download of this TUI run; it is
+	// validated on first use and again only after an authentication failure.
+	sessions := themis.NewSessionProvider(func() (*themis.Session, error) {
+		baseURL, err := themis.NormalizeBaseURL(common.baseURL)
+		if err != nil {
+			return nil, err
+		}
+		return newSession(*common, baseURL)
+	})
+
+	refreshExec := func(ctx context.Context, current state.State, req tuiapp.RefreshRequest) (out tuiapp.RefreshOutcome) {
 		start := time.Now()
-		out := tuiapp.RefreshOutcome{
+		ctx, cancel := common.commandContextFrom(ctx)
+		defer cancel()
+		out = tuiapp.RefreshOutcome{
 			State:        current,
 			Scope:        req.Scope,
 			TargetNodeID: req.TargetNodeID,
 		}
 
-		baseURL, err := themis.NormalizeBaseURL(common.baseURL)
-		if err != nil {
-			out.Err = err
-			return out
-		}
-		session, err := themis.NewSessionWithAuthConfig(baseURL, themis.AuthConfig{
-			CookieFile:        common.cookieFile,
-			CookieEnv:         common.cookieEnv,
-			DefaultCookiePath: common.defaultCookiePath,
-		})
-		if err != nil {
-			out.Err = err
-			return out
-		}
-		if _, err := session.ValidateAuthentication(); err != nil {
-			out.Err = err
-			return out
-		}
+		defer func() {
+			if err := sessions.PersistCookies(); err != nil {
+				out.Warnings = append(out.Warnings, fmt.Sprintf("persist cookies: %v", err))
+			}
+		}()
 
-		service := discovery.NewService(session.BaseURL)
 		var result discovery.RefreshResult
-		switch req.Scope {
-		case tuiapp.RefreshScopeNode:
-			result, err = service.RefreshNode(session.Client, &current, req.TargetURL, 0)
-		case tuiapp.RefreshScopeSubtree:
-			result, err = service.RefreshNode(session.Client, &current, req.TargetURL, req.Depth)
-		case tuiapp.RefreshScopeFull:
-			result, err = service.RefreshCatalog(session.Client, &current, req.Depth)
-		default:
-			err = fmt.Errorf("unsupported refresh scope: %s", req.Scope)
-		}
-		if err != nil {
+		err := sessions.Do(ctx, func(session *themis.Session) error {
+			service := discovery.NewService(session.BaseURL)
+			if !req.Background {
+				service.Store = store
+			}
+			if req.Progress != nil {
+				service.Progress = func(event discovery.ProgressEvent) {
+					req.Progress(tuiapp.RefreshProgress{
+						URL:     event.URL,
+						Fetched: event.Fetched,
+						Queued:  event.Queued,
+						Errors:  event.Errors,
+						Err:     event.Err,
+						Nodes:   event.Nodes,
+					})
+				}
+			}
+			var err error
+			switch req.Scope {
+			case tuiapp.RefreshScopeNode:
+				result, err = service.RefreshNodeContext(ctx, session.Client, &current, req.TargetURL, 0)
+			case tuiapp.RefreshScopeSubtree:
+				result, err = service.RefreshNodeContext(ctx, session.Client, &current, req.TargetURL, req.Depth)
+			case tuiapp.RefreshScopeFull:
+				result, err = service.RefreshCatalogContext(ctx, session.Client, &current, req.Depth)
+			default:
+				err = fmt.Errorf("unsupported refresh scope: %s", req.Scope)
+			}
+			return err
+		})
+		if err != nil && ctx.Err() == nil {
 			out.Err = err
 			out.DurationMs = time.Since(start).Milliseconds()
 			return out
@@ -680,45 +1018,39 @@ func runTUI(args []string) {
 		if len(result.Errors) > 0 {
 			out.Warnings = append(out.Warnings, result.Errors...)
 		}
-
-		if err := state.SaveAtomic(statePath, current, true); err != nil {
-			out.Err = err
-			out.DurationMs = time.Since(start).Milliseconds()
-			return out
-		}
+		// Apart from background steps, which the TUI saves together, the
+		// service has already stored the nodes it touched; an interrupted
+		// refresh still keeps the pages it finished.
 		out.State = current
 		out.UpdatedNodes = result.UpdatedNodes
 		out.DurationMs = time.Since(start).Milliseconds()
+		out.Err = err
 		return out
 	}
 
-	downloadExec := func(current state.State, req tuiapp.DownloadRequest) tuiapp.DownloadOutcome {
+	// Background revalidation steps are saved together, merged rather than
+	// saved so changes made meanwhile survive.
+	saveRevalidated := func(refreshed state.State) error {
+		return store.Update(func(cur *state.State) (bool, error) {
+			return state.MergeRefreshed(cur, refreshed) > 0, nil
+		})
+	}
+
+	downloadExec := func(ctx context.Context, current state.State, req tuiapp.DownloadRequest) tuiapp.DownloadOutcome {
 		start := time.Now()
+		ctx, cancel := common.commandContextFrom(ctx)
+		defer cancel()
 		out := tuiapp.DownloadOutcome{
 			NodeID:    req.NodeID,
 			TargetDir: req.TargetDir,
 		}
 
-		baseURL, err := themis.NormalizeBaseURL(common.baseURL)
-		if err != nil {
-			out.Err = err
-			return out
-		}
-		session, err := themis.NewSessionWithAuthConfig(baseURL, themis.AuthConfig{
-			CookieFile:        common.cookieFile,
-			CookieEnv:         common.cookieEnv,
-			DefaultCookiePath: common.defaultCookiePath,
+		var items []discovery.DownloadedAsset
+		err := sessions.Do(ctx, func(session *themis.Session) error {
+			var err error
+			items, err = discovery.DownloadAssetRefsContext(ctx, session.Client, req.Assets, req.TargetDir)
+			return err
 		})
-		if err != nil {
-			out.Err = err
-			return out
-		}
-		if _, err := session.ValidateAuthentication(); err != nil {
-			out.Err = err
-			return out
-		}
-
-		items, err := discovery.DownloadAssetRefs(session.Client, req.Assets, req.TargetDir)
 		out.DurationMs = time.Since(start).Milliseconds()
 		if err != nil {
 			out.Err = err
@@ -737,19 +1069,53 @@ func runTUI(args []string) {
 		return out
 	}
 
-	if err := tuiapp.Run(tuiapp.Config{
+	runErr := tuiapp.Run(tuiapp.Config{
 		State:               st,
 		RootNodeID:          rootNodeID,
 		LinkedRootNodeID:    linkedRootNodeID,
 		SubtreeRefreshDepth: subtreeRefreshDepth,
+		StalePolicy:         stalePolicy,
+		AutoRefreshOnOpen:   autoRefreshOnOpen,
+		DownloadConcurrency: *downloadConcurrency,
+		Opener:              tuiapp.CommandOpener(*opener),
 		RefreshExecutor:     refreshExec,
 		DownloadExecutor:    downloadExec,
 		DefaultDownloadDir:  downloadDir,
 		RecentAssetChoices:  recentChoices,
 		PersistChoices:      persistChoices,
-	}); err != nil {
-		fail(err, false, "")
+		SaveRevalidated:     saveRevalidated,
+		Session:             session,
+		SaveSession:         saveSession,
+		KeyMap:              &keyMap,
+	})
+	if err := sessions.PersistCookies(); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: persist cookies:", err)
+	}
+	if runErr != nil {
+		fail(runErr, false, "")
+	}
+}
+
+// resolveKeyMap builds the TUI key map from the user profile's keys section;
+// a non-empty profileFlag replaces its profile.
+func resolveKeyMap(profileFlag string) (tuiapp.KeyMap, error) {
+	profilePath, err := projectlink.DefaultProfilePath()
+	if err != nil {
+		return tuiapp.KeyMap{}, err
+	}
+	profile, err := projectlink.LoadProfile(profilePath)
+	if err != nil {
+		return tuiapp.KeyMap{}, err
+	}
+	opts := tuiapp.KeyMapOptions{Profile: profile.Keys.Profile, Bindings: profile.Keys.Bindings}
+	if strings.TrimSpace(profileFlag) != "" {
+		opts.Profile = profileFlag
+	}
+	keyMap, err := tuiapp.NewKeyMap(opts)
+	if err != nil {
+		return tuiapp.KeyMap{}, fmt.Errorf("profile %s: %w", profilePath, err)
 	}
+	return keyMap, nil
 }
 
 func findRepoRoot(start string) (string, error) {
@@ -786,12 +1152,146 @@ func addCommonFlags(fs *flag.FlagSet) *commonFlags {
 	fs.StringVar(&common.baseURL, "base-url", defaultBase, "Themis base URL")
 	fs.StringVar(&common.cookieFile, "cookie-file", defaultCookieFile, "Path to cookie file")
 	fs.StringVar(&common.cookieEnv, "cookie-env", defaultCookieEnv, "Name of env var containing cookie string")
+	fs.StringVar(&common.cookieKeyFile, "cookie-key-file", defaultFromEnv("THEMIS_COOKIE_KEY_FILE", ""), "Key file for encrypted cookie files")
+	fs.StringVar(&common.recordDir, "record", defaultFromEnv("THEMIS_RECORD", ""), "Record HTTP exchanges (cookies redacted) into this cassette directory")
+	fs.StringVar(&common.replayDir, "replay", defaultFromEnv("THEMIS_REPLAY", ""), "Serve HTTP responses from this cassette directory instead of the network")
+	fs.BoolVar(&common.persistCookies, "persist-cookies", defaultBoolFromEnv("THEMIS_PERSIST_COOKIES", false), "Write cookies rotated by Themis back to the cookie file")
+	fs.DurationVar(&common.timeout, "timeout", defaultDurationFromEnv("THEMIS_TIMEOUT", themis.DefaultRequestTimeout), "Timeout for each HTTP request (0 disables)")
+	fs.DurationVar(&common.deadline, "deadline", defaultDurationFromEnv("THEMIS_DEADLINE", 0), "Overall deadline for the command; in the TUI, for each refresh/download (0 disables)")
+	fs.StringVar(&common.proxyURL, "proxy", defaultFromEnv("THEMIS_PROXY", ""), "Proxy URL (default: HTTPS_PROXY/HTTP_PROXY)")
+	fs.StringVar(&common.caBundle, "ca-bundle", defaultFromEnv("THEMIS_CA_BUNDLE", ""), "PEM file with extra trusted CA certificates")
+	fs.StringVar(&common.userAgent, "user-agent", defaultFromEnv("THEMIS_USER_AGENT", ""), "User-Agent header (default: themis-cli/<version>)")
 	common.defaultCookiePath = defaultCookiePath
+	fs.BoolVar(&common.strictState, "strict-state", defaultBoolFromEnv("THEMIS_STRICT_STATE", false), "Refuse to use a state file that fails integrity checks")
+	fs.StringVar(&common.stateBackend, "state-backend", defaultFromEnv("THEMIS_STATE_BACKEND", state.BackendJSON), "State storage backend: json or log (append-only, incremental writes)")
+	fs.IntVar(&common.backupKeep, "state-backups", defaultCountFromEnv("THEMIS_STATE_BACKUPS", state.DefaultBackupPolicy().Keep), "Timestamped state backups to keep (0 disables)")
+	fs.DurationVar(&common.backupMaxAge, "state-backup-max-age", defaultDurationFromEnv("THEMIS_STATE_BACKUP_MAX_AGE", 0), "Prune state backups older than this (0 keeps them)")
+	fs.StringVar(&common.statePath, "state-path", defaultFromEnv("THEMIS_STATE_PATH", ""), "State file (default: ~/.config/themis/state.json, or state.db for the log backend)")
 	fs.BoolVar(&common.jsonOutput, "json", false, "Output JSON")
 
 	return common
 }
 
+// openStore opens the state store selected by --state-backend and --state-path.
+func (c commonFlags) openStore() (state.Store, error) {
+	backups, err := c.backupPolicy()
+	if err != nil {
+		return nil, err
+	}
+	return state.OpenStore(c.stateBackend, c.statePath, state.StoreOptions{Strict: c.strictState, Backups: &backups})
+}
+
+// backupPolicy is the state backup retention selected by --state-backups and
+// --state-backup-max-age.
+func (c commonFlags) backupPolicy() (state.BackupPolicy, error) {
+	if c.backupKeep < 0 {
+		return state.BackupPolicy{}, fmt.Errorf("--state-backups must be >= 0")
+	}
+	if c.backupMaxAge < 0 {
+		return state.BackupPolicy{}, fmt.Errorf("--state-backup-max-age must be >= 0")
+	}
+	policy := state.DefaultBackupPolicy()
+	policy.Keep = c.backupKeep
+	policy.MaxAge = c.backupMaxAge
+	return policy, nil
+}
+
+func (c commonFlags) authConfig() themis.AuthConfig {
+	return themis.AuthConfig{
+		CookieFile:        c.cookieFile,
+		CookieEnv:         c.cookieEnv,
+		DefaultCookiePath: c.defaultCookiePath,
+		Encryption:        c.cookieEncryption(),
+		PersistCookies:    c.persistCookies,
+	}
+}
+
+func (c commonFlags) clientConfig() themis.ClientConfig {
+	return themis.ClientConfig{
+		Timeout:   c.timeout,
+		ProxyURL:  c.proxyURL,
+		CABundle:  c.caBundle,
+		UserAgent: c.userAgent,
+	}
+}
+
+// commandContext derives a context from rootCtx that honours --deadline.
+func (c commonFlags) commandContext() (context.Context, context.CancelFunc) {
+	return c.commandContextFrom(rootCtx)
+}
+
+// commandContextFrom is commandContext for work that parent can also cancel.
+func (c commonFlags) commandContextFrom(parent context.Context) (context.Context, context.CancelFunc) {
+	if c.deadline > 0 {
+		return context.WithTimeout(parent, c.deadline)
+	}
+	return context.WithCancel(parent)
+}
+
+// newSession opens a session for a command, honouring --replay and --record.
+// The command owns it and must finish with closeSession (or failSession) so
+// rotated cookies are written back.
+func newSession(common commonFlags, baseURL string) (*themis.Session, error) {
+	replayDir := strings.TrimSpace(common.replayDir)
+	recordDir := strings.TrimSpace(common.recordDir)
+	if replayDir != "" && recordDir != "" {
+		return nil, fmt.Errorf("--record and --replay cannot be combined")
+	}
+	if replayDir != "" {
+		return themis.NewReplaySession(baseURL, replayDir)
+	}
+
+	session, err := themis.NewSessionWithConfig(baseURL, common.authConfig(), common.clientConfig())
+	if err != nil {
+		return nil, err
+	}
+	if recordDir != "" {
+		if err := session.RecordTo(recordDir); err != nil {
+			return nil, err
+		}
+	}
+	return session, nil
+}
+
+// closeSession writes cookies rotated during the command back to the cookie
+// file. A write-back failure is returned alongside err.
+func closeSession(session *themis.Session, err error) error {
+	if persistErr := session.PersistCookies(); persistErr != nil {
+		return errors.Join(err, fmt.Errorf("persist cookies: %w", persistErr))
+	}
+	return err
+}
+
+// failSession is fail for errors raised while session is open.
+func failSession(session *themis.Session, err error, asJSON bool) {
+	fail(closeSession(session, err), asJSON, session.BaseURL)
+}
+
+func (c commonFlags) cookieEncryption() themis.CookieEncryption {
+	return themis.CookieEncryption{
+		KeyFile:    strings.TrimSpace(c.cookieKeyFile),
+		Passphrase: promptCookiePassphrase,
+	}
+}
+
+// promptCookiePassphrase reads THEMIS_COOKIE_PASSPHRASE, falling back to an
+// interactive prompt on the controlling terminal.
+func promptCookiePassphrase(prompt string) (string, error) {
+	if passphrase := os.Getenv("THEMIS_COOKIE_PASSPHRASE"); passphrase != "" {
+		return passphrase, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("no terminal available; set THEMIS_COOKIE_PASSPHRASE")
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	raw, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
 func newFlagSet(name string) *flag.FlagSet {
 	fs := flag.NewFlagSet(name, flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
@@ -804,23 +1304,49 @@ func printUsage() {
 	fmt.Println()
 	fmt.Println("Subcommands:")
 	fmt.Println("  check  Validate authentication and base URL access")
+	fmt.Println("  doctor Diagnose cookie, base URL, state, lock and project link problems")
 	fmt.Println("  list   List available test case indices")
 	fmt.Println("  fetch  Download available test cases")
 	fmt.Println("  project Manage repository link metadata")
+	fmt.Println("  state  Maintain the local state cache (migrate, fsck, gc, convert, export, import, diff, backups, restore)")
+	fmt.Println("  cookie Encrypt cookie files at rest")
+	fmt.Println("  query  Filter the cached hierarchy offline (kind, status, title, depth, due, result, ...)")
+	fmt.Println("  show   Print a page's assignment body as Markdown")
 	fmt.Println("  tui    Browse cached hierarchy and trigger targeted refresh actions")
 	fmt.Println()
 	fmt.Println("Common flags (all subcommands):")
 	fmt.Println("  --base-url <url>")
 	fmt.Println("  --cookie-file <path>")
 	fmt.Println("  --cookie-env <env-var-name>")
+	fmt.Println("  --cookie-key-file <path>")
+	fmt.Println("  --persist-cookies")
+	fmt.Println("  --record <dir> | --replay <dir>")
+	fmt.Println("  --timeout <duration> --deadline <duration>")
+	fmt.Println("  --proxy <url> --ca-bundle <path> --user-agent <string>")
+	fmt.Println("  --strict-state")
+	fmt.Println("  --state-backend json|log --state-path <path>")
+	fmt.Println("  --state-backups <n> --state-backup-max-age <duration>")
 	fmt.Println("  --json")
 	fmt.Println()
 	fmt.Println("Subcommand flags:")
 	fmt.Println("  list  --tests-url <url> [--start <n>] [--max <n>] [--max-misses <n>]")
-	fmt.Println("  list  --discover [--root-url <url>] [--discover-depth <n>] [--refresh-url <url>] [--refresh-depth <n>] [--full-refresh] [--from-state-only]")
+	fmt.Println("  list  --discover [--root-url <url>] [--discover-depth <n>] [--refresh-url <url>] [--refresh-depth <n>] [--full-refresh] [--from-state-only] [--dry-run]")
 	fmt.Println("  fetch --tests-url <url> [--out <dir>]")
 	fmt.Println("  project link --root-url <url> [--default-refresh-depth <n>]")
-	fmt.Println("  tui [--root-url <url>]")
+	fmt.Println("  state migrate [--dry-run]")
+	fmt.Println("  state fsck [--repair]")
+	fmt.Println("  state gc [--dry-run] [--grace <duration>] [--tombstone-max-age <duration>]")
+	fmt.Println("  state convert --to json|log [--out <path>] [--force]")
+	fmt.Println("  state export [--root-url <url>] [--out <path>] [--strip-personal=false]")
+	fmt.Println("  state import [--dry-run] <path>|-")
+	fmt.Println("  state diff [--from <path>] [--to <path>] [--exit-code]")
+	fmt.Println("  state backups list")
+	fmt.Println("  state restore <backup-id|timestamp>")
+	fmt.Println("  cookie encrypt [--in <path>] [--out <path>]")
+	fmt.Println("  cookie keygen [--out <path>]")
+	fmt.Println("  query [--root-url <url>] [--fields <a,b,...>] [--format table|json|ndjson] [--limit <n>] [<expression>]")
+	fmt.Println("  show [--markdown] [--refresh] <url>")
+	fmt.Println("  tui [--root-url <url>] [--key-profile default|vim|arrows]")
 }
 
 func fail(err error, asJSON bool, baseURL string) {
@@ -861,6 +1387,60 @@ func defaultFromEnv(key string, fallback string) string {
 	return value
 }
 
+func defaultBoolFromEnv(key string, fallback bool) bool {
+	value := strings.TrimSpace(os.Getenv(key))
+	switch strings.ToLower(value) {
+	case "":
+		return fallback
+	case "1", "true", "yes", "on":
+		return true
+	case "0", "false", "no", "off":
+		return false
+	default:
+		failEnv(key, value, "true or false")
+		return fallback
+	}
+}
+
+func defaultDurationFromEnv(key string, fallback time.Duration) time.Duration {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		failEnv(key, value, "a duration such as 30s or 2m")
+	}
+	return d
+}
+
+func defaultIntFromEnv(key string, fallback int) int {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		failEnv(key, value, "an integer")
+	}
+	return n
+}
+
+// defaultCountFromEnv is defaultIntFromEnv for counts, which cannot be negative.
+func defaultCountFromEnv(key string, fallback int) int {
+	n := defaultIntFromEnv(key, fallback)
+	if n < 0 {
+		failEnv(key, strings.TrimSpace(os.Getenv(key)), "an integer >= 0")
+	}
+	return n
+}
+
+// failEnv rejects a malformed environment default the way fs.Parse rejects a
+// malformed flag.
+func failEnv(key string, value string, want string) {
+	fail(fmt.Errorf("invalid value %q for %s: want %s", value, key, want), wantsJSON(os.Args[1:]), "")
+}
+
 func mustUserHomeDir() string {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"themis-cli/internal/query"
+	"themis-cli/internal/state"
+)
+
+func runQuery(args []string) {
+	jsonRequested := wantsJSON(args)
+	fs := newFlagSet("query")
+	common := addCommonFlags(fs)
+	rootURL := fs.String("root-url", "", "Start at this URL instead of the tracked roots (depth is measured from here)")
+	fieldsSpec := fs.String("fields", "", "Comma-separated fields to print (default: "+strings.Join(query.DefaultFields, ",")+")")
+	format := fs.String("format", "table", "Output format: table, json or ndjson")
+	limit := fs.Int("limit", 0, "Stop after this many results (0 = no limit)")
+	if err := fs.Parse(args); err != nil {
+		fail(err, jsonRequested, "")
+	}
+	if common.jsonOutput {
+		*format = "json"
+	}
+	switch *format {
+	case "table", "json", "ndjson":
+	default:
+		fail(fmt.Errorf("unknown --format %q (want table, json or ndjson)", *format), common.jsonOutput, "")
+	}
+
+	fields, err := query.ParseFields(*fieldsSpec)
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+	store, err := common.openStore()
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+	st, err := store.Load()
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+	policy, err := resolveStalePolicy()
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+	opts := query.Options{Expr: strings.Join(fs.Args(), " "), StalePolicy: &policy}
+	if strings.TrimSpace(*rootURL) != "" {
+		id, _, err := state.NodeIDFromURL(strings.TrimSpace(*rootURL))
+		if err != nil {
+			fail(err, common.jsonOutput, "")
+		}
+		opts.RootID = id
+	}
+	rows, err := query.Run(st, opts)
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+	if *limit > 0 && len(rows) > *limit {
+		rows = rows[:*limit]
+	}
+
+	switch *format {
+	case "json":
+		results := make([]map[string]any, 0, len(rows))
+		for _, row := range rows {
+			results = append(results, row.Project(fields))
+		}
+		writeJSON(map[string]any{
+			"status":  "ok",
+			"query":   opts.Expr,
+			"fields":  fields,
+			"count":   len(results),
+			"results": results,
+		})
+	case "ndjson":
+		encoder := json.NewEncoder(os.Stdout)
+		for _, row := range rows {
+			if err := encoder.Encode(row.Project(fields)); err != nil {
+				fail(err, false, "")
+			}
+		}
+	default:
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(fields, "\t")))
+		for _, row := range rows {
+			cells := make([]string, 0, len(fields))
+			for _, f := range fields {
+				cells = append(cells, row.Text(f))
+			}
+			fmt.Fprintln(tw, strings.Join(cells, "\t"))
+		}
+		_ = tw.Flush()
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"themis-cli/internal/discovery"
+	"themis-cli/internal/projectlink"
+	"themis-cli/internal/state"
+	"themis-cli/internal/themis"
+)
+
+// revalidateOnOpen implements the linked project's auto_refresh_on_open for
+// commands that have already printed cached results: stale nodes under the
+// linked root (up to default_refresh_depth) are refreshed afterwards and merged
+// into the store, so the next read is fresh. It runs synchronously after the
+// output, reporting progress on stderr; JSON output skips it, since nothing
+// could report it. Failures never change the exit status.
+func revalidateOnOpen(ctx context.Context, common commonFlags) {
+	if common.jsonOutput {
+		return
+	}
+	cfg, _, err := projectlink.ResolveByCWD(".")
+	if err != nil || !cfg.Preferences.AutoRefreshOnOpen {
+		return
+	}
+	refreshed, failed, err := revalidateStale(ctx, common, cfg)
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Revalidation failed: %v\n", err)
+	case refreshed+failed > 0:
+		fmt.Fprintf(os.Stderr, "Revalidated %d stale node(s), %d failed.\n", refreshed, failed)
+	}
+}
+
+func revalidateStale(ctx context.Context, common commonFlags, cfg projectlink.Config) (refreshed int, failed int, err error) {
+	store, err := common.openStore()
+	if err != nil {
+		return 0, 0, err
+	}
+	st, err := store.Load()
+	if err != nil {
+		return 0, 0, err
+	}
+	policy, err := resolveStalePolicy()
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := state.ApplyStalePolicyByKind(&st, time.Now(), policy); err != nil {
+		return 0, 0, err
+	}
+	rootID := cfg.LinkedRootNodeID
+	if rootID == "" {
+		rootID = state.NodeIDFromCanonicalURL(cfg.LinkedRootURL)
+	}
+	ids := state.StaleNodeIDs(st, rootID, cfg.Preferences.DefaultRefreshDepth)
+	if len(ids) == 0 {
+		return 0, 0, nil
+	}
+
+	baseURL, err := themis.NormalizeBaseURL(common.baseURL)
+	if err != nil {
+		return 0, 0, err
+	}
+	// The provider validates the session on first use and re-opens it once
+	// if a refresh reports that the cookies were rejected.
+	sessions := themis.NewSessionProvider(func() (*themis.Session, error) {
+		return newSession(common, baseURL)
+	})
+	defer func() {
+		if persistErr := sessions.PersistCookies(); persistErr != nil {
+			err = errors.Join(err, fmt.Errorf("persist cookies: %w", persistErr))
+		}
+	}()
+
+	service := discovery.NewService(baseURL)
+	working, err := state.CloneState(st)
+	if err != nil {
+		return 0, 0, fmt.Errorf("copy state: %w", err)
+	}
+	var authErr error
+	for i, id := range ids {
+		if ctx.Err() != nil || authErr != nil {
+			break
+		}
+		targetURL := st.Nodes[id].CanonicalURL
+		fmt.Fprintf(os.Stderr, "Revalidating %d/%d %s\n", i+1, len(ids), targetURL)
+		err := sessions.Do(ctx, func(session *themis.Session) error {
+			result, err := service.RefreshNodeContext(ctx, session.Client, &working, targetURL, 0)
+			if err == nil && len(result.Errors) > 0 {
+				err = errors.New(result.Errors[0])
+			}
+			return err
+		})
+		if err != nil {
+			if errors.Is(err, themis.ErrNotAuthenticated) {
+				authErr = err
+			}
+			failed++
+			continue
+		}
+		refreshed++
+	}
+
+	// Merge rather than save so changes made by other commands meanwhile
+	// survive; an interrupted run still keeps the nodes it finished.
+	if mergeErr := store.Update(func(cur *state.State) (bool, error) {
+		return state.MergeRefreshed(cur, working) > 0, nil
+	}); mergeErr != nil {
+		return refreshed, failed, mergeErr
+	}
+	if authErr != nil {
+		return refreshed, failed, authErr
+	}
+	return refreshed, failed, ctx.Err()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"themis-cli/internal/discovery"
+	"themis-cli/internal/state"
+)
+
+func runShow(args []string) {
+	jsonRequested := wantsJSON(args)
+	fs := newFlagSet("show")
+	common := addCommonFlags(fs)
+	markdown := fs.Bool("markdown", false, "Print a Markdown document: the title as a # heading, then the page body")
+	refresh := fs.Bool("refresh", false, "Fetch the page before showing it, even when it is cached")
+	if err := fs.Parse(args); err != nil {
+		fail(err, jsonRequested, "")
+	}
+	if fs.NArg() != 1 {
+		fail(fmt.Errorf("usage: themis show [flags] <url>"), common.jsonOutput, "")
+	}
+	nodeID, canonicalURL, err := state.NodeIDFromURL(strings.TrimSpace(fs.Arg(0)))
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+
+	store, err := common.openStore()
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+	st, err := store.Load()
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+	baseURL := common.baseURL
+	if _, ok := st.Nodes[nodeID]; !ok || *refresh {
+		ctx, cancel := common.commandContext()
+		defer cancel()
+		session, err := newSession(*common, common.baseURL)
+		if err != nil {
+			fail(err, common.jsonOutput, common.baseURL)
+		}
+		baseURL = session.BaseURL
+		if _, err := session.ValidateAuthenticationContext(ctx); err != nil {
+			failSession(session, err, common.jsonOutput)
+		}
+		// The service stores the refreshed node itself, so only that node is
+		// written back rather than the whole state.
+		service := discovery.NewService(session.BaseURL)
+		service.Store = store
+		result, err := service.RefreshNodeContext(ctx, session.Client, &st, canonicalURL, 0)
+		if err == nil && len(result.Errors) > 0 {
+			err = fmt.Errorf("refresh %s: %s", canonicalURL, strings.Join(result.Errors, "; "))
+		}
+		if err := closeSession(session, err); err != nil {
+			fail(err, common.jsonOutput, session.BaseURL)
+		}
+	}
+	node, ok := st.Nodes[nodeID]
+	if !ok {
+		fail(fmt.Errorf("node not found in state: %s", canonicalURL), common.jsonOutput, baseURL)
+	}
+
+	body, _ := node.Details["body_markdown"].(string)
+	if body == "" {
+		body, _ = node.Details["description"].(string)
+		if !common.jsonOutput {
+			fmt.Fprintln(os.Stderr, "Note: no page body stored for this node; rerun with --refresh to fetch it")
+		}
+	}
+
+	if common.jsonOutput {
+		writeJSON(map[string]any{
+			"status":      "ok",
+			"url":         node.CanonicalURL,
+			"node_id":     node.ID,
+			"title":       node.Title,
+			"kind":        node.Kind,
+			"node_status": node.Status,
+			"markdown":    body,
+		})
+		return
+	}
+	if *markdown {
+		fmt.Printf("# %s\n", node.Title)
+		if body != "" {
+			fmt.Printf("\n%s\n", body)
+		}
+		return
+	}
+	fmt.Printf("%s (%s)\n", node.Title, node.Kind)
+	fmt.Printf("URL: %s\n", node.CanonicalURL)
+	fmt.Printf("Status: %s\n", node.Status)
+	if node.LastSuccessAt != nil {
+		fmt.Printf("Fetched: %s\n", node.LastSuccessAt.Local().Format("2006-01-02 15:04"))
+	}
+	if body != "" {
+		fmt.Printf("\n%s\n", body)
+	}
+}
@@ -0,0 +1,639 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"themis-cli/internal/projectlink"
+	"themis-cli/internal/state"
+)
+
+func runState(args []string) {
+	if len(args) == 0 {
+		fail(fmt.Errorf("missing state subcommand"), wantsJSON(args), "")
+	}
+
+	switch args[0] {
+	case "migrate":
+		runStateMigrate(args[1:])
+	case "fsck":
+		runStateFsck(args[1:])
+	case "gc":
+		runStateGC(args[1:])
+	case "convert":
+		runStateConvert(args[1:])
+	case "export":
+		runStateExport(args[1:])
+	case "import":
+		runStateImport(args[1:])
+	case "diff":
+		runStateDiff(args[1:])
+	case "backups":
+		runStateBackups(args[1:])
+	case "restore":
+		runStateRestore(args[1:])
+	default:
+		fail(fmt.Errorf("unknown state subcommand: %s", args[0]), wantsJSON(args[1:]), "")
+	}
+}
+
+type migrationFileResult struct {
+	Kind    string                   `json:"kind"`
+	Path    string                   `json:"path"`
+	From    int                      `json:"from"`
+	To      int                      `json:"to"`
+	Steps   []string                 `json:"steps"`
+	Applied []state.AppliedMigration `json:"applied,omitempty"`
+}
+
+func runStateMigrate(args []string) {
+	jsonRequested := wantsJSON(args)
+	fs := newFlagSet("state migrate")
+	common := addCommonFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "Show pending migrations without writing")
+	if err := fs.Parse(args); err != nil {
+		fail(err, jsonRequested, "")
+	}
+
+	store, err := openMaintenanceStore(*common)
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+	results := make([]migrationFileResult, 0, 2)
+
+	// The log backend always writes the current schema; only JSON files carry
+	// an on-disk version that can lag behind.
+	if jsonStore, ok := store.(*state.JSONStore); ok {
+		statePath := jsonStore.Location()
+		plan, err := state.PlanStateMigrations(statePath)
+		if err != nil {
+			fail(fmt.Errorf("%s: %w", statePath, err), common.jsonOutput, "")
+		}
+		stateResult := migrationFileResult{Kind: "state", Path: statePath, From: plan.From, To: plan.To, Steps: plan.Names()}
+		if plan.Pending() && !*dryRun {
+			applied, err := state.MigrateFile(statePath, jsonStore.Backups)
+			if err != nil {
+				fail(err, common.jsonOutput, "")
+			}
+			stateResult.Applied = applied
+		}
+		results = append(results, stateResult)
+	}
+
+	_, cfgPath, err := projectlink.ResolveByCWD(".")
+	if err != nil && !errors.Is(err, projectlink.ErrNotLinked) {
+		fail(err, common.jsonOutput, "")
+	}
+	if err == nil {
+		plan, err := projectlink.PlanMigrations(cfgPath)
+		if err != nil {
+			fail(fmt.Errorf("%s: %w", cfgPath, err), common.jsonOutput, "")
+		}
+		projectResult := migrationFileResult{Kind: "project", Path: cfgPath, From: plan.From, To: plan.To, Steps: plan.Names()}
+		if plan.Pending() && !*dryRun {
+			applied, err := projectlink.MigrateFile(cfgPath)
+			if err != nil {
+				fail(err, common.jsonOutput, "")
+			}
+			projectResult.Applied = applied
+		}
+		results = append(results, projectResult)
+	}
+
+	if common.jsonOutput {
+		writeJSON(map[string]any{
+			"status":  "ok",
+			"dry_run": *dryRun,
+			"files":   results,
+		})
+		return
+	}
+
+	for _, r := range results {
+		switch {
+		case len(r.Steps) == 0:
+			fmt.Printf("%s: %s is up to date (schema_version %d)\n", r.Kind, r.Path, r.To)
+		case *dryRun:
+			fmt.Printf("%s: %s would migrate %d -> %d: %s\n", r.Kind, r.Path, r.From, r.To, strings.Join(r.Steps, ", "))
+		default:
+			fmt.Printf("%s: %s migrated %d -> %d: %s\n", r.Kind, r.Path, r.From, r.To, strings.Join(r.Steps, ", "))
+		}
+	}
+}
+
+func runStateFsck(args []string) {
+	jsonRequested := wantsJSON(args)
+	fs := newFlagSet("state fsck")
+	common := addCommonFlags(fs)
+	repair := fs.Bool("repair", false, "Fix repairable issues and save the state (keeps a .bak copy)")
+	if err := fs.Parse(args); err != nil {
+		fail(err, jsonRequested, "")
+	}
+
+	store, err := openMaintenanceStore(*common)
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+	statePath := store.Location()
+	report, err := state.FsckStore(store, *repair)
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+	unresolved := report.Unresolved()
+
+	status := "ok"
+	if len(unresolved) > 0 {
+		status = "error"
+	}
+	if common.jsonOutput {
+		writeJSON(map[string]any{
+			"status":     status,
+			"path":       statePath,
+			"repair":     *repair,
+			"nodes":      report.Nodes,
+			"roots":      report.Roots,
+			"issues":     report.Issues,
+			"unresolved": len(unresolved),
+		})
+	} else {
+		fmt.Printf("Checked %d nodes and %d roots in %s\n", report.Nodes, report.Roots, statePath)
+		for _, issue := range report.Issues {
+			mark := "issue"
+			switch {
+			case issue.Repaired:
+				mark = "fixed"
+			case !issue.Repairable:
+				mark = "manual"
+			}
+			fmt.Printf("[%-6s] %-17s %s %s\n", mark, issue.Code, issue.NodeID, issue.Detail)
+		}
+		switch {
+		case report.Clean():
+			fmt.Println("No issues found.")
+		case len(unresolved) == 0:
+			fmt.Printf("Repaired %d issue(s).\n", len(report.Issues))
+		case *repair:
+			fmt.Printf("%d issue(s) need manual attention.\n", len(unresolved))
+		default:
+			fmt.Printf("%d issue(s) found; run `themis state fsck --repair` to fix what can be fixed.\n", len(unresolved))
+		}
+	}
+	if len(unresolved) > 0 {
+		os.Exit(1)
+	}
+}
+
+func runStateGC(args []string) {
+	jsonRequested := wantsJSON(args)
+	fs := newFlagSet("state gc")
+	common := addCommonFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "Report what would be removed without writing")
+	grace := fs.Duration("grace", state.DefaultGCGracePeriod, "Keep unreachable nodes orphaned more recently than this")
+	tombstoneMaxAge := fs.Duration("tombstone-max-age", state.DefaultTombstoneMaxAge, "Prune removed-child tombstones older than this (0 keeps them)")
+	if err := fs.Parse(args); err != nil {
+		fail(err, jsonRequested, "")
+	}
+	if *grace < 0 || *tombstoneMaxAge < 0 {
+		fail(fmt.Errorf("--grace and --tombstone-max-age must be >= 0"), common.jsonOutput, "")
+	}
+
+	store, err := openMaintenanceStore(*common)
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+	statePath := store.Location()
+	report, err := state.GCStore(store, state.GCOptions{
+		GracePeriod:     *grace,
+		TombstoneMaxAge: *tombstoneMaxAge,
+	}, *dryRun)
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+
+	if common.jsonOutput {
+		writeJSON(map[string]any{
+			"status":            "ok",
+			"path":              statePath,
+			"dry_run":           *dryRun,
+			"reachable":         report.Reachable,
+			"orphaned":          report.Orphaned,
+			"removed_node_ids":  report.RemovedNodeIDs,
+			"kept_in_grace":     report.KeptInGrace,
+			"pruned_tombstones": report.PrunedTombstones,
+			"bytes_before":      report.BytesBefore,
+			"bytes_after":       report.BytesAfter,
+			"freed_bytes":       report.FreedBytes(),
+		})
+		return
+	}
+
+	verb := "Removed"
+	if *dryRun {
+		verb = "Would remove"
+	}
+	fmt.Printf("%d reachable, %d orphaned node(s) in %s\n", report.Reachable, report.Orphaned, statePath)
+	fmt.Printf("%s %d node(s) and %d tombstone(s), freeing %d bytes\n", verb, len(report.RemovedNodeIDs), report.PrunedTombstones, report.FreedBytes())
+	if len(report.KeptInGrace) > 0 {
+		fmt.Printf("Kept %d orphaned node(s) still within the %s grace period\n", len(report.KeptInGrace), *grace)
+	}
+}
+
+func runStateConvert(args []string) {
+	jsonRequested := wantsJSON(args)
+	fs := newFlagSet("state convert")
+	common := addCommonFlags(fs)
+	to := fs.String("to", "", "Destination backend: json or log")
+	outPath := fs.String("out", "", "Destination file (default: the default file for --to)")
+	force := fs.Bool("force", false, "Overwrite an existing destination")
+	if err := fs.Parse(args); err != nil {
+		fail(err, jsonRequested, "")
+	}
+	if strings.TrimSpace(*to) == "" {
+		fail(fmt.Errorf("--to is required (json or log)"), common.jsonOutput, "")
+	}
+
+	src, err := openMaintenanceStore(*common)
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+	dst, err := state.OpenStore(*to, *outPath, state.StoreOptions{})
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+	st, err := state.ConvertStore(src, dst, *force)
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+
+	if common.jsonOutput {
+		writeJSON(map[string]any{
+			"status": "ok",
+			"from":   map[string]string{"backend": src.Backend(), "path": src.Location()},
+			"to":     map[string]string{"backend": dst.Backend(), "path": dst.Location()},
+			"nodes":  len(st.Nodes),
+			"roots":  len(st.Roots),
+		})
+		return
+	}
+	fmt.Printf("Copied %d nodes and %d roots from %s (%s) to %s (%s)\n", len(st.Nodes), len(st.Roots), src.Location(), src.Backend(), dst.Location(), dst.Backend())
+	fmt.Printf("Use --state-backend %s (or THEMIS_STATE_BACKEND=%s) to read from it.\n", dst.Backend(), dst.Backend())
+}
+
+// openMaintenanceStore opens the configured store without --strict-state so
+// maintenance commands can work on a damaged state.
+func openMaintenanceStore(common commonFlags) (state.Store, error) {
+	backups, err := common.backupPolicy()
+	if err != nil {
+		return nil, err
+	}
+	return state.OpenStore(common.stateBackend, common.statePath, state.StoreOptions{Backups: &backups})
+}
+
+func runStateExport(args []string) {
+	jsonRequested := wantsJSON(args)
+	fs := newFlagSet("state export")
+	common := addCommonFlags(fs)
+	rootURL := fs.String("root-url", "", "Export only the subtree below this URL (default: everything reachable from tracked roots)")
+	outPath := fs.String("out", "-", "Output file, or - for stdout")
+	stripPersonal := fs.Bool("strip-personal", true, "Drop grades, submission refs and local asset paths")
+	if err := fs.Parse(args); err != nil {
+		fail(err, jsonRequested, "")
+	}
+
+	store, err := common.openStore()
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+	st, err := store.Load()
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+	policy, err := resolveStalePolicy()
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+	opts := state.ExportOptions{StripPersonal: *stripPersonal, StalePolicy: &policy}
+	if strings.TrimSpace(*rootURL) != "" {
+		id, _, err := state.NodeIDFromURL(strings.TrimSpace(*rootURL))
+		if err != nil {
+			fail(err, common.jsonOutput, "")
+		}
+		opts.RootID = id
+	}
+	doc, err := state.BuildExport(st, opts, time.Now())
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+
+	if *outPath == "-" {
+		if err := state.EncodeExport(os.Stdout, doc); err != nil {
+			fail(err, false, "")
+		}
+		return
+	}
+	var buf bytes.Buffer
+	if err := state.EncodeExport(&buf, doc); err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+	if err := os.WriteFile(*outPath, buf.Bytes(), 0o644); err != nil {
+		fail(fmt.Errorf("write export: %w", err), common.jsonOutput, "")
+	}
+
+	if common.jsonOutput {
+		writeJSON(map[string]any{
+			"status":            "ok",
+			"path":              *outPath,
+			"root_id":           doc.RootID,
+			"nodes":             len(doc.Nodes),
+			"roots":             len(doc.Roots),
+			"stripped_personal": doc.StrippedPersonal,
+		})
+		return
+	}
+	fmt.Printf("Exported %d nodes and %d roots to %s\n", len(doc.Nodes), len(doc.Roots), *outPath)
+}
+
+func runStateImport(args []string) {
+	jsonRequested := wantsJSON(args)
+	fs := newFlagSet("state import")
+	common := addCommonFlags(fs)
+	inPath := fs.String("in", "", "Export file to merge, or - for stdin (also accepted as the first argument)")
+	dryRun := fs.Bool("dry-run", false, "Report what would change without writing")
+	if err := fs.Parse(args); err != nil {
+		fail(err, jsonRequested, "")
+	}
+	if *inPath == "" && fs.NArg() > 0 {
+		*inPath = fs.Arg(0)
+	}
+	if *inPath == "" {
+		fail(fmt.Errorf("missing export file (pass --in <path> or -)"), common.jsonOutput, "")
+	}
+
+	var in io.Reader = os.Stdin
+	if *inPath != "-" {
+		file, err := os.Open(*inPath)
+		if err != nil {
+			fail(fmt.Errorf("open export: %w", err), common.jsonOutput, "")
+		}
+		defer file.Close()
+		in = file
+	}
+	doc, err := state.DecodeExport(in)
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+
+	store, err := common.openStore()
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+	var report state.MergeReport
+	err = store.Update(func(st *state.State) (bool, error) {
+		var err error
+		report, err = state.MergeExport(st, doc, time.Now())
+		if err != nil {
+			return false, err
+		}
+		return report.Changed() && !*dryRun, nil
+	})
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+
+	if common.jsonOutput {
+		writeJSON(map[string]any{
+			"status":      "ok",
+			"path":        store.Location(),
+			"dry_run":     *dryRun,
+			"added":       report.Added,
+			"updated":     report.Updated,
+			"kept_local":  report.KeptLocal,
+			"unchanged":   report.Unchanged,
+			"roots_added": report.RootsAdded,
+			"conflicts":   report.Conflicts,
+		})
+		return
+	}
+
+	verb := "Merged"
+	if *dryRun {
+		verb = "Would merge"
+	}
+	fmt.Printf("%s %d nodes into %s: %d added, %d updated, %d kept local, %d unchanged, %d root(s) added\n",
+		verb, len(doc.Nodes), store.Location(), report.Added, report.Updated, report.KeptLocal, report.Unchanged, report.RootsAdded)
+	for _, c := range report.Conflicts {
+		fmt.Printf("[%-6s] %s %s\n", c.Winner, c.CanonicalURL, c.Reason)
+	}
+}
+
+func runStateDiff(args []string) {
+	jsonRequested := wantsJSON(args)
+	fs := newFlagSet("state diff")
+	common := addCommonFlags(fs)
+	fromPath := fs.String("from", "", "Older state file (default: the .bak kept by the last save)")
+	toPath := fs.String("to", "", "Newer state file (default: the current state)")
+	exitCode := fs.Bool("exit-code", false, "Exit with status 1 when the states differ")
+	if err := fs.Parse(args); err != nil {
+		fail(err, jsonRequested, "")
+	}
+
+	store, err := openMaintenanceStore(*common)
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+	if *toPath == "" {
+		*toPath = store.Location()
+	}
+	if *fromPath == "" {
+		if store.Backend() != state.BackendJSON {
+			fail(fmt.Errorf("the %s backend keeps no .bak copy; pass --from <file>", store.Backend()), common.jsonOutput, "")
+		}
+		*fromPath = state.BackupPath(store.Location())
+	}
+	before, err := state.ReadSnapshot(*fromPath)
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+	after, err := state.ReadSnapshot(*toPath)
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+	diff := state.DiffStates(before, after)
+
+	if common.jsonOutput {
+		writeJSON(map[string]any{
+			"status":        "ok",
+			"from":          *fromPath,
+			"to":            *toPath,
+			"identical":     diff.Empty(),
+			"added":         diff.Added,
+			"removed":       diff.Removed,
+			"changed":       diff.Changed,
+			"roots_added":   diff.RootsAdded,
+			"roots_removed": diff.RootsRemoved,
+			"unchanged":     diff.Unchanged,
+		})
+	} else {
+		printStateDiff(diff, before, after, *fromPath, *toPath)
+	}
+	if *exitCode && !diff.Empty() {
+		os.Exit(1)
+	}
+}
+
+func printStateDiff(diff state.StateDiff, before state.State, after state.State, fromPath string, toPath string) {
+	fmt.Printf("--- %s\n+++ %s\n", fromPath, toPath)
+	if diff.Empty() {
+		fmt.Println("No changes.")
+		return
+	}
+	urlOf := func(id string) string {
+		if node, ok := after.Nodes[id]; ok {
+			return node.CanonicalURL
+		}
+		if node, ok := before.Nodes[id]; ok {
+			return node.CanonicalURL
+		}
+		return id
+	}
+	for _, url := range diff.RootsAdded {
+		fmt.Printf("+ root %s\n", url)
+	}
+	for _, url := range diff.RootsRemoved {
+		fmt.Printf("- root %s\n", url)
+	}
+	for _, ref := range diff.Added {
+		fmt.Printf("+ %s %q %s\n", ref.Kind, ref.Title, ref.CanonicalURL)
+	}
+	for _, ref := range diff.Removed {
+		fmt.Printf("- %s %q %s\n", ref.Kind, ref.Title, ref.CanonicalURL)
+	}
+	for _, c := range diff.Changed {
+		fmt.Printf("~ %s %q %s\n", c.Kind, c.Title, c.CanonicalURL)
+		if c.Title != nil {
+			fmt.Printf("    title: %q -> %q\n", c.Title.From, c.Title.To)
+		}
+		if c.Status != nil {
+			fmt.Printf("    status: %s -> %s\n", c.Status.From, c.Status.To)
+		}
+		if c.ContentHash != nil {
+			fmt.Println("    content changed")
+		}
+		for _, id := range c.AddedChildren {
+			fmt.Printf("    + child %s\n", urlOf(id))
+		}
+		for _, id := range c.RemovedChildren {
+			fmt.Printf("    - child %s\n", urlOf(id))
+		}
+		for _, id := range c.AddedParents {
+			fmt.Printf("    + parent %s\n", urlOf(id))
+		}
+		for _, id := range c.RemovedParents {
+			fmt.Printf("    - parent %s\n", urlOf(id))
+		}
+		if len(c.AddedDetailKeys)+len(c.RemovedDetailKeys)+len(c.ChangedDetailKeys) > 0 {
+			parts := make([]string, 0)
+			for _, k := range c.AddedDetailKeys {
+				parts = append(parts, "+"+k)
+			}
+			for _, k := range c.RemovedDetailKeys {
+				parts = append(parts, "-"+k)
+			}
+			for _, k := range c.ChangedDetailKeys {
+				parts = append(parts, "~"+k)
+			}
+			fmt.Printf("    details: %s\n", strings.Join(parts, " "))
+		}
+		if c.AssetsChanged {
+			fmt.Println("    assets changed")
+		}
+	}
+	fmt.Printf("%d added, %d removed, %d changed, %d unchanged\n", len(diff.Added), len(diff.Removed), len(diff.Changed), diff.Unchanged)
+}
+
+func runStateBackups(args []string) {
+	if len(args) == 0 || args[0] != "list" {
+		sub := ""
+		if len(args) > 0 {
+			sub = args[0]
+		}
+		fail(fmt.Errorf("unknown state backups subcommand %q (want list)", sub), wantsJSON(args), "")
+	}
+	jsonRequested := wantsJSON(args[1:])
+	fs := newFlagSet("state backups list")
+	common := addCommonFlags(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		fail(err, jsonRequested, "")
+	}
+
+	store, err := openMaintenanceStore(*common)
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+	backups, err := state.ListBackups(store.Location())
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+
+	if common.jsonOutput {
+		writeJSON(map[string]any{
+			"status":  "ok",
+			"dir":     state.BackupDir(store.Location()),
+			"backups": backups,
+		})
+		return
+	}
+	if len(backups) == 0 {
+		fmt.Printf("No backups in %s\n", state.BackupDir(store.Location()))
+		return
+	}
+	for _, b := range backups {
+		kind := "json"
+		if b.Compressed {
+			kind = "gzip"
+		}
+		fmt.Printf("%-24s %s  %-4s %8d bytes\n", b.ID, b.CreatedAt.Local().Format("2006-01-02 15:04:05"), kind, b.SizeBytes)
+	}
+}
+
+func runStateRestore(args []string) {
+	jsonRequested := wantsJSON(args)
+	fs := newFlagSet("state restore")
+	common := addCommonFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		fail(err, jsonRequested, "")
+	}
+	if fs.NArg() != 1 {
+		fail(fmt.Errorf("usage: themis state restore [flags] <backup-id|timestamp>"), common.jsonOutput, "")
+	}
+
+	store, err := openMaintenanceStore(*common)
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+	jsonStore, ok := store.(*state.JSONStore)
+	if !ok {
+		fail(fmt.Errorf("backups are only kept for the json backend"), common.jsonOutput, "")
+	}
+	info, st, err := state.RestoreBackup(jsonStore.Location(), fs.Arg(0), jsonStore.Backups)
+	if err != nil {
+		fail(err, common.jsonOutput, "")
+	}
+
+	if common.jsonOutput {
+		writeJSON(map[string]any{
+			"status": "ok",
+			"path":   store.Location(),
+			"backup": info,
+			"nodes":  len(st.Nodes),
+			"roots":  len(st.Roots),
+		})
+		return
+	}
+	fmt.Printf("Restored %s from backup %s (%d nodes, %d roots); the replaced state was backed up first.\n", store.Location(), info.ID, len(st.Nodes), len(st.Roots))
+}
@@ -1,6 +1,7 @@
 package discovery
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -20,6 +21,11 @@ type DownloadedAsset struct {
 }
 
 func DownloadAssetRefs(client *http.Client, assets []state.AssetRef, targetDir string) ([]DownloadedAsset, error) {
+	return DownloadAssetRefsContext(context.Background(), client, assets, targetDir)
+}
+
+// DownloadAssetRefsContext is DownloadAssetRefs bound to ctx.
+func DownloadAssetRefsContext(ctx context.Context, client *http.Client, assets []state.AssetRef, targetDir string) ([]DownloadedAsset, error) {
 	if err := os.MkdirAll(targetDir, 0o755); err != nil {
 		return nil, fmt.Errorf("create target dir: %w", err)
 	}
@@ -38,7 +44,7 @@ func DownloadAssetRefs(client *http.Client, assets []state.AssetRef, targetDir s
 			rawURL = ensureRawQuery(assetURL)
 		}
 
-		body, err := downloadRawFile(client, rawURL)
+		body, err := downloadRawFile(ctx, client, rawURL)
 		if err != nil {
 			return nil, fmt.Errorf("download asset %s: %w", assetURL, err)
 		}
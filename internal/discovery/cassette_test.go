@@ -0,0 +1,156 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"themis-cli/internal/state"
+	"themis-cli/internal/themis"
+)
+
+// recordingClient records every exchange made through client into dir.
+func recordingClient(t *testing.T, client *http.Client, dir string) *http.Client {
+	t.Helper()
+	transport, err := themis.NewRecordingTransport(dir, client.Transport)
+	if err != nil {
+		t.Fatalf("record setup failed: %v", err)
+	}
+	return &http.Client{Transport: transport}
+}
+
+// replayClient answers only from the cassette in dir.
+func replayClient(t *testing.T, dir string) *http.Client {
+	t.Helper()
+	transport, err := themis.NewReplayTransport(dir)
+	if err != nil {
+		t.Fatalf("replay setup failed: %v", err)
+	}
+	return &http.Client{Transport: transport}
+}
+
+func TestCassetteReplay_RefreshWithStats(t *testing.T) {
+	server, client := newTestServer(map[string]string{
+		"/course/2025-2026/os/lab5/5_file_writer": `<html><body>
+		<section class="assignment"><div class="sec-heading"><h3 class="sec-title">/ <a href="/course/2025-2026/os/lab5/5_file_writer">Exercise 5: File Writer</a></h3></div>
+		<div class="sec-body description"><p>Write a file writer.</p></div></section>
+		<div class="subsec round help shade"><a href="/stats/2025-2026/os/lab5/5_file_writer" class="iconize status">Status</a></div>
+		<div class="subsec round shade ass-children"><ul class="round"></ul></div>
+		</body></html>`,
+		"/stats/2025-2026/os/lab5/5_file_writer": `<html><body>
+		<section class="status border passed">
+			<div class="sec-heading fill passed round"><h3 class="sec-title fill status-icon passed">Status: <a class="fill passed" href="/stats/2025-2026/os/lab5/5_file_writer/@submissions/s1">Exercise 5: File Writer</a></h3></div>
+			<div class="sec-body round"><div class="cfg-container round">
+				<div class="cfg-line"><span class="cfg-key">Status:</span><span class="cfg-val"><strong>passed</strong>: Passed all test cases</span></div>
+				<div class="cfg-group-title">Counts</div>
+				<div class="cfg-line"><span class="cfg-key">Total:</span><span class="cfg-val">8</span></div>
+				<div class="cfg-line"><span class="cfg-key">Passed:</span><span class="cfg-val">1</span></div>
+			</div></div>
+		</section>
+		</body></html>`,
+	})
+	base := server.URL
+	assignment := base + "/course/2025-2026/os/lab5/5_file_writer"
+	cassette := t.TempDir()
+
+	live := state.NewEmptyState()
+	if _, err := NewService(base).RefreshNode(recordingClient(t, client, cassette), &live, assignment, 0); err != nil {
+		t.Fatalf("live refresh failed: %v", err)
+	}
+	server.Close()
+	if files, _ := filepath.Glob(filepath.Join(cassette, "*.json")); len(files) != 2 {
+		t.Fatalf("expected the page and stats page to be recorded, got %d interactions", len(files))
+	}
+
+	replayed := state.NewEmptyState()
+	result, err := NewService(base).RefreshNode(replayClient(t, cassette), &replayed, assignment, 0)
+	if err != nil || len(result.Errors) != 0 {
+		t.Fatalf("replayed refresh failed: %v %v", err, result.Errors)
+	}
+	nodeID, _, _ := state.NodeIDFromURL(assignment)
+	want, got := live.Nodes[nodeID], replayed.Nodes[nodeID]
+	if got.Title != want.Title || got.Kind != "assignment" || got.ContentHash != want.ContentHash {
+		t.Fatalf("replayed node differs: %+v vs %+v", got, want)
+	}
+	if !reflect.DeepEqual(got.Details["stats"], want.Details["stats"]) {
+		t.Fatalf("replayed stats differ: %#v vs %#v", got.Details["stats"], want.Details["stats"])
+	}
+	counts := got.Details["stats"].(map[string]any)["counts"].(map[string]any)
+	if counts["total"] != 8 || counts["passed"] != 1 {
+		t.Fatalf("unexpected replayed counts: %#v", counts)
+	}
+
+	// A page missing from the cassette fails instead of reaching the network.
+	result, err = NewService(base).RefreshNode(replayClient(t, cassette), &replayed, base+"/course/2025-2026/os", 0)
+	if err != nil {
+		t.Fatalf("refresh returned error: %v", err)
+	}
+	if len(result.Errors) != 1 || !strings.Contains(result.Errors[0], themis.ErrCassetteMiss.Error()) {
+		t.Fatalf("expected a cassette miss, got %v", result.Errors)
+	}
+}
+
+func TestCassetteReplay_ListTestsProbe(t *testing.T) {
+	server, client := newTestServer(map[string]string{
+		"/file/course/@tests/1.in":  "in1",
+		"/file/course/@tests/1.out": "out1",
+		"/file/course/@tests/2.in":  "in2",
+		"/file/course/@tests/2.out": "out2",
+	})
+	testsURL := server.URL + "/file/course/%40tests"
+	opts := ListOptions{Start: 1, Max: 10, MaxMisses: 2}
+	cassette := t.TempDir()
+
+	_, liveCases, err := ListTestCasesContext(context.Background(), recordingClient(t, client, cassette), testsURL, opts)
+	if err != nil {
+		t.Fatalf("live probe failed: %v", err)
+	}
+	server.Close()
+
+	_, replayedCases, err := ListTestCasesContext(context.Background(), replayClient(t, cassette), testsURL, opts)
+	if err != nil {
+		t.Fatalf("replayed probe failed: %v", err)
+	}
+	if got := ListTestNumbers(replayedCases); !reflect.DeepEqual(got, []int{1, 2}) || !reflect.DeepEqual(got, ListTestNumbers(liveCases)) {
+		t.Fatalf("unexpected replayed tests: %v", got)
+	}
+
+	_, _, err = ListTestCasesContext(context.Background(), replayClient(t, cassette), testsURL, ListOptions{Start: 1, Max: 10, MaxMisses: 5})
+	if !errors.Is(err, themis.ErrCassetteMiss) {
+		t.Fatalf("expected a cassette miss when probing further than recorded, got %v", err)
+	}
+}
+
+func TestCassetteReplay_Fetch(t *testing.T) {
+	server, client := newTestServer(map[string]string{
+		"/file/course/@tests/1.in":  "in1",
+		"/file/course/@tests/1.out": "out1",
+	})
+	testsURL := server.URL + "/file/course/%40tests"
+	cassette := t.TempDir()
+
+	if _, _, err := FetchTestCasesContext(context.Background(), recordingClient(t, client, cassette), testsURL, t.TempDir()); err != nil {
+		t.Fatalf("live fetch failed: %v", err)
+	}
+	server.Close()
+
+	outDir := t.TempDir()
+	_, downloaded, err := FetchTestCasesContext(context.Background(), replayClient(t, cassette), testsURL, outDir)
+	if err != nil {
+		t.Fatalf("replayed fetch failed: %v", err)
+	}
+	if len(downloaded) != 1 {
+		t.Fatalf("expected one replayed test case, got %d", len(downloaded))
+	}
+	for name, want := range map[string]string{"1.in": "in1", "1.out": "out1"} {
+		raw, err := os.ReadFile(filepath.Join(outDir, name))
+		if err != nil || string(raw) != want {
+			t.Fatalf("unexpected %s: %q %v", name, raw, err)
+		}
+	}
+}
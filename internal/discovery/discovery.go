@@ -1,6 +1,7 @@
 package discovery
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -8,10 +9,23 @@ import (
 
 	"github.com/PuerkitoBio/goquery"
 	log "github.com/charmbracelet/log"
+
+	"themis-cli/internal/state"
 )
 
 type Service struct {
 	BaseURL string
+	// Progress, when set, is called synchronously for every step of a
+	// refresh walk.
+	Progress func(ProgressEvent)
+	// Store, when set, receives the nodes each refresh touched, including
+	// those of an interrupted refresh, in a single write, so callers need not
+	// save the whole state afterwards.
+	Store state.Store
+	// OnPersist, when set, is applied to the stored state in that same write,
+	// for changes the caller wants saved with the refresh (such as a root
+	// reference). It reports whether it changed anything.
+	OnPersist func(st *state.State) bool
 }
 
 type AssignmentEntry struct {
@@ -19,6 +33,12 @@ type AssignmentEntry struct {
 	URL       string `json:"url"`
 	Depth     int    `json:"depth"`
 	ParentURL string `json:"parent_url,omitempty"`
+	// Kind, Status and AgeSeconds are filled when listing from local state;
+	// Status reflects the staleness policy at listing time.
+	Kind       string `json:"kind,omitempty"`
+	Status     string `json:"status,omitempty"`
+	AgeSeconds *int64 `json:"age_seconds,omitempty"`
+	Stale      bool   `json:"stale,omitempty"`
 }
 
 type AssignmentNode struct {
@@ -56,7 +76,7 @@ func BuildRootAssignmentNode(name string, assignmentURL string, logger *log.Logg
 }
 
 func (s *Service) PullAssignmentsAndBuildTree(client *http.Client, pageURL string, rootNode *AssignmentNode, depth int, logger *log.Logger) (*AssignmentNode, error) {
-	assignments, err := s.getAssignmentsOnPage(client, pageURL)
+	assignments, err := s.getAssignmentsOnPage(context.Background(), client, pageURL)
 	if err != nil {
 		return nil, fmt.Errorf("error getting assignments on page: %w", err)
 	}
@@ -81,6 +101,11 @@ func (s *Service) PullAssignmentsAndBuildTree(client *http.Client, pageURL strin
 }
 
 func (s *Service) DiscoverAssignments(client *http.Client, rootURL string, maxDepth int) (string, []AssignmentEntry, error) {
+	return s.DiscoverAssignmentsContext(context.Background(), client, rootURL, maxDepth)
+}
+
+// DiscoverAssignmentsContext is DiscoverAssignments bound to ctx.
+func (s *Service) DiscoverAssignmentsContext(ctx context.Context, client *http.Client, rootURL string, maxDepth int) (string, []AssignmentEntry, error) {
 	if maxDepth < 0 {
 		return "", nil, fmt.Errorf("--discover-depth must be >= 0")
 	}
@@ -103,7 +128,7 @@ func (s *Service) DiscoverAssignments(client *http.Client, rootURL string, maxDe
 		}
 		visited[currentURL] = true
 
-		assignments, err := s.getAssignmentsOnPage(client, currentURL)
+		assignments, err := s.getAssignmentsOnPage(ctx, client, currentURL)
 		if err != nil {
 			return err
 		}
@@ -134,8 +159,8 @@ type assignmentRef struct {
 	URL  string
 }
 
-func (s *Service) getAssignmentsOnPage(client *http.Client, pageURL string) ([]assignmentRef, error) {
-	resp, err := client.Get(pageURL)
+func (s *Service) getAssignmentsOnPage(ctx context.Context, client *http.Client, pageURL string) ([]assignmentRef, error) {
+	resp, err := httpGet(ctx, client, pageURL)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching page: %w", err)
 	}
@@ -0,0 +1,29 @@
+package discovery
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// httpGet issues a GET bound to ctx so callers can cancel in-flight requests.
+func httpGet(ctx context.Context, client *http.Client, rawURL string) (*http.Response, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+// isLoginPage reports whether a request for requestedURL was redirected to a
+// login form, which is how Themis answers an expired session.
+func isLoginPage(resp *http.Response, requestedURL string, doc *goquery.Document) bool {
+	if resp.Request == nil || resp.Request.URL == nil || resp.Request.URL.String() == requestedURL {
+		return false
+	}
+	return doc.Find(`input[type="password"]`).Length() > 0
+}
@@ -0,0 +1,389 @@
+package discovery
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// droppedElements never contribute to the Markdown body: scripts, styling,
+// embedded content and form controls.
+var droppedElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true,
+	"iframe": true, "object": true, "embed": true, "svg": true, "canvas": true,
+	"form": true, "input": true, "button": true, "select": true, "textarea": true,
+}
+
+var blockElements = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "main": true,
+	"header": true, "footer": true, "aside": true, "nav": true, "figure": true,
+	"figcaption": true, "details": true, "summary": true, "dl": true, "dt": true, "dd": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"pre": true, "ul": true, "ol": true, "blockquote": true, "table": true, "hr": true,
+}
+
+// containerElements only group other content and add no Markdown of their own.
+var containerElements = map[string]bool{
+	"div": true, "section": true, "article": true, "main": true, "header": true,
+	"footer": true, "aside": true, "nav": true, "figure": true, "details": true, "dl": true,
+}
+
+var whitespaceRun = regexp.MustCompile(`[ \t\r\n\f]+`)
+
+// extractBodyMarkdown returns the assignment statement as Markdown. Themis
+// renders it in a foldable "Description" subsection; pages without one fall
+// back to the short p.ass-description summary.
+func extractBodyMarkdown(doc *goquery.Document, canonicalURL string) string {
+	var body *goquery.Selection
+	doc.Find(".subsec").EachWithBreak(func(_ int, sub *goquery.Selection) bool {
+		title := strings.ToLower(strings.TrimSpace(sub.Find(".subsec-title").First().Text()))
+		if title != "description" && title != "assignment" {
+			return true
+		}
+		body = sub.Find(".foldable").First()
+		if body.Length() == 0 {
+			body = sub.Clone()
+			body.Find(".subsec-title").Remove()
+		}
+		return false
+	})
+	if body == nil || body.Length() == 0 {
+		body = doc.Find(".ass-description")
+	}
+	if body.Length() == 0 {
+		return ""
+	}
+	return HTMLToMarkdown(body, canonicalURL)
+}
+
+// HTMLToMarkdown converts the selected elements to Markdown. Headings, lists,
+// block quotes, tables and emphasis are kept; code blocks keep their
+// whitespace and language. Links and images become numbered references
+// resolved against pageURL and listed at the end. Scripts, styles, embeds and
+// form controls are dropped.
+func HTMLToMarkdown(sel *goquery.Selection, pageURL string) string {
+	w := &markdownWriter{base: pageURL, refIndex: map[string]int{}}
+	blocks := make([]string, 0)
+	for _, n := range sel.Nodes {
+		blocks = append(blocks, w.blocks(n)...)
+	}
+	out := strings.Join(blocks, "\n\n")
+	if len(w.refs) > 0 {
+		lines := make([]string, 0, len(w.refs))
+		for i, ref := range w.refs {
+			lines = append(lines, fmt.Sprintf("[%d]: %s", i+1, ref))
+		}
+		out += "\n\n" + strings.Join(lines, "\n")
+	}
+	return strings.TrimSpace(out)
+}
+
+type markdownWriter struct {
+	base     string
+	refs     []string
+	refIndex map[string]int
+}
+
+// ref returns the reference number for target, resolving it against the page
+// URL. Unsafe or in-page targets return 0.
+func (w *markdownWriter) ref(target string) int {
+	target = strings.TrimSpace(target)
+	lower := strings.ToLower(target)
+	if target == "" || strings.HasPrefix(target, "#") || strings.HasPrefix(lower, "javascript:") || strings.HasPrefix(lower, "data:") {
+		return 0
+	}
+	if abs, err := resolveLinkFromCanonical(w.base, target); err == nil {
+		target = abs
+	}
+	if i, ok := w.refIndex[target]; ok {
+		return i
+	}
+	w.refs = append(w.refs, target)
+	w.refIndex[target] = len(w.refs)
+	return len(w.refs)
+}
+
+// blocks renders n as Markdown blocks.
+func (w *markdownWriter) blocks(n *html.Node) []string {
+	if n.Type == html.ElementNode && blockElements[n.Data] && !containerElements[n.Data] {
+		return nonEmpty(w.block(n))
+	}
+	return w.childBlocks(n)
+}
+
+// childBlocks renders n's children as Markdown blocks. Inline content between
+// block elements becomes a paragraph.
+func (w *markdownWriter) childBlocks(n *html.Node) []string {
+	out := make([]string, 0)
+	var inline strings.Builder
+	flush := func() {
+		if p := cleanParagraph(inline.String()); p != "" {
+			out = append(out, p)
+		}
+		inline.Reset()
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && droppedElements[c.Data] {
+			continue
+		}
+		if c.Type == html.ElementNode && blockElements[c.Data] {
+			flush()
+			out = append(out, w.blocks(c)...)
+			continue
+		}
+		inline.WriteString(w.inline(c))
+	}
+	flush()
+	return out
+}
+
+func (w *markdownWriter) block(n *html.Node) string {
+	switch n.Data {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		text := cleanParagraph(w.inlineChildren(n))
+		if text == "" {
+			return ""
+		}
+		return strings.Repeat("#", int(n.Data[1]-'0')) + " " + strings.ReplaceAll(text, "\n", " ")
+	case "pre":
+		return codeFence(n)
+	case "ul", "ol":
+		return w.list(n)
+	case "blockquote":
+		inner := strings.Join(w.childBlocks(n), "\n\n")
+		if inner == "" {
+			return ""
+		}
+		lines := strings.Split(inner, "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight("> "+line, " ")
+		}
+		return strings.Join(lines, "\n")
+	case "table":
+		return w.table(n)
+	case "hr":
+		return "---"
+	case "dt":
+		if text := cleanParagraph(w.inlineChildren(n)); text != "" {
+			return "**" + text + "**"
+		}
+		return ""
+	default:
+		return strings.Join(w.childBlocks(n), "\n\n")
+	}
+}
+
+func (w *markdownWriter) list(n *html.Node) string {
+	items := make([]string, 0)
+	number := 1
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || c.Data != "li" {
+			continue
+		}
+		marker := "- "
+		if n.Data == "ol" {
+			marker = fmt.Sprintf("%d. ", number)
+			number++
+		}
+		content := strings.Join(w.childBlocks(c), "\n")
+		lines := strings.Split(content, "\n")
+		indent := strings.Repeat(" ", len(marker))
+		for i := range lines {
+			if i == 0 {
+				lines[i] = marker + lines[i]
+			} else if lines[i] != "" {
+				lines[i] = indent + lines[i]
+			}
+		}
+		items = append(items, strings.Join(lines, "\n"))
+	}
+	return strings.Join(items, "\n")
+}
+
+func (w *markdownWriter) table(n *html.Node) string {
+	rows := make([][]string, 0)
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		for c := node.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			if c.Data != "tr" {
+				walk(c)
+				continue
+			}
+			cells := make([]string, 0)
+			for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.Type == html.ElementNode && (cell.Data == "td" || cell.Data == "th") {
+					text := strings.ReplaceAll(cleanParagraph(w.inlineChildren(cell)), "\n", " ")
+					cells = append(cells, strings.ReplaceAll(text, "|", `\|`))
+				}
+			}
+			rows = append(rows, cells)
+		}
+	}
+	walk(n)
+	if len(rows) == 0 {
+		return ""
+	}
+	width := 0
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	lines := make([]string, 0, len(rows)+1)
+	for i, row := range rows {
+		for len(row) < width {
+			row = append(row, "")
+		}
+		lines = append(lines, "| "+strings.Join(row, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", width))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (w *markdownWriter) inlineChildren(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(w.inline(c))
+	}
+	return b.String()
+}
+
+func (w *markdownWriter) inline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return whitespaceRun.ReplaceAllString(n.Data, " ")
+	case html.ElementNode:
+	default:
+		return ""
+	}
+	if droppedElements[n.Data] {
+		return ""
+	}
+	switch n.Data {
+	case "br":
+		return "\n"
+	case "code", "kbd", "tt", "samp":
+		text := strings.TrimSpace(nodeText(n))
+		if text == "" {
+			return ""
+		}
+		fence := "`"
+		if strings.Contains(text, "`") {
+			fence = "``"
+		}
+		return fence + text + fence
+	case "strong", "b":
+		return wrapInline(w.inlineChildren(n), "**")
+	case "em", "i":
+		return wrapInline(w.inlineChildren(n), "*")
+	case "a":
+		text := strings.TrimSpace(w.inlineChildren(n))
+		i := w.ref(attr(n, "href"))
+		if i == 0 {
+			return text
+		}
+		if text == "" {
+			text = w.refs[i-1]
+		}
+		return fmt.Sprintf("[%s][%d]", text, i)
+	case "img":
+		i := w.ref(attr(n, "src"))
+		if i == 0 {
+			return ""
+		}
+		return fmt.Sprintf("![%s][%d]", strings.TrimSpace(attr(n, "alt")), i)
+	}
+	if blockElements[n.Data] {
+		return " " + strings.Join(w.childBlocks(n), " ") + " "
+	}
+	return w.inlineChildren(n)
+}
+
+// wrapInline puts marker around text, keeping surrounding spaces outside.
+func wrapInline(text string, marker string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	lead := text[:len(text)-len(strings.TrimLeft(text, " "))]
+	trail := text[len(strings.TrimRight(text, " ")):]
+	return lead + marker + trimmed + marker + trail
+}
+
+func codeFence(pre *html.Node) string {
+	lang := ""
+	for c := pre.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == "code" {
+			for _, class := range strings.Fields(attr(c, "class")) {
+				if l, ok := strings.CutPrefix(class, "language-"); ok {
+					lang = l
+				} else if l, ok := strings.CutPrefix(class, "lang-"); ok {
+					lang = l
+				}
+			}
+		}
+	}
+	code := strings.Trim(nodeText(pre), "\n")
+	fence := "```"
+	if strings.Contains(code, "```") {
+		fence = "~~~"
+	}
+	return fence + lang + "\n" + code + "\n" + fence
+}
+
+// nodeText is the raw text under n, whitespace preserved.
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.TextNode {
+			b.WriteString(node.Data)
+			return
+		}
+		if node.Type == html.ElementNode && node.Data == "br" {
+			b.WriteString("\n")
+			return
+		}
+		for c := node.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// cleanParagraph trims every line of inline text and drops blank lines.
+func cleanParagraph(text string) string {
+	lines := strings.Split(text, "\n")
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if line = strings.TrimSpace(whitespaceRun.ReplaceAllString(line, " ")); line != "" {
+			out = append(out, line)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+func nonEmpty(block string) []string {
+	if strings.TrimSpace(block) == "" {
+		return nil
+	}
+	return []string{block}
+}
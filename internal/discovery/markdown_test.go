@@ -0,0 +1,86 @@
+package discovery
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestHTMLToMarkdown(t *testing.T) {
+	page := `<div class="body">
+	<h2>Problem  statement</h2>
+	<p>Write a <strong>shell</strong> that reads <code>stdin</code>.
+	See <a href="/file/os/spec.pdf">the spec</a> and <a href="https://example.com/x">this</a>.</p>
+	<script>alert("x")</script>
+	<style>p { color: red }</style>
+	<pre><code class="language-c">int main(void) {
+    return 0;
+}</code></pre>
+	<ul><li>first</li><li>second <em>item</em></li></ul>
+	<ol><li>one</li><li>two</li></ol>
+	<table><tr><th>Input</th><th>Output</th></tr><tr><td>1 2</td><td>3</td></tr></table>
+	<p>Again <a href="/file/os/spec.pdf">spec</a>, <a href="javascript:void(0)">nothing</a>. <img src="/img/fig.png" alt="Figure"></p>
+	<form><input name="q"></form>
+	</div>`
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	got := HTMLToMarkdown(doc.Find(".body"), "https://themis.housing.rug.nl/course/2025-2026/os/lab1")
+	want := strings.Join([]string{
+		"## Problem statement",
+		"",
+		"Write a **shell** that reads `stdin`. See [the spec][1] and [this][2].",
+		"",
+		"```c",
+		"int main(void) {",
+		"    return 0;",
+		"}",
+		"```",
+		"",
+		"- first",
+		"- second *item*",
+		"",
+		"1. one",
+		"2. two",
+		"",
+		"| Input | Output |",
+		"| --- | --- |",
+		"| 1 2 | 3 |",
+		"",
+		"Again [spec][1], nothing. ![Figure][3]",
+		"",
+		"[1]: https://themis.housing.rug.nl/file/os/spec.pdf",
+		"[2]: https://example.com/x",
+		"[3]: https://themis.housing.rug.nl/img/fig.png",
+	}, "\n")
+	if got != want {
+		t.Fatalf("unexpected markdown:\n%s\n--- want ---\n%s", got, want)
+	}
+}
+
+func TestExtractBodyMarkdown_PrefersDescriptionSection(t *testing.T) {
+	page := `<html><body>
+	<div class="subsec"><h4 class="subsec-title">Files</h4><div class="foldable"><p>ignored</p></div></div>
+	<div class="subsec"><h4 class="subsec-title">Description</h4><div class="foldable"><p>Full statement.</p><pre>a  b
+c</pre></div></div>
+	<p class="ass-description">Short summary</p>
+	</body></html>`
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	got := extractBodyMarkdown(doc, "https://themis.housing.rug.nl/course/2025-2026/os/lab1")
+	if got != "Full statement.\n\n```\na  b\nc\n```" {
+		t.Fatalf("unexpected body: %q", got)
+	}
+
+	doc, err = goquery.NewDocumentFromReader(strings.NewReader(`<html><body><p class="ass-description">Short <b>summary</b></p></body></html>`))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if got := extractBodyMarkdown(doc, ""); got != "Short **summary**" {
+		t.Fatalf("unexpected fallback body: %q", got)
+	}
+}
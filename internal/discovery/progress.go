@@ -0,0 +1,60 @@
+package discovery
+
+import "themis-cli/internal/state"
+
+type ProgressKind string
+
+const (
+	ProgressPageStarted        ProgressKind = "page_started"
+	ProgressPageFetched        ProgressKind = "page_fetched"
+	ProgressChildrenDiscovered ProgressKind = "children_discovered"
+	ProgressError              ProgressKind = "error"
+)
+
+// ProgressEvent reports one step of a refresh walk. Counters are totals for
+// the walk so far.
+type ProgressEvent struct {
+	Kind ProgressKind
+	URL  string
+	// Fetched counts pages fetched, Queued pages discovered but not yet
+	// started, Errors the entries in RefreshResult.Errors.
+	Fetched int
+	Queued  int
+	Errors  int
+	// Children is the number of children found on the page
+	// (ProgressChildrenDiscovered only).
+	Children int
+	// Nodes are copies of the nodes written to state by this step: the page's
+	// node for ProgressPageFetched, the node and its children for
+	// ProgressChildrenDiscovered.
+	Nodes []state.Node
+	Err   string
+}
+
+func (s *Service) emitProgress(event ProgressEvent) {
+	if s.Progress != nil {
+		s.Progress(event)
+	}
+}
+
+// copyNodes returns deep copies of the nodes ids in st, in order, so events
+// stay valid while the walk keeps mutating st.
+func copyNodes(st *state.State, ids ...string) []state.Node {
+	subset := state.State{Nodes: make(map[string]state.Node, len(ids))}
+	for _, id := range ids {
+		if node, ok := st.Nodes[id]; ok {
+			subset.Nodes[id] = node
+		}
+	}
+	cloned, err := state.CloneState(subset)
+	if err != nil {
+		return nil
+	}
+	out := make([]state.Node, 0, len(cloned.Nodes))
+	for _, id := range ids {
+		if node, ok := cloned.Nodes[id]; ok {
+			out = append(out, node)
+		}
+	}
+	return out
+}
@@ -1,13 +1,16 @@
 package discovery
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -15,6 +18,7 @@ import (
 	"github.com/PuerkitoBio/goquery"
 
 	"themis-cli/internal/state"
+	"themis-cli/internal/themis"
 )
 
 type RefreshResult struct {
@@ -46,6 +50,11 @@ type pageSnapshot struct {
 }
 
 func (s *Service) RefreshCatalog(client *http.Client, st *state.State, depth int) (RefreshResult, error) {
+	return s.RefreshCatalogContext(context.Background(), client, st, depth)
+}
+
+// RefreshCatalogContext is RefreshCatalog bound to ctx.
+func (s *Service) RefreshCatalogContext(ctx context.Context, client *http.Client, st *state.State, depth int) (RefreshResult, error) {
 	if st == nil {
 		return RefreshResult{}, fmt.Errorf("state is nil")
 	}
@@ -53,10 +62,24 @@ func (s *Service) RefreshCatalog(client *http.Client, st *state.State, depth int
 	if target == "" {
 		target = strings.TrimRight(s.BaseURL, "/") + "/course"
 	}
-	return s.RefreshNode(client, st, target, depth)
+	return s.RefreshNodeContext(ctx, client, st, target, depth)
 }
 
 func (s *Service) RefreshNode(client *http.Client, st *state.State, targetURL string, depth int) (RefreshResult, error) {
+	return s.RefreshNodeContext(context.Background(), client, st, targetURL, depth)
+}
+
+// RefreshNodeContext is RefreshNode bound to ctx. Once ctx is done no further
+// pages are fetched and an error wrapping ctx.Err() is returned. Every page
+// fetched before that is applied to st as a whole, so st stays consistent and
+// may be saved; the result then counts the nodes updated so far. A page that
+// the server refuses for lack of a login (401, 403 or a redirect to the login
+// form) stops the walk the same way, with an error wrapping
+// themis.ErrNotAuthenticated.
+func (s *Service) RefreshNodeContext(ctx context.Context, client *http.Client, st *state.State, targetURL string, depth int) (RefreshResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	if st == nil {
 		return RefreshResult{}, fmt.Errorf("state is nil")
 	}
@@ -84,9 +107,19 @@ func (s *Service) RefreshNode(client *http.Client, st *state.State, targetURL st
 	}
 	updatedNodeIDs := map[string]struct{}{}
 	visited := map[string]struct{}{}
+	queued := map[string]struct{}{canonicalTarget: {}}
+	progress := func(kind ProgressKind, pageURL string) ProgressEvent {
+		return ProgressEvent{Kind: kind, URL: pageURL, Fetched: result.FetchedNodes, Queued: len(queued), Errors: len(result.Errors)}
+	}
 
+	// authErr stops the walk: every further page would fail the same way, and
+	// the error is returned so callers can re-authenticate and retry.
+	var authErr error
 	var walk func(canonicalURL string, remainingDepth int, parentID string)
 	walk = func(canonicalURL string, remainingDepth int, parentID string) {
+		if authErr != nil {
+			return
+		}
 		if _, ok := visited[canonicalURL]; ok {
 			if parentID != "" {
 				childID := state.NodeIDFromCanonicalURL(canonicalURL)
@@ -98,12 +131,30 @@ func (s *Service) RefreshNode(client *http.Client, st *state.State, targetURL st
 			return
 		}
 		visited[canonicalURL] = struct{}{}
+		delete(queued, canonicalURL)
+		if ctx.Err() != nil {
+			return
+		}
 
-		snap, fetchErr := s.fetchPageSnapshot(client, canonicalURL)
+		s.emitProgress(progress(ProgressPageStarted, canonicalURL))
+		snap, fetchErr := s.fetchPageSnapshot(ctx, client, canonicalURL)
 		if fetchErr != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if errors.Is(fetchErr, themis.ErrNotAuthenticated) {
+				authErr = fmt.Errorf("%s: %w", canonicalURL, fetchErr)
+				return
+			}
 			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", canonicalURL, fetchErr))
 			errNodeID := markNodeFetchError(st, canonicalURL, fetchErr.Error(), now)
 			updatedNodeIDs[errNodeID] = struct{}{}
+			if s.Progress != nil {
+				event := progress(ProgressError, canonicalURL)
+				event.Err = fetchErr.Error()
+				event.Nodes = copyNodes(st, errNodeID)
+				s.emitProgress(event)
+			}
 			return
 		}
 		result.FetchedNodes++
@@ -124,9 +175,12 @@ func (s *Service) RefreshNode(client *http.Client, st *state.State, targetURL st
 				snap.Details = withStatusPageLink(snap.Details, statusURL)
 				shouldFetchStats := explicitStatusURL != "" || hasStatsDetails(current.Details) || (parentID == "" && depth == 0)
 				if shouldFetchStats {
-					stats, err := s.fetchAssignmentStats(client, statusURL)
+					stats, err := s.fetchAssignmentStats(ctx, client, statusURL)
 					if err != nil {
 						result.Errors = append(result.Errors, fmt.Sprintf("[stats] %s: %v", statusURL, err))
+						event := progress(ProgressError, statusURL)
+						event.Err = err.Error()
+						s.emitProgress(event)
 					} else {
 						snap.Details = withStatsDetails(snap.Details, stats)
 					}
@@ -167,6 +221,11 @@ func (s *Service) RefreshNode(client *http.Client, st *state.State, targetURL st
 		if changed {
 			updatedNodeIDs[nodeID] = struct{}{}
 		}
+		if s.Progress != nil {
+			event := progress(ProgressPageFetched, canonicalURL)
+			event.Nodes = copyNodes(st, nodeID)
+			s.emitProgress(event)
+		}
 
 		if parentID != "" {
 			if edgeAdded(st, parentID, nodeID, now) {
@@ -248,6 +307,22 @@ func (s *Service) RefreshNode(client *http.Client, st *state.State, targetURL st
 		}
 		result.RemovedEdges += len(diff.Removed)
 
+		if remainingDepth > 0 {
+			for _, child := range snap.Children {
+				if childCanonical, cErr := state.CanonicalizeURL(child.URL); cErr == nil {
+					if _, seen := visited[childCanonical]; !seen {
+						queued[childCanonical] = struct{}{}
+					}
+				}
+			}
+		}
+		if s.Progress != nil {
+			event := progress(ProgressChildrenDiscovered, canonicalURL)
+			event.Children = len(children)
+			event.Nodes = copyNodes(st, append([]string{nodeID}, children...)...)
+			s.emitProgress(event)
+		}
+
 		if remainingDepth == 0 {
 			return
 		}
@@ -262,25 +337,81 @@ func (s *Service) RefreshNode(client *http.Client, st *state.State, targetURL st
 
 	walk(canonicalTarget, depth, "")
 	result.UpdatedNodes = len(updatedNodeIDs)
+	interrupted := ctx.Err()
 
-	if st.BaseURL == "" {
-		if base, err := state.CanonicalizeURL(strings.TrimRight(s.BaseURL, "/")); err == nil {
-			st.BaseURL = strings.TrimRight(base, "/")
+	if interrupted == nil {
+		if st.BaseURL == "" {
+			if base, err := state.CanonicalizeURL(strings.TrimRight(s.BaseURL, "/")); err == nil {
+				st.BaseURL = strings.TrimRight(base, "/")
+			}
+		}
+		if st.CatalogRootURL == "" {
+			st.CatalogRootURL = strings.TrimRight(s.BaseURL, "/") + "/course"
 		}
 	}
-	if st.CatalogRootURL == "" {
-		st.CatalogRootURL = strings.TrimRight(s.BaseURL, "/") + "/course"
+	if err := s.persist(st, updatedNodeIDs); err != nil {
+		return result, err
 	}
 
+	if interrupted != nil {
+		return result, fmt.Errorf("refresh %s interrupted: %w", canonicalTarget, interrupted)
+	}
+	if authErr != nil {
+		return result, fmt.Errorf("refresh %s: %w", canonicalTarget, authErr)
+	}
 	return result, nil
 }
 
-func (s *Service) fetchPageSnapshot(client *http.Client, pageURL string) (pageSnapshot, error) {
-	resp, err := client.Get(pageURL)
+// persist writes the nodes a refresh touched, the catalog URLs missing from
+// the store and the caller's OnPersist changes to s.Store in one Update, so a
+// refresh costs a single write (and a single backup). Nodes the refresh did
+// not touch are left as stored, so changes other processes made meanwhile
+// survive.
+func (s *Service) persist(st *state.State, nodeIDs map[string]struct{}) error {
+	if s.Store == nil {
+		return nil
+	}
+	ids := make([]string, 0, len(nodeIDs))
+	for id := range nodeIDs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	err := s.Store.Update(func(cur *state.State) (bool, error) {
+		changed := false
+		for _, id := range ids {
+			if node, ok := st.Nodes[id]; ok {
+				cur.Nodes[id] = node
+				changed = true
+			}
+		}
+		if cur.BaseURL == "" && st.BaseURL != "" {
+			cur.BaseURL = st.BaseURL
+			changed = true
+		}
+		if cur.CatalogRootURL == "" && st.CatalogRootURL != "" {
+			cur.CatalogRootURL = st.CatalogRootURL
+			changed = true
+		}
+		if s.OnPersist != nil && s.OnPersist(cur) {
+			changed = true
+		}
+		return changed, nil
+	})
+	if err != nil {
+		return fmt.Errorf("save refreshed nodes: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) fetchPageSnapshot(ctx context.Context, client *http.Client, pageURL string) (pageSnapshot, error) {
+	resp, err := httpGet(ctx, client, pageURL)
 	if err != nil {
 		return pageSnapshot{}, fmt.Errorf("fetch page: %w", err)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return pageSnapshot{}, fmt.Errorf("fetch page status %d: %w", resp.StatusCode, themis.ErrNotAuthenticated)
+	}
 	if resp.StatusCode >= http.StatusBadRequest {
 		return pageSnapshot{}, fmt.Errorf("fetch page status %d", resp.StatusCode)
 	}
@@ -293,6 +424,9 @@ func (s *Service) fetchPageSnapshot(client *http.Client, pageURL string) (pageSn
 	if err != nil {
 		return pageSnapshot{}, fmt.Errorf("parse page: %w", err)
 	}
+	if isLoginPage(resp, pageURL, doc) {
+		return pageSnapshot{}, fmt.Errorf("fetch page redirected to %s: %w", resp.Request.URL, themis.ErrNotAuthenticated)
+	}
 
 	canonical, err := state.CanonicalizeURL(pageURL)
 	if err != nil {
@@ -317,8 +451,8 @@ func (s *Service) fetchPageSnapshot(client *http.Client, pageURL string) (pageSn
 	}, nil
 }
 
-func (s *Service) fetchAssignmentStats(client *http.Client, statsURL string) (map[string]any, error) {
-	resp, err := client.Get(statsURL)
+func (s *Service) fetchAssignmentStats(ctx context.Context, client *http.Client, statsURL string) (map[string]any, error) {
+	resp, err := httpGet(ctx, client, statsURL)
 	if err != nil {
 		return nil, fmt.Errorf("fetch stats page: %w", err)
 	}
@@ -720,6 +854,9 @@ func extractDetails(doc *goquery.Document, canonicalURL string) map[string]any {
 	if desc := strings.TrimSpace(doc.Find("p.ass-description").First().Text()); desc != "" {
 		out["description"] = desc
 	}
+	if body := extractBodyMarkdown(doc, canonicalURL); body != "" {
+		out["body_markdown"] = body
+	}
 
 	return out
 }
@@ -2,12 +2,16 @@ package discovery
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
 	"themis-cli/internal/state"
+	"themis-cli/internal/themis"
 )
 
 type roundTripFunc func(*http.Request) (*http.Response, error)
@@ -204,6 +208,9 @@ func TestRefreshNode_ExtractsMetadata(t *testing.T) {
 	if node.Assets[2].Kind != "archive" {
 		t.Fatalf("unexpected archive asset kind: %#v", node.Assets[2])
 	}
+	if node.Details["body_markdown"] != "Course summary" {
+		t.Fatalf("unexpected body_markdown: %#v", node.Details["body_markdown"])
+	}
 }
 
 func TestRefreshNode_AssignmentStatsSummaryAndFallback(t *testing.T) {
@@ -373,6 +380,103 @@ func TestRefreshNode_DepthZeroFetchesDerivedStatsForTargetAssignment(t *testing.
 	}
 }
 
+func TestRefreshNodeContext_StopsFetchingWhenCancelled(t *testing.T) {
+	base := "https://themis.housing.rug.nl"
+	course := base + "/course/2025-2026/os"
+	first := course + "/lab1"
+	second := course + "/lab2"
+
+	pages := map[string]string{
+		course: `<html><body>
+		<div class="subsec round shade ass-children"><ul class="round">
+		<li><span class="ass-link"><a href="/course/2025-2026/os/lab1">Lab 1</a></span></li>
+		<li><span class="ass-link"><a href="/course/2025-2026/os/lab2">Lab 2</a></span></li>
+		</ul></div>
+		</body></html>`,
+		first:  `<html><body></body></html>`,
+		second: `<html><body></body></html>`,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hits := map[string]int{}
+	inner := testClientFromMap(t, pages, hits)
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.String() == first {
+			cancel()
+		}
+		return inner.Transport.RoundTrip(req)
+	})}
+
+	st := state.NewEmptyState()
+	result, err := NewService(base).RefreshNodeContext(ctx, client, &st, course, 1)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	courseID, _, _ := state.NodeIDFromURL(course)
+	if got := st.Nodes[courseID]; got.Status != state.StatusOK || len(got.ChildIDs) != 2 {
+		t.Fatalf("expected the page fetched before cancellation to be kept, got %+v", got)
+	}
+	if result.UpdatedNodes == 0 {
+		t.Fatalf("expected interrupted refresh to count updated nodes")
+	}
+	if hits[second] != 0 {
+		t.Fatalf("expected no fetch after cancellation, got %d", hits[second])
+	}
+	secondID, _, _ := state.NodeIDFromURL(second)
+	if st.Nodes[secondID].Status == state.StatusError {
+		t.Fatalf("cancelled fetch must not be recorded as a node error")
+	}
+}
+
+func TestRefreshNode_EmitsProgress(t *testing.T) {
+	base := "https://themis.housing.rug.nl"
+	course := base + "/course/2025-2026/os"
+	first := course + "/lab1"
+	second := course + "/lab2"
+
+	pages := map[string]string{
+		course: `<html><body>
+		<div class="subsec round shade ass-children"><ul class="round">
+		<li><span class="ass-link"><a href="/course/2025-2026/os/lab1">Lab 1</a></span></li>
+		<li><span class="ass-link"><a href="/course/2025-2026/os/lab2">Lab 2</a></span></li>
+		</ul></div>
+		</body></html>`,
+		first: `<html><body></body></html>`,
+	}
+
+	events := []ProgressEvent{}
+	service := NewService(base)
+	service.Progress = func(e ProgressEvent) { events = append(events, e) }
+	st := state.NewEmptyState()
+	if _, err := service.RefreshNode(testClientFromMap(t, pages, map[string]int{}), &st, course, 1); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+
+	kinds := make([]string, 0, len(events))
+	for _, e := range events {
+		kinds = append(kinds, string(e.Kind))
+	}
+	want := "page_started page_fetched children_discovered page_started page_fetched children_discovered page_started error"
+	if got := strings.Join(kinds, " "); got != want {
+		t.Fatalf("unexpected events:\n got %s\nwant %s", got, want)
+	}
+	children := events[2]
+	if children.Children != 2 || children.Queued != 2 || len(children.Nodes) != 3 {
+		t.Fatalf("unexpected children event: %+v", children)
+	}
+	if children.Nodes[0].Status != state.StatusOK || len(children.Nodes[0].ChildIDs) != 2 {
+		t.Fatalf("expected event to carry the refreshed course node, got %+v", children.Nodes[0])
+	}
+	last := events[len(events)-1]
+	if last.URL != second || last.Err == "" || last.Fetched != 2 || last.Queued != 0 || last.Errors != 1 {
+		t.Fatalf("unexpected error event: %+v", last)
+	}
+	if last.Nodes[0].Status != state.StatusError {
+		t.Fatalf("expected error event to carry the failed node")
+	}
+}
+
 func contains(list []string, target string) bool {
 	for _, v := range list {
 		if v == target {
@@ -381,3 +485,120 @@ func contains(list []string, target string) bool {
 	}
 	return false
 }
+
+func TestRefreshNode_StorePersistsTouchedNodesOnly(t *testing.T) {
+	base := "https://themis.housing.rug.nl"
+	course := base + "/course/2025-2026/os"
+	lab := course + "/lab1"
+	pages := map[string]string{
+		course: `<html><body>
+		<div class="subsec round shade ass-children"><ul class="round">
+		<li><span class="ass-link"><a href="/course/2025-2026/os/lab1">Lab 1</a></span></li>
+		</ul></div>
+		</body></html>`,
+		lab: `<html><body></body></html>`,
+	}
+
+	statePath := t.TempDir() + "/state.json"
+	store, err := state.OpenStore(state.BackendJSON, statePath, state.StoreOptions{})
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	otherID, otherURL, _ := state.NodeIDFromURL(base + "/course/2025-2026/other")
+	other := state.Node{
+		ID:           otherID,
+		CanonicalURL: otherURL,
+		Title:        "Written elsewhere",
+		Status:       state.StatusOK,
+		ParentIDs:    []string{},
+		ChildIDs:     []string{},
+	}
+	if err := store.UpsertNodes([]state.Node{other}); err != nil {
+		t.Fatalf("seed store: %v", err)
+	}
+
+	// The refresh starts from a state that predates the other writer.
+	st := state.NewEmptyState()
+	service := NewService(base)
+	service.Store = store
+	hookCalls := 0
+	service.OnPersist = func(cur *state.State) bool {
+		hookCalls++
+		cur.Roots = append(cur.Roots, state.RootRef{CanonicalURL: course})
+		return true
+	}
+	if _, err := service.RefreshNode(testClientFromMap(t, pages, map[string]int{}), &st, course, 1); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if hookCalls != 1 {
+		t.Fatalf("expected OnPersist to run once, got %d", hookCalls)
+	}
+	// The seed created the file; the refresh must replace it exactly once.
+	backups, err := state.ListBackups(statePath)
+	if err != nil {
+		t.Fatalf("list backups: %v", err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("expected a single write for the refresh, got %d backups", len(backups))
+	}
+
+	stored, err := store.Load()
+	if err != nil {
+		t.Fatalf("load store: %v", err)
+	}
+	if got, ok := stored.Nodes[other.ID]; !ok || got.Title != other.Title {
+		t.Fatalf("expected the untouched node to survive, got %+v", got)
+	}
+	courseID, _, _ := state.NodeIDFromURL(course)
+	labID, _, _ := state.NodeIDFromURL(lab)
+	if got := stored.Nodes[courseID]; got.Status != state.StatusOK || len(got.ChildIDs) != 1 || got.ChildIDs[0] != labID {
+		t.Fatalf("expected the refreshed course to be stored, got %+v", got)
+	}
+	if _, ok := stored.Nodes[labID]; !ok {
+		t.Fatalf("expected the refreshed child to be stored")
+	}
+	if stored.CatalogRootURL != base+"/course" || stored.BaseURL == "" {
+		t.Fatalf("expected catalog metadata to be stored, got %q %q", stored.BaseURL, stored.CatalogRootURL)
+	}
+	if len(stored.Roots) != 1 || stored.Roots[0].CanonicalURL != course {
+		t.Fatalf("expected the OnPersist change in the same write, got %+v", stored.Roots)
+	}
+}
+
+func TestRefreshNode_UnauthenticatedPageStopsWithErrNotAuthenticated(t *testing.T) {
+	course := "/course/2025-2026/os"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case course:
+			_, _ = w.Write([]byte(`<html><body>
+			<div class="subsec round shade ass-children"><ul class="round">
+			<li><span class="ass-link"><a href="/course/2025-2026/os/lab1">Lab 1</a></span></li>
+			<li><span class="ass-link"><a href="/course/2025-2026/os/lab2">Lab 2</a></span></li>
+			</ul></div>
+			</body></html>`))
+		case course + "/lab1":
+			http.Redirect(w, r, "/log/in", http.StatusFound)
+		case "/log/in":
+			_, _ = w.Write([]byte(`<html><body><form method="post"><input name="user"><input type="password" name="password"></form></body></html>`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	for name, target := range map[string]string{"forbidden": course + "/lab2", "login redirect": course} {
+		st := state.NewEmptyState()
+		result, err := NewService(server.URL).RefreshNode(server.Client(), &st, server.URL+target, 1)
+		if !errors.Is(err, themis.ErrNotAuthenticated) {
+			t.Fatalf("%s: expected ErrNotAuthenticated, got %v", name, err)
+		}
+		if len(result.Errors) != 0 {
+			t.Fatalf("%s: a login failure must not be recorded as a page error, got %v", name, result.Errors)
+		}
+		for id, node := range st.Nodes {
+			if node.Status == state.StatusError {
+				t.Fatalf("%s: node %s marked as failed", name, id)
+			}
+		}
+	}
+}
@@ -1,12 +1,15 @@
 package discovery
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"themis-cli/internal/themis"
 )
 
 type TestCase struct {
@@ -40,6 +43,11 @@ func ListTestCases(client *http.Client, testsURL string) (string, []TestCase, er
 }
 
 func ListTestCasesWithOptions(client *http.Client, testsURL string, options ListOptions) (string, []TestCase, error) {
+	return ListTestCasesContext(context.Background(), client, testsURL, options)
+}
+
+// ListTestCasesContext is ListTestCasesWithOptions bound to ctx.
+func ListTestCasesContext(ctx context.Context, client *http.Client, testsURL string, options ListOptions) (string, []TestCase, error) {
 	if options.Start < 1 {
 		return "", nil, fmt.Errorf("--start must be >= 1")
 	}
@@ -64,11 +72,11 @@ func ListTestCasesWithOptions(client *http.Client, testsURL string, options List
 		inURL := fmt.Sprintf("%s/%d.in", baseTestsURL, current)
 		outURL := fmt.Sprintf("%s/%d.out", baseTestsURL, current)
 
-		inExists, err := rawFileExists(client, inURL)
+		inExists, err := rawFileExists(ctx, client, inURL)
 		if err != nil {
 			return "", nil, err
 		}
-		outExists, err := rawFileExists(client, outURL)
+		outExists, err := rawFileExists(ctx, client, outURL)
 		if err != nil {
 			return "", nil, err
 		}
@@ -92,7 +100,12 @@ func ListTestCasesWithOptions(client *http.Client, testsURL string, options List
 }
 
 func FetchTestCases(client *http.Client, testsURL string, targetDir string) (string, []DownloadedTestCase, error) {
-	baseTestsURL, testCases, err := ListTestCases(client, testsURL)
+	return FetchTestCasesContext(context.Background(), client, testsURL, targetDir)
+}
+
+// FetchTestCasesContext is FetchTestCases bound to ctx.
+func FetchTestCasesContext(ctx context.Context, client *http.Client, testsURL string, targetDir string) (string, []DownloadedTestCase, error) {
+	baseTestsURL, testCases, err := ListTestCasesContext(ctx, client, testsURL, defaultListOptions())
 	if err != nil {
 		return "", nil, err
 	}
@@ -106,11 +119,11 @@ func FetchTestCases(client *http.Client, testsURL string, targetDir string) (str
 		inRawURL := tc.InURL + "?raw=true"
 		outRawURL := tc.OutURL + "?raw=true"
 
-		inBytes, err := downloadRawFile(client, inRawURL)
+		inBytes, err := downloadRawFile(ctx, client, inRawURL)
 		if err != nil {
 			return "", nil, fmt.Errorf("failed downloading %s: %w", tc.InURL, err)
 		}
-		outBytes, err := downloadRawFile(client, outRawURL)
+		outBytes, err := downloadRawFile(ctx, client, outRawURL)
 		if err != nil {
 			return "", nil, fmt.Errorf("failed downloading %s: %w", tc.OutURL, err)
 		}
@@ -142,8 +155,8 @@ func ListTestNumbers(testCases []TestCase) []int {
 	return numbers
 }
 
-func rawFileExists(client *http.Client, fileURL string) (bool, error) {
-	body, statusCode, err := getRawFile(client, fileURL+"?raw=true")
+func rawFileExists(ctx context.Context, client *http.Client, fileURL string) (bool, error) {
+	body, statusCode, err := getRawFile(ctx, client, fileURL+"?raw=true")
 	if err != nil {
 		return false, err
 	}
@@ -162,22 +175,26 @@ func rawFileExists(client *http.Client, fileURL string) (bool, error) {
 	return true, nil
 }
 
-func downloadRawFile(client *http.Client, rawURL string) ([]byte, error) {
-	body, statusCode, err := getRawFile(client, rawURL)
+func downloadRawFile(ctx context.Context, client *http.Client, rawURL string) ([]byte, error) {
+	body, statusCode, err := getRawFile(ctx, client, rawURL)
 	if err != nil {
 		return nil, err
 	}
+	if statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("request failed with status %d: %w", statusCode, themis.ErrNotAuthenticated)
+	}
 	if statusCode >= http.StatusBadRequest {
 		return nil, fmt.Errorf("request failed with status %d", statusCode)
 	}
 	if isHTMLDocument(body) {
-		return nil, fmt.Errorf("received HTML instead of raw test file")
+		// An expired login redirects raw file URLs to the HTML login page.
+		return nil, fmt.Errorf("received HTML instead of raw test file: %w", themis.ErrNotAuthenticated)
 	}
 	return body, nil
 }
 
-func getRawFile(client *http.Client, rawURL string) ([]byte, int, error) {
-	resp, err := client.Get(rawURL)
+func getRawFile(ctx context.Context, client *http.Client, rawURL string) ([]byte, int, error) {
+	resp, err := httpGet(ctx, client, rawURL)
 	if err != nil {
 		return nil, 0, fmt.Errorf("error fetching %s: %w", rawURL, err)
 	}
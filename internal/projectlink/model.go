@@ -1,13 +1,22 @@
 package projectlink
 
-import "time"
+import (
+	"time"
+
+	"themis-cli/internal/state"
+)
 
 const CurrentSchemaVersion = 1
 
 type Preferences struct {
-	DefaultRefreshDepth          int  `json:"default_refresh_depth"`
-	AutoRefreshOnOpen            bool `json:"auto_refresh_on_open"`
-	ShowStaleWarningAfterMinutes int  `json:"show_stale_warning_after_minutes"`
+	DefaultRefreshDepth int  `json:"default_refresh_depth"`
+	AutoRefreshOnOpen   bool `json:"auto_refresh_on_open"`
+	// ShowStaleWarningAfterMinutes is the default stale TTL; 0 inherits it
+	// from the layer below (the user profile, then the built-in default).
+	ShowStaleWarningAfterMinutes int `json:"show_stale_warning_after_minutes,omitempty"`
+	// StaleAfterMinutesByKind overrides ShowStaleWarningAfterMinutes for
+	// individual node kinds (catalog, year, course, assignment).
+	StaleAfterMinutesByKind map[string]int `json:"stale_after_minutes_by_kind,omitempty"`
 }
 
 type Config struct {
@@ -19,26 +28,44 @@ type Config struct {
 	LastDownloadDir    string              `json:"last_download_dir,omitempty"`
 	RecentAssetChoices map[string][]string `json:"recent_asset_choices,omitempty"`
 	Preferences        Preferences         `json:"preferences"`
-	UpdatedAt          time.Time           `json:"updated_at"`
+	// TUISession is the tree view saved when the TUI exits; the selected
+	// node is LastOpenNodeID.
+	TUISession *TUISession `json:"tui_session,omitempty"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+	// Migrations records schema upgrades applied to this file, oldest first.
+	Migrations []state.AppliedMigration `json:"migrations,omitempty"`
+}
+
+type TUISession struct {
+	ExpandedNodeIDs []string `json:"expanded_node_ids,omitempty"`
+	ScrollOffset    int      `json:"scroll_offset,omitempty"`
+}
+
+// configMigrations is the registry for project.json, ordered by From.
+var configMigrations = []state.Migration{
+	{
+		From: 0,
+		To:   1,
+		Name: "initial-schema",
+		Apply: func(doc map[string]any) error {
+			if _, ok := doc["preferences"].(map[string]any); !ok {
+				doc["preferences"] = map[string]any{}
+			}
+			return nil
+		},
+	},
 }
 
 func DefaultPreferences() Preferences {
 	return Preferences{
-		DefaultRefreshDepth:          1,
-		AutoRefreshOnOpen:            false,
-		ShowStaleWarningAfterMinutes: 120,
+		DefaultRefreshDepth: 1,
+		AutoRefreshOnOpen:   false,
 	}
 }
 
 func applyDefaults(cfg *Config) {
-	if cfg.SchemaVersion == 0 {
-		cfg.SchemaVersion = CurrentSchemaVersion
-	}
 	defaults := DefaultPreferences()
 	if cfg.Preferences.DefaultRefreshDepth <= 0 {
 		cfg.Preferences.DefaultRefreshDepth = defaults.DefaultRefreshDepth
 	}
-	if cfg.Preferences.ShowStaleWarningAfterMinutes <= 0 {
-		cfg.Preferences.ShowStaleWarningAfterMinutes = defaults.ShowStaleWarningAfterMinutes
-	}
 }
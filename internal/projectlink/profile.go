@@ -0,0 +1,131 @@
+package projectlink
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"themis-cli/internal/state"
+)
+
+const profileFileName = "profile.json"
+
+// Profile holds per-user preferences shared by every project. Values left at
+// zero fall through to the built-in defaults; a linked project's preferences
+// take precedence over the profile.
+type Profile struct {
+	Preferences Preferences `json:"preferences"`
+	Keys        KeyBindings `json:"keys"`
+}
+
+// KeyBindings customises the TUI keys: a profile (default, vim or arrows)
+// and per-action overrides such as {"refresh_full": ["F"]}. An empty list
+// unbinds the action. Action names are checked when the TUI starts.
+type KeyBindings struct {
+	Profile  string              `json:"profile,omitempty"`
+	Bindings map[string][]string `json:"bindings,omitempty"`
+}
+
+// DefaultProfilePath is ~/.config/themis/profile.json, next to the state file.
+func DefaultProfilePath() (string, error) {
+	statePath, err := state.DefaultStatePath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(statePath), profileFileName), nil
+}
+
+// LoadProfile reads the profile at path; a missing file is an empty profile.
+func LoadProfile(path string) (Profile, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Profile{}, nil
+		}
+		return Profile{}, fmt.Errorf("read profile: %w", err)
+	}
+	var profile Profile
+	if err := json.Unmarshal(raw, &profile); err != nil {
+		return Profile{}, fmt.Errorf("decode profile %s: %w", path, err)
+	}
+	if err := validateStaleKinds(profile.Preferences.StaleAfterMinutesByKind); err != nil {
+		return Profile{}, fmt.Errorf("profile %s: %w", path, err)
+	}
+	return profile, nil
+}
+
+// ResolveStalePolicy layers the built-in defaults, the user profile and the
+// linked project (nil when not linked), later layers winning per kind.
+func ResolveStalePolicy(profile Profile, project *Config) state.StalePolicy {
+	policy := state.DefaultStalePolicy()
+	overlayStalePreferences(&policy, profile.Preferences)
+	if project != nil {
+		overlayStalePreferences(&policy, project.Preferences)
+	}
+	return policy
+}
+
+func overlayStalePreferences(policy *state.StalePolicy, prefs Preferences) {
+	if prefs.ShowStaleWarningAfterMinutes > 0 {
+		policy.Default = time.Duration(prefs.ShowStaleWarningAfterMinutes) * time.Minute
+	}
+	for kind, minutes := range prefs.StaleAfterMinutesByKind {
+		if minutes > 0 {
+			policy.ByKind[kind] = time.Duration(minutes) * time.Minute
+		}
+	}
+}
+
+// ParseStaleTTLs parses "kind=duration[,kind=duration...]" (for example
+// "course=24h,assignment=30m") into whole minutes per kind.
+func ParseStaleTTLs(spec string) (map[string]int, error) {
+	out := map[string]int{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kind, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("stale ttl %q: want kind=duration", part)
+		}
+		kind = strings.ToLower(strings.TrimSpace(kind))
+		ttl, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("stale ttl for %s: %w", kind, err)
+		}
+		if ttl < time.Minute {
+			return nil, fmt.Errorf("stale ttl for %s must be at least 1m", kind)
+		}
+		out[kind] = int(ttl / time.Minute)
+	}
+	if err := validateStaleKinds(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func validateStaleKinds(byKind map[string]int) error {
+	unknown := make([]string, 0)
+	for kind := range byKind {
+		known := false
+		for _, k := range state.NodeKinds {
+			if kind == k {
+				known = true
+				break
+			}
+		}
+		if !known {
+			unknown = append(unknown, kind)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("unknown node kind(s) %s in stale ttls (want %s)", strings.Join(unknown, ", "), strings.Join(state.NodeKinds, ", "))
+}
@@ -0,0 +1,98 @@
+package projectlink
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadProfile_MissingIsEmpty(t *testing.T) {
+	profile, err := LoadProfile(filepath.Join(t.TempDir(), "profile.json"))
+	if err != nil {
+		t.Fatalf("load missing profile failed: %v", err)
+	}
+	if profile.Preferences.ShowStaleWarningAfterMinutes != 0 || len(profile.Preferences.StaleAfterMinutesByKind) != 0 {
+		t.Fatalf("expected empty profile, got %#v", profile)
+	}
+}
+
+func TestLoadProfile_RejectsUnknownKind(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profile.json")
+	raw := `{"preferences":{"stale_after_minutes_by_kind":{"semester":60}}}`
+	if err := os.WriteFile(path, []byte(raw), 0o644); err != nil {
+		t.Fatalf("write profile: %v", err)
+	}
+	if _, err := LoadProfile(path); err == nil || !strings.Contains(err.Error(), "semester") {
+		t.Fatalf("expected unknown kind error, got %v", err)
+	}
+}
+
+func TestResolveStalePolicy_Layers(t *testing.T) {
+	profile := Profile{Preferences: Preferences{
+		ShowStaleWarningAfterMinutes: 30,
+		StaleAfterMinutesByKind:      map[string]int{"course": 600, "year": 1440},
+	}}
+
+	policy := ResolveStalePolicy(profile, nil)
+	if policy.Default != 30*time.Minute || policy.TTL("course") != 10*time.Hour || policy.TTL("assignment") != 30*time.Minute {
+		t.Fatalf("unexpected profile-only policy: %#v", policy)
+	}
+
+	project := &Config{Preferences: Preferences{
+		ShowStaleWarningAfterMinutes: 90,
+		StaleAfterMinutesByKind:      map[string]int{"course": 60},
+	}}
+	policy = ResolveStalePolicy(profile, project)
+	if policy.Default != 90*time.Minute {
+		t.Fatalf("project default should win, got %s", policy.Default)
+	}
+	if policy.TTL("course") != time.Hour {
+		t.Fatalf("project course ttl should win, got %s", policy.TTL("course"))
+	}
+	if policy.TTL("year") != 24*time.Hour {
+		t.Fatalf("profile year ttl should remain, got %s", policy.TTL("year"))
+	}
+}
+
+func TestParseStaleTTLs(t *testing.T) {
+	got, err := ParseStaleTTLs("course=24h, assignment=30m")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if got["course"] != 1440 || got["assignment"] != 30 || len(got) != 2 {
+		t.Fatalf("unexpected ttls: %#v", got)
+	}
+	for _, bad := range []string{"course", "course=soon", "course=10s", "module=1h"} {
+		if _, err := ParseStaleTTLs(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadProfile_KeyBindings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profile.json")
+	raw := `{"keys":{"profile":"vim","bindings":{"refresh_full":["F"],"toggle":[]}}}`
+	if err := os.WriteFile(path, []byte(raw), 0o644); err != nil {
+		t.Fatalf("write profile: %v", err)
+	}
+	profile, err := LoadProfile(path)
+	if err != nil {
+		t.Fatalf("load profile failed: %v", err)
+	}
+	if profile.Keys.Profile != "vim" || len(profile.Keys.Bindings["refresh_full"]) != 1 || profile.Keys.Bindings["refresh_full"][0] != "F" {
+		t.Fatalf("unexpected keys: %#v", profile.Keys)
+	}
+	if bindings, ok := profile.Keys.Bindings["toggle"]; !ok || len(bindings) != 0 {
+		t.Fatalf("expected an empty toggle list, got %#v", profile.Keys.Bindings)
+	}
+}
+
+func TestResolveStalePolicy_UnsetProjectDefaultInheritsProfile(t *testing.T) {
+	profile := Profile{Preferences: Preferences{ShowStaleWarningAfterMinutes: 30}}
+	project := &Config{Preferences: DefaultPreferences()}
+	if policy := ResolveStalePolicy(profile, project); policy.Default != 30*time.Minute {
+		t.Fatalf("project without a stale default should inherit the profile's, got %s", policy.Default)
+	}
+}
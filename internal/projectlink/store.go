@@ -81,20 +81,57 @@ func Save(path string, cfg Config) error {
 }
 
 func Load(path string) (Config, error) {
-	file, err := os.Open(path)
+	raw, err := os.ReadFile(path)
 	if err != nil {
 		return Config{}, err
 	}
-	defer file.Close()
 
 	var cfg Config
-	if err := json.NewDecoder(file).Decode(&cfg); err != nil {
+	if _, err := state.DecodeMigrated(raw, CurrentSchemaVersion, configMigrations, time.Now(), &cfg); err != nil {
+		if errors.Is(err, state.ErrSchemaTooNew) {
+			return Config{}, fmt.Errorf("load %s: %w", path, err)
+		}
 		return Config{}, fmt.Errorf("decode project config: %w", err)
 	}
 	applyDefaults(&cfg)
 	return cfg, nil
 }
 
+// PlanMigrations reports the steps Load would apply to the config at path.
+func PlanMigrations(path string) (state.MigrationPlan, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return state.MigrationPlan{}, err
+	}
+	var header struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return state.MigrationPlan{}, fmt.Errorf("decode project config: %w", err)
+	}
+	return state.PlanMigrations(header.SchemaVersion, CurrentSchemaVersion, configMigrations)
+}
+
+// MigrateFile applies pending migrations to the config at path and saves it.
+func MigrateFile(path string) ([]state.AppliedMigration, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	applied, err := state.DecodeMigrated(raw, CurrentSchemaVersion, configMigrations, time.Now(), &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("migrate project config: %w", err)
+	}
+	if len(applied) == 0 {
+		return nil, nil
+	}
+	if err := Save(path, cfg); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
 func ResolveByCWD(cwd string) (Config, string, error) {
 	abs, err := filepath.Abs(cwd)
 	if err != nil {
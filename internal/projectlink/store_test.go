@@ -19,6 +19,8 @@ func TestSaveLoadRoundTrip(t *testing.T) {
 			AutoRefreshOnOpen:            true,
 			ShowStaleWarningAfterMinutes: 60,
 		},
+		LastOpenNodeID: "url:lab1",
+		TUISession:     &TUISession{ExpandedNodeIDs: []string{"url:root"}, ScrollOffset: 3},
 	}
 	if err := Save(path, in); err != nil {
 		t.Fatalf("save failed: %v", err)
@@ -44,6 +46,9 @@ func TestSaveLoadRoundTrip(t *testing.T) {
 	if out.Preferences.DefaultRefreshDepth != 2 || !out.Preferences.AutoRefreshOnOpen || out.Preferences.ShowStaleWarningAfterMinutes != 60 {
 		t.Fatalf("preferences mismatch: %#v", out.Preferences)
 	}
+	if out.LastOpenNodeID != "url:lab1" || out.TUISession == nil || out.TUISession.ScrollOffset != 3 || len(out.TUISession.ExpandedNodeIDs) != 1 {
+		t.Fatalf("tui session mismatch: %q %#v", out.LastOpenNodeID, out.TUISession)
+	}
 	if out.UpdatedAt.IsZero() {
 		t.Fatalf("expected updated_at to be set")
 	}
@@ -109,7 +114,44 @@ func TestLoad_AppliesDefaultPreferences(t *testing.T) {
 	if cfg.Preferences.DefaultRefreshDepth != 1 {
 		t.Fatalf("default refresh depth mismatch: %d", cfg.Preferences.DefaultRefreshDepth)
 	}
-	if cfg.Preferences.ShowStaleWarningAfterMinutes != 120 {
-		t.Fatalf("default stale warning mismatch: %d", cfg.Preferences.ShowStaleWarningAfterMinutes)
+	if cfg.Preferences.ShowStaleWarningAfterMinutes != 0 {
+		t.Fatalf("unset stale warning should inherit, got %d", cfg.Preferences.ShowStaleWarningAfterMinutes)
+	}
+}
+
+func TestLoad_MigratesUnversionedConfig(t *testing.T) {
+	path := ConfigPathFromRepoRoot(t.TempDir())
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	raw := `{"base_url":"https://themis.housing.rug.nl","linked_root_url":"https://themis.housing.rug.nl/course/2025-2026/os"}`
+	if err := os.WriteFile(path, []byte(raw), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := PlanMigrations(path)
+	if err != nil || !plan.Pending() {
+		t.Fatalf("expected pending migration: %#v %v", plan, err)
+	}
+	applied, err := MigrateFile(path)
+	if err != nil || len(applied) != 1 {
+		t.Fatalf("migrate failed: %#v %v", applied, err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if cfg.SchemaVersion != CurrentSchemaVersion || len(cfg.Migrations) != 1 {
+		t.Fatalf("expected recorded migration: %#v", cfg)
+	}
+	if cfg.Preferences.DefaultRefreshDepth != DefaultPreferences().DefaultRefreshDepth {
+		t.Fatalf("expected default preferences, got %#v", cfg.Preferences)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"schema_version":42}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Fatalf("expected newer schema to be rejected")
 	}
 }
@@ -0,0 +1,118 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"themis-cli/internal/state"
+)
+
+// DefaultFields is the projection used when none is given.
+var DefaultFields = []string{"title", "kind", "status", "result", "due", "url"}
+
+// Fields lists every projectable field in display order.
+var Fields = []string{
+	"id", "title", "kind", "status", "result", "url", "parent_url",
+	"depth", "due", "age", "assets", "children", "last_success_at", "updated_at",
+}
+
+// ParseFields splits a comma-separated projection and validates each name.
+// An empty spec returns DefaultFields.
+func ParseFields(spec string) ([]string, error) {
+	if strings.TrimSpace(spec) == "" {
+		return append([]string{}, DefaultFields...), nil
+	}
+	known := map[string]bool{}
+	for _, f := range Fields {
+		known[f] = true
+	}
+	out := make([]string, 0)
+	for _, part := range strings.Split(spec, ",") {
+		name := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(part)), "-", "_")
+		if name == "" {
+			continue
+		}
+		if !known[name] {
+			return nil, fmt.Errorf("unknown field %q (known: %s)", name, strings.Join(Fields, ", "))
+		}
+		out = append(out, name)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no fields selected")
+	}
+	return out, nil
+}
+
+// Value returns the field for JSON output; timestamps are RFC3339 strings and
+// absent optional values are nil.
+func (r Row) Value(field string) any {
+	switch field {
+	case "id":
+		return r.Node.ID
+	case "title":
+		return r.Node.Title
+	case "kind":
+		return r.Node.Kind
+	case "status":
+		return string(r.Node.Status)
+	case "result":
+		return r.Result
+	case "url":
+		return r.Node.CanonicalURL
+	case "parent_url":
+		return r.ParentURL
+	case "depth":
+		return r.Depth
+	case "due":
+		return formatTimePtr(r.Due)
+	case "age":
+		if r.Age == nil {
+			return nil
+		}
+		return int64(*r.Age / time.Second)
+	case "assets":
+		return len(r.Node.Assets)
+	case "children":
+		return len(r.Node.ChildIDs)
+	case "last_success_at":
+		return formatTimePtr(r.Node.LastSuccessAt)
+	case "updated_at":
+		return formatTimePtr(&r.Node.UpdatedAt)
+	}
+	return nil
+}
+
+// Text returns the field as a table cell.
+func (r Row) Text(field string) string {
+	if field == "age" && r.Age != nil {
+		return state.FormatAge(*r.Age)
+	}
+	switch v := r.Value(field).(type) {
+	case nil:
+		return "-"
+	case string:
+		if v == "" {
+			return "-"
+		}
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Project returns the selected fields of r keyed by name.
+func (r Row) Project(fields []string) map[string]any {
+	out := make(map[string]any, len(fields))
+	for _, f := range fields {
+		out[f] = r.Value(f)
+	}
+	return out
+}
+
+func formatTimePtr(t *time.Time) any {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
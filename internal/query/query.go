@@ -0,0 +1,598 @@
+// Package query filters and projects the cached state graph without touching
+// the network.
+//
+// An expression is a list of predicates joined by `and` (also implied between
+// adjacent predicates), `or` and `not`, with parentheses for grouping:
+//
+//	kind=assignment and result!=passed and due<+7d
+//	(status=error or status=stale) and under=https://themis.housing.rug.nl/course/2024-2025/os
+//	title~"^Lab [0-9]+" has_assets depth<=3
+//
+// String fields (id, url, kind, status, title, result) support = and != (case
+// insensitive) and ~ / !~ (Go regular expressions). Numeric fields (depth,
+// assets, children) and due support = != < <= > >=; due accepts a date, an
+// RFC3339 timestamp, `now`, or an offset from now such as +7d or -12h. under
+// matches strict descendants of a URL. has_assets and has_due are flags.
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"themis-cli/internal/state"
+)
+
+// Row is one node matched by a query.
+type Row struct {
+	Node      state.Node
+	Depth     int
+	ParentURL string
+	Result    string
+	Due       *time.Time
+	// Age is the time since the last successful fetch, nil if never fetched.
+	Age *time.Duration
+}
+
+// Options controls Run.
+type Options struct {
+	// Expr is the filter expression; empty matches every node.
+	Expr string
+	// RootID starts the walk at this node instead of the tracked roots.
+	RootID string
+	// Now anchors relative due dates and node ages; zero means time.Now().
+	Now time.Time
+	// StalePolicy, when set, re-evaluates staleness before filtering so
+	// status:stale follows the configured TTLs. st is not modified.
+	StalePolicy *state.StalePolicy
+}
+
+// Run walks st breadth-first from the start nodes, in child order, and returns
+// the nodes matching opts.Expr. Depth is the distance from the start node.
+func Run(st state.State, opts Options) ([]Row, error) {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	expr, err := Parse(opts.Expr, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.StalePolicy != nil {
+		nodes := make(map[string]state.Node, len(st.Nodes))
+		for id, node := range st.Nodes {
+			nodes[id] = node
+		}
+		st.Nodes = nodes
+		if _, err := state.ApplyStalePolicyByKind(&st, now, *opts.StalePolicy); err != nil {
+			return nil, err
+		}
+	}
+
+	starts, err := startIDs(st, opts.RootID)
+	if err != nil {
+		return nil, err
+	}
+	ctx := &evalContext{st: st, subtrees: map[string]map[string]bool{}}
+
+	rows := make([]Row, 0)
+	seen := map[string]bool{}
+	type item struct {
+		id        string
+		depth     int
+		parentURL string
+	}
+	queue := make([]item, 0, len(starts))
+	for _, id := range starts {
+		queue = append(queue, item{id: id})
+	}
+	for len(queue) > 0 {
+		it := queue[0]
+		queue = queue[1:]
+		if seen[it.id] {
+			continue
+		}
+		node, ok := st.Nodes[it.id]
+		if !ok {
+			continue
+		}
+		seen[it.id] = true
+
+		row := Row{Node: node, Depth: it.depth, ParentURL: it.parentURL, Result: state.ResultLabel(node)}
+		if due, ok := state.DueAt(node); ok {
+			row.Due = &due
+		}
+		if age, ok := state.NodeAge(node, now); ok {
+			row.Age = &age
+		}
+		if expr == nil || expr.eval(ctx, row) {
+			rows = append(rows, row)
+		}
+		for _, childID := range node.ChildIDs {
+			if !seen[childID] {
+				queue = append(queue, item{id: childID, depth: it.depth + 1, parentURL: node.CanonicalURL})
+			}
+		}
+	}
+	return rows, nil
+}
+
+func startIDs(st state.State, rootID string) ([]string, error) {
+	if rootID != "" {
+		if _, ok := st.Nodes[rootID]; !ok {
+			return nil, fmt.Errorf("root %s is not in local state", rootID)
+		}
+		return []string{rootID}, nil
+	}
+	ids := make([]string, 0, len(st.Roots)+1)
+	for _, root := range st.Roots {
+		ids = append(ids, root.NodeID)
+	}
+	if st.CatalogRootURL != "" {
+		if id, _, err := state.NodeIDFromURL(st.CatalogRootURL); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		for id, node := range st.Nodes {
+			if len(node.ParentIDs) == 0 {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+type evalContext struct {
+	st       state.State
+	subtrees map[string]map[string]bool
+}
+
+// descendants returns the strict descendants of id, cached per query run.
+func (c *evalContext) descendants(id string) map[string]bool {
+	if out, ok := c.subtrees[id]; ok {
+		return out
+	}
+	out := map[string]bool{}
+	queue := append([]string{}, c.st.Nodes[id].ChildIDs...)
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		if out[next] || next == id {
+			continue
+		}
+		node, ok := c.st.Nodes[next]
+		if !ok {
+			continue
+		}
+		out[next] = true
+		queue = append(queue, node.ChildIDs...)
+	}
+	c.subtrees[id] = out
+	return out
+}
+
+// Expr is a parsed query expression.
+type Expr interface {
+	eval(ctx *evalContext, row Row) bool
+}
+
+type andExpr struct{ left, right Expr }
+type orExpr struct{ left, right Expr }
+type notExpr struct{ inner Expr }
+
+func (e andExpr) eval(ctx *evalContext, row Row) bool {
+	return e.left.eval(ctx, row) && e.right.eval(ctx, row)
+}
+func (e orExpr) eval(ctx *evalContext, row Row) bool {
+	return e.left.eval(ctx, row) || e.right.eval(ctx, row)
+}
+func (e notExpr) eval(ctx *evalContext, row Row) bool { return !e.inner.eval(ctx, row) }
+
+type stringPred struct {
+	field string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+func (p stringPred) eval(_ *evalContext, row Row) bool {
+	got := stringField(row, p.field)
+	switch p.op {
+	case "=":
+		return strings.EqualFold(got, p.value)
+	case "!=":
+		return !strings.EqualFold(got, p.value)
+	case "~":
+		return p.re.MatchString(got)
+	default: // "!~"
+		return !p.re.MatchString(got)
+	}
+}
+
+type intPred struct {
+	field string
+	op    string
+	value int
+}
+
+func (p intPred) eval(_ *evalContext, row Row) bool {
+	var got int
+	switch p.field {
+	case "depth":
+		got = row.Depth
+	case "assets":
+		got = len(row.Node.Assets)
+	case "children":
+		got = len(row.Node.ChildIDs)
+	}
+	return compareOrdered(got, p.value, p.op)
+}
+
+type duePred struct {
+	op    string
+	value time.Time
+}
+
+func (p duePred) eval(_ *evalContext, row Row) bool {
+	if row.Due == nil {
+		return false
+	}
+	switch {
+	case row.Due.Before(p.value):
+		return compareOrdered(-1, 0, p.op)
+	case row.Due.After(p.value):
+		return compareOrdered(1, 0, p.op)
+	}
+	return compareOrdered(0, 0, p.op)
+}
+
+type underPred struct{ id string }
+
+func (p underPred) eval(ctx *evalContext, row Row) bool {
+	return ctx.descendants(p.id)[row.Node.ID]
+}
+
+type flagPred struct{ field string }
+
+func (p flagPred) eval(_ *evalContext, row Row) bool {
+	switch p.field {
+	case "has_assets":
+		return len(row.Node.Assets) > 0
+	case "has_due":
+		return row.Due != nil
+	}
+	return false
+}
+
+func compareOrdered(got int, want int, op string) bool {
+	switch op {
+	case "=":
+		return got == want
+	case "!=":
+		return got != want
+	case "<":
+		return got < want
+	case "<=":
+		return got <= want
+	case ">":
+		return got > want
+	default: // ">="
+		return got >= want
+	}
+}
+
+func stringField(row Row, field string) string {
+	switch field {
+	case "id":
+		return row.Node.ID
+	case "url":
+		return row.Node.CanonicalURL
+	case "kind":
+		return row.Node.Kind
+	case "status":
+		return string(row.Node.Status)
+	case "title":
+		return row.Node.Title
+	case "result":
+		return row.Result
+	}
+	return ""
+}
+
+var (
+	stringFields = map[string]bool{"id": true, "url": true, "kind": true, "status": true, "title": true, "result": true}
+	intFields    = map[string]bool{"depth": true, "assets": true, "children": true}
+	flagFields   = map[string]bool{"has_assets": true, "has_due": true}
+)
+
+// Parse compiles src. An empty expression returns a nil Expr, which Run treats
+// as matching everything. now anchors relative due dates.
+func Parse(src string, now time.Time) (Expr, error) {
+	p := &parser{src: src, now: now}
+	p.skipSpace()
+	if p.done() {
+		return nil, nil
+	}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.done() {
+		return nil, p.errorf("unexpected %q", p.rest())
+	}
+	return expr, nil
+}
+
+type parser struct {
+	src string
+	pos int
+	now time.Time
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if p.done() || p.peek() == ')' || p.peekKeyword("or") {
+			return left, nil
+		}
+		p.acceptKeyword("and")
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if p.acceptKeyword("not") {
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{inner}, nil
+	}
+	p.skipSpace()
+	if p.peek() == '(' {
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.peek() != ')' {
+			return nil, p.errorf("missing )")
+		}
+		p.pos++
+		return inner, nil
+	}
+	return p.parsePredicate()
+}
+
+func (p *parser) parsePredicate() (Expr, error) {
+	p.skipSpace()
+	start := p.pos
+	field := strings.ToLower(p.readIdent())
+	if field == "" {
+		if p.done() {
+			return nil, p.errorf("expected a predicate")
+		}
+		return nil, p.errorf("unexpected %q", p.rest())
+	}
+	if flagFields[field] {
+		return flagPred{field: field}, nil
+	}
+
+	p.skipSpace()
+	op := p.readOperator()
+	if op == "" {
+		return nil, fmt.Errorf("query: %s at offset %d needs an operator (=, !=, ~, !~, <, <=, >, >=)", field, start)
+	}
+	p.skipSpace()
+	value, err := p.readValue()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case stringFields[field]:
+		pred := stringPred{field: field, op: op, value: value}
+		switch op {
+		case "=", "!=":
+		case "~", "!~":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("query: %s%s: %w", field, op, err)
+			}
+			pred.re = re
+		default:
+			return nil, fmt.Errorf("query: %s does not support %s", field, op)
+		}
+		return pred, nil
+	case intFields[field]:
+		if op == "~" || op == "!~" {
+			return nil, fmt.Errorf("query: %s does not support %s", field, op)
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("query: %s needs a number, got %q", field, value)
+		}
+		return intPred{field: field, op: op, value: n}, nil
+	case field == "due":
+		if op == "~" || op == "!~" {
+			return nil, fmt.Errorf("query: due does not support %s", op)
+		}
+		at, err := parseDueValue(value, p.now)
+		if err != nil {
+			return nil, err
+		}
+		return duePred{op: op, value: at}, nil
+	case field == "under":
+		if op != "=" {
+			return nil, fmt.Errorf("query: under only supports =")
+		}
+		id, _, err := state.NodeIDFromURL(value)
+		if err != nil {
+			return nil, fmt.Errorf("query: under: %w", err)
+		}
+		return underPred{id: id}, nil
+	}
+	return nil, fmt.Errorf("query: unknown field %q", field)
+}
+
+// parseDueValue accepts now, +/-N with a d or Go duration suffix, a date, or
+// an RFC3339 timestamp.
+func parseDueValue(raw string, now time.Time) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if strings.EqualFold(raw, "now") {
+		return now, nil
+	}
+	if strings.HasPrefix(raw, "+") || strings.HasPrefix(raw, "-") {
+		sign := time.Duration(1)
+		if raw[0] == '-' {
+			sign = -1
+		}
+		body := raw[1:]
+		if strings.HasSuffix(body, "d") {
+			days, err := strconv.Atoi(strings.TrimSuffix(body, "d"))
+			if err != nil {
+				return time.Time{}, fmt.Errorf("query: bad due offset %q", raw)
+			}
+			return now.Add(sign * time.Duration(days) * 24 * time.Hour), nil
+		}
+		d, err := time.ParseDuration(body)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("query: bad due offset %q", raw)
+		}
+		return now.Add(sign * d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", raw, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("query: due needs a date, RFC3339 time, now or an offset like +7d, got %q", raw)
+}
+
+func (p *parser) done() bool { return p.pos >= len(p.src) }
+
+func (p *parser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *parser) rest() string { return p.src[p.pos:] }
+
+func (p *parser) skipSpace() {
+	for !p.done() && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *parser) readIdent() string {
+	start := p.pos
+	for !p.done() {
+		c := p.src[p.pos]
+		if c == '_' || c == '-' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return strings.ReplaceAll(p.src[start:p.pos], "-", "_")
+}
+
+func (p *parser) readOperator() string {
+	for _, op := range []string{"!=", "!~", "<=", ">=", "=", "~", "<", ">"} {
+		if strings.HasPrefix(p.rest(), op) {
+			p.pos += len(op)
+			return op
+		}
+	}
+	return ""
+}
+
+func (p *parser) readValue() (string, error) {
+	if p.done() {
+		return "", p.errorf("missing value")
+	}
+	if quote := p.peek(); quote == '"' || quote == '\'' {
+		p.pos++
+		var b strings.Builder
+		for !p.done() {
+			c := p.src[p.pos]
+			p.pos++
+			switch {
+			case c == '\\' && !p.done():
+				b.WriteByte(p.src[p.pos])
+				p.pos++
+			case c == quote:
+				return b.String(), nil
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", p.errorf("unterminated string")
+	}
+	start := p.pos
+	for !p.done() && !unicode.IsSpace(rune(p.src[p.pos])) && p.src[p.pos] != ')' {
+		p.pos++
+	}
+	if start == p.pos {
+		return "", p.errorf("missing value")
+	}
+	return p.src[start:p.pos], nil
+}
+
+func (p *parser) peekKeyword(word string) bool {
+	rest := p.rest()
+	if len(rest) < len(word) || !strings.EqualFold(rest[:len(word)], word) {
+		return false
+	}
+	if len(rest) == len(word) {
+		return true
+	}
+	next := rest[len(word)]
+	return unicode.IsSpace(rune(next)) || next == '('
+}
+
+func (p *parser) acceptKeyword(word string) bool {
+	p.skipSpace()
+	if !p.peekKeyword(word) {
+		return false
+	}
+	p.pos += len(word)
+	return true
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("query: "+format+" at offset %d", append(args, p.pos)...)
+}
@@ -0,0 +1,136 @@
+package query
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"themis-cli/internal/state"
+)
+
+const testBase = "https://themis.housing.rug.nl/course/2024-2025"
+
+func queryTestState(now time.Time) state.State {
+	id := state.NodeIDFromCanonicalURL
+	year, os, ads := testBase, testBase+"/os", testBase+"/ads"
+	lab1, lab2 := os+"/lab1", os+"/lab2"
+	st := state.NewEmptyState()
+	for _, node := range []state.Node{
+		{CanonicalURL: year, Kind: "year", Title: "2024-2025", Status: state.StatusOK, ChildIDs: []string{id(os), id(ads)}},
+		{CanonicalURL: os, Kind: "course", Title: "Operating Systems", Status: state.StatusOK, ParentIDs: []string{id(year)}, ChildIDs: []string{id(lab1), id(lab2)}},
+		{CanonicalURL: ads, Kind: "course", Title: "Algorithms", Status: state.StatusError, ParentIDs: []string{id(year)}},
+		{
+			CanonicalURL: lab1, Kind: "assignment", Title: "Lab 1", Status: state.StatusOK, ParentIDs: []string{id(os)},
+			Assets: []state.AssetRef{{Name: "spec.pdf", URL: lab1 + "/@spec.pdf"}},
+			Details: map[string]any{
+				"config": map[string]any{"end_iso": now.Add(3 * 24 * time.Hour).Format(time.RFC3339)},
+				"stats":  map[string]any{"summary": map[string]any{"status": "passed"}},
+			},
+		},
+		{
+			CanonicalURL: lab2, Kind: "assignment", Title: "Lab 2", Status: state.StatusOK, ParentIDs: []string{id(os)},
+			Details: map[string]any{
+				"config": map[string]any{"end_iso": now.Add(20 * 24 * time.Hour).Format(time.RFC3339)},
+				"links":  map[string]any{"status_page": lab2 + "/@status"},
+			},
+		},
+	} {
+		node.ID = id(node.CanonicalURL)
+		node.UpdatedAt = now
+		st.Nodes[node.ID] = node
+	}
+	st.Roots = []state.RootRef{{NodeID: id(year), CanonicalURL: year, UpdatedAt: now}}
+	return st
+}
+
+func titles(rows []Row) string {
+	out := make([]string, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, r.Node.Title)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestRun_Filters(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	st := queryTestState(now)
+
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{"", "2024-2025,Operating Systems,Algorithms,Lab 1,Lab 2"},
+		{"kind=assignment", "Lab 1,Lab 2"},
+		{"kind=ASSIGNMENT result=passed", "Lab 1"},
+		{"result=not_submitted", "Lab 2"},
+		{"status=error or depth=0", "2024-2025,Algorithms"},
+		{`title~"^Lab [0-9]$" and not has_assets`, "Lab 2"},
+		{"has_assets", "Lab 1"},
+		{"due<+7d", "Lab 1"},
+		{"due>=2025-03-10", "Lab 2"},
+		{"has_due and depth>1", "Lab 1,Lab 2"},
+		{"under=" + testBase + "/os", "Lab 1,Lab 2"},
+		{"not (kind=assignment or kind=course)", "2024-2025"},
+		{"children>=2 and url!=" + testBase, "Operating Systems"},
+	}
+	for _, tc := range cases {
+		rows, err := Run(st, Options{Expr: tc.expr, Now: now})
+		if err != nil {
+			t.Fatalf("%q: %v", tc.expr, err)
+		}
+		if got := titles(rows); got != tc.want {
+			t.Fatalf("%q: got %s, want %s", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestRun_RootIDSetsDepthAndParent(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	st := queryTestState(now)
+	rootID := state.NodeIDFromCanonicalURL(testBase + "/os")
+
+	rows, err := Run(st, Options{Expr: "depth=1", RootID: rootID, Now: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles(rows) != "Lab 1,Lab 2" || rows[0].ParentURL != testBase+"/os" {
+		t.Fatalf("unexpected rows: %+v", rows)
+	}
+	projected := rows[0].Project([]string{"title", "due", "assets", "result"})
+	if projected["assets"] != 1 || projected["result"] != "passed" || projected["due"] == nil {
+		t.Fatalf("unexpected projection: %+v", projected)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	now := time.Now()
+	for _, expr := range []string{
+		"colour=red",
+		"kind",
+		"kind<assignment",
+		"depth=deep",
+		`title~"(unclosed"`,
+		`title="open`,
+		"(kind=course",
+		"under~x",
+		"due<someday",
+		"kind=course )",
+	} {
+		if _, err := Parse(expr, now); err == nil {
+			t.Fatalf("%q: expected parse error", expr)
+		}
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	fields, err := ParseFields("id, Parent-URL ,due")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(fields, ",") != "id,parent_url,due" {
+		t.Fatalf("unexpected fields: %v", fields)
+	}
+	if _, err := ParseFields("id,bogus"); err == nil {
+		t.Fatalf("expected unknown field error")
+	}
+}
@@ -0,0 +1,278 @@
+package state
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	backupDirName    = "backups"
+	backupTimeLayout = "20060102T150405.000Z"
+	backupExt        = ".json"
+	backupGzipExt    = ".json.gz"
+)
+
+// BackupPolicy controls the timestamped backups kept next to a JSON state file
+// in addition to the single <path>.bak.
+type BackupPolicy struct {
+	// Keep is how many timestamped backups to retain; 0 disables them.
+	Keep int
+	// MaxAge prunes backups older than this; 0 keeps them regardless of age.
+	// The newest backup is never pruned by age.
+	MaxAge time.Duration
+	// KeepUncompressed leaves the newest backups as plain JSON and gzips the rest.
+	KeepUncompressed int
+}
+
+// DefaultBackupPolicy keeps ten backups, the newest one uncompressed.
+func DefaultBackupPolicy() BackupPolicy {
+	return BackupPolicy{Keep: 10, KeepUncompressed: 1}
+}
+
+// BackupInfo describes one timestamped backup.
+type BackupInfo struct {
+	ID         string    `json:"id"`
+	Path       string    `json:"path"`
+	CreatedAt  time.Time `json:"created_at"`
+	SizeBytes  int64     `json:"size_bytes"`
+	Compressed bool      `json:"compressed"`
+}
+
+// BackupDir is the directory holding timestamped backups of statePath.
+func BackupDir(statePath string) string {
+	return filepath.Join(filepath.Dir(statePath), backupDirName)
+}
+
+func backupPrefix(statePath string) string {
+	base := filepath.Base(statePath)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + "-"
+}
+
+// ListBackups returns the backups of statePath, newest first.
+func ListBackups(statePath string) ([]BackupInfo, error) {
+	entries, err := os.ReadDir(BackupDir(statePath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []BackupInfo{}, nil
+		}
+		return nil, fmt.Errorf("list backups: %w", err)
+	}
+	prefix := backupPrefix(statePath)
+	out := make([]BackupInfo, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		compressed := strings.HasSuffix(name, backupGzipExt)
+		id := strings.TrimPrefix(name, prefix)
+		if compressed {
+			id = strings.TrimSuffix(id, backupGzipExt)
+		} else if strings.HasSuffix(id, backupExt) {
+			id = strings.TrimSuffix(id, backupExt)
+		} else {
+			continue
+		}
+		created, err := time.Parse(backupTimeLayout, strings.SplitN(id, "-", 2)[0])
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("stat backup %s: %w", name, err)
+		}
+		out = append(out, BackupInfo{
+			ID:         id,
+			Path:       filepath.Join(BackupDir(statePath), name),
+			CreatedAt:  created,
+			SizeBytes:  info.Size(),
+			Compressed: compressed,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return out[i].ID > out[j].ID
+	})
+	return out, nil
+}
+
+// FindBackup resolves ref to a backup: an exact backup ID, or a point in time
+// (RFC3339, a backup timestamp, "2006-01-02T15:04" or a date in local time)
+// selecting the newest backup taken at or before it.
+func FindBackup(statePath string, ref string) (BackupInfo, error) {
+	ref = strings.TrimSpace(ref)
+	backups, err := ListBackups(statePath)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	if len(backups) == 0 {
+		return BackupInfo{}, fmt.Errorf("no backups in %s", BackupDir(statePath))
+	}
+	for _, b := range backups {
+		if b.ID == ref {
+			return b, nil
+		}
+	}
+	at, err := parseBackupRef(ref)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	for _, b := range backups {
+		if !b.CreatedAt.After(at) {
+			return b, nil
+		}
+	}
+	return BackupInfo{}, fmt.Errorf("no backup at or before %s (oldest is %s)", at.Format(time.RFC3339), backups[len(backups)-1].ID)
+}
+
+func parseBackupRef(ref string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, ref); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(backupTimeLayout, ref); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, ref, time.Local); err == nil {
+			if layout == "2006-01-02" {
+				// A bare date means "as of the end of that day".
+				t = t.Add(24*time.Hour - time.Nanosecond)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown backup %q: want a backup id from `themis state backups list` or a timestamp", ref)
+}
+
+// ReadBackup returns the JSON content of a backup, decompressing if needed.
+func ReadBackup(info BackupInfo) ([]byte, error) {
+	raw, err := os.ReadFile(info.Path)
+	if err != nil {
+		return nil, fmt.Errorf("read backup: %w", err)
+	}
+	if !info.Compressed {
+		return raw, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("open compressed backup: %w", err)
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("decompress backup: %w", err)
+	}
+	return out, nil
+}
+
+// RestoreBackup replaces the state at statePath with the backup selected by
+// ref under the exclusive lock. The current state is backed up first, so a
+// restore can itself be undone; backups governs the copies kept of it.
+func RestoreBackup(statePath string, ref string, backups BackupPolicy) (BackupInfo, State, error) {
+	if err := ensureStateDir(statePath); err != nil {
+		return BackupInfo{}, State{}, err
+	}
+	lock, err := acquireLock(lockPath(statePath), true)
+	if err != nil {
+		return BackupInfo{}, State{}, err
+	}
+	defer lock.Close()
+
+	info, err := FindBackup(statePath, ref)
+	if err != nil {
+		return BackupInfo{}, State{}, err
+	}
+	raw, err := ReadBackup(info)
+	if err != nil {
+		return info, State{}, err
+	}
+	st := NewEmptyState()
+	if _, err := DecodeMigrated(raw, CurrentSchemaVersion, stateMigrations, time.Now(), &st); err != nil {
+		return info, State{}, fmt.Errorf("decode backup %s: %w", info.ID, err)
+	}
+	if err := writeStateLocked(statePath, st, &backups); err != nil {
+		return info, State{}, err
+	}
+	return info, st, nil
+}
+
+// rotateBackup stores raw (the state being replaced) as a timestamped backup
+// and applies policy. The caller holds the exclusive state lock.
+func rotateBackup(statePath string, raw []byte, now time.Time, policy BackupPolicy) error {
+	if policy.Keep <= 0 {
+		return nil
+	}
+	dir := BackupDir(statePath)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create backup directory: %w", err)
+	}
+
+	stamp := now.UTC().Format(backupTimeLayout)
+	name := backupPrefix(statePath) + stamp + backupExt
+	for n := 2; ; n++ {
+		_, errPlain := os.Stat(filepath.Join(dir, name))
+		_, errGzip := os.Stat(filepath.Join(dir, strings.TrimSuffix(name, backupExt)+backupGzipExt))
+		if os.IsNotExist(errPlain) && os.IsNotExist(errGzip) {
+			break
+		}
+		name = fmt.Sprintf("%s%s-%d%s", backupPrefix(statePath), stamp, n, backupExt)
+	}
+	if err := writeFileAtomic(filepath.Join(dir, name), raw); err != nil {
+		return fmt.Errorf("write backup: %w", err)
+	}
+	return applyBackupPolicy(statePath, now, policy)
+}
+
+func applyBackupPolicy(statePath string, now time.Time, policy BackupPolicy) error {
+	backups, err := ListBackups(statePath)
+	if err != nil {
+		return err
+	}
+	for i, b := range backups {
+		expired := policy.MaxAge > 0 && i > 0 && now.Sub(b.CreatedAt) > policy.MaxAge
+		if i >= policy.Keep || expired {
+			if err := os.Remove(b.Path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("prune backup %s: %w", b.ID, err)
+			}
+			continue
+		}
+		if i >= policy.KeepUncompressed && !b.Compressed {
+			if err := compressBackup(b); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func compressBackup(b BackupInfo) error {
+	raw, err := os.ReadFile(b.Path)
+	if err != nil {
+		return fmt.Errorf("read backup %s: %w", b.ID, err)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(raw); err != nil {
+		return fmt.Errorf("compress backup %s: %w", b.ID, err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("compress backup %s: %w", b.ID, err)
+	}
+	gzPath := strings.TrimSuffix(b.Path, backupExt) + backupGzipExt
+	if err := writeFileAtomic(gzPath, buf.Bytes()); err != nil {
+		return fmt.Errorf("write compressed backup %s: %w", b.ID, err)
+	}
+	if err := os.Remove(b.Path); err != nil {
+		return fmt.Errorf("remove uncompressed backup %s: %w", b.ID, err)
+	}
+	return nil
+}
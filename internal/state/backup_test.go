@@ -0,0 +1,131 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotateBackup_RetainsAndCompresses(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	policy := BackupPolicy{Keep: 3, KeepUncompressed: 1}
+
+	for i := 0; i < 5; i++ {
+		raw := []byte(`{"schema_version":1,"nodes":{},"roots":[],"base_url":"` + string(rune('a'+i)) + `"}`)
+		if err := rotateBackup(statePath, raw, base.Add(time.Duration(i)*time.Hour), policy); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := ListBackups(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 3 {
+		t.Fatalf("expected 3 backups, got %d: %+v", len(backups), backups)
+	}
+	if backups[0].Compressed || !backups[1].Compressed || !backups[2].Compressed {
+		t.Fatalf("only the newest backup should be uncompressed: %+v", backups)
+	}
+	if !backups[2].CreatedAt.Equal(base.Add(2 * time.Hour)) {
+		t.Fatalf("oldest kept backup is %s", backups[2].CreatedAt)
+	}
+	raw, err := ReadBackup(backups[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != `{"schema_version":1,"nodes":{},"roots":[],"base_url":"d"}` {
+		t.Fatalf("unexpected decompressed backup: %s", raw)
+	}
+
+	found, err := FindBackup(statePath, base.Add(3*time.Hour+30*time.Minute).Format(time.RFC3339))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != backups[1].ID {
+		t.Fatalf("point-in-time lookup picked %s, want %s", found.ID, backups[1].ID)
+	}
+	if _, err := FindBackup(statePath, base.Format(time.RFC3339)); err == nil {
+		t.Fatalf("expected no backup before the oldest kept one")
+	}
+
+	if err := applyBackupPolicy(statePath, base.Add(30*24*time.Hour), BackupPolicy{Keep: 3, MaxAge: 24 * time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if backups, _ := ListBackups(statePath); len(backups) != 1 {
+		t.Fatalf("max age should prune all but the newest backup, got %d", len(backups))
+	}
+}
+
+func TestRestoreBackup_RestoresAndBacksUpCurrent(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	good, _ := storeTestState(t)
+	if err := SaveAtomic(statePath, good, true); err != nil {
+		t.Fatal(err)
+	}
+	bad := NewEmptyState()
+	bad.BaseURL = good.BaseURL
+	if err := SaveAtomic(statePath, bad, true); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := ListBackups(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("expected the good state as the only backup, got %+v", backups)
+	}
+
+	info, restored, err := RestoreBackup(statePath, backups[0].ID, DefaultBackupPolicy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ID != backups[0].ID || len(restored.Nodes) != len(good.Nodes) {
+		t.Fatalf("unexpected restore: %+v", info)
+	}
+	loaded, err := Load(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Nodes) != len(good.Nodes) {
+		t.Fatalf("state not restored: %d nodes", len(loaded.Nodes))
+	}
+	if backups, _ := ListBackups(statePath); len(backups) != 2 {
+		t.Fatalf("restore should back up the replaced state, got %d backups", len(backups))
+	}
+}
+
+func TestOpenStore_AppliesBackupPolicyPerStore(t *testing.T) {
+	dir := t.TempDir()
+	st, _ := storeTestState(t)
+
+	defaults, err := OpenStore(BackendJSON, filepath.Join(dir, "defaults.json"), StoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	none, err := OpenStore(BackendJSON, filepath.Join(dir, "none.json"), StoreOptions{Backups: &BackupPolicy{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := defaults.Save(st); err != nil {
+			t.Fatal(err)
+		}
+		if err := none.Save(st); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if backups, _ := ListBackups(defaults.Location()); len(backups) != 2 {
+		t.Fatalf("expected the default policy to back up each replaced state, got %d", len(backups))
+	}
+	if backups, _ := ListBackups(none.Location()); len(backups) != 0 {
+		t.Fatalf("expected no timestamped backups with Keep 0, got %d", len(backups))
+	}
+	if _, err := os.Stat(BackupPath(none.Location())); err != nil {
+		t.Fatalf("expected the .bak copy regardless of policy: %v", err)
+	}
+}
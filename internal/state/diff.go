@@ -0,0 +1,213 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// NodeRef identifies a node in a StateDiff.
+type NodeRef struct {
+	ID           string `json:"id"`
+	CanonicalURL string `json:"canonical_url"`
+	Title        string `json:"title,omitempty"`
+	Kind         string `json:"kind,omitempty"`
+}
+
+// FieldChange is a before/after pair.
+type FieldChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// NodeChange lists what differs for a node present in both states.
+type NodeChange struct {
+	NodeRef
+	Title             *FieldChange `json:"title_change,omitempty"`
+	Status            *FieldChange `json:"status_change,omitempty"`
+	ContentHash       *FieldChange `json:"content_hash_change,omitempty"`
+	AddedChildren     []string     `json:"added_children,omitempty"`
+	RemovedChildren   []string     `json:"removed_children,omitempty"`
+	AddedParents      []string     `json:"added_parents,omitempty"`
+	RemovedParents    []string     `json:"removed_parents,omitempty"`
+	AddedDetailKeys   []string     `json:"added_detail_keys,omitempty"`
+	RemovedDetailKeys []string     `json:"removed_detail_keys,omitempty"`
+	ChangedDetailKeys []string     `json:"changed_detail_keys,omitempty"`
+	AssetsChanged     bool         `json:"assets_changed,omitempty"`
+}
+
+// StateDiff is the result of DiffStates. Slices are sorted by canonical URL.
+type StateDiff struct {
+	Added        []NodeRef    `json:"added"`
+	Removed      []NodeRef    `json:"removed"`
+	Changed      []NodeChange `json:"changed"`
+	RootsAdded   []string     `json:"roots_added"`
+	RootsRemoved []string     `json:"roots_removed"`
+	// Unchanged counts nodes present in both states with no reported change.
+	Unchanged int `json:"unchanged"`
+}
+
+// Empty reports whether the two states are equivalent.
+func (d StateDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 && len(d.RootsAdded) == 0 && len(d.RootsRemoved) == 0
+}
+
+// DiffStates compares before and after node by node. Fetch bookkeeping
+// (timestamps, last error) is ignored so only observed changes are reported.
+func DiffStates(before State, after State) StateDiff {
+	diff := StateDiff{
+		Added:        []NodeRef{},
+		Removed:      []NodeRef{},
+		Changed:      []NodeChange{},
+		RootsAdded:   []string{},
+		RootsRemoved: []string{},
+	}
+
+	for id, node := range after.Nodes {
+		old, ok := before.Nodes[id]
+		if !ok {
+			diff.Added = append(diff.Added, nodeRef(node))
+			continue
+		}
+		change, changed := diffNode(old, node)
+		if changed {
+			diff.Changed = append(diff.Changed, change)
+		} else {
+			diff.Unchanged++
+		}
+	}
+	for id, node := range before.Nodes {
+		if _, ok := after.Nodes[id]; !ok {
+			diff.Removed = append(diff.Removed, nodeRef(node))
+		}
+	}
+
+	beforeRoots := rootURLs(before.Roots)
+	afterRoots := rootURLs(after.Roots)
+	for id, url := range afterRoots {
+		if _, ok := beforeRoots[id]; !ok {
+			diff.RootsAdded = append(diff.RootsAdded, url)
+		}
+	}
+	for id, url := range beforeRoots {
+		if _, ok := afterRoots[id]; !ok {
+			diff.RootsRemoved = append(diff.RootsRemoved, url)
+		}
+	}
+
+	sortRefs(diff.Added)
+	sortRefs(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].CanonicalURL < diff.Changed[j].CanonicalURL })
+	sort.Strings(diff.RootsAdded)
+	sort.Strings(diff.RootsRemoved)
+	return diff
+}
+
+func diffNode(before Node, after Node) (NodeChange, bool) {
+	change := NodeChange{NodeRef: nodeRef(after)}
+	changed := false
+	if before.Title != after.Title {
+		change.Title = &FieldChange{From: before.Title, To: after.Title}
+		changed = true
+	}
+	if before.Status != after.Status {
+		change.Status = &FieldChange{From: string(before.Status), To: string(after.Status)}
+		changed = true
+	}
+	if before.ContentHash != after.ContentHash {
+		change.ContentHash = &FieldChange{From: before.ContentHash, To: after.ContentHash}
+		changed = true
+	}
+
+	edges := DiffChildren(before.ChildIDs, after.ChildIDs)
+	change.AddedChildren, change.RemovedChildren = edges.Added, edges.Removed
+	parents := DiffChildren(before.ParentIDs, after.ParentIDs)
+	change.AddedParents, change.RemovedParents = parents.Added, parents.Removed
+	if len(edges.Added)+len(edges.Removed)+len(parents.Added)+len(parents.Removed) > 0 {
+		changed = true
+	}
+
+	for key, value := range after.Details {
+		old, ok := before.Details[key]
+		switch {
+		case !ok:
+			change.AddedDetailKeys = append(change.AddedDetailKeys, key)
+		case !jsonEqual(old, value):
+			change.ChangedDetailKeys = append(change.ChangedDetailKeys, key)
+		}
+	}
+	for key := range before.Details {
+		if _, ok := after.Details[key]; !ok {
+			change.RemovedDetailKeys = append(change.RemovedDetailKeys, key)
+		}
+	}
+	sort.Strings(change.AddedDetailKeys)
+	sort.Strings(change.RemovedDetailKeys)
+	sort.Strings(change.ChangedDetailKeys)
+	if len(change.AddedDetailKeys)+len(change.RemovedDetailKeys)+len(change.ChangedDetailKeys) > 0 {
+		changed = true
+	}
+
+	if !jsonEqual(before.Assets, after.Assets) {
+		change.AssetsChanged = true
+		changed = true
+	}
+	return change, changed
+}
+
+// jsonEqual compares values by their JSON encoding so a freshly scraped
+// map[string]string equals its map[string]any round trip.
+func jsonEqual(a any, b any) bool {
+	ra, errA := json.Marshal(a)
+	rb, errB := json.Marshal(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return bytes.Equal(ra, rb)
+}
+
+func nodeRef(node Node) NodeRef {
+	return NodeRef{ID: node.ID, CanonicalURL: node.CanonicalURL, Title: node.Title, Kind: node.Kind}
+}
+
+func rootURLs(roots []RootRef) map[string]string {
+	out := make(map[string]string, len(roots))
+	for _, root := range roots {
+		out[root.NodeID] = root.CanonicalURL
+	}
+	return out
+}
+
+func sortRefs(refs []NodeRef) {
+	sort.Slice(refs, func(i, j int) bool { return refs[i].CanonicalURL < refs[j].CanonicalURL })
+}
+
+// ReadSnapshot decodes a state file without taking the state lock, for
+// comparing backups and copies. Both JSON files and append logs are accepted;
+// older JSON schemas are migrated in memory.
+func ReadSnapshot(path string) (State, error) {
+	raw, err := readStateFile(path)
+	if err != nil {
+		return State{}, err
+	}
+	if raw == nil {
+		return State{}, fmt.Errorf("%s does not exist", path)
+	}
+	if bytes.HasPrefix(raw, []byte(`{"format":"`+logStoreFormat+`"`)) {
+		snap, err := replayLog(bytes.NewReader(raw))
+		if err != nil {
+			return State{}, fmt.Errorf("read state log %s: %w", path, err)
+		}
+		return snap.decode()
+	}
+	st := NewEmptyState()
+	if _, err := DecodeMigrated(raw, CurrentSchemaVersion, stateMigrations, time.Now(), &st); err != nil {
+		return State{}, fmt.Errorf("decode %s: %w", path, err)
+	}
+	if st.Nodes == nil {
+		st.Nodes = map[string]Node{}
+	}
+	return st, nil
+}
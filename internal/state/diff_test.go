@@ -0,0 +1,104 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiffStates_ReportsNodeEdgeStatusAndDetailChanges(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	before, ids := exportTestState(t, now)
+
+	after, err := cloneState(before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	later := now.Add(time.Hour)
+	if _, err := SetChildren(&after, ids["os"], []string{ids["lab1"]}, later); err != nil {
+		t.Fatal(err)
+	}
+	delete(after.Nodes, ids["lab2"])
+	newID := NodeIDFromCanonicalURL("https://themis.housing.rug.nl/course/2024-2025/os/lab3")
+	if _, _, err := UpsertNode(&after, Node{ID: newID, CanonicalURL: "https://themis.housing.rug.nl/course/2024-2025/os/lab3", Title: "lab3"}, later); err != nil {
+		t.Fatal(err)
+	}
+	lab1 := after.Nodes[ids["lab1"]]
+	lab1.Title = "Lab 1: pipes"
+	lab1.Status = StatusError
+	lab1.ContentHash = "sha256:new"
+	lab1.Details = map[string]any{"config": "python", "description": "new"}
+	lab1.UpdatedAt = later
+	after.Nodes[ids["lab1"]] = lab1
+	ads := after.Nodes[ids["ads"]]
+	ads.LastFetchedAt = &later
+	after.Nodes[ids["ads"]] = ads
+
+	diff := DiffStates(before, after)
+	if len(diff.Added) != 1 || diff.Added[0].ID != newID {
+		t.Fatalf("unexpected added: %+v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].ID != ids["lab2"] {
+		t.Fatalf("unexpected removed: %+v", diff.Removed)
+	}
+
+	changes := map[string]NodeChange{}
+	for _, c := range diff.Changed {
+		changes[c.ID] = c
+	}
+	if _, ok := changes[ids["ads"]]; ok {
+		t.Fatalf("fetch timestamps alone should not count as a change")
+	}
+	osChange := changes[ids["os"]]
+	if len(osChange.RemovedChildren) != 1 || osChange.RemovedChildren[0] != ids["lab2"] {
+		t.Fatalf("unexpected os change: %+v", osChange)
+	}
+	c := changes[ids["lab1"]]
+	if c.Title == nil || c.Title.To != "Lab 1: pipes" || c.Status == nil || c.Status.To != "error" || c.ContentHash == nil {
+		t.Fatalf("unexpected lab1 change: %+v", c)
+	}
+	if len(c.AddedDetailKeys) != 1 || c.AddedDetailKeys[0] != "description" || len(c.RemovedDetailKeys) != 1 || c.RemovedDetailKeys[0] != "stats" {
+		t.Fatalf("unexpected detail keys: %+v", c)
+	}
+	if diff.Empty() || !DiffStates(before, before).Empty() {
+		t.Fatalf("Empty() is wrong")
+	}
+}
+
+func TestReadSnapshot_ReadsBackupAndLogFiles(t *testing.T) {
+	dir := t.TempDir()
+	st, _ := storeTestState(t)
+	jsonPath := filepath.Join(dir, "state.json")
+	if err := SaveAtomic(jsonPath, st, true); err != nil {
+		t.Fatal(err)
+	}
+	changed := st
+	changed.Nodes = map[string]Node{}
+	if err := SaveAtomic(jsonPath, changed, true); err != nil {
+		t.Fatal(err)
+	}
+
+	backup, err := ReadSnapshot(BackupPath(jsonPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backup.Nodes) != len(st.Nodes) {
+		t.Fatalf("backup has %d nodes, want %d", len(backup.Nodes), len(st.Nodes))
+	}
+	if _, err := os.Stat(lockPath(BackupPath(jsonPath))); !os.IsNotExist(err) {
+		t.Fatalf("ReadSnapshot should not create lock files")
+	}
+
+	logPath := filepath.Join(dir, "state.db")
+	if err := (&LogStore{Path: logPath}).Save(st); err != nil {
+		t.Fatal(err)
+	}
+	fromLog, err := ReadSnapshot(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := DiffStates(backup, fromLog); !diff.Empty() {
+		t.Fatalf("json backup and log differ: %+v", diff)
+	}
+}
@@ -0,0 +1,73 @@
+package state
+
+// RefreshEstimate predicts how many requests a refresh would make, based on
+// the cached graph.
+type RefreshEstimate struct {
+	// Pages counts the cached nodes within depth of the root, including the
+	// root itself; each is one page fetch.
+	Pages int `json:"pages"`
+	// StatsPages counts the assignments among them; refresh also fetches
+	// each assignment's stats page.
+	StatsPages int `json:"stats_pages"`
+	// Unexplored counts nodes above the depth limit that were never fetched.
+	// Their children are unknown, so the real refresh may fetch more.
+	Unexplored int `json:"unexplored"`
+	// ByDepth[i] is the number of pages i levels below the root.
+	ByDepth []int `json:"by_depth"`
+}
+
+// Requests is the estimated number of HTTP requests.
+func (e RefreshEstimate) Requests() int {
+	return e.Pages + e.StatsPages
+}
+
+// EstimateRefresh walks the cached graph from rootID down to maxDepth child
+// edges, visiting each node once like a refresh does. A root missing from st
+// counts as a single unexplored page.
+func EstimateRefresh(st State, rootID string, maxDepth int) RefreshEstimate {
+	if maxDepth < 0 {
+		maxDepth = 0
+	}
+	root, ok := st.Nodes[rootID]
+	if !ok {
+		est := RefreshEstimate{Pages: 1, ByDepth: []int{1}}
+		if maxDepth > 0 {
+			est.Unexplored = 1
+		}
+		return est
+	}
+	est := RefreshEstimate{ByDepth: []int{}}
+	type item struct {
+		node  Node
+		depth int
+	}
+	seen := map[string]bool{rootID: true}
+	queue := []item{{node: root}}
+	for len(queue) > 0 {
+		it := queue[0]
+		queue = queue[1:]
+		est.Pages++
+		if it.node.Kind == "assignment" {
+			est.StatsPages++
+		}
+		if len(est.ByDepth) <= it.depth {
+			est.ByDepth = append(est.ByDepth, 0)
+		}
+		est.ByDepth[it.depth]++
+		if it.depth >= maxDepth {
+			continue
+		}
+		if it.node.LastSuccessAt == nil {
+			est.Unexplored++
+		}
+		for _, childID := range it.node.ChildIDs {
+			child, ok := st.Nodes[childID]
+			if !ok || seen[childID] {
+				continue
+			}
+			seen[childID] = true
+			queue = append(queue, item{node: child, depth: it.depth + 1})
+		}
+	}
+	return est
+}
@@ -0,0 +1,40 @@
+package state
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEstimateRefresh_CountsPagesWithinDepth(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	st, ids := exportTestState(t, now)
+	for name, kind := range map[string]string{"year": "year", "os": "course", "ads": "course", "lab1": "assignment", "lab2": "assignment"} {
+		node := st.Nodes[ids[name]]
+		node.Kind = kind
+		if name != "ads" {
+			node.LastSuccessAt = &now
+		}
+		st.Nodes[ids[name]] = node
+	}
+
+	got := EstimateRefresh(st, ids["year"], 8)
+	want := RefreshEstimate{Pages: 5, StatsPages: 2, Unexplored: 1, ByDepth: []int{1, 2, 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected estimate: %+v", got)
+	}
+	if got.Requests() != 7 {
+		t.Fatalf("expected 7 requests, got %d", got.Requests())
+	}
+
+	got = EstimateRefresh(st, ids["year"], 1)
+	want = RefreshEstimate{Pages: 3, StatsPages: 0, Unexplored: 0, ByDepth: []int{1, 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected depth-1 estimate: %+v", got)
+	}
+
+	got = EstimateRefresh(st, "url:missing", 2)
+	if got.Pages != 1 || got.Unexplored != 1 {
+		t.Fatalf("expected a single unexplored page for a missing root, got %+v", got)
+	}
+}
@@ -0,0 +1,428 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	exportFormat  = "themis-state-export"
+	exportVersion = 1
+)
+
+// PersonalDetailsKeys are node details tied to the account that crawled them
+// (grades, submission refs, status page stats). They are dropped from exports
+// with StripPersonal and never taken from an import.
+var PersonalDetailsKeys = []string{"stats"}
+
+// ErrBaseURLMismatch is returned when an export comes from another Themis instance.
+var ErrBaseURLMismatch = errors.New("export is for a different base URL")
+
+// ExportDocument is a self-contained slice of the graph that can be shared and
+// merged into another state with MergeExport.
+type ExportDocument struct {
+	Format           string          `json:"format"`
+	Version          int             `json:"version"`
+	SchemaVersion    int             `json:"schema_version"`
+	ExportedAt       time.Time       `json:"exported_at"`
+	BaseURL          string          `json:"base_url"`
+	CatalogRootURL   string          `json:"catalog_root_url,omitempty"`
+	RootID           string          `json:"root_id,omitempty"`
+	StrippedPersonal bool            `json:"stripped_personal"`
+	Roots            []RootRef       `json:"roots"`
+	Nodes            map[string]Node `json:"nodes"`
+}
+
+// ExportOptions controls BuildExport.
+type ExportOptions struct {
+	// RootID limits the export to the subtree below this node. Empty exports
+	// everything reachable from the tracked roots and the catalog root.
+	RootID string
+	// StripPersonal removes PersonalDetailsKeys and local asset paths.
+	StripPersonal bool
+	// StalePolicy, when set, re-evaluates node staleness at export time so the
+	// exported statuses match what list and the TUI show.
+	StalePolicy *StalePolicy
+}
+
+// BuildExport copies the selected subtree of st into an ExportDocument. Edges
+// to nodes outside the export are dropped so the document is closed.
+func BuildExport(st State, opts ExportOptions, now time.Time) (ExportDocument, error) {
+	clone, err := cloneState(st)
+	if err != nil {
+		return ExportDocument{}, fmt.Errorf("copy state: %w", err)
+	}
+	if opts.StalePolicy != nil {
+		if _, err := ApplyStalePolicyByKind(&clone, now, *opts.StalePolicy); err != nil {
+			return ExportDocument{}, err
+		}
+	}
+
+	var included map[string]struct{}
+	roots := make([]RootRef, 0)
+	if opts.RootID != "" {
+		root, ok := clone.Nodes[opts.RootID]
+		if !ok {
+			return ExportDocument{}, fmt.Errorf("root %s is not in local state", opts.RootID)
+		}
+		included = subtreeIDs(clone, opts.RootID)
+		roots = append(roots, RootRef{NodeID: root.ID, CanonicalURL: root.CanonicalURL, Title: root.Title, Kind: root.Kind, UpdatedAt: root.UpdatedAt})
+	} else {
+		included = reachableNodeIDs(clone)
+		roots = append(roots, clone.Roots...)
+	}
+
+	doc := ExportDocument{
+		Format:           exportFormat,
+		Version:          exportVersion,
+		SchemaVersion:    CurrentSchemaVersion,
+		ExportedAt:       now.UTC(),
+		BaseURL:          clone.BaseURL,
+		CatalogRootURL:   clone.CatalogRootURL,
+		RootID:           opts.RootID,
+		StrippedPersonal: opts.StripPersonal,
+		Roots:            roots,
+		Nodes:            make(map[string]Node, len(included)),
+	}
+	for id := range included {
+		node := clone.Nodes[id]
+		node.ParentIDs = keepIncluded(node.ParentIDs, included)
+		node.ChildIDs = keepIncluded(node.ChildIDs, included)
+		if opts.StripPersonal {
+			stripPersonal(&node)
+		}
+		doc.Nodes[id] = node
+	}
+	return doc, nil
+}
+
+// EncodeExport writes doc as indented JSON.
+func EncodeExport(w io.Writer, doc ExportDocument) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("encode export: %w", err)
+	}
+	return nil
+}
+
+// DecodeExport reads an export and rejects other files and newer versions.
+func DecodeExport(r io.Reader) (ExportDocument, error) {
+	var doc ExportDocument
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return ExportDocument{}, fmt.Errorf("decode export: %w", err)
+	}
+	if doc.Format != exportFormat {
+		return ExportDocument{}, fmt.Errorf("not a themis state export (format %q)", doc.Format)
+	}
+	if doc.Version > exportVersion || doc.SchemaVersion > CurrentSchemaVersion {
+		return ExportDocument{}, fmt.Errorf("%w: export version %d, schema_version %d", ErrSchemaTooNew, doc.Version, doc.SchemaVersion)
+	}
+	if doc.Nodes == nil {
+		doc.Nodes = map[string]Node{}
+	}
+	for id, node := range doc.Nodes {
+		if node.ID != id {
+			return ExportDocument{}, fmt.Errorf("export node %s is stored under %s", node.ID, id)
+		}
+	}
+	return doc, nil
+}
+
+// Merge outcomes recorded per node in MergeReport.Conflicts.
+const (
+	MergeWinnerLocal  = "local"
+	MergeWinnerImport = "import"
+)
+
+// MergeConflict is a node that differs between the local state and the import.
+type MergeConflict struct {
+	NodeID       string `json:"node_id"`
+	CanonicalURL string `json:"canonical_url"`
+	Winner       string `json:"winner"`
+	Reason       string `json:"reason"`
+}
+
+// MergeReport summarises MergeExport.
+type MergeReport struct {
+	Added      int             `json:"added"`
+	Updated    int             `json:"updated"`
+	KeptLocal  int             `json:"kept_local"`
+	Unchanged  int             `json:"unchanged"`
+	RootsAdded int             `json:"roots_added"`
+	Conflicts  []MergeConflict `json:"conflicts"`
+}
+
+// Changed reports whether the merge modified the state.
+func (r MergeReport) Changed() bool {
+	return r.Added > 0 || r.Updated > 0 || r.RootsAdded > 0
+}
+
+// MergeExport merges doc into st. New nodes are added. For nodes present on
+// both sides the fresher one wins, comparing LastSuccessAt and then UpdatedAt;
+// ties keep the local node. An imported node never removes local details it
+// does not carry (including personal details), local asset paths, or local
+// parent edges.
+func MergeExport(st *State, doc ExportDocument, now time.Time) (MergeReport, error) {
+	report := MergeReport{Conflicts: []MergeConflict{}}
+	if st == nil {
+		return report, fmt.Errorf("state is nil")
+	}
+	if st.Nodes == nil {
+		st.Nodes = map[string]Node{}
+	}
+	if st.BaseURL != "" && doc.BaseURL != "" && !strings.EqualFold(strings.TrimRight(st.BaseURL, "/"), strings.TrimRight(doc.BaseURL, "/")) {
+		return report, fmt.Errorf("%w: local %s, export %s", ErrBaseURLMismatch, st.BaseURL, doc.BaseURL)
+	}
+	if st.BaseURL == "" {
+		st.BaseURL = doc.BaseURL
+	}
+	if st.CatalogRootURL == "" {
+		st.CatalogRootURL = doc.CatalogRootURL
+	}
+
+	ids := make([]string, 0, len(doc.Nodes))
+	for id := range doc.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	touched := map[string]bool{}
+	for _, id := range ids {
+		incoming := doc.Nodes[id]
+		local, ok := st.Nodes[id]
+		if !ok {
+			stripPersonal(&incoming)
+			st.Nodes[id] = incoming
+			touched[id] = true
+			report.Added++
+			continue
+		}
+		if sameNodeContent(local, incoming) {
+			report.Unchanged++
+			continue
+		}
+
+		conflict := MergeConflict{NodeID: id, CanonicalURL: local.CanonicalURL}
+		switch cmp := compareFreshness(incoming, local); {
+		case cmp > 0:
+			st.Nodes[id] = mergeImportedNode(local, incoming)
+			touched[id] = true
+			report.Updated++
+			conflict.Winner = MergeWinnerImport
+			conflict.Reason = "import is newer"
+		case cmp < 0:
+			report.KeptLocal++
+			conflict.Winner = MergeWinnerLocal
+			conflict.Reason = "local is newer"
+		default:
+			report.KeptLocal++
+			conflict.Winner = MergeWinnerLocal
+			conflict.Reason = "same timestamps, kept local"
+		}
+		report.Conflicts = append(report.Conflicts, conflict)
+	}
+
+	relinkMerged(st, touched)
+
+	for _, root := range doc.Roots {
+		if _, ok := st.Nodes[root.NodeID]; !ok || hasRoot(st.Roots, root.NodeID) {
+			continue
+		}
+		st.Roots = append(st.Roots, root)
+		report.RootsAdded++
+	}
+	if report.Changed() {
+		st.UpdatedAt = now.UTC()
+	}
+	return report, nil
+}
+
+// mergeImportedNode takes incoming as the winner while keeping what only the
+// local side knows.
+func mergeImportedNode(local Node, incoming Node) Node {
+	out := incoming
+	out.ParentIDs = uniqueNonEmptyPreserveOrder(append(append([]string{}, local.ParentIDs...), incoming.ParentIDs...))
+	if local.CreatedAt.Before(out.CreatedAt) && !local.CreatedAt.IsZero() {
+		out.CreatedAt = local.CreatedAt
+	}
+
+	details := map[string]any{}
+	for k, v := range local.Details {
+		details[k] = v
+	}
+	for k, v := range incoming.Details {
+		if isPersonalDetailsKey(k) {
+			continue
+		}
+		details[k] = v
+	}
+	if len(details) == 0 {
+		details = nil
+	}
+	out.Details = details
+
+	localAssets := make(map[string]AssetRef, len(local.Assets))
+	for _, asset := range local.Assets {
+		localAssets[asset.URL] = asset
+	}
+	assets := make([]AssetRef, 0, len(incoming.Assets))
+	for _, asset := range incoming.Assets {
+		if prev, ok := localAssets[asset.URL]; ok && asset.Path == "" {
+			asset.Path = prev.Path
+			if asset.SHA256 == "" {
+				asset.SHA256 = prev.SHA256
+				asset.SizeBytes = prev.SizeBytes
+			}
+		}
+		assets = append(assets, asset)
+	}
+	out.Assets = assets
+	return out
+}
+
+// relinkMerged makes edges symmetric around the touched nodes. Child lists are
+// authoritative: listed children gain the reverse parent edge, and parent edges
+// of touched nodes (or to touched parents) without a matching child edge are
+// dropped.
+func relinkMerged(st *State, touched map[string]bool) {
+	if len(touched) == 0 {
+		return
+	}
+	for id := range touched {
+		node := st.Nodes[id]
+		children := make([]string, 0, len(node.ChildIDs))
+		for _, childID := range node.ChildIDs {
+			child, ok := st.Nodes[childID]
+			if !ok {
+				continue
+			}
+			children = append(children, childID)
+			if !containsString(child.ParentIDs, id) {
+				child.ParentIDs = append(child.ParentIDs, id)
+				st.Nodes[childID] = child
+			}
+		}
+		node = st.Nodes[id]
+		node.ChildIDs = children
+		st.Nodes[id] = node
+	}
+	for id, node := range st.Nodes {
+		parents := make([]string, 0, len(node.ParentIDs))
+		for _, parentID := range node.ParentIDs {
+			parent, ok := st.Nodes[parentID]
+			if !ok || ((touched[parentID] || touched[id]) && !containsString(parent.ChildIDs, id)) {
+				continue
+			}
+			parents = append(parents, parentID)
+		}
+		if len(parents) != len(node.ParentIDs) {
+			node.ParentIDs = parents
+			st.Nodes[id] = node
+		}
+	}
+}
+
+func compareFreshness(a Node, b Node) int {
+	if c := compareTimePtr(a.LastSuccessAt, b.LastSuccessAt); c != 0 {
+		return c
+	}
+	switch {
+	case a.UpdatedAt.After(b.UpdatedAt):
+		return 1
+	case a.UpdatedAt.Before(b.UpdatedAt):
+		return -1
+	}
+	return 0
+}
+
+func compareTimePtr(a *time.Time, b *time.Time) int {
+	var at, bt time.Time
+	if a != nil {
+		at = *a
+	}
+	if b != nil {
+		bt = *b
+	}
+	switch {
+	case at.After(bt):
+		return 1
+	case at.Before(bt):
+		return -1
+	}
+	return 0
+}
+
+// sameNodeContent compares what a crawl observes, ignoring edges to parents,
+// timestamps and personal details.
+func sameNodeContent(a Node, b Node) bool {
+	return a.Title == b.Title &&
+		a.Kind == b.Kind &&
+		a.Status == b.Status &&
+		a.ContentHash == b.ContentHash &&
+		stringSlicesEqual(a.ChildIDs, b.ChildIDs)
+}
+
+func stripPersonal(node *Node) {
+	for _, key := range PersonalDetailsKeys {
+		delete(node.Details, key)
+	}
+	if len(node.Details) == 0 {
+		node.Details = nil
+	}
+	for i := range node.Assets {
+		node.Assets[i].Path = ""
+	}
+}
+
+func isPersonalDetailsKey(key string) bool {
+	for _, k := range PersonalDetailsKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func subtreeIDs(st State, rootID string) map[string]struct{} {
+	seen := map[string]struct{}{}
+	queue := []string{rootID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		node, ok := st.Nodes[id]
+		if !ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		queue = append(queue, node.ChildIDs...)
+	}
+	return seen
+}
+
+func keepIncluded(ids []string, included map[string]struct{}) []string {
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := included[id]; ok {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func hasRoot(roots []RootRef, nodeID string) bool {
+	for _, root := range roots {
+		if root.NodeID == nodeID {
+			return true
+		}
+	}
+	return false
+}
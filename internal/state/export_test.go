@@ -0,0 +1,150 @@
+package state
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func exportTestState(t *testing.T, now time.Time) (State, map[string]string) {
+	t.Helper()
+	g := newTestGraph(t, "https://themis.housing.rug.nl/course/2024-2025", now)
+	g.add("year", "", Node{Title: "year", Status: StatusOK})
+	g.add("os", "/os", Node{Title: "os", Status: StatusOK})
+	g.add("lab1", "/os/lab1", Node{Title: "lab1", Status: StatusOK})
+	g.add("lab2", "/os/lab2", Node{Title: "lab2", Status: StatusOK})
+	g.add("ads", "/ads", Node{Title: "ads", Status: StatusOK})
+	g.link("year", "os", "ads")
+	g.link("os", "lab1", "lab2")
+	g.root("year")
+	st, ids := g.st, g.ids
+	st.BaseURL = "https://themis.housing.rug.nl"
+
+	lab1 := st.Nodes[ids["lab1"]]
+	lab1.Details = map[string]any{"stats": map[string]any{"grade": "8"}, "config": "python"}
+	lab1.Assets = []AssetRef{{Name: "spec.pdf", URL: lab1.CanonicalURL + "/@spec.pdf", Path: "/home/me/spec.pdf"}}
+	st.Nodes[ids["lab1"]] = lab1
+	return st, ids
+}
+
+func TestBuildExport_SubtreeStripsPersonalAndOuterEdges(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	st, ids := exportTestState(t, now)
+
+	doc, err := BuildExport(st, ExportOptions{RootID: ids["os"], StripPersonal: true}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Nodes) != 3 {
+		t.Fatalf("expected os subtree of 3 nodes, got %d", len(doc.Nodes))
+	}
+	if _, ok := doc.Nodes[ids["ads"]]; ok {
+		t.Fatalf("sibling subtree leaked into export")
+	}
+	if parents := doc.Nodes[ids["os"]].ParentIDs; len(parents) != 0 {
+		t.Fatalf("edge to parent outside export kept: %v", parents)
+	}
+	lab1 := doc.Nodes[ids["lab1"]]
+	if _, ok := lab1.Details["stats"]; ok {
+		t.Fatalf("stats were not stripped")
+	}
+	if lab1.Details["config"] != "python" || lab1.Assets[0].Path != "" {
+		t.Fatalf("unexpected lab1 export: %+v", lab1)
+	}
+	if _, ok := st.Nodes[ids["lab1"]].Details["stats"]; !ok {
+		t.Fatalf("export modified the source state")
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeExport(&buf, doc); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeExport(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Nodes) != 3 || decoded.RootID != ids["os"] || !decoded.StrippedPersonal {
+		t.Fatalf("round trip mismatch: %+v", decoded)
+	}
+}
+
+func TestMergeExport_PicksFresherNodesAndKeepsLocalDetails(t *testing.T) {
+	old := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	fresh := old.Add(24 * time.Hour)
+
+	local, ids := exportTestState(t, old)
+	delete(local.Nodes, ids["lab2"])
+	osNode := local.Nodes[ids["os"]]
+	osNode.ChildIDs = []string{ids["lab1"]}
+	local.Nodes[ids["os"]] = osNode
+	localAds := local.Nodes[ids["ads"]]
+	localAds.Title = "ads (local)"
+	localAds.LastSuccessAt = &fresh
+	local.Nodes[ids["ads"]] = localAds
+
+	remote, _ := exportTestState(t, old)
+	for _, name := range []string{"os", "lab1"} {
+		node := remote.Nodes[ids[name]]
+		node.Title = name + " (remote)"
+		node.LastSuccessAt = &fresh
+		node.UpdatedAt = fresh
+		remote.Nodes[ids[name]] = node
+	}
+	remoteLab1 := remote.Nodes[ids["lab1"]]
+	remoteLab1.Details = map[string]any{"stats": map[string]any{"grade": "3"}}
+	remote.Nodes[ids["lab1"]] = remoteLab1
+	remoteAds := remote.Nodes[ids["ads"]]
+	remoteAds.Title = "ads (remote)"
+	remote.Nodes[ids["ads"]] = remoteAds
+
+	doc, err := BuildExport(remote, ExportOptions{}, fresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := MergeExport(&local, doc, fresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Added != 1 || report.Updated != 2 || report.KeptLocal != 1 || report.Unchanged != 1 {
+		t.Fatalf("unexpected counts: %+v", report)
+	}
+	if len(report.Conflicts) != 3 {
+		t.Fatalf("expected 3 conflicts, got %+v", report.Conflicts)
+	}
+	if got := local.Nodes[ids["ads"]].Title; got != "ads (local)" {
+		t.Fatalf("fresher local node was overwritten: %q", got)
+	}
+	lab1 := local.Nodes[ids["lab1"]]
+	if lab1.Title != "lab1 (remote)" {
+		t.Fatalf("newer import did not win: %q", lab1.Title)
+	}
+	stats, _ := lab1.Details["stats"].(map[string]any)
+	if stats["grade"] != "8" || lab1.Details["config"] != "python" {
+		t.Fatalf("local details not preserved: %+v", lab1.Details)
+	}
+	if lab1.Assets[0].Path != "/home/me/spec.pdf" {
+		t.Fatalf("local asset path lost: %+v", lab1.Assets)
+	}
+	if !containsString(local.Nodes[ids["lab2"]].ParentIDs, ids["os"]) || !containsString(local.Nodes[ids["os"]].ChildIDs, ids["lab2"]) {
+		t.Fatalf("added node not linked into the graph")
+	}
+	if err := CheckEdgeConsistency(local); err != nil {
+		t.Fatalf("merge left inconsistent edges: %v", err)
+	}
+}
+
+func TestMergeExport_RejectsOtherBaseURL(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	local, _ := exportTestState(t, now)
+	remote, _ := exportTestState(t, now)
+	remote.BaseURL = "https://themis.example.org"
+	doc, err := BuildExport(remote, ExportOptions{}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MergeExport(&local, doc, now); !errors.Is(err, ErrBaseURLMismatch) {
+		t.Fatalf("expected ErrBaseURLMismatch, got %v", err)
+	}
+}
@@ -0,0 +1,431 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrIntegrity is returned by a strict load when the state graph is inconsistent.
+var ErrIntegrity = errors.New("state integrity check failed")
+
+// maxClockSkew is how far in the future a timestamp may be before it is flagged.
+const maxClockSkew = 24 * time.Hour
+
+// Issue codes reported by Check and Repair.
+const (
+	IssueKeyMismatch      = "key_mismatch"
+	IssueIDMismatch       = "id_mismatch"
+	IssueNonCanonicalURL  = "non_canonical_url"
+	IssueMissingURL       = "missing_url"
+	IssueDuplicateEdge    = "duplicate_edge"
+	IssueDanglingChild    = "dangling_child"
+	IssueDanglingParent   = "dangling_parent"
+	IssueAsymmetricEdge   = "asymmetric_edge"
+	IssueMissingRoot      = "missing_root"
+	IssueRootIDMismatch   = "root_id_mismatch"
+	IssueInvalidStatus    = "invalid_status"
+	IssueMissingTimestamp = "missing_timestamp"
+	IssueFutureTimestamp  = "future_timestamp"
+	IssueTimestampOrder   = "timestamp_order"
+)
+
+// Issue is one integrity problem found in a state graph.
+type Issue struct {
+	Code       string `json:"code"`
+	NodeID     string `json:"node_id,omitempty"`
+	Detail     string `json:"detail"`
+	Repairable bool   `json:"repairable"`
+	Repaired   bool   `json:"repaired,omitempty"`
+}
+
+// FsckReport is the result of Check or Repair.
+type FsckReport struct {
+	Nodes  int     `json:"nodes"`
+	Roots  int     `json:"roots"`
+	Issues []Issue `json:"issues"`
+}
+
+// Clean reports whether no issues were found.
+func (r FsckReport) Clean() bool {
+	return len(r.Issues) == 0
+}
+
+// Unresolved returns issues that were not repaired.
+func (r FsckReport) Unresolved() []Issue {
+	out := make([]Issue, 0)
+	for _, issue := range r.Issues {
+		if !issue.Repaired {
+			out = append(out, issue)
+		}
+	}
+	return out
+}
+
+// Check validates node identity, edge symmetry, root references, statuses and
+// timestamps without modifying st.
+func Check(st State, now time.Time) FsckReport {
+	clone, err := cloneState(st)
+	if err != nil {
+		return FsckReport{Issues: []Issue{{Code: "unreadable", Detail: err.Error()}}}
+	}
+	return fsck(&clone, now, false)
+}
+
+// Repair fixes what it can in place and reports every issue found; issues that
+// could not be fixed have Repaired=false. Parent ChildIDs are treated as the
+// source of truth for edges because they come from the fetched page.
+func Repair(st *State, now time.Time) FsckReport {
+	if st == nil {
+		return FsckReport{}
+	}
+	return fsck(st, now, true)
+}
+
+// FsckFile checks the state file at path. With repair it takes the write lock,
+// applies repairs and saves the result (keeping a .bak copy and backups under
+// the given policy) when anything changed.
+func FsckFile(path string, repair bool, backups BackupPolicy) (FsckReport, error) {
+	if err := ensureStateDir(path); err != nil {
+		return FsckReport{}, err
+	}
+	lock, err := acquireLock(lockPath(path), repair)
+	if err != nil {
+		return FsckReport{}, err
+	}
+	defer lock.Close()
+
+	raw, err := readStateFile(path)
+	if err != nil {
+		return FsckReport{}, err
+	}
+	st := NewEmptyState()
+	if raw != nil {
+		if _, err := DecodeMigrated(raw, CurrentSchemaVersion, stateMigrations, time.Now(), &st); err != nil {
+			return FsckReport{}, fmt.Errorf("decode state JSON: %w", err)
+		}
+	}
+
+	now := time.Now().UTC()
+	if !repair {
+		return Check(st, now), nil
+	}
+	report := Repair(&st, now)
+	for _, issue := range report.Issues {
+		if issue.Repaired {
+			if err := writeStateLocked(path, st, &backups); err != nil {
+				return report, err
+			}
+			break
+		}
+	}
+	return report, nil
+}
+
+func fsck(st *State, now time.Time, repair bool) FsckReport {
+	if st.Nodes == nil {
+		st.Nodes = map[string]Node{}
+	}
+	c := &fsckRun{st: st, now: now.UTC(), repair: repair, issues: []Issue{}}
+
+	c.checkIdentity()
+	c.checkDuplicateEdges()
+	c.checkDanglingEdges()
+	c.checkSymmetry()
+	c.checkRoots()
+	c.checkStatuses()
+	c.checkTimestamps()
+
+	return FsckReport{Nodes: len(st.Nodes), Roots: len(st.Roots), Issues: c.issues}
+}
+
+type fsckRun struct {
+	st     *State
+	now    time.Time
+	repair bool
+	issues []Issue
+}
+
+func (c *fsckRun) report(code string, nodeID string, repairable bool, detail string, args ...any) bool {
+	issue := Issue{
+		Code:       code,
+		NodeID:     nodeID,
+		Detail:     fmt.Sprintf(detail, args...),
+		Repairable: repairable,
+		Repaired:   repairable && c.repair,
+	}
+	c.issues = append(c.issues, issue)
+	return issue.Repairable
+}
+
+func (c *fsckRun) sortedIDs() []string {
+	ids := make([]string, 0, len(c.st.Nodes))
+	for id := range c.st.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// checkIdentity verifies map keys, node IDs and canonical URLs agree, and
+// re-keys nodes (rewriting references) when the correct ID is free.
+func (c *fsckRun) checkIdentity() {
+	renames := map[string]string{}
+	for _, key := range c.sortedIDs() {
+		node := c.st.Nodes[key]
+		if node.CanonicalURL == "" {
+			c.report(IssueMissingURL, key, false, "node has no canonical_url")
+			continue
+		}
+
+		canonical, err := CanonicalizeURL(node.CanonicalURL)
+		if err != nil {
+			c.report(IssueNonCanonicalURL, key, false, "canonical_url %q is invalid: %v", node.CanonicalURL, err)
+			continue
+		}
+		if canonical != node.CanonicalURL {
+			if c.report(IssueNonCanonicalURL, key, true, "canonical_url %q should be %q", node.CanonicalURL, canonical) && c.repair {
+				node.CanonicalURL = canonical
+				c.st.Nodes[key] = node
+			}
+		}
+
+		wantID := NodeIDFromCanonicalURL(canonical)
+		if node.ID != key && node.ID != wantID {
+			if c.report(IssueKeyMismatch, key, true, "node stored under %s has id %s", key, node.ID) && c.repair {
+				node.ID = key
+				c.st.Nodes[key] = node
+			}
+		}
+		if key == wantID {
+			if node.ID != wantID && c.repair {
+				node.ID = wantID
+				c.st.Nodes[key] = node
+			}
+			continue
+		}
+
+		if _, taken := c.st.Nodes[wantID]; taken {
+			c.report(IssueIDMismatch, key, false, "id should be %s for %s, but that id is already used by another node", wantID, canonical)
+			continue
+		}
+		if c.report(IssueIDMismatch, key, true, "id should be %s for %s", wantID, canonical) && c.repair {
+			delete(c.st.Nodes, key)
+			node.ID = wantID
+			c.st.Nodes[wantID] = node
+			renames[key] = wantID
+		}
+	}
+
+	if len(renames) == 0 {
+		return
+	}
+	rename := func(ids []string) []string {
+		out := make([]string, len(ids))
+		for i, id := range ids {
+			if next, ok := renames[id]; ok {
+				id = next
+			}
+			out[i] = id
+		}
+		return out
+	}
+	for id, node := range c.st.Nodes {
+		node.ParentIDs = rename(node.ParentIDs)
+		node.ChildIDs = rename(node.ChildIDs)
+		c.st.Nodes[id] = node
+	}
+	for i := range c.st.Roots {
+		if next, ok := renames[c.st.Roots[i].NodeID]; ok {
+			c.st.Roots[i].NodeID = next
+		}
+	}
+}
+
+func (c *fsckRun) checkDuplicateEdges() {
+	for _, id := range c.sortedIDs() {
+		node := c.st.Nodes[id]
+		parents := uniqueNonEmptyPreserveOrder(node.ParentIDs)
+		children := uniqueNonEmptyPreserveOrder(node.ChildIDs)
+		if len(parents) == len(node.ParentIDs) && len(children) == len(node.ChildIDs) {
+			continue
+		}
+		if c.report(IssueDuplicateEdge, id, true, "duplicate or empty ids in parent_ids/child_ids") && c.repair {
+			node.ParentIDs = parents
+			node.ChildIDs = children
+			c.st.Nodes[id] = node
+		}
+	}
+}
+
+func (c *fsckRun) checkDanglingEdges() {
+	for _, id := range c.sortedIDs() {
+		node := c.st.Nodes[id]
+		changed := false
+		for _, childID := range node.ChildIDs {
+			if _, ok := c.st.Nodes[childID]; ok {
+				continue
+			}
+			if c.report(IssueDanglingChild, id, true, "child %s does not exist", childID) && c.repair {
+				node.ChildIDs = removeString(node.ChildIDs, childID)
+				changed = true
+			}
+		}
+		for _, parentID := range node.ParentIDs {
+			if _, ok := c.st.Nodes[parentID]; ok {
+				continue
+			}
+			if c.report(IssueDanglingParent, id, true, "parent %s does not exist", parentID) && c.repair {
+				node.ParentIDs = removeString(node.ParentIDs, parentID)
+				changed = true
+			}
+		}
+		if changed {
+			c.st.Nodes[id] = node
+		}
+	}
+}
+
+func (c *fsckRun) checkSymmetry() {
+	for _, parentID := range c.sortedIDs() {
+		for _, childID := range c.st.Nodes[parentID].ChildIDs {
+			child, ok := c.st.Nodes[childID]
+			if !ok || containsString(child.ParentIDs, parentID) {
+				continue
+			}
+			if c.report(IssueAsymmetricEdge, childID, true, "%s lists %s as child but the reverse parent edge is missing", parentID, childID) && c.repair {
+				child.ParentIDs = append(child.ParentIDs, parentID)
+				c.st.Nodes[childID] = child
+			}
+		}
+	}
+	for _, childID := range c.sortedIDs() {
+		child := c.st.Nodes[childID]
+		for _, parentID := range child.ParentIDs {
+			parent, ok := c.st.Nodes[parentID]
+			if !ok || containsString(parent.ChildIDs, childID) {
+				continue
+			}
+			if c.report(IssueAsymmetricEdge, childID, true, "%s lists %s as parent but %s does not list it as child", childID, parentID, parentID) && c.repair {
+				child.ParentIDs = removeString(child.ParentIDs, parentID)
+				c.st.Nodes[childID] = child
+			}
+		}
+	}
+}
+
+func (c *fsckRun) checkRoots() {
+	kept := make([]RootRef, 0, len(c.st.Roots))
+	for _, root := range c.st.Roots {
+		if canonical, err := CanonicalizeURL(root.CanonicalURL); err == nil {
+			if wantID := NodeIDFromCanonicalURL(canonical); wantID != root.NodeID {
+				if c.report(IssueRootIDMismatch, root.NodeID, true, "root %s should have id %s", canonical, wantID) && c.repair {
+					root.NodeID = wantID
+					root.CanonicalURL = canonical
+				}
+			}
+		}
+		if _, ok := c.st.Nodes[root.NodeID]; !ok {
+			if c.report(IssueMissingRoot, root.NodeID, true, "root %s is not in nodes", root.CanonicalURL) && c.repair {
+				continue
+			}
+		}
+		kept = append(kept, root)
+	}
+	if c.repair {
+		c.st.Roots = kept
+	}
+}
+
+func (c *fsckRun) checkStatuses() {
+	for _, id := range c.sortedIDs() {
+		node := c.st.Nodes[id]
+		switch node.Status {
+		case StatusNever, StatusOK, StatusStale, StatusError:
+			continue
+		}
+		next := StatusNever
+		switch {
+		case node.LastError != "":
+			next = StatusError
+		case node.LastSuccessAt != nil:
+			next = StatusStale
+		}
+		if c.report(IssueInvalidStatus, id, true, "status %q is not one of never/ok/stale/error; resetting to %s", node.Status, next) && c.repair {
+			node.Status = next
+			c.st.Nodes[id] = node
+		}
+	}
+}
+
+func (c *fsckRun) checkTimestamps() {
+	limit := c.now.Add(maxClockSkew)
+	for _, id := range c.sortedIDs() {
+		node := c.st.Nodes[id]
+		changed := false
+
+		if node.CreatedAt.IsZero() || node.UpdatedAt.IsZero() {
+			if c.report(IssueMissingTimestamp, id, true, "created_at/updated_at is missing") && c.repair {
+				switch {
+				case node.CreatedAt.IsZero() && node.UpdatedAt.IsZero():
+					node.CreatedAt, node.UpdatedAt = c.now, c.now
+				case node.CreatedAt.IsZero():
+					node.CreatedAt = node.UpdatedAt
+				default:
+					node.UpdatedAt = node.CreatedAt
+				}
+				changed = true
+			}
+		}
+
+		for _, field := range []struct {
+			name string
+			ts   *time.Time
+		}{
+			{"created_at", &node.CreatedAt},
+			{"updated_at", &node.UpdatedAt},
+			{"last_fetched_at", node.LastFetchedAt},
+			{"last_success_at", node.LastSuccessAt},
+		} {
+			if field.ts == nil || !field.ts.After(limit) {
+				continue
+			}
+			if c.report(IssueFutureTimestamp, id, true, "%s %s is in the future", field.name, field.ts.Format(time.RFC3339)) && c.repair {
+				*field.ts = c.now
+				changed = true
+			}
+		}
+
+		if node.CreatedAt.After(node.UpdatedAt) {
+			if c.report(IssueTimestampOrder, id, true, "created_at is after updated_at") && c.repair {
+				node.CreatedAt = node.UpdatedAt
+				changed = true
+			}
+		}
+		if node.LastSuccessAt != nil && node.LastFetchedAt != nil && node.LastSuccessAt.After(*node.LastFetchedAt) {
+			if c.report(IssueTimestampOrder, id, true, "last_success_at is after last_fetched_at") && c.repair {
+				fetched := *node.LastSuccessAt
+				node.LastFetchedAt = &fetched
+				changed = true
+			}
+		}
+
+		if changed {
+			c.st.Nodes[id] = node
+		}
+	}
+}
+
+func cloneState(st State) (State, error) {
+	raw, err := json.Marshal(st)
+	if err != nil {
+		return State{}, err
+	}
+	var out State
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return State{}, err
+	}
+	return out, nil
+}
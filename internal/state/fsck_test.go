@@ -0,0 +1,126 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func fsckTestState(t *testing.T, now time.Time) (State, string, string) {
+	t.Helper()
+	g := newTestGraph(t, "https://themis.housing.rug.nl/course/2025-2026/os", now)
+	g.add("parent", "", Node{Kind: "course", Status: StatusOK})
+	g.add("child", "/lab1", Node{Kind: "assignment", Status: StatusNever})
+	g.link("parent", "child")
+	g.root("parent")
+	return g.st, g.ids["parent"], g.ids["child"]
+}
+
+func issueCodes(report FsckReport) map[string]int {
+	out := map[string]int{}
+	for _, issue := range report.Issues {
+		out[issue.Code]++
+	}
+	return out
+}
+
+func TestCheck_CleanGraphHasNoIssues(t *testing.T) {
+	now := time.Date(2026, 3, 17, 10, 0, 0, 0, time.UTC)
+	st, _, _ := fsckTestState(t, now)
+	if report := Check(st, now); !report.Clean() {
+		t.Fatalf("expected clean report, got %#v", report.Issues)
+	}
+}
+
+func TestRepair_FixesCorruptGraph(t *testing.T) {
+	now := time.Date(2026, 3, 17, 10, 0, 0, 0, time.UTC)
+	st, parentID, childID := fsckTestState(t, now)
+
+	child := st.Nodes[childID]
+	child.ParentIDs = nil
+	child.Status = "bogus"
+	future := now.Add(72 * time.Hour)
+	child.LastFetchedAt = &future
+	st.Nodes[childID] = child
+
+	parent := st.Nodes[parentID]
+	parent.ChildIDs = append(parent.ChildIDs, "url:missing", childID)
+	delete(st.Nodes, parentID)
+	st.Nodes["url:wrong-key"] = parent
+
+	st.Roots = append(st.Roots, RootRef{NodeID: "url:gone", CanonicalURL: "https://themis.housing.rug.nl/course/gone"})
+
+	report := Check(st, now)
+	codes := issueCodes(report)
+	for _, code := range []string{IssueIDMismatch, IssueDuplicateEdge, IssueDanglingChild, IssueAsymmetricEdge, IssueInvalidStatus, IssueFutureTimestamp, IssueRootIDMismatch} {
+		if codes[code] == 0 {
+			t.Fatalf("expected %s issue, got %#v", code, report.Issues)
+		}
+	}
+	if _, ok := st.Nodes["url:wrong-key"]; !ok {
+		t.Fatalf("Check must not modify state")
+	}
+
+	repaired := Repair(&st, now)
+	if len(repaired.Unresolved()) != 0 {
+		t.Fatalf("expected everything repaired, got %#v", repaired.Unresolved())
+	}
+	if err := CheckEdgeConsistency(st); err != nil {
+		t.Fatalf("edges still inconsistent: %v", err)
+	}
+	if again := Check(st, now); !again.Clean() {
+		t.Fatalf("expected clean graph after repair, got %#v", again.Issues)
+	}
+	if len(st.Roots) != 1 || st.Roots[0].NodeID != parentID {
+		t.Fatalf("unexpected roots: %#v", st.Roots)
+	}
+	if st.Nodes[childID].Status != StatusNever || !st.Nodes[childID].LastFetchedAt.Equal(now) {
+		t.Fatalf("unexpected child after repair: %#v", st.Nodes[childID])
+	}
+}
+
+func TestRepair_ReportsIDConflictAsUnresolved(t *testing.T) {
+	now := time.Date(2026, 3, 17, 10, 0, 0, 0, time.UTC)
+	st, parentID, _ := fsckTestState(t, now)
+	dup := st.Nodes[parentID]
+	dup.ID = "url:copy"
+	st.Nodes["url:copy"] = dup
+
+	report := Repair(&st, now)
+	unresolved := report.Unresolved()
+	if len(unresolved) != 1 || unresolved[0].Code != IssueIDMismatch || unresolved[0].Repairable {
+		t.Fatalf("expected one unrepairable id mismatch, got %#v", report.Issues)
+	}
+}
+
+func TestLoadWithOptions_StrictRejectsInconsistentState(t *testing.T) {
+	now := time.Now().UTC()
+	st, _, childID := fsckTestState(t, now)
+	child := st.Nodes[childID]
+	child.ParentIDs = nil
+	st.Nodes[childID] = child
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := SaveAtomic(path, st, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err != nil {
+		t.Fatalf("non-strict load should succeed: %v", err)
+	}
+	if _, err := LoadWithOptions(path, LoadOptions{Strict: true}); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("expected ErrIntegrity, got %v", err)
+	}
+
+	report, err := FsckFile(path, true, DefaultBackupPolicy())
+	if err != nil || len(report.Issues) == 0 || len(report.Unresolved()) != 0 {
+		t.Fatalf("unexpected fsck result: %#v %v", report, err)
+	}
+	if _, err := os.Stat(path + ".bak"); err != nil {
+		t.Fatalf("expected backup after repair: %v", err)
+	}
+	if _, err := LoadWithOptions(path, LoadOptions{Strict: true}); err != nil {
+		t.Fatalf("strict load after repair failed: %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultGCGracePeriod keeps orphaned nodes around for a while in case the
+	// removal was a transient page glitch.
+	DefaultGCGracePeriod = 30 * 24 * time.Hour
+	// DefaultTombstoneMaxAge is how long removed-child tombstones are kept.
+	DefaultTombstoneMaxAge = 180 * 24 * time.Hour
+)
+
+// GCOptions controls CollectGarbage.
+type GCOptions struct {
+	// GracePeriod is how long an unreachable node is kept after it was orphaned.
+	GracePeriod time.Duration
+	// TombstoneMaxAge prunes tombstones older than this. Zero keeps them.
+	TombstoneMaxAge time.Duration
+}
+
+// GCReport summarises a garbage collection run.
+type GCReport struct {
+	Reachable        int      `json:"reachable"`
+	Orphaned         int      `json:"orphaned"`
+	RemovedNodeIDs   []string `json:"removed_node_ids"`
+	KeptInGrace      []string `json:"kept_in_grace"`
+	PrunedTombstones int      `json:"pruned_tombstones"`
+	BytesBefore      int64    `json:"bytes_before,omitempty"`
+	BytesAfter       int64    `json:"bytes_after,omitempty"`
+}
+
+// FreedBytes is the size reduction of the encoded state.
+func (r GCReport) FreedBytes() int64 {
+	return r.BytesBefore - r.BytesAfter
+}
+
+// Changed reports whether the run removed anything.
+func (r GCReport) Changed() bool {
+	return len(r.RemovedNodeIDs) > 0 || r.PrunedTombstones > 0
+}
+
+// CollectGarbage removes nodes unreachable from any root or the catalog root
+// once they have been orphaned for longer than opts.GracePeriod, and prunes old
+// tombstones. A node counts as orphaned from the newest tombstone recording its
+// removal, inherited from orphaned ancestors, falling back to its updated_at.
+func CollectGarbage(st *State, now time.Time, opts GCOptions) GCReport {
+	report := GCReport{RemovedNodeIDs: []string{}, KeptInGrace: []string{}}
+	if st == nil || st.Nodes == nil {
+		return report
+	}
+	now = now.UTC()
+
+	reachable := reachableNodeIDs(*st)
+	report.Reachable = len(reachable)
+
+	removedAt := map[string]time.Time{}
+	for _, node := range st.Nodes {
+		for _, ts := range coerceTombstones(node.Details[TombstonesDetailsKey]) {
+			if ts.RemovedAt.After(removedAt[ts.ChildID]) {
+				removedAt[ts.ChildID] = ts.RemovedAt
+			}
+		}
+	}
+
+	orphanedAt := map[string]time.Time{}
+	var since func(id string, seen map[string]bool) time.Time
+	since = func(id string, seen map[string]bool) time.Time {
+		if ts, ok := orphanedAt[id]; ok {
+			return ts
+		}
+		if ts, ok := removedAt[id]; ok {
+			orphanedAt[id] = ts
+			return ts
+		}
+		seen[id] = true
+		var latest time.Time
+		for _, parentID := range st.Nodes[id].ParentIDs {
+			if _, ok := reachable[parentID]; ok || seen[parentID] {
+				continue
+			}
+			if _, ok := st.Nodes[parentID]; !ok {
+				continue
+			}
+			if ts := since(parentID, seen); ts.After(latest) {
+				latest = ts
+			}
+		}
+		if latest.IsZero() {
+			latest = st.Nodes[id].UpdatedAt
+		}
+		orphanedAt[id] = latest
+		return latest
+	}
+
+	orphans := make([]string, 0)
+	for id := range st.Nodes {
+		if _, ok := reachable[id]; !ok {
+			orphans = append(orphans, id)
+		}
+	}
+	sort.Strings(orphans)
+	report.Orphaned = len(orphans)
+
+	removed := map[string]bool{}
+	for _, id := range orphans {
+		if now.Sub(since(id, map[string]bool{})) < opts.GracePeriod {
+			report.KeptInGrace = append(report.KeptInGrace, id)
+			continue
+		}
+		removed[id] = true
+		report.RemovedNodeIDs = append(report.RemovedNodeIDs, id)
+	}
+	for id := range removed {
+		delete(st.Nodes, id)
+	}
+
+	for id, node := range st.Nodes {
+		changed := false
+		if len(removed) > 0 {
+			parents := filterIDs(node.ParentIDs, removed)
+			children := filterIDs(node.ChildIDs, removed)
+			if len(parents) != len(node.ParentIDs) || len(children) != len(node.ChildIDs) {
+				node.ParentIDs, node.ChildIDs = parents, children
+				changed = true
+			}
+		}
+		if pruned := pruneTombstones(&node, now, opts.TombstoneMaxAge); pruned > 0 {
+			report.PrunedTombstones += pruned
+			changed = true
+		}
+		if changed {
+			st.Nodes[id] = node
+		}
+	}
+
+	return report
+}
+
+// GCFile runs CollectGarbage on the state file at path. Unless dryRun is set
+// the result is saved atomically with a .bak copy and backups under the given
+// policy.
+func GCFile(path string, opts GCOptions, dryRun bool, backups BackupPolicy) (GCReport, error) {
+	if err := ensureStateDir(path); err != nil {
+		return GCReport{}, err
+	}
+	lock, err := acquireLock(lockPath(path), !dryRun)
+	if err != nil {
+		return GCReport{}, err
+	}
+	defer lock.Close()
+
+	raw, err := readStateFile(path)
+	if err != nil {
+		return GCReport{}, err
+	}
+	if raw == nil {
+		return GCReport{RemovedNodeIDs: []string{}, KeptInGrace: []string{}}, nil
+	}
+	var st State
+	if _, err := DecodeMigrated(raw, CurrentSchemaVersion, stateMigrations, time.Now(), &st); err != nil {
+		return GCReport{}, fmt.Errorf("decode state JSON: %w", err)
+	}
+
+	report := CollectGarbage(&st, time.Now(), opts)
+	report.BytesBefore = int64(len(raw))
+	report.BytesAfter = report.BytesBefore
+	if !report.Changed() {
+		return report, nil
+	}
+	encoded, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return report, fmt.Errorf("encode state JSON: %w", err)
+	}
+	report.BytesAfter = int64(len(encoded) + 1)
+
+	if dryRun {
+		return report, nil
+	}
+	if err := writeStateLocked(path, st, &backups); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+func reachableNodeIDs(st State) map[string]struct{} {
+	queue := make([]string, 0, len(st.Roots)+1)
+	for _, root := range st.Roots {
+		queue = append(queue, root.NodeID)
+	}
+	if st.CatalogRootURL != "" {
+		if canonical, err := CanonicalizeURL(st.CatalogRootURL); err == nil {
+			queue = append(queue, NodeIDFromCanonicalURL(canonical))
+		}
+	}
+
+	seen := map[string]struct{}{}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		node, ok := st.Nodes[id]
+		if !ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		queue = append(queue, node.ChildIDs...)
+	}
+	return seen
+}
+
+// pruneTombstones drops tombstones older than maxAge and those for children
+// that have since been re-added.
+func pruneTombstones(node *Node, now time.Time, maxAge time.Duration) int {
+	raw, ok := node.Details[TombstonesDetailsKey]
+	if !ok {
+		return 0
+	}
+	tombstones := coerceTombstones(raw)
+	kept := make([]Tombstone, 0, len(tombstones))
+	for _, ts := range tombstones {
+		if maxAge > 0 && now.Sub(ts.RemovedAt) > maxAge {
+			continue
+		}
+		if containsString(node.ChildIDs, ts.ChildID) {
+			continue
+		}
+		kept = append(kept, ts)
+	}
+	pruned := len(tombstones) - len(kept)
+	if pruned == 0 {
+		return 0
+	}
+	if len(kept) == 0 {
+		delete(node.Details, TombstonesDetailsKey)
+	} else {
+		node.Details[TombstonesDetailsKey] = kept
+	}
+	return pruned
+}
+
+func filterIDs(ids []string, drop map[string]bool) []string {
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !drop[id] {
+			out = append(out, id)
+		}
+	}
+	return out
+}
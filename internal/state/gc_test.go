@@ -0,0 +1,106 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func gcTestState(t *testing.T, removedAt time.Time) (State, map[string]string) {
+	t.Helper()
+	g := newTestGraph(t, "https://themis.housing.rug.nl/course/2024-2025/os", removedAt.Add(-time.Hour))
+	g.add("root", "", Node{})
+	g.add("kept", "/lab1", Node{})
+	g.add("dropped", "/lab2", Node{})
+	g.add("grandkid", "/lab2/task", Node{})
+	g.link("root", "kept", "dropped")
+	g.link("dropped", "grandkid")
+	g.root("root")
+
+	st, ids := g.st, g.ids
+	diff, err := SetChildren(&st, ids["root"], []string{ids["kept"]}, removedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := st.Nodes[ids["root"]]
+	if err := ApplyChildRemovalTombstones(&root, diff.Removed, removedAt, 10); err != nil {
+		t.Fatal(err)
+	}
+	st.Nodes[ids["root"]] = root
+	return st, ids
+}
+
+func TestCollectGarbage_RespectsGracePeriod(t *testing.T) {
+	removedAt := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	st, ids := gcTestState(t, removedAt)
+
+	report := CollectGarbage(&st, removedAt.Add(24*time.Hour), GCOptions{GracePeriod: 7 * 24 * time.Hour})
+	if report.Orphaned != 2 || len(report.KeptInGrace) != 2 || len(report.RemovedNodeIDs) != 0 {
+		t.Fatalf("expected orphans kept in grace, got %#v", report)
+	}
+
+	report = CollectGarbage(&st, removedAt.Add(8*24*time.Hour), GCOptions{GracePeriod: 7 * 24 * time.Hour})
+	if len(report.RemovedNodeIDs) != 2 {
+		t.Fatalf("expected dropped subtree removed, got %#v", report)
+	}
+	if _, ok := st.Nodes[ids["grandkid"]]; ok {
+		t.Fatalf("grandchild of dropped node should be collected")
+	}
+	if _, ok := st.Nodes[ids["kept"]]; !ok {
+		t.Fatalf("reachable node must be kept")
+	}
+	if err := CheckEdgeConsistency(st); err != nil {
+		t.Fatalf("edges inconsistent after gc: %v", err)
+	}
+}
+
+func TestCollectGarbage_PrunesOldAndReaddedTombstones(t *testing.T) {
+	removedAt := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	st, ids := gcTestState(t, removedAt)
+
+	report := CollectGarbage(&st, removedAt.Add(time.Hour), GCOptions{GracePeriod: time.Hour * 24, TombstoneMaxAge: 48 * time.Hour})
+	if report.PrunedTombstones != 0 {
+		t.Fatalf("fresh tombstone should be kept, got %#v", report)
+	}
+	report = CollectGarbage(&st, removedAt.Add(72*time.Hour), GCOptions{GracePeriod: 365 * 24 * time.Hour, TombstoneMaxAge: 48 * time.Hour})
+	if report.PrunedTombstones != 1 || report.Orphaned != 2 || len(report.RemovedNodeIDs) != 0 {
+		t.Fatalf("expected old tombstone pruned and orphans kept, got %#v", report)
+	}
+	if _, ok := st.Nodes[ids["root"]].Details[TombstonesDetailsKey]; ok {
+		t.Fatalf("expected empty tombstone list to be dropped")
+	}
+}
+
+func TestGCFile_DryRunDoesNotWrite(t *testing.T) {
+	removedAt := time.Now().UTC().Add(-60 * 24 * time.Hour)
+	st, _ := gcTestState(t, removedAt)
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := SaveAtomic(path, st, false); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(path)
+
+	report, err := GCFile(path, GCOptions{GracePeriod: DefaultGCGracePeriod}, true, DefaultBackupPolicy())
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if len(report.RemovedNodeIDs) != 2 || report.FreedBytes() <= 0 {
+		t.Fatalf("unexpected dry-run report: %#v", report)
+	}
+	after, _ := os.ReadFile(path)
+	if string(before) != string(after) {
+		t.Fatalf("dry run modified the state file")
+	}
+
+	if _, err := GCFile(path, GCOptions{GracePeriod: DefaultGCGracePeriod}, false, DefaultBackupPolicy()); err != nil {
+		t.Fatalf("gc failed: %v", err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Nodes) != 2 {
+		t.Fatalf("expected 2 nodes after gc, got %d", len(loaded.Nodes))
+	}
+}
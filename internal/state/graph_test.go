@@ -6,6 +6,50 @@ import (
 	"time"
 )
 
+// testGraph builds small catalogs for tests. Nodes are named, and their URLs
+// are paths under a common base.
+type testGraph struct {
+	t    *testing.T
+	base string
+	now  time.Time
+	st   State
+	ids  map[string]string
+}
+
+func newTestGraph(t *testing.T, base string, now time.Time) *testGraph {
+	t.Helper()
+	return &testGraph{t: t, base: base, now: now, st: NewEmptyState(), ids: map[string]string{}}
+}
+
+// add upserts node as name at base+path, filling in its ID and URL.
+func (g *testGraph) add(name string, path string, node Node) {
+	g.t.Helper()
+	node.CanonicalURL = g.base + path
+	node.ID = NodeIDFromCanonicalURL(node.CanonicalURL)
+	if _, _, err := UpsertNode(&g.st, node, g.now); err != nil {
+		g.t.Fatal(err)
+	}
+	g.ids[name] = node.ID
+}
+
+// link sets the children of parent.
+func (g *testGraph) link(parent string, children ...string) {
+	g.t.Helper()
+	ids := make([]string, 0, len(children))
+	for _, name := range children {
+		ids = append(ids, g.ids[name])
+	}
+	if _, err := SetChildren(&g.st, g.ids[parent], ids, g.now); err != nil {
+		g.t.Fatal(err)
+	}
+}
+
+// root makes name the only root.
+func (g *testGraph) root(name string) {
+	node := g.st.Nodes[g.ids[name]]
+	g.st.Roots = []RootRef{{NodeID: node.ID, CanonicalURL: node.CanonicalURL, UpdatedAt: g.now}}
+}
+
 func TestDiffChildren(t *testing.T) {
 	diff := DiffChildren([]string{"c1", "c2", "c2"}, []string{"c2", "c3", "", "c3"})
 
@@ -0,0 +1,223 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrSchemaTooNew is returned for documents written by a newer binary.
+var ErrSchemaTooNew = errors.New("schema version is newer than supported")
+
+// Migration upgrades a decoded JSON document from schema From to To. Apply
+// only reshapes the document; the runner updates schema_version and records
+// the step under "migrations".
+type Migration struct {
+	From  int
+	To    int
+	Name  string
+	Apply func(doc map[string]any) error
+}
+
+// AppliedMigration is the timestamped record stored for each executed step.
+type AppliedMigration struct {
+	From      int       `json:"from"`
+	To        int       `json:"to"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// MigrationPlan lists the steps needed to bring a document to the target schema.
+type MigrationPlan struct {
+	From  int         `json:"from"`
+	To    int         `json:"to"`
+	Steps []Migration `json:"-"`
+}
+
+// Names returns the step names in execution order.
+func (p MigrationPlan) Names() []string {
+	out := make([]string, 0, len(p.Steps))
+	for _, step := range p.Steps {
+		out = append(out, fmt.Sprintf("%d->%d %s", step.From, step.To, step.Name))
+	}
+	return out
+}
+
+// Pending reports whether the plan has any step to run.
+func (p MigrationPlan) Pending() bool {
+	return len(p.Steps) > 0
+}
+
+// stateMigrations is the registry for state.json, ordered by From.
+var stateMigrations = []Migration{
+	{
+		From: 0,
+		To:   1,
+		Name: "initial-schema",
+		Apply: func(doc map[string]any) error {
+			if _, ok := doc["roots"].([]any); !ok {
+				doc["roots"] = []any{}
+			}
+			if _, ok := doc["nodes"].(map[string]any); !ok {
+				doc["nodes"] = map[string]any{}
+			}
+			return nil
+		},
+	},
+}
+
+// PlanMigrations chains registry steps from version to target. It fails when
+// version is newer than target or when the registry has a gap.
+func PlanMigrations(version int, target int, registry []Migration) (MigrationPlan, error) {
+	plan := MigrationPlan{From: version, To: target}
+	if version > target {
+		return plan, fmt.Errorf("%w: file has schema_version %d, this binary supports up to %d", ErrSchemaTooNew, version, target)
+	}
+	current := version
+	for current < target {
+		var next *Migration
+		for i := range registry {
+			if registry[i].From == current {
+				next = &registry[i]
+				break
+			}
+		}
+		if next == nil {
+			return plan, fmt.Errorf("no migration registered from schema_version %d", current)
+		}
+		if next.To <= next.From {
+			return plan, fmt.Errorf("migration %q must increase schema_version", next.Name)
+		}
+		plan.Steps = append(plan.Steps, *next)
+		current = next.To
+	}
+	return plan, nil
+}
+
+// MigrateDocument runs every pending step on doc in order. Each step runs only
+// when doc is at its From version, so re-running on a migrated document is a
+// no-op. Applied steps are appended to doc["migrations"].
+func MigrateDocument(doc map[string]any, target int, registry []Migration, now time.Time) ([]AppliedMigration, error) {
+	version, err := documentSchemaVersion(doc)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := PlanMigrations(version, target, registry)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make([]AppliedMigration, 0, len(plan.Steps))
+	for _, step := range plan.Steps {
+		if step.Apply != nil {
+			if err := step.Apply(doc); err != nil {
+				return applied, fmt.Errorf("migration %d->%d %s: %w", step.From, step.To, step.Name, err)
+			}
+		}
+		record := AppliedMigration{From: step.From, To: step.To, Name: step.Name, AppliedAt: now.UTC()}
+		doc["schema_version"] = step.To
+		history, _ := doc["migrations"].([]any)
+		doc["migrations"] = append(history, map[string]any{
+			"from":       record.From,
+			"to":         record.To,
+			"name":       record.Name,
+			"applied_at": record.AppliedAt.Format(time.RFC3339Nano),
+		})
+		applied = append(applied, record)
+	}
+	return applied, nil
+}
+
+// DecodeMigrated decodes raw into out, first running any migrations needed to
+// reach target. Documents already at target are decoded directly.
+func DecodeMigrated(raw []byte, target int, registry []Migration, now time.Time, out any) ([]AppliedMigration, error) {
+	var header struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return nil, err
+	}
+	if header.SchemaVersion == target {
+		return nil, json.Unmarshal(raw, out)
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	applied, err := MigrateDocument(doc, target, registry, now)
+	if err != nil {
+		return nil, err
+	}
+	migrated, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("encode migrated document: %w", err)
+	}
+	if err := json.Unmarshal(migrated, out); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// PlanStateMigrations reports the steps Load would apply to the file at path.
+func PlanStateMigrations(path string) (MigrationPlan, error) {
+	raw, err := readStateFile(path)
+	if err != nil {
+		return MigrationPlan{}, err
+	}
+	if raw == nil {
+		return MigrationPlan{From: CurrentSchemaVersion, To: CurrentSchemaVersion}, nil
+	}
+	var header struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return MigrationPlan{}, fmt.Errorf("decode state JSON: %w", err)
+	}
+	return PlanMigrations(header.SchemaVersion, CurrentSchemaVersion, stateMigrations)
+}
+
+// MigrateFile applies pending state migrations and writes the result back
+// atomically (keeping a .bak copy and backups under the given policy). It
+// returns the steps that were applied.
+func MigrateFile(path string, backups BackupPolicy) ([]AppliedMigration, error) {
+	if err := ensureStateDir(path); err != nil {
+		return nil, err
+	}
+	lock, err := acquireLock(lockPath(path), true)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Close()
+
+	raw, err := readStateFile(path)
+	if err != nil || raw == nil {
+		return nil, err
+	}
+	var st State
+	applied, err := DecodeMigrated(raw, CurrentSchemaVersion, stateMigrations, time.Now(), &st)
+	if err != nil {
+		return nil, fmt.Errorf("migrate state: %w", err)
+	}
+	if len(applied) == 0 {
+		return nil, nil
+	}
+	if err := writeStateLocked(path, st, &backups); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+func documentSchemaVersion(doc map[string]any) (int, error) {
+	switch v := doc["schema_version"].(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return int(v), nil
+	case int:
+		return v, nil
+	default:
+		return 0, fmt.Errorf("invalid schema_version %v", v)
+	}
+}
@@ -0,0 +1,97 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPlanMigrations_ChainsStepsAndRejectsGapsAndNewer(t *testing.T) {
+	registry := []Migration{
+		{From: 1, To: 2, Name: "b"},
+		{From: 0, To: 1, Name: "a"},
+	}
+	plan, err := PlanMigrations(0, 2, registry)
+	if err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	names := plan.Names()
+	if len(names) != 2 || names[0] != "0->1 a" || names[1] != "1->2 b" {
+		t.Fatalf("unexpected plan: %#v", names)
+	}
+
+	if _, err := PlanMigrations(0, 3, registry); err == nil {
+		t.Fatalf("expected gap error")
+	}
+	if _, err := PlanMigrations(3, 2, registry); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("expected ErrSchemaTooNew, got %v", err)
+	}
+}
+
+func TestMigrateDocument_IsIdempotentAndRecordsHistory(t *testing.T) {
+	calls := 0
+	registry := []Migration{{From: 0, To: 1, Name: "init", Apply: func(doc map[string]any) error {
+		calls++
+		doc["added"] = true
+		return nil
+	}}}
+	doc := map[string]any{}
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	applied, err := MigrateDocument(doc, 1, registry, now)
+	if err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if len(applied) != 1 || applied[0].AppliedAt != now || doc["schema_version"] != 1 {
+		t.Fatalf("unexpected result: %#v doc=%#v", applied, doc)
+	}
+	again, err := MigrateDocument(doc, 1, registry, now)
+	if err != nil {
+		t.Fatalf("second migrate failed: %v", err)
+	}
+	if len(again) != 0 || calls != 1 {
+		t.Fatalf("expected no-op on migrated document, applied=%d calls=%d", len(again), calls)
+	}
+	if history, _ := doc["migrations"].([]any); len(history) != 1 {
+		t.Fatalf("unexpected history: %#v", doc["migrations"])
+	}
+}
+
+func TestLoad_MigratesUnversionedFileAndRejectsNewer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte(`{"base_url":"https://themis.housing.rug.nl"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := Load(path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if st.SchemaVersion != CurrentSchemaVersion || len(st.Migrations) != 1 || st.Migrations[0].Name != "initial-schema" {
+		t.Fatalf("expected recorded migration, got version=%d migrations=%#v", st.SchemaVersion, st.Migrations)
+	}
+	if st.Nodes == nil || st.Roots == nil {
+		t.Fatalf("expected initialized collections")
+	}
+
+	applied, err := MigrateFile(path, DefaultBackupPolicy())
+	if err != nil || len(applied) != 1 {
+		t.Fatalf("migrate file: applied=%#v err=%v", applied, err)
+	}
+	plan, err := PlanStateMigrations(path)
+	if err != nil || plan.Pending() {
+		t.Fatalf("expected migrated file to be current: %#v %v", plan, err)
+	}
+	if applied, err := MigrateFile(path, DefaultBackupPolicy()); err != nil || len(applied) != 0 {
+		t.Fatalf("expected second migrate to be a no-op: %#v %v", applied, err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"schema_version":99}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("expected ErrSchemaTooNew, got %v", err)
+	}
+}
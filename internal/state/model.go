@@ -20,6 +20,8 @@ type State struct {
 	UpdatedAt      time.Time       `json:"updated_at"`
 	Roots          []RootRef       `json:"roots"`
 	Nodes          map[string]Node `json:"nodes"`
+	// Migrations records schema upgrades applied to this file, oldest first.
+	Migrations []AppliedMigration `json:"migrations,omitempty"`
 }
 
 type RootRef struct {
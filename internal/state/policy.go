@@ -81,6 +81,102 @@ func ApplyStateStalePolicy(st *State, now time.Time, ttl time.Duration) (int, er
 	return updated, nil
 }
 
+// NodeKinds are the node kinds discovery assigns, from the catalog down.
+var NodeKinds = []string{"catalog", "year", "course", "assignment"}
+
+// StalePolicy holds the age after which an OK node counts as stale, per node
+// kind (catalog, year, course, assignment). Kinds without an entry use Default.
+type StalePolicy struct {
+	Default time.Duration
+	ByKind  map[string]time.Duration
+}
+
+// DefaultStalePolicy marks every kind stale two hours after its last success.
+func DefaultStalePolicy() StalePolicy {
+	return StalePolicy{Default: 2 * time.Hour, ByKind: map[string]time.Duration{}}
+}
+
+// TTL returns the staleness threshold for kind.
+func (p StalePolicy) TTL(kind string) time.Duration {
+	if ttl, ok := p.ByKind[kind]; ok && ttl > 0 {
+		return ttl
+	}
+	return p.Default
+}
+
+// NodeAge is the time since the node's last successful fetch; ok is false when
+// it never succeeded.
+func NodeAge(node Node, now time.Time) (time.Duration, bool) {
+	if node.LastSuccessAt == nil {
+		return 0, false
+	}
+	age := now.UTC().Sub(node.LastSuccessAt.UTC())
+	if age < 0 {
+		age = 0
+	}
+	return age, true
+}
+
+// ApplyStalePolicyByKind re-evaluates staleness for every node with the TTL of
+// its kind. Unlike ApplyStateStalePolicy it also returns STALE nodes to OK when
+// they are younger than their TTL, so a longer TTL takes effect on stored
+// state. ERROR and NEVER nodes are left alone.
+func ApplyStalePolicyByKind(st *State, now time.Time, policy StalePolicy) (int, error) {
+	if st == nil {
+		return 0, fmt.Errorf("state is nil")
+	}
+	updated := 0
+	for id, node := range st.Nodes {
+		if node.Status != StatusOK && node.Status != StatusStale {
+			continue
+		}
+		ttl := policy.TTL(node.Kind)
+		if ttl <= 0 {
+			return updated, fmt.Errorf("ttl for kind %q must be > 0", node.Kind)
+		}
+		age, ok := NodeAge(node, now)
+		if !ok {
+			continue
+		}
+		want := StatusOK
+		if age >= ttl {
+			want = StatusStale
+		}
+		if node.Status == want {
+			continue
+		}
+		node.Status = want
+		node.UpdatedAt = now.UTC()
+		st.Nodes[id] = node
+		updated++
+	}
+	return updated, nil
+}
+
+// FormatAge renders an age compactly for listings, e.g. "45m", "5h10m", "3d4h".
+func FormatAge(age time.Duration) string {
+	switch {
+	case age < time.Minute:
+		return "<1m"
+	case age < time.Hour:
+		return fmt.Sprintf("%dm", int(age/time.Minute))
+	case age < 24*time.Hour:
+		h := int(age / time.Hour)
+		m := int((age % time.Hour) / time.Minute)
+		if m == 0 {
+			return fmt.Sprintf("%dh", h)
+		}
+		return fmt.Sprintf("%dh%dm", h, m)
+	default:
+		d := int(age / (24 * time.Hour))
+		h := int((age % (24 * time.Hour)) / time.Hour)
+		if h == 0 {
+			return fmt.Sprintf("%dd", d)
+		}
+		return fmt.Sprintf("%dd%dh", d, h)
+	}
+}
+
 // ApplyChildRemovalTombstones stores optional tombstones for removed children in node.details.
 func ApplyChildRemovalTombstones(node *Node, removedChildIDs []string, now time.Time, maxItems int) error {
 	if node == nil {
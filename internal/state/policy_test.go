@@ -111,6 +111,79 @@ func TestApplyStateStalePolicy(t *testing.T) {
 	}
 }
 
+func TestApplyStalePolicyByKind(t *testing.T) {
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+	threeHours := now.Add(-3 * time.Hour)
+
+	st := NewEmptyState()
+	st.Nodes = map[string]Node{
+		"url:course":     {ID: "url:course", Kind: "course", Status: StatusOK, LastSuccessAt: &threeHours},
+		"url:assignment": {ID: "url:assignment", Kind: "assignment", Status: StatusOK, LastSuccessAt: &threeHours},
+		"url:year":       {ID: "url:year", Kind: "year", Status: StatusStale, LastSuccessAt: &threeHours},
+		"url:error":      {ID: "url:error", Kind: "assignment", Status: StatusError, LastSuccessAt: &threeHours},
+		"url:never":      {ID: "url:never", Kind: "assignment", Status: StatusNever},
+	}
+	policy := StalePolicy{
+		Default: 2 * time.Hour,
+		ByKind:  map[string]time.Duration{"course": 24 * time.Hour, "year": 7 * 24 * time.Hour},
+	}
+
+	updated, err := ApplyStalePolicyByKind(&st, now, policy)
+	if err != nil {
+		t.Fatalf("apply policy failed: %v", err)
+	}
+	if updated != 2 {
+		t.Fatalf("expected 2 updates, got %d", updated)
+	}
+	want := map[string]Status{
+		"url:course":     StatusOK,
+		"url:assignment": StatusStale,
+		"url:year":       StatusOK,
+		"url:error":      StatusError,
+		"url:never":      StatusNever,
+	}
+	for id, status := range want {
+		if got := st.Nodes[id].Status; got != status {
+			t.Fatalf("%s: expected %s, got %s", id, status, got)
+		}
+	}
+}
+
+func TestApplyStalePolicyByKind_RejectsZeroTTL(t *testing.T) {
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+	st := NewEmptyState()
+	st.Nodes = map[string]Node{"url:a": {ID: "url:a", Kind: "course", Status: StatusOK, LastSuccessAt: &now}}
+	if _, err := ApplyStalePolicyByKind(&st, now, StalePolicy{}); err == nil {
+		t.Fatalf("expected error for zero ttl")
+	}
+}
+
+func TestNodeAgeAndFormatAge(t *testing.T) {
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+	if _, ok := NodeAge(Node{}, now); ok {
+		t.Fatalf("never-fetched node should have no age")
+	}
+	success := now.Add(-(26*time.Hour + 10*time.Minute))
+	age, ok := NodeAge(Node{LastSuccessAt: &success}, now)
+	if !ok || age != 26*time.Hour+10*time.Minute {
+		t.Fatalf("unexpected age %s", age)
+	}
+
+	cases := map[time.Duration]string{
+		30 * time.Second:             "<1m",
+		45 * time.Minute:             "45m",
+		5 * time.Hour:                "5h",
+		5*time.Hour + 10*time.Minute: "5h10m",
+		age:                          "1d2h",
+		72 * time.Hour:               "3d",
+	}
+	for in, want := range cases {
+		if got := FormatAge(in); got != want {
+			t.Fatalf("FormatAge(%s) = %q, want %q", in, got, want)
+		}
+	}
+}
+
 func TestApplyChildRemovalTombstones(t *testing.T) {
 	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
 	n := Node{Details: map[string]any{}}
@@ -0,0 +1,122 @@
+package state
+
+import (
+	"strings"
+	"time"
+)
+
+// ResultLabel summarises a node for display and filtering. Assignments report
+// their submission outcome from the stats details ("passed", "failing", a
+// grade, "not_submitted" or "unknown"); other nodes report their fetch status.
+func ResultLabel(node Node) string {
+	if strings.TrimSpace(strings.ToLower(node.Kind)) != "assignment" {
+		switch node.Status {
+		case StatusOK:
+			return "ok"
+		case StatusStale:
+			return "stale"
+		case StatusError:
+			return "error"
+		case StatusNever:
+			return "never"
+		default:
+			return "unknown"
+		}
+	}
+
+	summary := detailsMap(detailsMap(node.Details, "stats"), "summary")
+	status := normalizeDetailsKey(detailsString(summary, "status"))
+	statusText := normalizeDetailsKey(detailsString(summary, "status_text"))
+	combined := strings.TrimSpace(status + " " + statusText)
+
+	if containsAnySubstring(combined, "passed", "pass") {
+		return "passed"
+	}
+	if containsAnySubstring(combined, "failed", "failing", "wrong", "error", "timeout", "diff", "runtime") {
+		return "failing"
+	}
+	if grade := detailsString(summary, "grade"); grade != "" {
+		return grade
+	}
+	if statusPageLink(node.Details) != "" {
+		return "not_submitted"
+	}
+	return "unknown"
+}
+
+// DueAt returns the assignment deadline recorded in details.config.end_iso.
+func DueAt(node Node) (time.Time, bool) {
+	raw := detailsString(detailsMap(node.Details, "config"), "end_iso")
+	if raw == "" {
+		return time.Time{}, false
+	}
+	due, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return due.UTC(), true
+}
+
+// statusPageLink reads details.links.status_page, which is a map[string]string
+// when freshly scraped and a map[string]any after a JSON round trip.
+func statusPageLink(details map[string]any) string {
+	switch links := details["links"].(type) {
+	case map[string]string:
+		return strings.TrimSpace(links["status_page"])
+	case map[string]any:
+		s, _ := links["status_page"].(string)
+		return strings.TrimSpace(s)
+	}
+	return ""
+}
+
+func detailsMap(m map[string]any, key string) map[string]any {
+	v, ok := lookupDetailsKey(m, key)
+	if !ok {
+		return nil
+	}
+	out, _ := v.(map[string]any)
+	return out
+}
+
+func detailsString(m map[string]any, key string) string {
+	v, ok := lookupDetailsKey(m, key)
+	if !ok {
+		return ""
+	}
+	s, _ := v.(string)
+	return strings.TrimSpace(s)
+}
+
+// lookupDetailsKey finds key in m, falling back to a case/spacing-insensitive
+// match since scraped labels vary between pages.
+func lookupDetailsKey(m map[string]any, key string) (any, bool) {
+	if m == nil {
+		return nil, false
+	}
+	if v, ok := m[key]; ok {
+		return v, true
+	}
+	target := normalizeDetailsKey(key)
+	for k, v := range m {
+		if normalizeDetailsKey(k) == target {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func normalizeDetailsKey(raw string) string {
+	out := strings.Join(strings.Fields(strings.ToLower(raw)), "_")
+	out = strings.ReplaceAll(out, "-", "_")
+	return strings.Trim(out, "_:")
+}
+
+func containsAnySubstring(haystack string, needles ...string) bool {
+	for _, n := range needles {
+		if strings.Contains(haystack, n) {
+			return true
+		}
+	}
+	return false
+}
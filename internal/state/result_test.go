@@ -0,0 +1,37 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResultLabel(t *testing.T) {
+	cases := []struct {
+		name string
+		node Node
+		want string
+	}{
+		{"course uses fetch status", Node{Kind: "course", Status: StatusStale}, "stale"},
+		{"passed", Node{Kind: "assignment", Details: map[string]any{"stats": map[string]any{"summary": map[string]any{"Status": "Passed"}}}}, "passed"},
+		{"failing from status text", Node{Kind: "assignment", Details: map[string]any{"stats": map[string]any{"summary": map[string]any{"status_text": "Wrong output"}}}}, "failing"},
+		{"grade", Node{Kind: "assignment", Details: map[string]any{"stats": map[string]any{"summary": map[string]any{"grade": "7.5"}}}}, "7.5"},
+		{"status page only", Node{Kind: "assignment", Details: map[string]any{"links": map[string]string{"status_page": "https://x/@status"}}}, "not_submitted"},
+		{"nothing known", Node{Kind: "assignment"}, "unknown"},
+	}
+	for _, tc := range cases {
+		if got := ResultLabel(tc.node); got != tc.want {
+			t.Fatalf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestDueAt(t *testing.T) {
+	node := Node{Details: map[string]any{"config": map[string]any{"end_iso": "2026-08-31T21:59:59.000Z"}}}
+	due, ok := DueAt(node)
+	if !ok || !due.Equal(time.Date(2026, 8, 31, 21, 59, 59, 0, time.UTC)) {
+		t.Fatalf("DueAt = %v, %v", due, ok)
+	}
+	if _, ok := DueAt(Node{}); ok {
+		t.Fatalf("expected no due date")
+	}
+}
@@ -0,0 +1,76 @@
+package state
+
+// StaleNodeIDs returns the stale nodes reachable from rootID within maxDepth
+// child edges, breadth-first in child order. The root itself is depth 0.
+func StaleNodeIDs(st State, rootID string, maxDepth int) []string {
+	out := make([]string, 0)
+	if _, ok := st.Nodes[rootID]; !ok {
+		return out
+	}
+	type item struct {
+		id    string
+		depth int
+	}
+	seen := map[string]bool{rootID: true}
+	queue := []item{{id: rootID}}
+	for len(queue) > 0 {
+		it := queue[0]
+		queue = queue[1:]
+		node := st.Nodes[it.id]
+		if node.Status == StatusStale {
+			out = append(out, it.id)
+		}
+		if it.depth >= maxDepth {
+			continue
+		}
+		for _, childID := range node.ChildIDs {
+			if _, ok := st.Nodes[childID]; !ok || seen[childID] {
+				continue
+			}
+			seen[childID] = true
+			queue = append(queue, item{id: childID, depth: it.depth + 1})
+		}
+	}
+	return out
+}
+
+// CloneState returns a deep copy of st, so a refresh can mutate the copy while
+// the original is still being read.
+func CloneState(st State) (State, error) {
+	return cloneState(st)
+}
+
+// MergeRefreshed copies into dst the nodes of refreshed that are new or have a
+// later UpdatedAt than dst's copy, so results of a refresh that ran on an older
+// snapshot can be folded in without undoing newer changes. Roots and catalog
+// metadata missing from dst are taken from refreshed. It returns the number of
+// nodes and roots copied.
+func MergeRefreshed(dst *State, refreshed State) int {
+	if dst == nil {
+		return 0
+	}
+	if dst.Nodes == nil {
+		dst.Nodes = map[string]Node{}
+	}
+	merged := 0
+	for id, node := range refreshed.Nodes {
+		if cur, ok := dst.Nodes[id]; ok && !node.UpdatedAt.After(cur.UpdatedAt) {
+			continue
+		}
+		dst.Nodes[id] = node
+		merged++
+	}
+	for _, root := range refreshed.Roots {
+		if !hasRoot(dst.Roots, root.NodeID) {
+			dst.Roots = append(dst.Roots, root)
+			merged++
+		}
+	}
+	if dst.BaseURL == "" {
+		dst.BaseURL = refreshed.BaseURL
+	}
+	if dst.CatalogRootURL == "" {
+		dst.CatalogRootURL = refreshed.CatalogRootURL
+	}
+	return merged
+}
@@ -0,0 +1,69 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStaleNodeIDs_BoundedByDepth(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	st, ids := exportTestState(t, now)
+	for _, name := range []string{"year", "os", "lab1", "ads"} {
+		node := st.Nodes[ids[name]]
+		node.Status = StatusStale
+		st.Nodes[ids[name]] = node
+	}
+
+	got := StaleNodeIDs(st, ids["year"], 1)
+	if len(got) != 3 || got[0] != ids["year"] || got[1] != ids["os"] || got[2] != ids["ads"] {
+		t.Fatalf("unexpected stale ids at depth 1: %v", got)
+	}
+	got = StaleNodeIDs(st, ids["os"], 1)
+	if len(got) != 2 || got[0] != ids["os"] || got[1] != ids["lab1"] {
+		t.Fatalf("unexpected stale ids under os: %v", got)
+	}
+	if got := StaleNodeIDs(st, "url:missing", 3); len(got) != 0 {
+		t.Fatalf("expected nothing for unknown root, got %v", got)
+	}
+}
+
+func TestMergeRefreshed_NewerWins(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	st, ids := exportTestState(t, now)
+	refreshed, err := CloneState(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	later := now.Add(time.Minute)
+	lab1 := refreshed.Nodes[ids["lab1"]]
+	lab1.Title = "Lab 1 (refreshed)"
+	lab1.UpdatedAt = later
+	refreshed.Nodes[ids["lab1"]] = lab1
+
+	// Changed locally after the refresh started: the local copy must win.
+	osNode := refreshed.Nodes[ids["os"]]
+	osNode.Title = "os (refreshed)"
+	osNode.UpdatedAt = later
+	refreshed.Nodes[ids["os"]] = osNode
+	localOS := st.Nodes[ids["os"]]
+	localOS.Title = "os (local)"
+	localOS.UpdatedAt = later.Add(time.Minute)
+	st.Nodes[ids["os"]] = localOS
+
+	refreshed.Nodes["url:new"] = Node{ID: "url:new", CanonicalURL: "https://themis.housing.rug.nl/course/new", UpdatedAt: later}
+	refreshed.Roots = append(refreshed.Roots, RootRef{NodeID: "url:new", CanonicalURL: "https://themis.housing.rug.nl/course/new"})
+
+	if merged := MergeRefreshed(&st, refreshed); merged != 3 {
+		t.Fatalf("expected 3 merged entries, got %d", merged)
+	}
+	if st.Nodes[ids["lab1"]].Title != "Lab 1 (refreshed)" {
+		t.Fatalf("refreshed node not merged")
+	}
+	if st.Nodes[ids["os"]].Title != "os (local)" {
+		t.Fatalf("newer local node was overwritten")
+	}
+	if _, ok := st.Nodes["url:new"]; !ok || len(st.Roots) != 2 {
+		t.Fatalf("new node or root missing")
+	}
+}
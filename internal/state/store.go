@@ -0,0 +1,200 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Backend names accepted by OpenStore.
+const (
+	BackendJSON = "json"
+	BackendLog  = "log"
+)
+
+const defaultLogStoreFileName = "state.db"
+
+// Store persists a State. Implementations serialise writers across processes
+// with the state lock file.
+type Store interface {
+	// Load returns the full state, or an empty state when nothing is stored yet.
+	Load() (State, error)
+	// Save replaces the stored state with st.
+	Save(st State) error
+	// GetNode returns one node by id.
+	GetNode(id string) (Node, bool, error)
+	// UpsertNodes writes the given nodes as-is; callers keep edges symmetric.
+	UpsertNodes(nodes []Node) error
+	// Children returns the stored children of id in ChildIDs order.
+	Children(id string) ([]Node, error)
+	// Update runs fn on the current state under the write lock and saves the
+	// result when fn reports a change.
+	Update(fn func(st *State) (bool, error)) error
+	// Location is the file backing the store.
+	Location() string
+	// Backend is BackendJSON or BackendLog.
+	Backend() string
+}
+
+// StoreOptions configures OpenStore.
+type StoreOptions struct {
+	// Strict fails Load with ErrIntegrity when Check reports issues.
+	Strict bool
+	// Backups is the JSON backend's backup retention; nil selects
+	// DefaultBackupPolicy.
+	Backups *BackupPolicy
+}
+
+// DefaultStorePath returns the default file for backend under ~/.config/themis.
+func DefaultStorePath(backend string) (string, error) {
+	jsonPath, err := DefaultStatePath()
+	if err != nil {
+		return "", err
+	}
+	switch normalizeBackend(backend) {
+	case BackendJSON:
+		return jsonPath, nil
+	case BackendLog:
+		return filepath.Join(filepath.Dir(jsonPath), defaultLogStoreFileName), nil
+	default:
+		return "", fmt.Errorf("unknown state backend %q (want %s or %s)", backend, BackendJSON, BackendLog)
+	}
+}
+
+// OpenStore opens the store for backend at path; an empty path selects the default.
+func OpenStore(backend string, path string, opts StoreOptions) (Store, error) {
+	backend = normalizeBackend(backend)
+	if strings.TrimSpace(path) == "" {
+		defaultPath, err := DefaultStorePath(backend)
+		if err != nil {
+			return nil, err
+		}
+		path = defaultPath
+	}
+	switch backend {
+	case BackendJSON:
+		backups := DefaultBackupPolicy()
+		if opts.Backups != nil {
+			backups = *opts.Backups
+		}
+		return &JSONStore{Path: path, Strict: opts.Strict, Backup: true, Backups: backups}, nil
+	case BackendLog:
+		return &LogStore{Path: path, Strict: opts.Strict}, nil
+	default:
+		return nil, fmt.Errorf("unknown state backend %q (want %s or %s)", backend, BackendJSON, BackendLog)
+	}
+}
+
+func normalizeBackend(backend string) string {
+	backend = strings.ToLower(strings.TrimSpace(backend))
+	if backend == "" {
+		return BackendJSON
+	}
+	return backend
+}
+
+func childrenOf(nodes map[string]Node, id string) []Node {
+	parent, ok := nodes[id]
+	if !ok {
+		return []Node{}
+	}
+	out := make([]Node, 0, len(parent.ChildIDs))
+	for _, childID := range parent.ChildIDs {
+		if child, ok := nodes[childID]; ok {
+			out = append(out, child)
+		}
+	}
+	return out
+}
+
+// storeExists reports whether the store has been written before.
+func storeExists(store Store) (bool, error) {
+	_, err := os.Stat(store.Location())
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// ConvertStore copies the full state from src into dst. dst must be empty
+// unless overwrite is set.
+func ConvertStore(src Store, dst Store, overwrite bool) (State, error) {
+	if src.Location() == dst.Location() {
+		return State{}, fmt.Errorf("source and destination are the same file: %s", src.Location())
+	}
+	exists, err := storeExists(dst)
+	if err != nil {
+		return State{}, err
+	}
+	if exists && !overwrite {
+		return State{}, fmt.Errorf("%s already exists; pass --force to overwrite", dst.Location())
+	}
+	st, err := src.Load()
+	if err != nil {
+		return State{}, err
+	}
+	if err := dst.Save(st); err != nil {
+		return State{}, err
+	}
+	return st, nil
+}
+
+// FsckStore runs Check, or Repair when repair is set, against store.
+func FsckStore(store Store, repair bool) (FsckReport, error) {
+	if js, ok := store.(*JSONStore); ok {
+		return FsckFile(js.Path, repair, js.Backups)
+	}
+	now := time.Now().UTC()
+	if !repair {
+		st, err := store.Load()
+		if err != nil {
+			return FsckReport{}, err
+		}
+		return Check(st, now), nil
+	}
+	var report FsckReport
+	err := store.Update(func(st *State) (bool, error) {
+		report = Repair(st, now)
+		for _, issue := range report.Issues {
+			if issue.Repaired {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	return report, err
+}
+
+// GCStore runs CollectGarbage against store. For non-JSON backends the byte
+// counts are those of the state encoded as JSON.
+func GCStore(store Store, opts GCOptions, dryRun bool) (GCReport, error) {
+	if js, ok := store.(*JSONStore); ok {
+		return GCFile(js.Path, opts, dryRun, js.Backups)
+	}
+	var report GCReport
+	err := store.Update(func(st *State) (bool, error) {
+		before, err := json.Marshal(st)
+		if err != nil {
+			return false, fmt.Errorf("encode state JSON: %w", err)
+		}
+		report = CollectGarbage(st, time.Now(), opts)
+		report.BytesBefore = int64(len(before))
+		report.BytesAfter = report.BytesBefore
+		if !report.Changed() {
+			return false, nil
+		}
+		after, err := json.Marshal(st)
+		if err != nil {
+			return false, fmt.Errorf("encode state JSON: %w", err)
+		}
+		report.BytesAfter = int64(len(after))
+		return !dryRun, nil
+	})
+	return report, err
+}
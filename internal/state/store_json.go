@@ -1,11 +1,13 @@
 package state
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -32,7 +34,17 @@ func NewEmptyState() State {
 	}
 }
 
+// LoadOptions tunes Load behaviour.
+type LoadOptions struct {
+	// Strict runs Check after loading and fails with ErrIntegrity on any issue.
+	Strict bool
+}
+
 func Load(path string) (State, error) {
+	return LoadWithOptions(path, LoadOptions{})
+}
+
+func LoadWithOptions(path string, opts LoadOptions) (State, error) {
 	if err := ensureStateDir(path); err != nil {
 		return State{}, err
 	}
@@ -43,23 +55,29 @@ func Load(path string) (State, error) {
 	}
 	defer lock.Close()
 
-	file, err := os.Open(path)
+	raw, err := readStateFile(path)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return NewEmptyState(), nil
-		}
-		return State{}, fmt.Errorf("open state file: %w", err)
+		return State{}, err
+	}
+	return decodeStateFile(path, raw, opts)
+}
+
+// decodeStateFile decodes a state file read from path, migrating it and, when
+// opts.Strict is set, checking its integrity. raw is nil for a missing file.
+// Every read of a JSON state goes through here.
+func decodeStateFile(path string, raw []byte, opts LoadOptions) (State, error) {
+	if raw == nil {
+		return NewEmptyState(), nil
 	}
-	defer file.Close()
 
 	var state State
-	if err := json.NewDecoder(file).Decode(&state); err != nil {
+	if _, err := DecodeMigrated(raw, CurrentSchemaVersion, stateMigrations, time.Now(), &state); err != nil {
+		if errors.Is(err, ErrSchemaTooNew) {
+			return State{}, fmt.Errorf("load %s: %w", path, err)
+		}
 		return State{}, fmt.Errorf("decode state JSON: %w", err)
 	}
 
-	if state.SchemaVersion == 0 {
-		state.SchemaVersion = CurrentSchemaVersion
-	}
 	if state.Roots == nil {
 		state.Roots = []RootRef{}
 	}
@@ -67,10 +85,31 @@ func Load(path string) (State, error) {
 		state.Nodes = map[string]Node{}
 	}
 
+	if opts.Strict {
+		report := Check(state, time.Now())
+		if !report.Clean() {
+			first := report.Issues[0]
+			return State{}, fmt.Errorf("%w: %d issue(s) in %s, first: %s %s: %s; run `themis state fsck --repair`", ErrIntegrity, len(report.Issues), path, first.Code, first.NodeID, first.Detail)
+		}
+	}
+
 	return state, nil
 }
 
+// SaveAtomic writes state to path under the exclusive lock. With backupOnWrite
+// the previous file is kept as <path>.bak and as a timestamped backup under
+// DefaultBackupPolicy.
 func SaveAtomic(path string, state State, backupOnWrite bool) error {
+	var backups *BackupPolicy
+	if backupOnWrite {
+		policy := DefaultBackupPolicy()
+		backups = &policy
+	}
+	return saveStateFile(path, state, backups)
+}
+
+// saveStateFile takes the exclusive lock and writes state with writeStateLocked.
+func saveStateFile(path string, state State, backups *BackupPolicy) error {
 	if err := ensureStateDir(path); err != nil {
 		return err
 	}
@@ -81,6 +120,12 @@ func SaveAtomic(path string, state State, backupOnWrite bool) error {
 	}
 	defer lock.Close()
 
+	return writeStateLocked(path, state, backups)
+}
+
+// writeStateLocked writes state atomically; the caller holds the exclusive
+// lock. Unless backups is nil the previous file is backed up under it first.
+func writeStateLocked(path string, state State, backups *BackupPolicy) error {
 	state.SchemaVersion = CurrentSchemaVersion
 	state.UpdatedAt = time.Now().UTC()
 	if state.Roots == nil {
@@ -90,16 +135,28 @@ func SaveAtomic(path string, state State, backupOnWrite bool) error {
 		state.Nodes = map[string]Node{}
 	}
 
-	if backupOnWrite {
-		if err := backupStateIfExists(path); err != nil {
+	if backups != nil {
+		if err := backupStateIfExists(path, *backups); err != nil {
 			return err
 		}
 	}
 
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(state); err != nil {
+		return fmt.Errorf("encode state JSON: %w", err)
+	}
+	return writeFileAtomic(path, buf.Bytes())
+}
+
+// writeFileAtomic replaces path with data through a synced temp file in the
+// same directory, so a crash leaves either the old or the new file.
+func writeFileAtomic(path string, data []byte) error {
 	dir := filepath.Dir(path)
 	tmp, err := os.CreateTemp(dir, ".state-*.tmp")
 	if err != nil {
-		return fmt.Errorf("create temp state file: %w", err)
+		return fmt.Errorf("create temp file: %w", err)
 	}
 	tmpName := tmp.Name()
 	cleanup := true
@@ -109,22 +166,20 @@ func SaveAtomic(path string, state State, backupOnWrite bool) error {
 		}
 	}()
 
-	enc := json.NewEncoder(tmp)
-	enc.SetIndent("", "  ")
-	if err := enc.Encode(state); err != nil {
+	if _, err := tmp.Write(data); err != nil {
 		_ = tmp.Close()
-		return fmt.Errorf("encode state JSON: %w", err)
+		return fmt.Errorf("write temp file: %w", err)
 	}
 	if err := tmp.Sync(); err != nil {
 		_ = tmp.Close()
-		return fmt.Errorf("fsync temp state file: %w", err)
+		return fmt.Errorf("fsync temp file: %w", err)
 	}
 	if err := tmp.Close(); err != nil {
-		return fmt.Errorf("close temp state file: %w", err)
+		return fmt.Errorf("close temp file: %w", err)
 	}
 
 	if err := os.Rename(tmpName, path); err != nil {
-		return fmt.Errorf("rename temp state file: %w", err)
+		return fmt.Errorf("rename temp file: %w", err)
 	}
 	cleanup = false
 
@@ -137,23 +192,41 @@ func SaveAtomic(path string, state State, backupOnWrite bool) error {
 	return nil
 }
 
-func backupStateIfExists(path string) error {
-	src, err := os.Open(path)
+// readStateFile returns the raw state file, or nil when it does not exist.
+func readStateFile(path string) ([]byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("open state file: %w", err)
+	}
+	return raw, nil
+}
+
+// BackupPath is where SaveAtomic keeps the previous state file.
+func BackupPath(path string) string {
+	return path + ".bak"
+}
+
+// backupStateIfExists copies the current file to <path>.bak and into the
+// timestamped backups governed by policy.
+func backupStateIfExists(path string, policy BackupPolicy) error {
+	raw, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
 		}
 		return fmt.Errorf("open current state for backup: %w", err)
 	}
-	defer src.Close()
 
-	backupPath := path + ".bak"
+	backupPath := BackupPath(path)
 	dst, err := os.Create(backupPath)
 	if err != nil {
 		return fmt.Errorf("create backup state file: %w", err)
 	}
 
-	if _, err := io.Copy(dst, src); err != nil {
+	if _, err := dst.Write(raw); err != nil {
 		_ = dst.Close()
 		return fmt.Errorf("write backup state file: %w", err)
 	}
@@ -165,7 +238,7 @@ func backupStateIfExists(path string) error {
 		return fmt.Errorf("close backup state file: %w", err)
 	}
 
-	return nil
+	return rotateBackup(path, raw, time.Now(), policy)
 }
 
 func ensureStateDir(path string) error {
@@ -198,6 +271,46 @@ func acquireLock(path string, exclusive bool) (*lockHandle, error) {
 	return &lockHandle{File: file}, nil
 }
 
+// LockStatus describes the advisory lock guarding a state file.
+type LockStatus struct {
+	Path           string   `json:"path"`
+	Exists         bool     `json:"exists"`
+	HeldExclusive  bool     `json:"held_exclusive"`
+	StaleTempFiles []string `json:"stale_temp_files,omitempty"`
+}
+
+// ProbeLock inspects the state lock without blocking. HeldExclusive is true when
+// another process currently holds the write lock. Leftover temp files from
+// interrupted saves are reported as StaleTempFiles.
+func ProbeLock(statePath string) (LockStatus, error) {
+	status := LockStatus{Path: lockPath(statePath)}
+
+	file, err := os.OpenFile(status.Path, os.O_RDWR, 0o600)
+	if err != nil && !os.IsNotExist(err) {
+		return status, fmt.Errorf("open lock file: %w", err)
+	}
+	if err == nil {
+		status.Exists = true
+		if lockErr := syscall.Flock(int(file.Fd()), syscall.LOCK_SH|syscall.LOCK_NB); lockErr != nil {
+			if lockErr != syscall.EWOULDBLOCK {
+				_ = file.Close()
+				return status, fmt.Errorf("probe state lock: %w", lockErr)
+			}
+			status.HeldExclusive = true
+		} else {
+			_ = syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		}
+		_ = file.Close()
+	}
+
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(statePath), ".state-*.tmp"))
+	if err != nil {
+		return status, fmt.Errorf("scan temp state files: %w", err)
+	}
+	status.StaleTempFiles = matches
+	return status, nil
+}
+
 type lockHandle struct {
 	*os.File
 }
@@ -209,3 +322,164 @@ func (l *lockHandle) Close() error {
 	}
 	return l.File.Close()
 }
+
+// JSONStore keeps the whole state in one pretty-printed JSON file, rewritten
+// atomically on every save.
+type JSONStore struct {
+	Path   string
+	Strict bool
+	// Backup copies the previous file to <path>.bak before each write.
+	Backup bool
+	// Backups governs the timestamped backups taken along with the .bak copy;
+	// the zero value keeps none.
+	Backups BackupPolicy
+
+	mu    sync.Mutex
+	cache *jsonSnapshot
+}
+
+// jsonSnapshot is the decoded state file, keyed by the size and modification
+// time it was read at, so node lookups do not decode an unchanged file again.
+type jsonSnapshot struct {
+	size    int64
+	modTime time.Time
+	state   State
+}
+
+func (s *JSONStore) Location() string { return s.Path }
+func (s *JSONStore) Backend() string  { return BackendJSON }
+
+// backups is the policy passed to writeStateLocked, nil when Backup is off.
+func (s *JSONStore) backups() *BackupPolicy {
+	if !s.Backup {
+		return nil
+	}
+	policy := s.Backups
+	return &policy
+}
+
+func (s *JSONStore) Load() (State, error) {
+	return LoadWithOptions(s.Path, LoadOptions{Strict: s.Strict})
+}
+
+func (s *JSONStore) Save(st State) error {
+	return saveStateFile(s.Path, st, s.backups())
+}
+
+func (s *JSONStore) GetNode(id string) (Node, bool, error) {
+	st, err := s.snapshot()
+	if err != nil {
+		return Node{}, false, err
+	}
+	node, ok := st.Nodes[id]
+	if !ok {
+		return Node{}, false, nil
+	}
+	clone, err := cloneNode(node)
+	if err != nil {
+		return Node{}, false, err
+	}
+	return clone, true, nil
+}
+
+func (s *JSONStore) Children(id string) ([]Node, error) {
+	st, err := s.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	children := childrenOf(st.Nodes, id)
+	for i := range children {
+		if children[i], err = cloneNode(children[i]); err != nil {
+			return nil, err
+		}
+	}
+	return children, nil
+}
+
+// snapshot returns the decoded state file under the shared lock, reusing the
+// previous decode while the file is unchanged. Callers must not modify it.
+func (s *JSONStore) snapshot() (State, error) {
+	if err := ensureStateDir(s.Path); err != nil {
+		return State{}, err
+	}
+	lock, err := acquireLock(lockPath(s.Path), false)
+	if err != nil {
+		return State{}, err
+	}
+	defer lock.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, err := os.Stat(s.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.cache = nil
+			return NewEmptyState(), nil
+		}
+		return State{}, fmt.Errorf("stat state file: %w", err)
+	}
+	if s.cache != nil && s.cache.size == info.Size() && s.cache.modTime.Equal(info.ModTime()) {
+		return s.cache.state, nil
+	}
+	raw, err := readStateFile(s.Path)
+	if err != nil {
+		return State{}, err
+	}
+	st, err := decodeStateFile(s.Path, raw, LoadOptions{Strict: s.Strict})
+	if err != nil {
+		return State{}, err
+	}
+	s.cache = &jsonSnapshot{size: info.Size(), modTime: info.ModTime(), state: st}
+	return st, nil
+}
+
+// cloneNode deep-copies node so callers cannot alias a cached snapshot.
+func cloneNode(node Node) (Node, error) {
+	raw, err := json.Marshal(node)
+	if err != nil {
+		return Node{}, fmt.Errorf("copy node %s: %w", node.ID, err)
+	}
+	var out Node
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return Node{}, fmt.Errorf("copy node %s: %w", node.ID, err)
+	}
+	return out, nil
+}
+
+func (s *JSONStore) UpsertNodes(nodes []Node) error {
+	return s.Update(func(st *State) (bool, error) {
+		for _, node := range nodes {
+			if node.ID == "" {
+				return false, fmt.Errorf("node id is required")
+			}
+			st.Nodes[node.ID] = node
+		}
+		return len(nodes) > 0, nil
+	})
+}
+
+func (s *JSONStore) Update(fn func(st *State) (bool, error)) error {
+	if err := ensureStateDir(s.Path); err != nil {
+		return err
+	}
+	lock, err := acquireLock(lockPath(s.Path), true)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	raw, err := readStateFile(s.Path)
+	if err != nil {
+		return err
+	}
+	st, err := decodeStateFile(s.Path, raw, LoadOptions{Strict: s.Strict})
+	if err != nil {
+		return err
+	}
+
+	changed, err := fn(&st)
+	if err != nil || !changed {
+		return err
+	}
+	return writeStateLocked(s.Path, st, s.backups())
+}
@@ -76,3 +76,46 @@ func TestSaveAtomic_BackupOnWrite(t *testing.T) {
 		t.Fatalf("backup mismatch: want=%q got=%q", first.BaseURL, backup.BaseURL)
 	}
 }
+
+func TestProbeLock_ReportsHeldLockAndTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	status, err := ProbeLock(path)
+	if err != nil {
+		t.Fatalf("probe failed: %v", err)
+	}
+	if status.Exists || status.HeldExclusive {
+		t.Fatalf("expected no lock file yet: %#v", status)
+	}
+
+	lock, err := acquireLock(lockPath(path), true)
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".state-123.tmp"), []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err = ProbeLock(path)
+	if err != nil {
+		t.Fatalf("probe failed: %v", err)
+	}
+	if !status.Exists || !status.HeldExclusive {
+		t.Fatalf("expected held lock: %#v", status)
+	}
+	if len(status.StaleTempFiles) != 1 {
+		t.Fatalf("expected one stale temp file, got %#v", status.StaleTempFiles)
+	}
+
+	if err := lock.Close(); err != nil {
+		t.Fatal(err)
+	}
+	status, err = ProbeLock(path)
+	if err != nil {
+		t.Fatalf("probe failed: %v", err)
+	}
+	if status.HeldExclusive {
+		t.Fatalf("expected released lock: %#v", status)
+	}
+}
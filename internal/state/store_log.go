@@ -0,0 +1,516 @@
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	logStoreFormat  = "themis-state-log"
+	logStoreVersion = 1
+
+	// logCompactMinRecords avoids compacting small logs.
+	logCompactMinRecords = 256
+)
+
+// LogStore is an append-only key/value log. Every save appends only the nodes
+// that changed (plus a metadata record when roots or URLs change) and fsyncs
+// the appended bytes, instead of rewriting the whole catalog. The log is
+// compacted once superseded records outnumber live ones.
+//
+// File layout: a header line, then one JSON record per line:
+//
+//	{"format":"themis-state-log","version":1}
+//	{"t":"meta","v":{...state without nodes...}}
+//	{"t":"put","k":"url:...","v":{...node...}}
+//	{"t":"del","k":"url:..."}
+//
+// A torn final line from an interrupted write is ignored and truncated away.
+type LogStore struct {
+	Path   string
+	Strict bool
+
+	mu    sync.Mutex
+	cache *logSnapshot
+}
+
+type logHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+}
+
+type logRecord struct {
+	Type  string          `json:"t"`
+	Key   string          `json:"k,omitempty"`
+	Value json.RawMessage `json:"v,omitempty"`
+}
+
+type logMeta struct {
+	SchemaVersion  int                `json:"schema_version"`
+	BaseURL        string             `json:"base_url"`
+	CatalogRootURL string             `json:"catalog_root_url"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+	Roots          []RootRef          `json:"roots"`
+	Migrations     []AppliedMigration `json:"migrations,omitempty"`
+}
+
+// logSnapshot is the replayed content of the log, keyed by the file size and
+// modification time it was read at.
+type logSnapshot struct {
+	size    int64
+	modTime time.Time
+	valid   int64 // bytes up to the last complete record
+	records int
+	meta    []byte
+	nodes   map[string][]byte
+}
+
+func (s *LogStore) Location() string { return s.Path }
+func (s *LogStore) Backend() string  { return BackendLog }
+
+func (s *LogStore) Load() (State, error) {
+	snap, err := s.read()
+	if err != nil {
+		return State{}, err
+	}
+	st, err := snap.decode()
+	if err != nil {
+		return State{}, err
+	}
+	if s.Strict {
+		report := Check(st, time.Now())
+		if !report.Clean() {
+			first := report.Issues[0]
+			return State{}, fmt.Errorf("%w: %d issue(s) in %s, first: %s %s: %s; run `themis state fsck --repair`", ErrIntegrity, len(report.Issues), s.Path, first.Code, first.NodeID, first.Detail)
+		}
+	}
+	return st, nil
+}
+
+func (s *LogStore) Save(st State) error {
+	return s.write(func(snap *logSnapshot) ([]logRecord, error) {
+		return snap.diff(st)
+	})
+}
+
+func (s *LogStore) GetNode(id string) (Node, bool, error) {
+	snap, err := s.read()
+	if err != nil {
+		return Node{}, false, err
+	}
+	raw, ok := snap.nodes[id]
+	if !ok {
+		return Node{}, false, nil
+	}
+	var node Node
+	if err := json.Unmarshal(raw, &node); err != nil {
+		return Node{}, false, fmt.Errorf("decode node %s: %w", id, err)
+	}
+	return node, true, nil
+}
+
+func (s *LogStore) Children(id string) ([]Node, error) {
+	parent, ok, err := s.GetNode(id)
+	if err != nil || !ok {
+		return []Node{}, err
+	}
+	out := make([]Node, 0, len(parent.ChildIDs))
+	for _, childID := range parent.ChildIDs {
+		child, ok, err := s.GetNode(childID)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, child)
+		}
+	}
+	return out, nil
+}
+
+func (s *LogStore) UpsertNodes(nodes []Node) error {
+	return s.write(func(snap *logSnapshot) ([]logRecord, error) {
+		records := make([]logRecord, 0, len(nodes))
+		for _, node := range nodes {
+			if node.ID == "" {
+				return nil, fmt.Errorf("node id is required")
+			}
+			encoded, err := json.Marshal(node)
+			if err != nil {
+				return nil, fmt.Errorf("encode node %s: %w", node.ID, err)
+			}
+			if bytes.Equal(snap.nodes[node.ID], encoded) {
+				continue
+			}
+			records = append(records, logRecord{Type: "put", Key: node.ID, Value: encoded})
+		}
+		return records, nil
+	})
+}
+
+func (s *LogStore) Update(fn func(st *State) (bool, error)) error {
+	return s.write(func(snap *logSnapshot) ([]logRecord, error) {
+		st, err := snap.decode()
+		if err != nil {
+			return nil, err
+		}
+		changed, err := fn(&st)
+		if err != nil || !changed {
+			return nil, err
+		}
+		return snap.diff(st)
+	})
+}
+
+// read returns the current snapshot under the shared lock.
+func (s *LogStore) read() (*logSnapshot, error) {
+	if err := ensureStateDir(s.Path); err != nil {
+		return nil, err
+	}
+	lock, err := acquireLock(lockPath(s.Path), false)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshotLocked()
+}
+
+// write appends the records produced by build under the exclusive lock and
+// compacts the log when it has grown mostly stale.
+func (s *LogStore) write(build func(snap *logSnapshot) ([]logRecord, error)) error {
+	if err := ensureStateDir(s.Path); err != nil {
+		return err
+	}
+	lock, err := acquireLock(lockPath(s.Path), true)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap, err := s.snapshotLocked()
+	if err != nil {
+		return err
+	}
+	records, err := build(snap)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	next := snap.clone()
+	for _, rec := range records {
+		next.apply(rec)
+	}
+	if next.records > logCompactMinRecords && next.records > 2*(len(next.nodes)+1) {
+		return s.compactLocked(next)
+	}
+	return s.appendLocked(snap, next, records)
+}
+
+func (s *LogStore) snapshotLocked() (*logSnapshot, error) {
+	info, err := os.Stat(s.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.cache = nil
+			return newLogSnapshot(), nil
+		}
+		return nil, fmt.Errorf("stat state log: %w", err)
+	}
+	if s.cache != nil && s.cache.size == info.Size() && s.cache.modTime.Equal(info.ModTime()) {
+		return s.cache, nil
+	}
+
+	file, err := os.Open(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("open state log: %w", err)
+	}
+	defer file.Close()
+
+	snap, err := replayLog(file)
+	if err != nil {
+		return nil, fmt.Errorf("read state log %s: %w", s.Path, err)
+	}
+	snap.size = info.Size()
+	snap.modTime = info.ModTime()
+	s.cache = snap
+	return snap, nil
+}
+
+func (s *LogStore) appendLocked(prev *logSnapshot, next *logSnapshot, records []logRecord) error {
+	var buf bytes.Buffer
+	if prev.valid == 0 {
+		if err := writeLogLine(&buf, logHeader{Format: logStoreFormat, Version: logStoreVersion}); err != nil {
+			return err
+		}
+	}
+	for _, rec := range records {
+		if err := writeLogLine(&buf, rec); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(s.Path, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open state log: %w", err)
+	}
+	// Drop a torn tail left by an interrupted append before writing after it.
+	if prev.valid < prev.size {
+		if err := file.Truncate(prev.valid); err != nil {
+			_ = file.Close()
+			return fmt.Errorf("truncate torn state log tail: %w", err)
+		}
+	}
+	if _, err := file.Seek(prev.valid, io.SeekStart); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("seek state log: %w", err)
+	}
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("append state log: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("fsync state log: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("close state log: %w", err)
+	}
+	return s.refreshCacheLocked(next)
+}
+
+// compactLocked rewrites the log with one record per live key.
+func (s *LogStore) compactLocked(snap *logSnapshot) error {
+	var buf bytes.Buffer
+	if err := writeLogLine(&buf, logHeader{Format: logStoreFormat, Version: logStoreVersion}); err != nil {
+		return err
+	}
+	compacted := newLogSnapshot()
+	if snap.meta != nil {
+		rec := logRecord{Type: "meta", Value: snap.meta}
+		compacted.apply(rec)
+		if err := writeLogLine(&buf, rec); err != nil {
+			return err
+		}
+	}
+	ids := make([]string, 0, len(snap.nodes))
+	for id := range snap.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		rec := logRecord{Type: "put", Key: id, Value: snap.nodes[id]}
+		compacted.apply(rec)
+		if err := writeLogLine(&buf, rec); err != nil {
+			return err
+		}
+	}
+
+	if err := writeFileAtomic(s.Path, buf.Bytes()); err != nil {
+		return fmt.Errorf("compact state log: %w", err)
+	}
+	return s.refreshCacheLocked(compacted)
+}
+
+func (s *LogStore) refreshCacheLocked(next *logSnapshot) error {
+	info, err := os.Stat(s.Path)
+	if err != nil {
+		s.cache = nil
+		return fmt.Errorf("stat state log: %w", err)
+	}
+	next.size = info.Size()
+	next.valid = info.Size()
+	next.modTime = info.ModTime()
+	s.cache = next
+	return nil
+}
+
+func replayLog(r io.Reader) (*logSnapshot, error) {
+	snap := newLogSnapshot()
+	reader := bufio.NewReader(r)
+	var offset int64
+	first := true
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// A final line without newline is a torn write; ignore it.
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		offset += int64(len(line))
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			snap.valid = offset
+			continue
+		}
+		if first {
+			first = false
+			var header logHeader
+			if err := json.Unmarshal(line, &header); err != nil || header.Format != logStoreFormat {
+				return nil, fmt.Errorf("not a themis state log")
+			}
+			if header.Version > logStoreVersion {
+				return nil, fmt.Errorf("%w: state log version %d", ErrSchemaTooNew, header.Version)
+			}
+			snap.valid = offset
+			continue
+		}
+		var rec logRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, fmt.Errorf("corrupt record at byte %d: %w", offset-int64(len(line)), err)
+		}
+		snap.apply(rec)
+		snap.valid = offset
+	}
+	return snap, nil
+}
+
+func newLogSnapshot() *logSnapshot {
+	return &logSnapshot{nodes: map[string][]byte{}}
+}
+
+func (snap *logSnapshot) clone() *logSnapshot {
+	out := &logSnapshot{
+		size:    snap.size,
+		modTime: snap.modTime,
+		valid:   snap.valid,
+		records: snap.records,
+		meta:    snap.meta,
+		nodes:   make(map[string][]byte, len(snap.nodes)),
+	}
+	for k, v := range snap.nodes {
+		out.nodes[k] = v
+	}
+	return out
+}
+
+func (snap *logSnapshot) apply(rec logRecord) {
+	snap.records++
+	switch rec.Type {
+	case "meta":
+		snap.meta = append([]byte(nil), rec.Value...)
+	case "put":
+		snap.nodes[rec.Key] = append([]byte(nil), rec.Value...)
+	case "del":
+		delete(snap.nodes, rec.Key)
+	}
+}
+
+func (snap *logSnapshot) decode() (State, error) {
+	st := NewEmptyState()
+	if snap.meta != nil {
+		var meta logMeta
+		if err := json.Unmarshal(snap.meta, &meta); err != nil {
+			return State{}, fmt.Errorf("decode state log metadata: %w", err)
+		}
+		if meta.SchemaVersion > CurrentSchemaVersion {
+			return State{}, fmt.Errorf("%w: state log has schema_version %d, this binary supports up to %d", ErrSchemaTooNew, meta.SchemaVersion, CurrentSchemaVersion)
+		}
+		st.BaseURL = meta.BaseURL
+		st.CatalogRootURL = meta.CatalogRootURL
+		st.UpdatedAt = meta.UpdatedAt
+		st.Migrations = meta.Migrations
+		if meta.Roots != nil {
+			st.Roots = meta.Roots
+		}
+	}
+	for id, raw := range snap.nodes {
+		var node Node
+		if err := json.Unmarshal(raw, &node); err != nil {
+			return State{}, fmt.Errorf("decode node %s: %w", id, err)
+		}
+		st.Nodes[id] = node
+	}
+	return st, nil
+}
+
+// diff returns the records that turn snap into st. UpdatedAt alone does not
+// produce a metadata record so no-op saves append nothing.
+func (snap *logSnapshot) diff(st State) ([]logRecord, error) {
+	records := make([]logRecord, 0)
+
+	roots := st.Roots
+	if roots == nil {
+		roots = []RootRef{}
+	}
+	meta := logMeta{
+		SchemaVersion:  CurrentSchemaVersion,
+		BaseURL:        st.BaseURL,
+		CatalogRootURL: st.CatalogRootURL,
+		Roots:          roots,
+		Migrations:     st.Migrations,
+	}
+	var previous logMeta
+	if snap.meta != nil {
+		if err := json.Unmarshal(snap.meta, &previous); err != nil {
+			return nil, fmt.Errorf("decode state log metadata: %w", err)
+		}
+		meta.UpdatedAt = previous.UpdatedAt
+	}
+	encodedMeta, err := json.Marshal(meta)
+	if err != nil {
+		return nil, fmt.Errorf("encode state metadata: %w", err)
+	}
+
+	ids := make([]string, 0, len(st.Nodes))
+	for id := range st.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		encoded, err := json.Marshal(st.Nodes[id])
+		if err != nil {
+			return nil, fmt.Errorf("encode node %s: %w", id, err)
+		}
+		if bytes.Equal(snap.nodes[id], encoded) {
+			continue
+		}
+		records = append(records, logRecord{Type: "put", Key: id, Value: encoded})
+	}
+	removed := make([]string, 0)
+	for id := range snap.nodes {
+		if _, ok := st.Nodes[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	sort.Strings(removed)
+	for _, id := range removed {
+		records = append(records, logRecord{Type: "del", Key: id})
+	}
+
+	if snap.meta == nil || !bytes.Equal(snap.meta, encodedMeta) || len(records) > 0 {
+		meta.UpdatedAt = time.Now().UTC()
+		encodedMeta, err = json.Marshal(meta)
+		if err != nil {
+			return nil, fmt.Errorf("encode state metadata: %w", err)
+		}
+		records = append(records, logRecord{Type: "meta", Value: encodedMeta})
+	}
+	return records, nil
+}
+
+func writeLogLine(buf *bytes.Buffer, v any) error {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode state log record: %w", err)
+	}
+	buf.Write(encoded)
+	buf.WriteByte('\n')
+	return nil
+}
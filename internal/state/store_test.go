@@ -0,0 +1,236 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func storeTestState(t *testing.T) (State, []string) {
+	t.Helper()
+	g := newTestGraph(t, "https://themis.housing.rug.nl/course/2024-2025/os", time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC))
+	g.add("os", "", Node{Title: "os"})
+	g.add("lab1", "/lab1", Node{Title: "lab1"})
+	g.add("lab2", "/lab2", Node{Title: "lab2"})
+	g.link("os", "lab1", "lab2")
+	g.root("os")
+	g.st.BaseURL = "https://themis.housing.rug.nl"
+	return g.st, []string{g.ids["os"], g.ids["lab1"], g.ids["lab2"]}
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestLogStore_RoundTripAndIncrementalWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	st, ids := storeTestState(t)
+
+	store := &LogStore{Path: path}
+	if err := store.Save(st); err != nil {
+		t.Fatal(err)
+	}
+	fullSize := fileSize(t, path)
+
+	loaded, err := (&LogStore{Path: path}).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Nodes, st.Nodes) || !reflect.DeepEqual(loaded.Roots, st.Roots) || loaded.BaseURL != st.BaseURL {
+		t.Fatalf("round trip mismatch: %+v", loaded)
+	}
+
+	if err := store.Save(loaded); err != nil {
+		t.Fatal(err)
+	}
+	if got := fileSize(t, path); got != fullSize {
+		t.Fatalf("no-op save grew log from %d to %d bytes", fullSize, got)
+	}
+
+	node := loaded.Nodes[ids[2]]
+	node.Title = "Lab 2 renamed"
+	if err := store.UpsertNodes([]Node{node}); err != nil {
+		t.Fatal(err)
+	}
+	grown := fileSize(t, path) - fullSize
+	if grown <= 0 || grown >= fullSize/2 {
+		t.Fatalf("upsert of one node appended %d bytes to a %d byte log", grown, fullSize)
+	}
+
+	got, ok, err := (&LogStore{Path: path}).GetNode(ids[2])
+	if err != nil || !ok || got.Title != "Lab 2 renamed" {
+		t.Fatalf("GetNode = %+v, %v, %v", got, ok, err)
+	}
+	children, err := store.Children(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 2 || children[0].ID != ids[1] || children[1].ID != ids[2] {
+		t.Fatalf("unexpected children: %+v", children)
+	}
+
+	if err := store.Update(func(st *State) (bool, error) {
+		delete(st.Nodes, ids[2])
+		return true, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := (&LogStore{Path: path}).GetNode(ids[2]); ok {
+		t.Fatalf("deleted node still present")
+	}
+}
+
+func TestLogStore_IgnoresAndTruncatesTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	st, ids := storeTestState(t)
+	if err := (&LogStore{Path: path}).Save(st); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"t":"put","k":"` + ids[1] + `","v":{"id":`); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	store := &LogStore{Path: path}
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("load with torn tail: %v", err)
+	}
+	if len(loaded.Nodes) != len(st.Nodes) {
+		t.Fatalf("expected %d nodes, got %d", len(st.Nodes), len(loaded.Nodes))
+	}
+
+	node := loaded.Nodes[ids[1]]
+	node.Title = "after crash"
+	if err := store.UpsertNodes([]Node{node}); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, line := range bytes.Split(bytes.TrimSuffix(raw, []byte("\n")), []byte("\n")) {
+		if !json.Valid(line) {
+			t.Fatalf("line %d is not valid JSON after recovery: %s", i+1, line)
+		}
+	}
+	got, ok, err := (&LogStore{Path: path}).GetNode(ids[1])
+	if err != nil || !ok || got.Title != "after crash" {
+		t.Fatalf("GetNode after recovery = %+v, %v, %v", got, ok, err)
+	}
+}
+
+func TestLogStore_CompactsSupersededRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	st, ids := storeTestState(t)
+	store := &LogStore{Path: path}
+	if err := store.Save(st); err != nil {
+		t.Fatal(err)
+	}
+	node := st.Nodes[ids[1]]
+	for i := 0; i < 2*logCompactMinRecords; i++ {
+		node.Title = time.Duration(i).String()
+		if err := store.UpsertNodes([]Node{node}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(raw, []byte("\n")); lines > logCompactMinRecords+2 {
+		t.Fatalf("log was not compacted: %d lines", lines)
+	}
+	got, ok, err := (&LogStore{Path: path}).GetNode(ids[1])
+	if err != nil || !ok || got.Title != node.Title {
+		t.Fatalf("GetNode after compaction = %+v, %v, %v", got, ok, err)
+	}
+}
+
+func TestConvertStore_RoundTripsBetweenBackends(t *testing.T) {
+	dir := t.TempDir()
+	st, _ := storeTestState(t)
+	jsonStore := &JSONStore{Path: filepath.Join(dir, "state.json")}
+	if err := jsonStore.Save(st); err != nil {
+		t.Fatal(err)
+	}
+	logStore := &LogStore{Path: filepath.Join(dir, "state.db")}
+
+	if _, err := ConvertStore(jsonStore, logStore, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ConvertStore(jsonStore, logStore, false); err == nil {
+		t.Fatalf("expected error converting onto an existing store without overwrite")
+	}
+
+	back := &JSONStore{Path: filepath.Join(dir, "back.json")}
+	if _, err := ConvertStore(logStore, back, false); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := back.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Nodes, st.Nodes) || !reflect.DeepEqual(loaded.Roots, st.Roots) {
+		t.Fatalf("conversion lost data: %+v", loaded)
+	}
+
+	if _, err := ConvertStore(jsonStore, jsonStore, true); err == nil {
+		t.Fatalf("expected error converting a store onto itself")
+	}
+}
+
+func TestJSONStore_NodeReadsShareLoadPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	st, ids := storeTestState(t)
+	store := &JSONStore{Path: path}
+	if err := store.Save(st); err != nil {
+		t.Fatal(err)
+	}
+
+	node, ok, err := store.GetNode(ids[1])
+	if err != nil || !ok || node.Title != "lab1" {
+		t.Fatalf("unexpected node: %+v %v %v", node, ok, err)
+	}
+	node.ParentIDs[0] = "url:changed"
+	children, err := store.Children(ids[0])
+	if err != nil || len(children) != 2 || children[0].ParentIDs[0] != ids[0] {
+		t.Fatalf("returned nodes must not alias the cached state: %+v %v", children, err)
+	}
+
+	if err := store.UpsertNodes([]Node{{ID: ids[1], CanonicalURL: st.Nodes[ids[1]].CanonicalURL, Title: "renamed", ParentIDs: []string{ids[0]}}}); err != nil {
+		t.Fatal(err)
+	}
+	if node, _, _ := store.GetNode(ids[1]); node.Title != "renamed" {
+		t.Fatalf("expected the write to invalidate the cached read, got %q", node.Title)
+	}
+
+	// A dangling child edge fails the integrity check; strict reads refuse it.
+	broken := st.Nodes[ids[0]]
+	broken.ChildIDs = append(broken.ChildIDs, "url:missing")
+	if err := store.UpsertNodes([]Node{broken}); err != nil {
+		t.Fatal(err)
+	}
+	strict := &JSONStore{Path: path, Strict: true}
+	if _, _, err := strict.GetNode(ids[1]); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("expected strict GetNode to fail the integrity check, got %v", err)
+	}
+	if _, err := strict.Children(ids[0]); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("expected strict Children to fail the integrity check, got %v", err)
+	}
+}
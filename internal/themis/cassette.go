@@ -0,0 +1,261 @@
+package themis
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const redactedValue = "REDACTED"
+
+// ErrCassetteMiss is returned by a replaying transport for requests that were never recorded.
+var ErrCassetteMiss = errors.New("request not found in cassette")
+
+// redactedHeaders are never written to cassette files.
+var redactedHeaders = map[string]bool{
+	"Cookie":        true,
+	"Set-Cookie":    true,
+	"Authorization": true,
+}
+
+// CassetteInteraction is one recorded request/response pair, stored as a
+// numbered JSON file inside the cassette directory.
+type CassetteInteraction struct {
+	Seq            int                 `json:"seq"`
+	Method         string              `json:"method"`
+	URL            string              `json:"url"`
+	RequestHeader  map[string][]string `json:"request_header,omitempty"`
+	Status         int                 `json:"status"`
+	ResponseHeader map[string][]string `json:"response_header,omitempty"`
+	Body           string              `json:"body"`
+	BodyEncoding   string              `json:"body_encoding,omitempty"`
+	RecordedAt     time.Time           `json:"recorded_at"`
+}
+
+// RecordingTransport forwards requests to Next and writes every exchange to Dir
+// with cookies and credentials redacted.
+type RecordingTransport struct {
+	Dir  string
+	Next http.RoundTripper
+
+	mu  sync.Mutex
+	seq int
+}
+
+// NewRecordingTransport creates the cassette directory and continues numbering
+// after any interactions already stored there.
+func NewRecordingTransport(dir string, next http.RoundTripper) (*RecordingTransport, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create cassette directory: %w", err)
+	}
+	existing, err := loadCassette(dir)
+	if err != nil {
+		return nil, err
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	seq := 0
+	for _, it := range existing {
+		if it.Seq > seq {
+			seq = it.Seq
+		}
+	}
+	return &RecordingTransport{Dir: dir, Next: next, seq: seq}, nil
+}
+
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.Next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, readErr := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if readErr != nil {
+		return nil, fmt.Errorf("read response for cassette: %w", readErr)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seq++
+	interaction := CassetteInteraction{
+		Seq:            t.seq,
+		Method:         req.Method,
+		URL:            req.URL.String(),
+		RequestHeader:  redactHeader(req.Header),
+		Status:         resp.StatusCode,
+		ResponseHeader: redactHeader(resp.Header),
+		RecordedAt:     time.Now().UTC(),
+	}
+	if utf8.Valid(body) {
+		interaction.Body = string(body)
+	} else {
+		interaction.Body = base64.StdEncoding.EncodeToString(body)
+		interaction.BodyEncoding = "base64"
+	}
+
+	encoded, err := json.MarshalIndent(interaction, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encode cassette interaction: %w", err)
+	}
+	name := filepath.Join(t.Dir, fmt.Sprintf("%05d.json", interaction.Seq))
+	if err := os.WriteFile(name, append(encoded, '\n'), 0o644); err != nil {
+		return nil, fmt.Errorf("write cassette interaction: %w", err)
+	}
+	return resp, nil
+}
+
+// ReplayTransport serves responses from a cassette directory. Requests are
+// matched on method and full URL; repeated requests for the same URL are served
+// in recording order, and the last recording is reused once they run out.
+type ReplayTransport struct {
+	mu      sync.Mutex
+	entries map[string][]CassetteInteraction
+	served  map[string]int
+}
+
+func NewReplayTransport(dir string) (*ReplayTransport, error) {
+	interactions, err := loadCassette(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(interactions) == 0 {
+		return nil, fmt.Errorf("cassette %s contains no interactions", dir)
+	}
+	entries := map[string][]CassetteInteraction{}
+	for _, it := range interactions {
+		key := cassetteKey(it.Method, it.URL)
+		entries[key] = append(entries[key], it)
+	}
+	return &ReplayTransport{entries: entries, served: map[string]int{}}, nil
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := cassetteKey(req.Method, req.URL.String())
+
+	t.mu.Lock()
+	recorded, ok := t.entries[key]
+	if !ok {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s %s", ErrCassetteMiss, req.Method, req.URL.String())
+	}
+	idx := t.served[key]
+	if idx >= len(recorded) {
+		idx = len(recorded) - 1
+	}
+	t.served[key]++
+	it := recorded[idx]
+	t.mu.Unlock()
+
+	body := []byte(it.Body)
+	if it.BodyEncoding == "base64" {
+		decoded, err := base64.StdEncoding.DecodeString(it.Body)
+		if err != nil {
+			return nil, fmt.Errorf("decode cassette body for %s: %w", it.URL, err)
+		}
+		body = decoded
+	}
+	header := http.Header{}
+	for k, v := range it.ResponseHeader {
+		if redactedHeaders[http.CanonicalHeaderKey(k)] {
+			continue
+		}
+		header[k] = append([]string(nil), v...)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", it.Status, http.StatusText(it.Status)),
+		StatusCode:    it.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// NewReplaySession builds a session whose client only answers from the cassette
+// in dir. No cookies are required.
+func NewReplaySession(baseURL string, dir string) (*Session, error) {
+	normalizedBaseURL, err := NormalizeBaseURL(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := NewReplayTransport(dir)
+	if err != nil {
+		return nil, err
+	}
+	client, err := initializeHTTPClient(ClientConfig{})
+	if err != nil {
+		return nil, err
+	}
+	client.Transport = transport
+	return &Session{BaseURL: normalizedBaseURL, Client: client}, nil
+}
+
+// RecordTo wraps the session transport so every exchange is stored in dir.
+func (s *Session) RecordTo(dir string) error {
+	transport, err := NewRecordingTransport(dir, s.Client.Transport)
+	if err != nil {
+		return err
+	}
+	s.Client.Transport = transport
+	return nil
+}
+
+func loadCassette(dir string) ([]CassetteInteraction, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("scan cassette: %w", err)
+	}
+	out := make([]CassetteInteraction, 0, len(matches))
+	for _, path := range matches {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read cassette interaction: %w", err)
+		}
+		var it CassetteInteraction
+		if err := json.Unmarshal(raw, &it); err != nil {
+			return nil, fmt.Errorf("decode cassette interaction %s: %w", path, err)
+		}
+		out = append(out, it)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Seq < out[j].Seq })
+	return out, nil
+}
+
+func cassetteKey(method string, rawURL string) string {
+	if method == "" {
+		method = http.MethodGet
+	}
+	return strings.ToUpper(method) + " " + rawURL
+}
+
+func redactHeader(h http.Header) map[string][]string {
+	if len(h) == 0 {
+		return nil
+	}
+	out := make(map[string][]string, len(h))
+	for k, v := range h {
+		if redactedHeaders[http.CanonicalHeaderKey(k)] {
+			out[k] = []string{redactedValue}
+			continue
+		}
+		out[k] = append([]string(nil), v...)
+	}
+	return out
+}
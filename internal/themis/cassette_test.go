@@ -0,0 +1,69 @@
+package themis
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordThenReplay(t *testing.T) {
+	resetCookieCache(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "server-secret", Path: "/"})
+		switch r.URL.Path {
+		case "/user":
+			_, _ = io.WriteString(w, `<section class="border accent"><div class="cfg-container"><div class="cfg-line"><span class="cfg-key">Full name:</span><span class="cfg-val">Ada</span></div></div></section>`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	cookiePath := filepath.Join(dir, "cookie.txt")
+	if err := os.WriteFile(cookiePath, []byte("session=client-secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cassette := filepath.Join(dir, "cassette")
+
+	session, err := NewSessionWithAuthConfig(server.URL, AuthConfig{CookieFile: cookiePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.RecordTo(cassette); err != nil {
+		t.Fatalf("record setup failed: %v", err)
+	}
+	user, err := session.ValidateAuthentication()
+	if err != nil || user.FullName != "Ada" {
+		t.Fatalf("live validation failed: %v %#v", err, user)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(cassette, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("expected one recorded interaction, got %d", len(files))
+	}
+	raw, _ := os.ReadFile(files[0])
+	if strings.Contains(string(raw), "client-secret") || strings.Contains(string(raw), "server-secret") {
+		t.Fatalf("cassette leaks cookies: %s", raw)
+	}
+
+	server.Close()
+	replay, err := NewReplaySession(server.URL, cassette)
+	if err != nil {
+		t.Fatalf("replay setup failed: %v", err)
+	}
+	user, err = replay.ValidateAuthentication()
+	if err != nil || user.FullName != "Ada" {
+		t.Fatalf("replayed validation failed: %v %#v", err, user)
+	}
+
+	_, err = replay.Client.Get(server.URL + "/course")
+	if err == nil || !errors.Is(err, ErrCassetteMiss) {
+		t.Fatalf("expected cassette miss, got %v", err)
+	}
+}
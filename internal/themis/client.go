@@ -0,0 +1,105 @@
+package themis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Version is the CLI version reported in the default User-Agent. Release builds
+// override it with -ldflags "-X themis-cli/internal/themis.Version=v1.2.3".
+var Version = "dev"
+
+// DefaultRequestTimeout bounds a single HTTP request when no timeout is configured.
+const DefaultRequestTimeout = 60 * time.Second
+
+// ClientConfig controls how the HTTP client talks to Themis.
+type ClientConfig struct {
+	// Timeout bounds each request including reading the body. Zero disables it.
+	Timeout time.Duration
+	// ProxyURL overrides the proxy from HTTPS_PROXY/HTTP_PROXY/NO_PROXY.
+	ProxyURL string
+	// CABundle is a PEM file with extra trusted roots, added to the system pool.
+	CABundle string
+	// UserAgent replaces DefaultUserAgent when set.
+	UserAgent string
+}
+
+// DefaultClientConfig is used by sessions that are not given an explicit config.
+func DefaultClientConfig() ClientConfig {
+	return ClientConfig{Timeout: DefaultRequestTimeout}
+}
+
+func DefaultUserAgent() string {
+	return fmt.Sprintf("themis-cli/%s (+https://github.com/danielgrbacbravo/themis-cli)", Version)
+}
+
+func initializeHTTPClient(cfg ClientConfig) (*http.Client, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy := strings.TrimSpace(cfg.ProxyURL); proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if bundle := strings.TrimSpace(cfg.CABundle); bundle != "" {
+		pool, err := loadCABundle(bundle)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	userAgent := strings.TrimSpace(cfg.UserAgent)
+	if userAgent == "" {
+		userAgent = DefaultUserAgent()
+	}
+
+	return &http.Client{
+		Jar:       jar,
+		Timeout:   cfg.Timeout,
+		Transport: &userAgentTransport{userAgent: userAgent, next: transport},
+	}, nil
+}
+
+func loadCABundle(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read CA bundle: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("CA bundle %s contains no PEM certificates", path)
+	}
+	return pool, nil
+}
+
+// userAgentTransport sets the User-Agent header on requests that lack one.
+type userAgentTransport struct {
+	userAgent string
+	next      http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") != "" {
+		return t.next.RoundTrip(req)
+	}
+	clone := req.Clone(req.Context())
+	clone.Header.Set("User-Agent", t.userAgent)
+	return t.next.RoundTrip(clone)
+}
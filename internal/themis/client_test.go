@@ -0,0 +1,104 @@
+package themis
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient_SendsDefaultAndCustomUserAgent(t *testing.T) {
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.UserAgent())
+	}))
+	defer server.Close()
+
+	for _, cfg := range []ClientConfig{{}, {UserAgent: "custom/1.0"}} {
+		client, err := initializeHTTPClient(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	if len(got) != 2 || !strings.HasPrefix(got[0], "themis-cli/"+Version) || got[1] != "custom/1.0" {
+		t.Fatalf("unexpected user agents: %#v", got)
+	}
+}
+
+func TestClient_TrustsExtraCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client, err := initializeHTTPClient(ClientConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(server.URL); err == nil {
+		t.Fatalf("expected TLS failure without CA bundle")
+	}
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	block := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(bundle, block, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	client, err = initializeHTTPClient(ClientConfig{CABundle: bundle})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected CA bundle to be trusted: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestClient_RejectsInvalidProxyAndEmptyBundle(t *testing.T) {
+	if _, err := initializeHTTPClient(ClientConfig{ProxyURL: "::not a url"}); err == nil {
+		t.Fatalf("expected invalid proxy error")
+	}
+	bundle := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(bundle, []byte("nothing here"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := initializeHTTPClient(ClientConfig{CABundle: bundle}); err == nil {
+		t.Fatalf("expected empty CA bundle error")
+	}
+}
+
+func TestSession_ContextCancelsHungRequest(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client, err := initializeHTTPClient(ClientConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := &Session{BaseURL: server.URL, Client: client}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = session.CheckBaseURLAccessContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,388 @@
+package themis
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	encryptedCookieFormat = "themis-encrypted-cookie"
+	encryptedCookieV1     = 1
+
+	kdfPBKDF2SHA256 = "pbkdf2-sha256"
+	kdfKeyFile      = "key-file"
+
+	cookieKeySize  = 32
+	cookieSaltSize = 16
+)
+
+// pbkdf2Iterations is a variable so tests can keep key derivation cheap.
+var pbkdf2Iterations = 600000
+
+// PassphraseFunc returns the passphrase used to decrypt or encrypt a cookie file.
+type PassphraseFunc func(prompt string) (string, error)
+
+// CookieEncryption configures how encrypted cookie files are opened.
+// A key file takes precedence over a passphrase.
+type CookieEncryption struct {
+	KeyFile    string
+	Passphrase PassphraseFunc
+}
+
+type encryptedCookieEnvelope struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	KDF        string    `json:"kdf"`
+	Iterations int       `json:"iterations,omitempty"`
+	Salt       string    `json:"salt,omitempty"`
+	Nonce      string    `json:"nonce"`
+	Ciphertext string    `json:"ciphertext"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type cachedCookieFile struct {
+	modTime time.Time
+	size    int64
+	value   string
+}
+
+// cookieCache keeps decrypted cookie strings and the passphrase for the lifetime
+// of the process, so a command that opens several sessions prompts only once.
+var cookieCache = struct {
+	sync.Mutex
+	files      map[string]cachedCookieFile
+	passphrase string
+	havePass   bool
+}{files: map[string]cachedCookieFile{}}
+
+// IsEncryptedCookieData reports whether raw cookie file contents use the encrypted envelope.
+func IsEncryptedCookieData(raw []byte) bool {
+	trimmed := strings.TrimSpace(string(raw))
+	if !strings.HasPrefix(trimmed, "{") {
+		return false
+	}
+	var probe struct {
+		Format string `json:"format"`
+	}
+	if err := json.Unmarshal([]byte(trimmed), &probe); err != nil {
+		return false
+	}
+	return probe.Format == encryptedCookieFormat
+}
+
+// EncryptCookieFile encrypts the plaintext cookie file at inPath and writes the
+// envelope atomically to outPath (which may equal inPath).
+func EncryptCookieFile(inPath string, outPath string, enc CookieEncryption) error {
+	raw, err := os.ReadFile(inPath)
+	if err != nil {
+		return fmt.Errorf("read cookie file: %w", err)
+	}
+	if IsEncryptedCookieData(raw) {
+		return fmt.Errorf("cookie file is already encrypted: %s", inPath)
+	}
+	cookieString := strings.TrimSpace(string(raw))
+	if cookieString == "" {
+		return fmt.Errorf("cookie file is empty: %s", inPath)
+	}
+	if _, err := parseCookieString(cookieString, fmt.Sprintf("file %q", inPath)); err != nil {
+		return err
+	}
+
+	sealed, err := sealCookieString(cookieString, enc)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(outPath, sealed, 0o600); err != nil {
+		return err
+	}
+
+	forgetCachedCookieFile(outPath)
+	return nil
+}
+
+func sealCookieString(cookieString string, enc CookieEncryption) ([]byte, error) {
+	env := encryptedCookieEnvelope{
+		Format:    encryptedCookieFormat,
+		Version:   encryptedCookieV1,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	var key []byte
+	if strings.TrimSpace(enc.KeyFile) != "" {
+		k, err := keyFromKeyFile(enc.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		key = k
+		env.KDF = kdfKeyFile
+	} else {
+		passphrase, err := newCookiePassphrase(enc)
+		if err != nil {
+			return nil, err
+		}
+		salt := make([]byte, cookieSaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, fmt.Errorf("generate salt: %w", err)
+		}
+		env.KDF = kdfPBKDF2SHA256
+		env.Iterations = pbkdf2Iterations
+		env.Salt = base64.StdEncoding.EncodeToString(salt)
+		key = pbkdf2.Key([]byte(passphrase), salt, env.Iterations, cookieKeySize, sha256.New)
+	}
+
+	gcm, err := newCookieAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	ciphertext := gcm.Seal(nil, nonce, []byte(cookieString), []byte(encryptedCookieFormat))
+	env.Nonce = base64.StdEncoding.EncodeToString(nonce)
+	env.Ciphertext = base64.StdEncoding.EncodeToString(ciphertext)
+
+	out, err := json.MarshalIndent(env, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encode encrypted cookie: %w", err)
+	}
+	return append(out, '\n'), nil
+}
+
+func openCookieEnvelope(raw []byte, path string, enc CookieEncryption) (string, error) {
+	var env encryptedCookieEnvelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return "", fmt.Errorf("decode encrypted cookie file: %w", err)
+	}
+	if env.Version != encryptedCookieV1 {
+		return "", fmt.Errorf("unsupported encrypted cookie version %d", env.Version)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(env.Nonce)
+	if err != nil {
+		return "", fmt.Errorf("decode nonce: %w", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(env.Ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("decode ciphertext: %w", err)
+	}
+
+	var key []byte
+	switch env.KDF {
+	case kdfKeyFile:
+		if strings.TrimSpace(enc.KeyFile) == "" {
+			return "", fmt.Errorf("cookie file is encrypted with a key file; provide --cookie-key-file")
+		}
+		key, err = keyFromKeyFile(enc.KeyFile)
+		if err != nil {
+			return "", err
+		}
+	case kdfPBKDF2SHA256:
+		salt, err := base64.StdEncoding.DecodeString(env.Salt)
+		if err != nil {
+			return "", fmt.Errorf("decode salt: %w", err)
+		}
+		if env.Iterations < 1 {
+			return "", fmt.Errorf("invalid kdf iterations: %d", env.Iterations)
+		}
+		passphrase, err := cachedPassphrase(enc, fmt.Sprintf("Passphrase for %s: ", path))
+		if err != nil {
+			return "", err
+		}
+		key = pbkdf2.Key([]byte(passphrase), salt, env.Iterations, cookieKeySize, sha256.New)
+	default:
+		return "", fmt.Errorf("unsupported cookie kdf: %q", env.KDF)
+	}
+
+	gcm, err := newCookieAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return "", fmt.Errorf("invalid nonce length %d", len(nonce))
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(encryptedCookieFormat))
+	if err != nil {
+		forgetCachedPassphrase()
+		return "", fmt.Errorf("decrypt cookie file: wrong key or passphrase")
+	}
+
+	cookieString := strings.TrimSpace(string(plaintext))
+	if cookieString == "" {
+		return "", fmt.Errorf("cookie file is empty: %s", path)
+	}
+	return cookieString, nil
+}
+
+func newCookieAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("init cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("init gcm: %w", err)
+	}
+	return gcm, nil
+}
+
+// keyFromKeyFile derives a fixed-size key from arbitrary key file contents.
+func keyFromKeyFile(path string) ([]byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read cookie key file: %w", err)
+	}
+	trimmed := strings.TrimSpace(string(raw))
+	if len(trimmed) < 16 {
+		return nil, fmt.Errorf("cookie key file %s is too short (need at least 16 characters)", path)
+	}
+	sum := sha256.Sum256([]byte(trimmed))
+	return sum[:], nil
+}
+
+// GenerateCookieKeyFile writes a new random key file with owner-only permissions.
+func GenerateCookieKeyFile(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("key file already exists: %s", path)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("check key file: %w", err)
+	}
+	buf := make([]byte, cookieKeySize)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Errorf("generate key: %w", err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(buf) + "\n"
+	return writeFileAtomic(path, []byte(encoded), 0o600)
+}
+
+func cachedPassphrase(enc CookieEncryption, prompt string) (string, error) {
+	cookieCache.Lock()
+	defer cookieCache.Unlock()
+	if cookieCache.havePass {
+		return cookieCache.passphrase, nil
+	}
+	if enc.Passphrase == nil {
+		return "", fmt.Errorf("cookie file is encrypted; set THEMIS_COOKIE_PASSPHRASE or provide --cookie-key-file")
+	}
+	passphrase, err := enc.Passphrase(prompt)
+	if err != nil {
+		return "", fmt.Errorf("read cookie passphrase: %w", err)
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("cookie passphrase is empty")
+	}
+	cookieCache.passphrase = passphrase
+	cookieCache.havePass = true
+	return passphrase, nil
+}
+
+// newCookiePassphrase asks for the passphrase that will encrypt a cookie
+// file. Unless one is already cached, it is asked twice so a typo cannot lock
+// the file.
+func newCookiePassphrase(enc CookieEncryption) (string, error) {
+	cookieCache.Lock()
+	defer cookieCache.Unlock()
+	if cookieCache.havePass {
+		return cookieCache.passphrase, nil
+	}
+	if enc.Passphrase == nil {
+		return "", fmt.Errorf("no cookie passphrase available; set THEMIS_COOKIE_PASSPHRASE or provide --cookie-key-file")
+	}
+	passphrase, err := enc.Passphrase("New cookie passphrase: ")
+	if err != nil {
+		return "", fmt.Errorf("read cookie passphrase: %w", err)
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("cookie passphrase is empty")
+	}
+	repeated, err := enc.Passphrase("Repeat cookie passphrase: ")
+	if err != nil {
+		return "", fmt.Errorf("read cookie passphrase: %w", err)
+	}
+	if repeated != passphrase {
+		return "", fmt.Errorf("cookie passphrases do not match")
+	}
+	cookieCache.passphrase = passphrase
+	cookieCache.havePass = true
+	return passphrase, nil
+}
+
+func forgetCachedPassphrase() {
+	cookieCache.Lock()
+	defer cookieCache.Unlock()
+	cookieCache.passphrase = ""
+	cookieCache.havePass = false
+}
+
+func cachedCookieFileValue(path string, info os.FileInfo) (string, bool) {
+	cookieCache.Lock()
+	defer cookieCache.Unlock()
+	entry, ok := cookieCache.files[path]
+	if !ok || !entry.modTime.Equal(info.ModTime()) || entry.size != info.Size() {
+		return "", false
+	}
+	return entry.value, true
+}
+
+func storeCachedCookieFile(path string, info os.FileInfo, value string) {
+	cookieCache.Lock()
+	defer cookieCache.Unlock()
+	cookieCache.files[path] = cachedCookieFile{modTime: info.ModTime(), size: info.Size(), value: value}
+}
+
+func forgetCachedCookieFile(path string) {
+	cookieCache.Lock()
+	defer cookieCache.Unlock()
+	delete(cookieCache.files, path)
+}
+
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("create directory %s: %w", dir, err)
+	}
+	tmp, err := os.CreateTemp(dir, ".cookie-*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	tmpName := tmp.Name()
+	cleanup := true
+	defer func() {
+		if cleanup {
+			_ = os.Remove(tmpName)
+		}
+	}()
+
+	if err := tmp.Chmod(perm); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("chmod temp file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write temp file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("fsync temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close temp file: %w", err)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("rename temp file: %w", err)
+	}
+	cleanup = false
+	return nil
+}
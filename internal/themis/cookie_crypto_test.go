@@ -0,0 +1,148 @@
+package themis
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func resetCookieCache(t *testing.T) {
+	t.Helper()
+	prevIterations := pbkdf2Iterations
+	pbkdf2Iterations = 1000
+	cookieCache.Lock()
+	cookieCache.files = map[string]cachedCookieFile{}
+	cookieCache.passphrase = ""
+	cookieCache.havePass = false
+	cookieCache.Unlock()
+	t.Cleanup(func() {
+		pbkdf2Iterations = prevIterations
+		cookieCache.Lock()
+		cookieCache.files = map[string]cachedCookieFile{}
+		cookieCache.passphrase = ""
+		cookieCache.havePass = false
+		cookieCache.Unlock()
+	})
+}
+
+func TestEncryptCookieFile_KeyFileRoundTrip(t *testing.T) {
+	resetCookieCache(t)
+	dir := t.TempDir()
+	cookiePath := filepath.Join(dir, "cookie.txt")
+	keyPath := filepath.Join(dir, "cookie.key")
+	if err := os.WriteFile(cookiePath, []byte("session=secret; csrf=abc\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenerateCookieKeyFile(keyPath); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	enc := CookieEncryption{KeyFile: keyPath}
+	if err := EncryptCookieFile(cookiePath, cookiePath, enc); err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+
+	raw, err := os.ReadFile(cookiePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "secret") {
+		t.Fatalf("encrypted file still contains plaintext cookie")
+	}
+	if !IsEncryptedCookieData(raw) {
+		t.Fatalf("expected encrypted envelope")
+	}
+
+	cookies, source, err := resolveCookies(AuthConfig{CookieFile: cookiePath, Encryption: enc})
+	if err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+	if source != "cookie-file" || len(cookies) != 2 || cookies[0].Value != "secret" {
+		t.Fatalf("unexpected cookies: source=%s %#v", source, cookies)
+	}
+
+	resetCookieCache(t)
+	if _, _, err := resolveCookies(AuthConfig{CookieFile: cookiePath}); err == nil {
+		t.Fatalf("expected error without key file")
+	}
+}
+
+func TestEncryptCookieFile_PassphraseConfirmedThenCached(t *testing.T) {
+	resetCookieCache(t)
+	dir := t.TempDir()
+	cookiePath := filepath.Join(dir, "cookie.txt")
+	if err := os.WriteFile(cookiePath, []byte("session=secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	prompts := []string{}
+	enc := CookieEncryption{Passphrase: func(prompt string) (string, error) {
+		prompts = append(prompts, prompt)
+		return "correct horse", nil
+	}}
+	if err := EncryptCookieFile(cookiePath, cookiePath, enc); err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		cookies, _, err := resolveCookies(AuthConfig{CookieFile: cookiePath, Encryption: enc})
+		if err != nil {
+			t.Fatalf("resolve %d failed: %v", i, err)
+		}
+		if cookies[0].Value != "secret" {
+			t.Fatalf("unexpected cookie value: %s", cookies[0].Value)
+		}
+	}
+	if len(prompts) != 2 || !strings.HasPrefix(prompts[1], "Repeat") {
+		t.Fatalf("expected the new passphrase to be asked twice and then cached, got %q", prompts)
+	}
+}
+
+func TestEncryptCookieFile_PassphraseMismatch(t *testing.T) {
+	resetCookieCache(t)
+	dir := t.TempDir()
+	cookiePath := filepath.Join(dir, "cookie.txt")
+	if err := os.WriteFile(cookiePath, []byte("session=secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	answers := []string{"correct horse", "correct hrose"}
+	enc := CookieEncryption{Passphrase: func(string) (string, error) {
+		answer := answers[0]
+		answers = answers[1:]
+		return answer, nil
+	}}
+	err := EncryptCookieFile(cookiePath, cookiePath, enc)
+	if err == nil || !strings.Contains(err.Error(), "do not match") {
+		t.Fatalf("expected mismatch error, got %v", err)
+	}
+	raw, err := os.ReadFile(cookiePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != "session=secret" {
+		t.Fatalf("cookie file changed after a mismatch: %q", raw)
+	}
+}
+
+func TestEncryptCookieFile_WrongPassphrase(t *testing.T) {
+	resetCookieCache(t)
+	dir := t.TempDir()
+	cookiePath := filepath.Join(dir, "cookie.txt")
+	if err := os.WriteFile(cookiePath, []byte("session=secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := EncryptCookieFile(cookiePath, cookiePath, CookieEncryption{Passphrase: func(string) (string, error) { return "right", nil }}); err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+
+	resetCookieCache(t)
+	_, _, err := resolveCookies(AuthConfig{
+		CookieFile: cookiePath,
+		Encryption: CookieEncryption{Passphrase: func(string) (string, error) { return "wrong", nil }},
+	})
+	if err == nil || !strings.Contains(err.Error(), "wrong key or passphrase") {
+		t.Fatalf("expected decrypt failure, got: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package themis
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// cookieOrigin remembers where a session's cookies came from so rotated
+// cookies can be written back in the same place and format.
+type cookieOrigin struct {
+	Source       string
+	Path         string
+	CookieString string
+	Encryption   CookieEncryption
+}
+
+func fileCookieOrigin(source string, path string, cookieString string, enc CookieEncryption) cookieOrigin {
+	return cookieOrigin{
+		Source:       source,
+		Path:         path,
+		CookieString: cookieString,
+		Encryption:   enc,
+	}
+}
+
+// CookieSource reports which configured source supplied the session cookies
+// ("cookie-file", "cookie-env" or "default-path") and the file path, if any.
+func (s *Session) CookieSource() (string, string) {
+	return s.cookieOrigin.Source, s.cookieOrigin.Path
+}
+
+// PersistCookies writes cookies updated through Set-Cookie responses back to the
+// originating cookie file. It is a no-op unless AuthConfig.PersistCookies was set,
+// when cookies came from an environment variable, or when nothing changed.
+// Encrypted files are re-encrypted with the same key source.
+func (s *Session) PersistCookies() error {
+	if s == nil || !s.persistJar || s.Client == nil || s.Client.Jar == nil {
+		return nil
+	}
+	origin := s.cookieOrigin
+	if origin.Path == "" {
+		return nil
+	}
+
+	baseURL, err := url.Parse(s.BaseURL)
+	if err != nil {
+		return fmt.Errorf("parse base URL: %w", err)
+	}
+	next := mergeCookieString(origin.CookieString, s.Client.Jar.Cookies(baseURL))
+	if next == "" || next == origin.CookieString {
+		return nil
+	}
+
+	info, err := os.Stat(origin.Path)
+	if err != nil {
+		return fmt.Errorf("stat cookie file: %w", err)
+	}
+	raw, err := os.ReadFile(origin.Path)
+	if err != nil {
+		return fmt.Errorf("read cookie file: %w", err)
+	}
+
+	encrypted := IsEncryptedCookieData(raw)
+	onDisk := strings.TrimSpace(string(raw))
+	if encrypted {
+		onDisk, err = loadCookiesFromFile(origin.Path, origin.Encryption)
+		if err != nil {
+			return err
+		}
+	}
+	if onDisk != origin.CookieString {
+		return fmt.Errorf("cookie file %s changed on disk since it was loaded; not overwriting", origin.Path)
+	}
+
+	var out []byte
+	if encrypted {
+		out, err = sealCookieString(next, origin.Encryption)
+		if err != nil {
+			return err
+		}
+	} else {
+		out = []byte(next)
+		if strings.HasSuffix(string(raw), "\n") {
+			out = append(out, '\n')
+		}
+	}
+
+	if err := writeFileAtomic(origin.Path, out, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("persist cookies: %w", err)
+	}
+	forgetCachedCookieFile(origin.Path)
+	s.cookieOrigin.CookieString = next
+	return nil
+}
+
+// mergeCookieString rewrites a "name=value; ..." cookie string with the values
+// currently held by the jar. Cookies missing from the jar were expired by the
+// server and are dropped; new cookies are appended in jar order.
+func mergeCookieString(original string, jarCookies []*http.Cookie) string {
+	if len(jarCookies) == 0 {
+		return original
+	}
+	current := make(map[string]string, len(jarCookies))
+	order := make([]string, 0, len(jarCookies))
+	for _, c := range jarCookies {
+		if _, ok := current[c.Name]; !ok {
+			order = append(order, c.Name)
+		}
+		current[c.Name] = c.Value
+	}
+
+	parts := make([]string, 0, len(order))
+	written := map[string]bool{}
+	for _, pair := range strings.Split(original, ";") {
+		name, _, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || written[name] {
+			continue
+		}
+		value, present := current[name]
+		if !present {
+			continue
+		}
+		parts = append(parts, name+"="+value)
+		written[name] = true
+	}
+	for _, name := range order {
+		if written[name] {
+			continue
+		}
+		parts = append(parts, name+"="+current[name])
+		written[name] = true
+	}
+	return strings.Join(parts, "; ")
+}
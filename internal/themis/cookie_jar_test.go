@@ -0,0 +1,126 @@
+package themis
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func rotatingCookieServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "rotated", Path: "/"})
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func TestPersistCookies_WritesRotatedCookiePreservingFormat(t *testing.T) {
+	resetCookieCache(t)
+	server := rotatingCookieServer(t)
+	defer server.Close()
+
+	cookiePath := filepath.Join(t.TempDir(), "cookie.txt")
+	if err := os.WriteFile(cookiePath, []byte("session=original; theme=dark\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := NewSessionWithAuthConfig(server.URL, AuthConfig{CookieFile: cookiePath, PersistCookies: true})
+	if err != nil {
+		t.Fatalf("new session failed: %v", err)
+	}
+	if err := session.CheckBaseURLAccess(); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if err := session.PersistCookies(); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+
+	raw, err := os.ReadFile(cookiePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != "session=rotated; theme=dark\n" {
+		t.Fatalf("unexpected cookie file: %q", string(raw))
+	}
+	info, err := os.Stat(cookiePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("permissions not preserved: %v", info.Mode().Perm())
+	}
+}
+
+func TestPersistCookies_ReencryptsEncryptedFile(t *testing.T) {
+	resetCookieCache(t)
+	server := rotatingCookieServer(t)
+	defer server.Close()
+
+	dir := t.TempDir()
+	cookiePath := filepath.Join(dir, "cookie.txt")
+	keyPath := filepath.Join(dir, "cookie.key")
+	if err := os.WriteFile(cookiePath, []byte("session=original"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenerateCookieKeyFile(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	enc := CookieEncryption{KeyFile: keyPath}
+	if err := EncryptCookieFile(cookiePath, cookiePath, enc); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := NewSessionWithAuthConfig(server.URL, AuthConfig{CookieFile: cookiePath, Encryption: enc, PersistCookies: true})
+	if err != nil {
+		t.Fatalf("new session failed: %v", err)
+	}
+	if err := session.CheckBaseURLAccess(); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if err := session.PersistCookies(); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+
+	raw, err := os.ReadFile(cookiePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncryptedCookieData(raw) {
+		t.Fatalf("expected cookie file to stay encrypted")
+	}
+	resetCookieCache(t)
+	cookies, _, err := resolveCookies(AuthConfig{CookieFile: cookiePath, Encryption: enc})
+	if err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+	if cookies[0].Value != "rotated" {
+		t.Fatalf("expected rotated cookie, got %q", cookies[0].Value)
+	}
+}
+
+func TestPersistCookies_DisabledByDefault(t *testing.T) {
+	resetCookieCache(t)
+	server := rotatingCookieServer(t)
+	defer server.Close()
+
+	cookiePath := filepath.Join(t.TempDir(), "cookie.txt")
+	if err := os.WriteFile(cookiePath, []byte("session=original"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	session, err := NewSessionWithAuthConfig(server.URL, AuthConfig{CookieFile: cookiePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.CheckBaseURLAccess(); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.PersistCookies(); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := os.ReadFile(cookiePath)
+	if string(raw) != "session=original" {
+		t.Fatalf("cookie file should be untouched, got %q", string(raw))
+	}
+}
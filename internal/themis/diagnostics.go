@@ -0,0 +1,143 @@
+package themis
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// CookieSourceReport describes one entry of the cookie resolution order.
+type CookieSourceReport struct {
+	Source     string     `json:"source"`
+	Location   string     `json:"location,omitempty"`
+	Configured bool       `json:"configured"`
+	Valid      bool       `json:"valid"`
+	Selected   bool       `json:"selected"`
+	Encrypted  bool       `json:"encrypted,omitempty"`
+	Cookies    int        `json:"cookies,omitempty"`
+	ModifiedAt *time.Time `json:"modified_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// CookieExpiry is the expiry advertised by Themis for a session cookie.
+type CookieExpiry struct {
+	Name      string     `json:"name"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Session   bool       `json:"session"`
+}
+
+// InspectCookieSources evaluates every configured cookie source in resolution
+// order (cookie file, cookie env, default path) without stopping at the first
+// valid one, and marks the source resolveCookies would pick as Selected.
+func InspectCookieSources(authConfig AuthConfig) []CookieSourceReport {
+	reports := []CookieSourceReport{
+		inspectCookieFile("cookie-file", authConfig.CookieFile, authConfig.Encryption),
+		inspectCookieEnv(authConfig.CookieEnv),
+		inspectCookieFile("default-path", authConfig.DefaultCookiePath, authConfig.Encryption),
+	}
+	for i := range reports {
+		if reports[i].Valid {
+			reports[i].Selected = true
+			break
+		}
+	}
+	return reports
+}
+
+func inspectCookieFile(source string, path string, enc CookieEncryption) CookieSourceReport {
+	path = strings.TrimSpace(path)
+	report := CookieSourceReport{Source: source, Location: path, Configured: path != ""}
+	if path == "" {
+		return report
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	modified := info.ModTime().UTC()
+	report.ModifiedAt = &modified
+
+	if raw, err := os.ReadFile(path); err == nil {
+		report.Encrypted = IsEncryptedCookieData(raw)
+	}
+	cookieString, err := loadCookiesFromFile(path, enc)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	cookies, err := parseCookieString(cookieString, fmt.Sprintf("file %q", path))
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	report.Valid = true
+	report.Cookies = len(cookies)
+	return report
+}
+
+func inspectCookieEnv(name string) CookieSourceReport {
+	name = strings.TrimSpace(name)
+	report := CookieSourceReport{Source: "cookie-env", Location: name, Configured: name != ""}
+	if name == "" {
+		return report
+	}
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		report.Error = "environment variable is unset or empty"
+		return report
+	}
+	cookies, err := parseCookieString(value, fmt.Sprintf("env %q", name))
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	report.Valid = true
+	report.Cookies = len(cookies)
+	return report
+}
+
+// CookieExpiry requests the user page and reports the expiry Themis attaches
+// to cookies it sets in the response. Cookies the server does not refresh are
+// not listed.
+func (s *Session) CookieExpiry() ([]CookieExpiry, error) {
+	return s.CookieExpiryContext(context.Background())
+}
+
+func (s *Session) CookieExpiryContext(ctx context.Context) ([]CookieExpiry, error) {
+	resp, err := s.get(ctx, s.BaseURL+userDataRoute)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching user data page: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	out := make([]CookieExpiry, 0)
+	for _, c := range resp.Cookies() {
+		out = append(out, cookieExpiryFromSetCookie(c, time.Now().UTC()))
+	}
+	return out, nil
+}
+
+func cookieExpiryFromSetCookie(c *http.Cookie, now time.Time) CookieExpiry {
+	entry := CookieExpiry{Name: c.Name}
+	switch {
+	case c.MaxAge > 0:
+		expires := now.Add(time.Duration(c.MaxAge) * time.Second)
+		entry.ExpiresAt = &expires
+	case c.MaxAge < 0:
+		expires := now
+		entry.ExpiresAt = &expires
+	case !c.Expires.IsZero():
+		expires := c.Expires.UTC()
+		entry.ExpiresAt = &expires
+	default:
+		entry.Session = true
+	}
+	return entry
+}
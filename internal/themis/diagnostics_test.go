@@ -0,0 +1,54 @@
+package themis
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInspectCookieSources_ReportsAllAndSelectsFirstValid(t *testing.T) {
+	resetCookieCache(t)
+	tmpDir := t.TempDir()
+	badFile := filepath.Join(tmpDir, "bad.txt")
+	defaultPath := filepath.Join(tmpDir, "default.txt")
+	if err := os.WriteFile(badFile, []byte("not-a-cookie"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(defaultPath, []byte("session=default"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("THEMIS_TEST_COOKIE", "session=env; other=1")
+
+	reports := InspectCookieSources(AuthConfig{
+		CookieFile:        badFile,
+		CookieEnv:         "THEMIS_TEST_COOKIE",
+		DefaultCookiePath: defaultPath,
+	})
+	if len(reports) != 3 {
+		t.Fatalf("expected 3 reports, got %d", len(reports))
+	}
+	if reports[0].Valid || reports[0].Error == "" || reports[0].ModifiedAt == nil {
+		t.Fatalf("unexpected cookie-file report: %#v", reports[0])
+	}
+	if !reports[1].Valid || !reports[1].Selected || reports[1].Cookies != 2 {
+		t.Fatalf("expected cookie-env selected: %#v", reports[1])
+	}
+	if !reports[2].Valid || reports[2].Selected {
+		t.Fatalf("expected default path valid but not selected: %#v", reports[2])
+	}
+}
+
+func TestCookieExpiryFromSetCookie(t *testing.T) {
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+
+	maxAge := cookieExpiryFromSetCookie(&http.Cookie{Name: "a", MaxAge: 3600}, now)
+	if maxAge.ExpiresAt == nil || !maxAge.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Fatalf("unexpected max-age expiry: %#v", maxAge)
+	}
+	session := cookieExpiryFromSetCookie(&http.Cookie{Name: "b"}, now)
+	if !session.Session || session.ExpiresAt != nil {
+		t.Fatalf("expected session cookie: %#v", session)
+	}
+}
@@ -0,0 +1,86 @@
+package themis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrNotAuthenticated marks failures caused by a missing or expired login, as
+// opposed to network or server errors.
+var ErrNotAuthenticated = errors.New("not authenticated")
+
+// SessionProvider hands out one shared session to concurrent callers. The
+// session is opened and validated against /user on first use only; it is
+// re-opened (re-reading cookies) and re-validated after a call reports
+// ErrNotAuthenticated.
+type SessionProvider struct {
+	open func() (*Session, error)
+
+	mu      sync.Mutex
+	session *Session
+}
+
+// NewSessionProvider returns a provider that creates sessions with open.
+func NewSessionProvider(open func() (*Session, error)) *SessionProvider {
+	return &SessionProvider{open: open}
+}
+
+// Session returns the shared session, opening and validating it if needed.
+// Concurrent callers wait for a single validation.
+func (p *SessionProvider) Session(ctx context.Context) (*Session, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.session != nil {
+		return p.session, nil
+	}
+	session, err := p.open()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := session.ValidateAuthenticationContext(ctx); err != nil {
+		return nil, err
+	}
+	p.session = session
+	return session, nil
+}
+
+// invalidate drops stale unless another caller already replaced it.
+func (p *SessionProvider) invalidate(stale *Session) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.session == stale {
+		_ = stale.PersistCookies()
+		p.session = nil
+	}
+}
+
+// Do runs fn with the shared session. If fn fails with ErrNotAuthenticated the
+// session is re-opened and re-validated and fn is retried once.
+func (p *SessionProvider) Do(ctx context.Context, fn func(*Session) error) error {
+	session, err := p.Session(ctx)
+	if err != nil {
+		return err
+	}
+	err = fn(session)
+	if err == nil || !errors.Is(err, ErrNotAuthenticated) {
+		return err
+	}
+	p.invalidate(session)
+	session, verr := p.Session(ctx)
+	if verr != nil {
+		return fmt.Errorf("re-authenticate after %v: %w", err, verr)
+	}
+	return fn(session)
+}
+
+// PersistCookies writes back cookies of the current session, if one is open.
+func (p *SessionProvider) PersistCookies() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.session == nil {
+		return nil
+	}
+	return p.session.PersistCookies()
+}
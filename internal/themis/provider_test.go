@@ -0,0 +1,99 @@
+package themis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+const testUserPage = `<html><body><section class="border accent"><div class="cfg-container">
+<div class="cfg-line"><span class="cfg-key">Full name:</span><span class="cfg-val">Test User</span></div>
+</div></section></body></html>`
+
+func newProviderTestServer(t *testing.T, userHits *int64) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == userDataRoute {
+			atomic.AddInt64(userHits, 1)
+			_, _ = w.Write([]byte(testUserPage))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSessionProvider_ValidatesOnceAcrossConcurrentCalls(t *testing.T) {
+	var userHits, calls int64
+	server := newProviderTestServer(t, &userHits)
+	t.Setenv("THEMIS_PROVIDER_TEST_COOKIE", "session=abc")
+
+	var opened int64
+	provider := NewSessionProvider(func() (*Session, error) {
+		atomic.AddInt64(&opened, 1)
+		return NewSessionWithAuthConfig(server.URL, AuthConfig{CookieEnv: "THEMIS_PROVIDER_TEST_COOKIE"})
+	})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- provider.Do(context.Background(), func(s *Session) error {
+				atomic.AddInt64(&calls, 1)
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("call failed: %v", err)
+		}
+	}
+	if opened != 1 || userHits != 1 || calls != 40 {
+		t.Fatalf("expected 1 session, 1 validation and 40 calls, got %d/%d/%d", opened, userHits, calls)
+	}
+}
+
+func TestSessionProvider_RevalidatesAfterAuthFailure(t *testing.T) {
+	var userHits, calls int64
+	server := newProviderTestServer(t, &userHits)
+	t.Setenv("THEMIS_PROVIDER_TEST_COOKIE", "session=abc")
+
+	var opened int64
+	provider := NewSessionProvider(func() (*Session, error) {
+		atomic.AddInt64(&opened, 1)
+		return NewSessionWithAuthConfig(server.URL, AuthConfig{CookieEnv: "THEMIS_PROVIDER_TEST_COOKIE"})
+	})
+
+	err := provider.Do(context.Background(), func(s *Session) error {
+		if atomic.AddInt64(&calls, 1) == 1 {
+			return fmt.Errorf("status 403: %w", ErrNotAuthenticated)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected retry to succeed, got %v", err)
+	}
+	if opened != 2 || userHits != 2 || calls != 2 {
+		t.Fatalf("expected one re-open and re-validation, got opened=%d user=%d calls=%d", opened, userHits, calls)
+	}
+
+	// Other errors are returned without re-validating.
+	boom := errors.New("boom")
+	if err := provider.Do(context.Background(), func(*Session) error { return boom }); !errors.Is(err, boom) {
+		t.Fatalf("expected boom, got %v", err)
+	}
+	if userHits != 2 {
+		t.Fatalf("unexpected re-validation for non-auth error")
+	}
+}
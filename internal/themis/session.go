@@ -1,10 +1,10 @@
 package themis
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
-	"net/http/cookiejar"
 	"net/url"
 	"os"
 	"strings"
@@ -17,12 +17,18 @@ const userDataRoute = "/user"
 type Session struct {
 	BaseURL string
 	Client  *http.Client
+
+	cookieOrigin cookieOrigin
+	persistJar   bool
 }
 
 type AuthConfig struct {
 	CookieFile        string
 	CookieEnv         string
 	DefaultCookiePath string
+	Encryption        CookieEncryption
+	// PersistCookies writes cookies rotated by Themis back to the file they were loaded from.
+	PersistCookies bool
 }
 
 type UserData struct {
@@ -37,12 +43,17 @@ func NewSession(baseURL string, cookiePath string) (*Session, error) {
 }
 
 func NewSessionWithAuthConfig(baseURL string, authConfig AuthConfig) (*Session, error) {
+	return NewSessionWithConfig(baseURL, authConfig, DefaultClientConfig())
+}
+
+// NewSessionWithConfig is NewSessionWithAuthConfig with explicit HTTP client settings.
+func NewSessionWithConfig(baseURL string, authConfig AuthConfig, clientConfig ClientConfig) (*Session, error) {
 	normalizedBaseURL, err := NormalizeBaseURL(baseURL)
 	if err != nil {
 		return nil, err
 	}
 
-	client, err := initializeHTTPClient()
+	client, err := initializeHTTPClient(clientConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -52,7 +63,7 @@ func NewSessionWithAuthConfig(baseURL string, authConfig AuthConfig) (*Session,
 		return nil, err
 	}
 
-	cookies, _, err := resolveCookies(authConfig)
+	cookies, origin, err := resolveCookieOrigin(authConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -60,16 +71,25 @@ func NewSessionWithAuthConfig(baseURL string, authConfig AuthConfig) (*Session,
 	client.Jar.SetCookies(parsedBaseURL, cookies)
 
 	return &Session{
-		BaseURL: normalizedBaseURL,
-		Client:  client,
+		BaseURL:      normalizedBaseURL,
+		Client:       client,
+		cookieOrigin: origin,
+		persistJar:   authConfig.PersistCookies,
 	}, nil
 }
 
 func (s *Session) GetUserData() (UserData, error) {
-	doc, statusCode, err := s.getDataFromUserPage()
+	return s.GetUserDataContext(context.Background())
+}
+
+func (s *Session) GetUserDataContext(ctx context.Context) (UserData, error) {
+	doc, statusCode, err := s.getDataFromUserPage(ctx)
 	if err != nil {
 		return UserData{}, err
 	}
+	if statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden {
+		return UserData{}, fmt.Errorf("user endpoint returned status %d: %w", statusCode, ErrNotAuthenticated)
+	}
 	if statusCode != http.StatusOK {
 		return UserData{}, fmt.Errorf("user endpoint returned status %d", statusCode)
 	}
@@ -90,7 +110,11 @@ func (s *Session) GetUserData() (UserData, error) {
 }
 
 func (s *Session) CheckBaseURLAccess() error {
-	resp, err := s.Client.Get(s.BaseURL)
+	return s.CheckBaseURLAccessContext(context.Background())
+}
+
+func (s *Session) CheckBaseURLAccessContext(ctx context.Context) error {
+	resp, err := s.get(ctx, s.BaseURL)
 	if err != nil {
 		return fmt.Errorf("error accessing base URL: %w", err)
 	}
@@ -104,18 +128,22 @@ func (s *Session) CheckBaseURLAccess() error {
 }
 
 func (s *Session) ValidateAuthentication() (UserData, error) {
-	userData, err := s.GetUserData()
+	return s.ValidateAuthenticationContext(context.Background())
+}
+
+func (s *Session) ValidateAuthenticationContext(ctx context.Context) (UserData, error) {
+	userData, err := s.GetUserDataContext(ctx)
 	if err != nil {
 		return UserData{}, err
 	}
 	if userData.FullName == "" {
-		return UserData{}, fmt.Errorf("authentication check failed: no user profile data found")
+		return UserData{}, fmt.Errorf("authentication check failed: no user profile data found: %w", ErrNotAuthenticated)
 	}
 	return userData, nil
 }
 
-func (s *Session) getDataFromUserPage() (*goquery.Document, int, error) {
-	resp, err := s.Client.Get(s.BaseURL + userDataRoute)
+func (s *Session) getDataFromUserPage(ctx context.Context) (*goquery.Document, int, error) {
+	resp, err := s.get(ctx, s.BaseURL+userDataRoute)
 	if err != nil {
 		return nil, 0, fmt.Errorf("error fetching user data page: %w", err)
 	}
@@ -128,21 +156,40 @@ func (s *Session) getDataFromUserPage() (*goquery.Document, int, error) {
 	return doc, resp.StatusCode, nil
 }
 
-func initializeHTTPClient() (*http.Client, error) {
-	jar, err := cookiejar.New(nil)
+func (s *Session) get(ctx context.Context, rawURL string) (*http.Response, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
 	if err != nil {
 		return nil, err
 	}
-
-	return &http.Client{Jar: jar}, nil
+	return s.Client.Do(req)
 }
 
-func loadCookiesFromFile(path string) (string, error) {
+func loadCookiesFromFile(path string, enc CookieEncryption) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if cached, ok := cachedCookieFileValue(path, info); ok {
+		return cached, nil
+	}
+
 	rawCookie, err := os.ReadFile(path)
 	if err != nil {
 		return "", err
 	}
 
+	if IsEncryptedCookieData(rawCookie) {
+		cookieString, err := openCookieEnvelope(rawCookie, path, enc)
+		if err != nil {
+			return "", err
+		}
+		storeCachedCookieFile(path, info, cookieString)
+		return cookieString, nil
+	}
+
 	cookieString := strings.TrimSpace(string(rawCookie))
 	if cookieString == "" {
 		return "", fmt.Errorf("cookie file is empty: %s", path)
@@ -179,11 +226,19 @@ func parseCookieString(cookieString string, source string) ([]*http.Cookie, erro
 }
 
 func resolveCookies(authConfig AuthConfig) ([]*http.Cookie, string, error) {
+	cookies, origin, err := resolveCookieOrigin(authConfig)
+	if err != nil {
+		return nil, "", err
+	}
+	return cookies, origin.Source, nil
+}
+
+func resolveCookieOrigin(authConfig AuthConfig) ([]*http.Cookie, cookieOrigin, error) {
 	attemptErrors := make([]string, 0, 3)
 
 	cookieFile := strings.TrimSpace(authConfig.CookieFile)
 	if cookieFile != "" {
-		cookieString, err := loadCookiesFromFile(cookieFile)
+		cookieString, err := loadCookiesFromFile(cookieFile, authConfig.Encryption)
 		if err != nil {
 			attemptErrors = append(attemptErrors, fmt.Sprintf("--cookie-file %q: %v", cookieFile, err))
 		} else {
@@ -191,7 +246,7 @@ func resolveCookies(authConfig AuthConfig) ([]*http.Cookie, string, error) {
 			if parseErr != nil {
 				attemptErrors = append(attemptErrors, fmt.Sprintf("--cookie-file %q: %v", cookieFile, parseErr))
 			} else {
-				return cookies, "cookie-file", nil
+				return cookies, fileCookieOrigin("cookie-file", cookieFile, cookieString, authConfig.Encryption), nil
 			}
 		}
 	}
@@ -206,14 +261,14 @@ func resolveCookies(authConfig AuthConfig) ([]*http.Cookie, string, error) {
 			if err != nil {
 				attemptErrors = append(attemptErrors, fmt.Sprintf("--cookie-env %q: %v", cookieEnv, err))
 			} else {
-				return cookies, "cookie-env", nil
+				return cookies, cookieOrigin{Source: "cookie-env", CookieString: cookieString}, nil
 			}
 		}
 	}
 
 	defaultCookiePath := strings.TrimSpace(authConfig.DefaultCookiePath)
 	if defaultCookiePath != "" {
-		cookieString, err := loadCookiesFromFile(defaultCookiePath)
+		cookieString, err := loadCookiesFromFile(defaultCookiePath, authConfig.Encryption)
 		if err != nil {
 			attemptErrors = append(attemptErrors, fmt.Sprintf("default path %q: %v", defaultCookiePath, err))
 		} else {
@@ -221,16 +276,16 @@ func resolveCookies(authConfig AuthConfig) ([]*http.Cookie, string, error) {
 			if parseErr != nil {
 				attemptErrors = append(attemptErrors, fmt.Sprintf("default path %q: %v", defaultCookiePath, parseErr))
 			} else {
-				return cookies, "default-path", nil
+				return cookies, fileCookieOrigin("default-path", defaultCookiePath, cookieString, authConfig.Encryption), nil
 			}
 		}
 	}
 
 	if len(attemptErrors) == 0 {
-		return nil, "", fmt.Errorf("no valid cookie source configured; provide --cookie-file, --cookie-env, or a default cookie path")
+		return nil, cookieOrigin{}, fmt.Errorf("no valid cookie source configured; provide --cookie-file, --cookie-env, or a default cookie path")
 	}
 
-	return nil, "", fmt.Errorf("no valid cookie source available: %s", strings.Join(attemptErrors, "; "))
+	return nil, cookieOrigin{}, fmt.Errorf("no valid cookie source available: %s", strings.Join(attemptErrors, "; "))
 }
 
 func trimDate(value string) string {
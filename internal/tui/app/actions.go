@@ -0,0 +1,159 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/atotto/clipboard"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/muesli/termenv"
+
+	"themis-cli/internal/state"
+)
+
+// ClipboardFunc copies text to the user's clipboard.
+type ClipboardFunc func(text string) error
+
+// OpenFunc opens a URL or local path with the system.
+type OpenFunc func(target string) error
+
+// SystemClipboard copies through the terminal (OSC 52) in SSH sessions, where
+// the local clipboard is on the other side. Elsewhere it uses the system
+// clipboard and falls back to OSC 52 when none is available.
+func SystemClipboard(text string) error {
+	if os.Getenv("SSH_TTY") == "" && os.Getenv("SSH_CONNECTION") == "" {
+		if err := clipboard.WriteAll(text); err == nil {
+			return nil
+		}
+	}
+	termenv.NewOutput(os.Stdout).Copy(text)
+	return nil
+}
+
+// DefaultOpenerCommand is the platform's command for opening URLs.
+func DefaultOpenerCommand() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "open"
+	case "windows":
+		return "rundll32 url.dll,FileProtocolHandler"
+	default:
+		return "xdg-open"
+	}
+}
+
+// CommandOpener returns an OpenFunc that runs command, split on spaces, with
+// the target appended. It does not wait for the command to exit.
+func CommandOpener(command string) OpenFunc {
+	return func(target string) error {
+		args := strings.Fields(command)
+		if len(args) == 0 {
+			return fmt.Errorf("no opener command configured")
+		}
+		cmd := exec.Command(args[0], append(args[1:], target)...)
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("run %s: %w", args[0], err)
+		}
+		go func() { _ = cmd.Wait() }()
+		return nil
+	}
+}
+
+type clipboardCopiedMsg struct {
+	What string
+	Err  error
+}
+
+type openedMsg struct {
+	What string
+	Err  error
+}
+
+func copyCmd(clipboard ClipboardFunc, what string, text string) tea.Cmd {
+	return func() tea.Msg {
+		return clipboardCopiedMsg{What: what, Err: clipboard(text)}
+	}
+}
+
+func openCmd(open OpenFunc, what string, target string) tea.Cmd {
+	return func() tea.Msg {
+		return openedMsg{What: what, Err: open(target)}
+	}
+}
+
+// highlightedAsset is the asset under the download mode cursor.
+func (m Model) highlightedAsset() (state.AssetRef, bool) {
+	assets := m.selectedNodeAssets()
+	if m.downloadCursor < 0 || m.downloadCursor >= len(assets) {
+		return state.AssetRef{}, false
+	}
+	return assets[m.downloadCursor], true
+}
+
+// keyAction names the open/copy action msg triggers, or "" for other keys.
+func (m Model) keyAction(msg tea.KeyMsg) string {
+	switch {
+	case key.Matches(msg, m.keys.OpenPage):
+		return "open_page"
+	case key.Matches(msg, m.keys.OpenStats):
+		return "open_stats"
+	case key.Matches(msg, m.keys.CopyPage):
+		return "copy_page"
+	case key.Matches(msg, m.keys.CopyStats):
+		return "copy_stats"
+	}
+	return ""
+}
+
+// actionTarget resolves what the open/copy actions act on: in download mode
+// the highlighted asset, otherwise the selected node. action is open_page,
+// open_stats, copy_page or copy_stats.
+func (m Model) actionTarget(action string) (what string, target string, err error) {
+	if m.mode == "download" {
+		asset, ok := m.highlightedAsset()
+		if !ok {
+			return "", "", fmt.Errorf("no asset highlighted")
+		}
+		if action == "copy_stats" {
+			path, ok := m.downloadedPaths[asset.URL]
+			if !ok {
+				return "", "", fmt.Errorf("%s was not downloaded in this session", asset.Name)
+			}
+			return "download path", path, nil
+		}
+		return "asset URL", asset.URL, nil
+	}
+
+	node := m.selectedNode()
+	if node == nil {
+		return "", "", fmt.Errorf("no selected node")
+	}
+	if action == "open_stats" || action == "copy_stats" {
+		page := statusPageURL(node.Details)
+		if page == "" {
+			return "", "", fmt.Errorf("selected node has no stats page")
+		}
+		return "stats page", page, nil
+	}
+	if node.CanonicalURL == "" {
+		return "", "", fmt.Errorf("selected node has no URL")
+	}
+	return "page URL", node.CanonicalURL, nil
+}
+
+func (m Model) openOrCopy(action string) (tea.Model, tea.Cmd) {
+	what, target, err := m.actionTarget(action)
+	if err != nil {
+		m.statusText = err.Error()
+		return m, nil
+	}
+	if action == "open_page" || action == "open_stats" {
+		m.statusText = "opening " + what
+		return m, openCmd(m.opener, what, target)
+	}
+	return m, copyCmd(m.clipboard, what, target)
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"themis-cli/internal/state"
+)
+
+func TestOpenAndCopyActions(t *testing.T) {
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+	st := baseStateForTUI(now)
+	root := st.Nodes["url:root"]
+	root.Details = map[string]any{"links": map[string]any{"status_page": "https://themis.housing.rug.nl/stats/2025-2026/os"}}
+	st.Nodes["url:root"] = root
+
+	opened := []string{}
+	copied := []string{}
+	exec := func(_ context.Context, st state.State, req DownloadRequest) DownloadOutcome {
+		return DownloadOutcome{NodeID: req.NodeID, Downloaded: 1, Files: []DownloadedFile{{URL: req.Assets[0].URL, Path: "/tmp/tests/" + req.Assets[0].Name}}}
+	}
+	m, err := NewModel(Config{
+		State:            st,
+		DownloadExecutor: exec,
+		Opener: func(target string) error {
+			opened = append(opened, target)
+			return nil
+		},
+		Clipboard: func(text string) error {
+			copied = append(copied, text)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("new model failed: %v", err)
+	}
+	press := func(key string) {
+		t.Helper()
+		msg := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)}
+		if key == "enter" {
+			msg = tea.KeyMsg{Type: tea.KeyEnter}
+		}
+		updated, cmd := m.Update(msg)
+		m = runCmds(updated.(Model), cmd)
+	}
+
+	press("o")
+	press("O")
+	press("y")
+	press("Y")
+	if strings.Join(opened, " ") != "https://themis.housing.rug.nl/course/2025-2026/os https://themis.housing.rug.nl/stats/2025-2026/os" {
+		t.Fatalf("unexpected opened: %v", opened)
+	}
+	if strings.Join(copied, " ") != "https://themis.housing.rug.nl/course/2025-2026/os https://themis.housing.rug.nl/stats/2025-2026/os" {
+		t.Fatalf("unexpected copied: %v", copied)
+	}
+	if m.statusText != "copied stats page to clipboard" {
+		t.Fatalf("unexpected status: %q", m.statusText)
+	}
+
+	press("d")
+	press("j")
+	press("o")
+	press("Y")
+	if m.statusText != "1.out was not downloaded in this session" {
+		t.Fatalf("expected missing path status, got %q", m.statusText)
+	}
+	press("enter")
+	press("Y")
+	asset := "https://themis.housing.rug.nl/file/course/%40tests/1.out"
+	if opened[len(opened)-1] != asset || copied[len(copied)-1] != "/tmp/tests/1.out" {
+		t.Fatalf("unexpected asset actions: opened=%v copied=%v", opened, copied)
+	}
+}
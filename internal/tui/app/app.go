@@ -18,8 +18,34 @@ type Config struct {
 	DefaultDownloadDir  string
 	RecentAssetChoices  map[string][]string
 	PersistChoices      PersistChoicesFunc
+	// StalePolicy decides when cached nodes show as stale; the zero value
+	// uses state.DefaultStalePolicy.
+	StalePolicy state.StalePolicy
+	// AutoRefreshOnOpen revalidates stale nodes under LinkedRootNodeID (up to
+	// SubtreeRefreshDepth) in the background while the cached view is shown.
+	AutoRefreshOnOpen bool
+	// DownloadConcurrency bounds how many files download at once; values
+	// below 1 use DefaultDownloadConcurrency.
+	DownloadConcurrency int
+	// Clipboard receives text copied from the TUI; nil uses SystemClipboard.
+	Clipboard ClipboardFunc
+	// Opener opens URLs and paths; nil runs DefaultOpenerCommand.
+	Opener OpenFunc
+	// Session restores a previous view; nodes missing from State are skipped.
+	Session *Session
+	// SaveRevalidated, when set, receives the nodes background revalidation
+	// refreshed, in one call once the queue drains or the TUI exits.
+	SaveRevalidated SaveRevalidatedFunc
+	// SaveSession, when set, receives the view state on exit.
+	SaveSession SaveSessionFunc
+	// KeyMap overrides DefaultKeyMap. Conflicting bindings are reported in
+	// the log pane on startup.
+	KeyMap *KeyMap
 }
 
+// DefaultDownloadConcurrency is the download pool size when none is configured.
+const DefaultDownloadConcurrency = 4
+
 func Run(cfg Config) error {
 	model, err := NewModel(cfg)
 	if err != nil {
@@ -27,8 +53,21 @@ func Run(cfg Config) error {
 	}
 
 	program := tea.NewProgram(model, tea.WithAltScreen())
-	if _, err := program.Run(); err != nil {
+	final, err := program.Run()
+	if err != nil {
 		return fmt.Errorf("run tui: %w", err)
 	}
+	m, ok := final.(Model)
+	if !ok {
+		return nil
+	}
+	if err := m.saveRevalidatedNodes(); err != nil {
+		return fmt.Errorf("save revalidated nodes: %w", err)
+	}
+	if cfg.SaveSession != nil {
+		if err := cfg.SaveSession(m.Session()); err != nil {
+			return fmt.Errorf("save tui session: %w", err)
+		}
+	}
 	return nil
 }
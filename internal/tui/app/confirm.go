@@ -0,0 +1,111 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"themis-cli/internal/state"
+)
+
+// deepRefreshDepth is the subtree depth from which a subtree refresh asks for
+// confirmation; full refreshes always do.
+const deepRefreshDepth = 2
+
+// maxConfirmDepth caps the depth that can be dialled in the confirmation.
+const maxConfirmDepth = 20
+
+// requestRefresh starts cheap refreshes right away and opens the
+// confirmation for full and deep subtree refreshes.
+func (m Model) requestRefresh(scope RefreshScope, depth int) (tea.Model, tea.Cmd) {
+	if scope != RefreshScopeFull && depth < deepRefreshDepth {
+		return m.startRefresh(scope, depth)
+	}
+	if reason := m.refreshUnavailable(); reason != "" {
+		m.statusText = reason
+		return m, nil
+	}
+	m.confirmReturnMode = m.mode
+	m.mode = "confirm"
+	m.confirmScope = scope
+	m.confirmDepth = depth
+	m.statusText = fmt.Sprintf("confirm %s refresh", scope)
+	return m, nil
+}
+
+func (m Model) updateConfirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, m.keys.Quit):
+		return m, tea.Quit
+	case key.Matches(msg, m.keys.Help):
+		return m.openHelp()
+	case key.Matches(msg, m.keys.Cancel):
+		m.mode = m.confirmReturnMode
+		m.statusText = fmt.Sprintf("%s refresh not started", m.confirmScope)
+	case key.Matches(msg, m.keys.Enter):
+		m.mode = m.confirmReturnMode
+		return m.startRefresh(m.confirmScope, m.confirmDepth)
+	case key.Matches(msg, m.keys.Deeper):
+		m.confirmDepth = minInt(maxConfirmDepth, m.confirmDepth+1)
+	case key.Matches(msg, m.keys.Shallower):
+		m.confirmDepth = maxInt(0, m.confirmDepth-1)
+	}
+	return m, nil
+}
+
+// refreshUnavailable explains why no refresh can start, or returns "".
+func (m Model) refreshUnavailable() string {
+	switch {
+	case m.refreshInFlight:
+		return "refresh already in progress"
+	case m.refreshExecutor == nil:
+		return "refresh unavailable (read-only mode)"
+	case m.selectedNode() == nil:
+		return "no selected node"
+	}
+	return ""
+}
+
+// refreshEstimateRootID is where a refresh of scope starts. Full refreshes
+// start at the catalog root when it is cached.
+func (m Model) refreshEstimateRootID(scope RefreshScope) string {
+	if scope == RefreshScopeFull {
+		if id, _, err := state.NodeIDFromURL(m.st.CatalogRootURL); err == nil {
+			if _, ok := m.st.Nodes[id]; ok {
+				return id
+			}
+		}
+		return m.rootNodeID
+	}
+	return m.selectedNodeID
+}
+
+func (m Model) renderConfirm() string {
+	rootID := m.refreshEstimateRootID(m.confirmScope)
+	est := state.EstimateRefresh(m.st, rootID, m.confirmDepth)
+	byDepth := make([]string, 0, len(est.ByDepth))
+	for depth, n := range est.ByDepth {
+		byDepth = append(byDepth, strconv.Itoa(depth)+":"+strconv.Itoa(n))
+	}
+	target := rootID
+	if node, ok := m.st.Nodes[rootID]; ok {
+		target = displayTitle(node)
+	}
+	lines := []string{
+		titleStyle.Render(fmt.Sprintf("Confirm %s refresh", m.confirmScope)),
+		fmt.Sprintf("Target: %s", target),
+		fmt.Sprintf("Depth: %d (%s deeper, %s shallower)", m.confirmDepth, m.keys.Deeper.Help().Key, m.keys.Shallower.Help().Key),
+		"",
+		fmt.Sprintf("Estimated requests: %s", staleStyle.Render(strconv.Itoa(est.Requests()))),
+		fmt.Sprintf("  %d page(s) + %d stats page(s)", est.Pages, est.StatsPages),
+		fmt.Sprintf("  pages by depth: %s", strings.Join(byDepth, " ")),
+	}
+	if est.Unexplored > 0 {
+		lines = append(lines, mutedStyle.Render(fmt.Sprintf("  at least: %d node(s) in range were never fetched", est.Unexplored)))
+	}
+	lines = append(lines, "", fmt.Sprintf("%s start · %s cancel", m.keys.Enter.Help().Key, m.keys.Cancel.Help().Key))
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,75 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"themis-cli/internal/state"
+)
+
+func TestExpensiveRefreshesAskForConfirmation(t *testing.T) {
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+	st := baseStateForTUI(now)
+	st.CatalogRootURL = "https://themis.housing.rug.nl/course/2025-2026/os"
+	requests := []RefreshRequest{}
+	m, err := NewModel(Config{
+		State:               st,
+		SubtreeRefreshDepth: 3,
+		RefreshExecutor: func(_ context.Context, st state.State, req RefreshRequest) RefreshOutcome {
+			requests = append(requests, req)
+			return RefreshOutcome{State: st, Scope: req.Scope, TargetNodeID: req.TargetNodeID}
+		},
+	})
+	if err != nil {
+		t.Fatalf("new model failed: %v", err)
+	}
+	press := func(msg tea.KeyMsg) {
+		t.Helper()
+		updated, cmd := m.Update(msg)
+		m = runCmds(updated.(Model), cmd)
+	}
+	runes := func(s string) tea.KeyMsg { return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)} }
+
+	press(runes("f"))
+	if m.mode != "confirm" || len(requests) != 0 {
+		t.Fatalf("expected confirmation before a full refresh, mode=%q requests=%d", m.mode, len(requests))
+	}
+	details := m.renderDetails(80, 20)
+	for _, want := range []string{"Confirm full refresh", "Target: Operating Systems", "Depth: 3", "Estimated requests: 5", "3 page(s) + 2 stats page(s)", "pages by depth: 0:1 1:2"} {
+		if !strings.Contains(details, want) {
+			t.Fatalf("expected %q in confirmation:\n%s", want, details)
+		}
+	}
+
+	press(runes("-"))
+	press(runes("-"))
+	press(runes("-"))
+	press(runes("-"))
+	if m.confirmDepth != 0 || !strings.Contains(m.renderDetails(80, 20), "Estimated requests: 1") {
+		t.Fatalf("expected depth 0 with a single page, got depth %d:\n%s", m.confirmDepth, m.renderDetails(80, 20))
+	}
+	press(runes("+"))
+	press(tea.KeyMsg{Type: tea.KeyEnter})
+	if len(requests) != 1 || requests[0].Scope != RefreshScopeFull || requests[0].Depth != 1 || m.mode != "browse" {
+		t.Fatalf("expected a full refresh at depth 1, got %+v mode=%q", requests, m.mode)
+	}
+
+	press(runes("R"))
+	if m.mode != "confirm" {
+		t.Fatalf("expected confirmation before a depth-3 subtree refresh")
+	}
+	press(tea.KeyMsg{Type: tea.KeyEsc})
+	if m.mode != "browse" || len(requests) != 1 || m.statusText != "subtree refresh not started" {
+		t.Fatalf("expected cancel without refreshing, mode=%q requests=%d status=%q", m.mode, len(requests), m.statusText)
+	}
+
+	m.subtreeRefreshDepth = 1
+	press(runes("R"))
+	if len(requests) != 2 || requests[1].Scope != RefreshScopeSubtree {
+		t.Fatalf("expected a shallow subtree refresh to start right away, got %+v", requests)
+	}
+}
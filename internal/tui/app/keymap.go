@@ -0,0 +1,406 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Key profiles selectable with KeyMapOptions.Profile.
+const (
+	KeyProfileDefault = "default"
+	KeyProfileVim     = "vim"
+	KeyProfileArrows  = "arrows"
+)
+
+// KeyMap holds the TUI's key bindings. Typing a search query is not
+// remappable; every other mode is driven by these bindings.
+type KeyMap struct {
+	Up             key.Binding
+	Down           key.Binding
+	Collapse       key.Binding
+	Expand         key.Binding
+	Top            key.Binding
+	Bottom         key.Binding
+	PageUp         key.Binding
+	PageDown       key.Binding
+	Enter          key.Binding
+	Search         key.Binding
+	NextMatch      key.Binding
+	PrevMatch      key.Binding
+	RefreshNode    key.Binding
+	RefreshSubtree key.Binding
+	RefreshFull    key.Binding
+	Download       key.Binding
+	Reader         key.Binding
+	Log            key.Binding
+	Project        key.Binding
+	OpenPage       key.Binding
+	OpenStats      key.Binding
+	CopyPage       key.Binding
+	CopyStats      key.Binding
+	Deeper         key.Binding
+	Shallower      key.Binding
+	Toggle         key.Binding
+	SelectAll      key.Binding
+	ClearSelection key.Binding
+	Cancel         key.Binding
+	Help           key.Binding
+	Quit           key.Binding
+}
+
+// KeyMapOptions selects a profile and remaps individual actions. Bindings
+// maps action names (see KeyActions) to the keys that trigger them, in
+// bubbletea notation such as "F", "ctrl+r" or "space".
+type KeyMapOptions struct {
+	Profile  string
+	Bindings map[string][]string
+}
+
+func binding(label, desc string, keys ...string) key.Binding {
+	return key.NewBinding(key.WithKeys(keys...), key.WithHelp(label, desc))
+}
+
+// DefaultKeyMap accepts both arrow keys and vim-style letters.
+func DefaultKeyMap() KeyMap {
+	return KeyMap{
+		Up:             binding("↑/k", "up", "up", "k"),
+		Down:           binding("↓/j", "down", "down", "j"),
+		Collapse:       binding("←/h", "fold / parent", "left", "h"),
+		Expand:         binding("→/l", "expand", "right", "l"),
+		Top:            binding("g/home", "top", "g", "home"),
+		Bottom:         binding("G/end", "bottom", "G", "end"),
+		PageUp:         binding("pgup/b", "page up", "pgup", "b"),
+		PageDown:       binding("pgdn/space", "page down", "pgdown", " "),
+		Enter:          binding("enter", "open", "enter"),
+		Search:         binding("/", "search", "/"),
+		NextMatch:      binding("n", "next match", "n"),
+		PrevMatch:      binding("N", "previous match", "N"),
+		RefreshNode:    binding("r", "refresh node", "r"),
+		RefreshSubtree: binding("R", "refresh subtree", "R"),
+		RefreshFull:    binding("f", "full refresh", "f"),
+		Download:       binding("d", "download", "d"),
+		Reader:         binding("v", "read page", "v"),
+		Log:            binding("L", "log", "L"),
+		Project:        binding("p", "project root", "p"),
+		OpenPage:       binding("o", "open page", "o"),
+		OpenStats:      binding("O", "open stats", "O"),
+		CopyPage:       binding("y", "copy page URL", "y"),
+		CopyStats:      binding("Y", "copy stats URL", "Y"),
+		Deeper:         binding("+/→", "deeper", "+", "=", "right", "l"),
+		Shallower:      binding("-/←", "shallower", "-", "left", "h"),
+		Toggle:         binding("space", "toggle", " "),
+		SelectAll:      binding("a", "select all", "a"),
+		ClearSelection: binding("c", "clear selection", "c"),
+		Cancel:         binding("esc", "cancel / close", "esc", "ctrl+x"),
+		Help:           binding("?", "help", "?"),
+		Quit:           binding("q", "quit", "q", "ctrl+c"),
+	}
+}
+
+// NewKeyMap builds a key map from a profile and per-action overrides.
+// "vim" drops the arrow keys and "arrows" drops the hjkl letters.
+func NewKeyMap(opts KeyMapOptions) (KeyMap, error) {
+	km := DefaultKeyMap()
+	switch strings.ToLower(strings.TrimSpace(opts.Profile)) {
+	case "", KeyProfileDefault:
+	case KeyProfileVim:
+		km.Up = binding("k", "up", "k")
+		km.Down = binding("j", "down", "j")
+		km.Collapse = binding("h", "fold / parent", "h")
+		km.Expand = binding("l", "expand", "l")
+		km.Top = binding("g", "top", "g")
+		km.Bottom = binding("G", "bottom", "G")
+		km.PageUp = binding("ctrl+b", "page up", "ctrl+b")
+		km.PageDown = binding("ctrl+f", "page down", "ctrl+f")
+	case KeyProfileArrows:
+		km.Up = binding("↑", "up", "up")
+		km.Down = binding("↓", "down", "down")
+		km.Collapse = binding("←", "fold / parent", "left")
+		km.Expand = binding("→", "expand", "right")
+		km.Top = binding("home", "top", "home")
+		km.Bottom = binding("end", "bottom", "end")
+		km.PageUp = binding("pgup", "page up", "pgup")
+		km.PageDown = binding("pgdn", "page down", "pgdown")
+	default:
+		return KeyMap{}, fmt.Errorf("unknown key profile %q (want %s, %s or %s)", opts.Profile, KeyProfileDefault, KeyProfileVim, KeyProfileArrows)
+	}
+
+	actions := km.actions()
+	names := make([]string, 0, len(opts.Bindings))
+	for name := range opts.Bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b, ok := actions[name]
+		if !ok {
+			return KeyMap{}, fmt.Errorf("unknown key action %q (want one of %s)", name, strings.Join(KeyActions(), ", "))
+		}
+		keys := make([]string, 0, len(opts.Bindings[name]))
+		labels := make([]string, 0, len(opts.Bindings[name]))
+		for _, k := range opts.Bindings[name] {
+			k = strings.TrimSpace(k)
+			if k == "" {
+				continue
+			}
+			label := k
+			if k == "space" {
+				k = " "
+			}
+			keys = append(keys, k)
+			labels = append(labels, label)
+		}
+		if len(keys) == 0 {
+			b.SetEnabled(false)
+			continue
+		}
+		b.SetKeys(keys...)
+		b.SetHelp(strings.Join(labels, "/"), b.Help().Desc)
+	}
+	return km, nil
+}
+
+// actions names every binding for overrides and conflict reports.
+func (km *KeyMap) actions() map[string]*key.Binding {
+	return map[string]*key.Binding{
+		"up":              &km.Up,
+		"down":            &km.Down,
+		"collapse":        &km.Collapse,
+		"expand":          &km.Expand,
+		"top":             &km.Top,
+		"bottom":          &km.Bottom,
+		"page_up":         &km.PageUp,
+		"page_down":       &km.PageDown,
+		"enter":           &km.Enter,
+		"search":          &km.Search,
+		"next_match":      &km.NextMatch,
+		"prev_match":      &km.PrevMatch,
+		"refresh_node":    &km.RefreshNode,
+		"refresh_subtree": &km.RefreshSubtree,
+		"refresh_full":    &km.RefreshFull,
+		"download":        &km.Download,
+		"reader":          &km.Reader,
+		"log":             &km.Log,
+		"project":         &km.Project,
+		"open_page":       &km.OpenPage,
+		"open_stats":      &km.OpenStats,
+		"copy_page":       &km.CopyPage,
+		"copy_stats":      &km.CopyStats,
+		"deeper":          &km.Deeper,
+		"shallower":       &km.Shallower,
+		"toggle":          &km.Toggle,
+		"select_all":      &km.SelectAll,
+		"clear_selection": &km.ClearSelection,
+		"cancel":          &km.Cancel,
+		"help":            &km.Help,
+		"quit":            &km.Quit,
+	}
+}
+
+// KeyActions lists the action names accepted in KeyMapOptions.Bindings.
+func KeyActions() []string {
+	km := DefaultKeyMap()
+	names := make([]string, 0)
+	for name := range km.actions() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// keyHelp describes what an action does in one mode.
+type keyHelp struct {
+	Action string
+	Desc   string
+}
+
+// modeKeys lists the actions each mode responds to, in help order. Download
+// mode also handles the browse keys it does not list.
+var modeKeys = map[string][]keyHelp{
+	"browse": {
+		{"up", "up"}, {"down", "down"}, {"collapse", "fold / parent"}, {"expand", "expand"},
+		{"top", "top"}, {"bottom", "bottom"}, {"enter", "expand"}, {"project", "jump to project root"},
+		{"search", "search"}, {"next_match", "next match"}, {"prev_match", "previous match"},
+		{"refresh_node", "refresh node"}, {"refresh_subtree", "refresh subtree"}, {"refresh_full", "full refresh"},
+		{"download", "download mode"}, {"reader", "read page"}, {"log", "log"},
+		{"open_page", "open page"}, {"open_stats", "open stats page"}, {"copy_page", "copy page URL"}, {"copy_stats", "copy stats URL"},
+		{"cancel", "cancel refresh"}, {"help", "help"}, {"quit", "quit"},
+	},
+	"download": {
+		{"up", "up"}, {"down", "down"}, {"toggle", "toggle file"}, {"select_all", "select all"},
+		{"clear_selection", "clear selection"}, {"enter", "download selected"},
+		{"open_page", "open asset"}, {"copy_page", "copy asset URL"}, {"copy_stats", "copy local path"},
+		{"collapse", "close"}, {"download", "close"}, {"cancel", "cancel download / close"},
+		{"help", "help"}, {"quit", "quit"},
+	},
+	"log": {
+		{"up", "up"}, {"down", "down"}, {"top", "first"}, {"bottom", "last"},
+		{"enter", "jump to node"}, {"copy_page", "copy message"}, {"log", "close"}, {"cancel", "close"},
+		{"help", "help"}, {"quit", "quit"},
+	},
+	"confirm": {
+		{"enter", "start refresh"}, {"deeper", "increase depth"}, {"shallower", "decrease depth"},
+		{"cancel", "cancel"}, {"help", "help"}, {"quit", "quit"},
+	},
+	"reader": {
+		{"up", "scroll up"}, {"down", "scroll down"}, {"page_up", "page up"}, {"page_down", "page down"},
+		{"top", "top"}, {"bottom", "bottom"}, {"refresh_node", "refresh page"},
+		{"open_page", "open page"}, {"open_stats", "open stats page"}, {"copy_page", "copy page URL"}, {"copy_stats", "copy stats URL"},
+		{"reader", "close"}, {"cancel", "close"}, {"help", "help"}, {"quit", "quit"},
+	},
+}
+
+// statusKeys are the few actions shown on the status line per mode; the
+// help overlay lists the rest.
+var statusKeys = map[string][]string{
+	"browse":   {"help", "enter", "search", "refresh_node", "download", "reader", "log", "quit"},
+	"download": {"help", "toggle", "enter", "download", "cancel", "quit"},
+	"log":      {"help", "enter", "copy_page", "log", "quit"},
+	"reader":   {"help", "down", "page_down", "reader", "quit"},
+	"confirm":  {"help", "enter", "deeper", "shallower", "cancel"},
+}
+
+// modeBindings returns the bindings of mode with their mode-specific help.
+func (km KeyMap) modeBindings(mode string) []key.Binding {
+	actions := km.actions()
+	out := make([]key.Binding, 0, len(modeKeys[mode]))
+	for _, h := range modeKeys[mode] {
+		b := *actions[h.Action]
+		if !b.Enabled() {
+			continue
+		}
+		b.SetHelp(b.Help().Key, h.Desc)
+		out = append(out, b)
+	}
+	return out
+}
+
+// statusHelp is the short key hint for the status line.
+func (km KeyMap) statusHelp(mode string) string {
+	return km.keyHints(mode, statusKeys[mode], " ")
+}
+
+// keyHints renders the bound keys of the named actions with their help in
+// mode, joined by sep.
+func (km KeyMap) keyHints(mode string, names []string, sep string) string {
+	descs := map[string]string{}
+	for _, h := range modeKeys[mode] {
+		descs[h.Action] = h.Desc
+	}
+	actions := km.actions()
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		b := actions[name]
+		if !b.Enabled() {
+			continue
+		}
+		parts = append(parts, b.Help().Key+" "+descs[name])
+	}
+	return strings.Join(parts, sep)
+}
+
+// Conflicts reports keys bound to more than one action within a mode. The
+// first matching action wins at runtime, so the others are unreachable.
+func (km KeyMap) Conflicts() []string {
+	actions := km.actions()
+	modes := []string{"browse", "download", "log", "reader", "confirm"}
+	seen := map[string]bool{}
+	out := make([]string, 0)
+	for _, mode := range modes {
+		scope := modeKeys[mode]
+		if mode == "download" {
+			scope = append(append([]keyHelp{}, modeKeys["browse"]...), scope...)
+		}
+		byKey := map[string][]string{}
+		for _, h := range scope {
+			b := actions[h.Action]
+			if !b.Enabled() {
+				continue
+			}
+			for _, k := range b.Keys() {
+				if !containsString(byKey[k], h.Action) {
+					byKey[k] = append(byKey[k], h.Action)
+				}
+			}
+		}
+		keys := make([]string, 0, len(byKey))
+		for k := range byKey {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if len(byKey[k]) < 2 {
+				continue
+			}
+			label := k
+			if k == " " {
+				label = "space"
+			}
+			msg := fmt.Sprintf("key %q is bound to %s", label, strings.Join(byKey[k], " and "))
+			if !seen[msg] {
+				seen[msg] = true
+				out = append(out, fmt.Sprintf("%s mode: %s", mode, msg))
+			}
+		}
+	}
+	return out
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (m Model) openHelp() (tea.Model, tea.Cmd) {
+	m.showHelp = true
+	return m, nil
+}
+
+// updateHelp closes the overlay on the help or cancel keys and otherwise
+// ignores input.
+func (m Model) updateHelp(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case msg.Type == tea.KeyCtrlC:
+		return m, tea.Quit
+	case key.Matches(msg, m.keys.Help, m.keys.Cancel, m.keys.Quit):
+		m.showHelp = false
+	}
+	return m, nil
+}
+
+// renderHelp is the help overlay for the current mode, in columns that fit
+// width.
+func (m Model) renderHelp(width int, height int) string {
+	mode := m.helpMode()
+	bindings := m.keys.modeBindings(mode)
+	rows := maxInt(1, height-2)
+	columns := make([][]key.Binding, 0)
+	for start := 0; start < len(bindings); start += rows {
+		columns = append(columns, bindings[start:minInt(len(bindings), start+rows)])
+	}
+	h := help.New()
+	h.Width = width
+	h.Styles.FullKey = selectedStyle
+	h.Styles.FullDesc = lipgloss.NewStyle()
+	h.Styles.FullSeparator = mutedStyle
+	title := titleStyle.Render(fmt.Sprintf("Keys: %s mode", mode)) + "  " + mutedStyle.Render(m.keys.Help.Help().Key+"/esc to close")
+	return clipTopLines(title+"\n\n"+h.FullHelpView(columns), height)
+}
+
+// helpMode is the mode the help overlay describes.
+func (m Model) helpMode() string {
+	if _, ok := modeKeys[m.mode]; ok {
+		return m.mode
+	}
+	return "browse"
+}
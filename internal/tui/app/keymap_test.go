@@ -0,0 +1,166 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"themis-cli/internal/state"
+)
+
+func TestKeyMapOverridesRemapFullRefresh(t *testing.T) {
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+	keys, err := NewKeyMap(KeyMapOptions{Profile: "vim", Bindings: map[string][]string{"refresh_full": {"F"}}})
+	if err != nil {
+		t.Fatalf("new key map failed: %v", err)
+	}
+	scopes := []RefreshScope{}
+	m, err := NewModel(Config{
+		State:  baseStateForTUI(now),
+		KeyMap: &keys,
+		RefreshExecutor: func(_ context.Context, st state.State, req RefreshRequest) RefreshOutcome {
+			scopes = append(scopes, req.Scope)
+			return RefreshOutcome{State: st, Scope: req.Scope, TargetNodeID: req.TargetNodeID}
+		},
+	})
+	if err != nil {
+		t.Fatalf("new model failed: %v", err)
+	}
+	if len(m.keys.Conflicts()) != 0 {
+		t.Fatalf("unexpected conflicts: %v", m.keys.Conflicts())
+	}
+
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'f'}})
+	m = runCmds(updated.(Model), cmd)
+	if len(scopes) != 0 {
+		t.Fatalf("f should no longer refresh, got %v", scopes)
+	}
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'F'}})
+	m = updated.(Model)
+	updated, cmd = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = runCmds(updated.(Model), cmd)
+	if len(scopes) != 1 || scopes[0] != RefreshScopeFull {
+		t.Fatalf("expected a full refresh on F, got %v", scopes)
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'j'}})
+	m = updated.(Model)
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	m = updated.(Model)
+	if m.selectedIndex != 1 {
+		t.Fatalf("vim profile should move on j only, got index %d", m.selectedIndex)
+	}
+	if label := m.keys.RefreshFull.Help().Key; label != "F" {
+		t.Fatalf("expected help to show the remapped key, got %q", label)
+	}
+}
+
+func TestKeyMapReportsConflictsAndErrors(t *testing.T) {
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+	keys, err := NewKeyMap(KeyMapOptions{Bindings: map[string][]string{"reader": {"d"}, "toggle": {}}})
+	if err != nil {
+		t.Fatalf("new key map failed: %v", err)
+	}
+	conflicts := keys.Conflicts()
+	if len(conflicts) != 1 || conflicts[0] != `browse mode: key "d" is bound to download and reader` {
+		t.Fatalf("unexpected conflicts: %v", conflicts)
+	}
+	if keys.Toggle.Enabled() {
+		t.Fatalf("expected an empty binding list to disable toggle")
+	}
+
+	m, err := NewModel(Config{State: baseStateForTUI(now), KeyMap: &keys})
+	if err != nil {
+		t.Fatalf("new model failed: %v", err)
+	}
+	if m.statusText != "1 key binding conflict(s) (L to view)" || len(m.logEntries) != 1 || m.logEntries[0].Source != "keys" {
+		t.Fatalf("expected conflict to be reported: status=%q log=%v", m.statusText, m.logEntries)
+	}
+
+	if _, err := NewKeyMap(KeyMapOptions{Profile: "emacs"}); err == nil || !strings.Contains(err.Error(), "emacs") {
+		t.Fatalf("expected unknown profile error, got %v", err)
+	}
+	if _, err := NewKeyMap(KeyMapOptions{Bindings: map[string][]string{"fly": {"x"}}}); err == nil || !strings.Contains(err.Error(), "fly") {
+		t.Fatalf("expected unknown action error, got %v", err)
+	}
+}
+
+func TestHelpOverlayListsModeKeys(t *testing.T) {
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+	m, err := NewModel(Config{State: baseStateForTUI(now)})
+	if err != nil {
+		t.Fatalf("new model failed: %v", err)
+	}
+	press := func(msg tea.KeyMsg) {
+		t.Helper()
+		updated, _ := m.Update(msg)
+		m = updated.(Model)
+	}
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'?'}})
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+	m = updated.(Model)
+	if !m.showHelp {
+		t.Fatalf("expected help overlay")
+	}
+	view := m.View()
+	for _, want := range []string{"Keys: browse mode", "full refresh", "read page"} {
+		if !strings.Contains(view, want) {
+			t.Fatalf("expected %q in help:\n%s", want, view)
+		}
+	}
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'j'}})
+	if m.selectedIndex != 0 {
+		t.Fatalf("help overlay should swallow keys, got index %d", m.selectedIndex)
+	}
+	press(tea.KeyMsg{Type: tea.KeyEsc})
+	if m.showHelp {
+		t.Fatalf("expected esc to close help")
+	}
+
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'d'}})
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'?'}})
+	if view := m.View(); !strings.Contains(view, "Keys: download mode") || !strings.Contains(view, "toggle file") {
+		t.Fatalf("expected download help:\n%s", view)
+	}
+}
+
+func TestKeyHintsFollowKeyMap(t *testing.T) {
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+	keys, err := NewKeyMap(KeyMapOptions{Bindings: map[string][]string{"toggle": {"t"}, "search": {"s"}, "cancel": {"ctrl+g"}}})
+	if err != nil {
+		t.Fatalf("new key map failed: %v", err)
+	}
+	m, err := NewModel(Config{State: baseStateForTUI(now), KeyMap: &keys})
+	if err != nil {
+		t.Fatalf("new model failed: %v", err)
+	}
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 160, Height: 30})
+	m = updated.(Model)
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'n'}})
+	m = updated.(Model)
+	if m.statusText != "no active search (press s to search)" {
+		t.Fatalf("unexpected status: %q", m.statusText)
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'d'}})
+	m = updated.(Model)
+	if view := m.View(); !strings.Contains(view, "t toggle file") {
+		t.Fatalf("expected the remapped toggle key in the download panel:\n%s", view)
+	}
+
+	m.mode = "browse"
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'s'}})
+	m = updated.(Model)
+	if status := m.renderStatus(); !strings.Contains(status, "enter jump ctrl+g cancel") {
+		t.Fatalf("expected the search hint to use the key map, got %q", status)
+	}
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyCtrlG})
+	m = updated.(Model)
+	if m.mode != "browse" || m.statusText != "search cancelled" {
+		t.Fatalf("expected the remapped cancel key to close search, got mode=%s status=%q", m.mode, m.statusText)
+	}
+}
@@ -0,0 +1,183 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"themis-cli/internal/state"
+)
+
+// logEntry is one message in the log pane. NodeID is empty when the message
+// does not refer to a node in state.
+type logEntry struct {
+	At     time.Time
+	Level  string
+	Source string
+	NodeID string
+	Text   string
+}
+
+func (m *Model) logf(level, source, nodeID, format string, args ...any) {
+	m.logEntries = append(m.logEntries, logEntry{
+		At:     time.Now(),
+		Level:  level,
+		Source: source,
+		NodeID: nodeID,
+		Text:   fmt.Sprintf(format, args...),
+	})
+}
+
+// logRefreshWarnings records the per-page errors of a refresh. Messages start
+// with the page URL, which links them to its node when it is in state.
+func (m *Model) logRefreshWarnings(warnings []string) {
+	for _, w := range warnings {
+		m.logf("warn", "refresh", m.nodeIDForMessage(w), "%s", w)
+	}
+}
+
+func (m Model) nodeIDForMessage(text string) string {
+	ref, _, _ := strings.Cut(strings.TrimPrefix(text, "[stats] "), ": ")
+	id, _, err := state.NodeIDFromURL(strings.TrimSpace(ref))
+	if err != nil {
+		return ""
+	}
+	if _, ok := m.st.Nodes[id]; !ok {
+		return ""
+	}
+	return id
+}
+
+// logRows is the session history, oldest first, followed by the last error
+// of every node under the root that is in StatusError.
+func (m Model) logRows() []logEntry {
+	rows := append([]logEntry{}, m.logEntries...)
+	nodeErrors := make([]logEntry, 0)
+	for _, c := range searchCandidates(m.st, m.rootNodeID) {
+		node := m.st.Nodes[c.NodeID]
+		if node.Status != state.StatusError {
+			continue
+		}
+		entry := logEntry{Level: "error", Source: "node", NodeID: node.ID, Text: c.Path + ": " + node.LastError}
+		if node.LastFetchedAt != nil {
+			entry.At = *node.LastFetchedAt
+		}
+		nodeErrors = append(nodeErrors, entry)
+	}
+	sort.SliceStable(nodeErrors, func(i, j int) bool { return nodeErrors[i].At.After(nodeErrors[j].At) })
+	return append(rows, nodeErrors...)
+}
+
+func (m Model) openLog() (tea.Model, tea.Cmd) {
+	m.mode = "log"
+	m.logCursor = maxInt(0, len(m.logEntries)-1)
+	if len(m.logRows()) == 0 {
+		m.statusText = "log is empty"
+	} else {
+		m.statusText = fmt.Sprintf("log: %d message(s)", len(m.logRows()))
+	}
+	return m, nil
+}
+
+func (m Model) updateLog(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	rows := m.logRows()
+	switch {
+	case key.Matches(msg, m.keys.Quit):
+		return m, tea.Quit
+	case key.Matches(msg, m.keys.Help):
+		return m.openHelp()
+	case key.Matches(msg, m.keys.Cancel, m.keys.Log):
+		m.mode = "browse"
+		m.statusText = "log closed"
+	case key.Matches(msg, m.keys.Up):
+		if m.logCursor > 0 {
+			m.logCursor--
+		}
+	case key.Matches(msg, m.keys.Down):
+		if m.logCursor < len(rows)-1 {
+			m.logCursor++
+		}
+	case key.Matches(msg, m.keys.Top):
+		m.logCursor = 0
+	case key.Matches(msg, m.keys.Bottom):
+		m.logCursor = maxInt(0, len(rows)-1)
+	case key.Matches(msg, m.keys.Enter):
+		if m.logCursor >= len(rows) {
+			return m, nil
+		}
+		nodeID := rows[m.logCursor].NodeID
+		if nodeID == "" || !m.ensureVisible(nodeID) {
+			m.statusText = "message does not refer to a node in the tree"
+			return m, nil
+		}
+		m.mode = "browse"
+		m.selectedNodeID = nodeID
+		m.syncSelectedIndex()
+		m.statusText = "jumped to " + displayTitle(m.st.Nodes[nodeID])
+	case key.Matches(msg, m.keys.CopyPage):
+		if m.logCursor >= len(rows) {
+			return m, nil
+		}
+		return m, copyCmd(m.clipboard, "message", rows[m.logCursor].Text)
+	}
+	return m, nil
+}
+
+func (m Model) renderLog(maxLines int) string {
+	rows := m.logRows()
+	lines := []string{titleStyle.Render(fmt.Sprintf("Log (%d)", len(rows)))}
+	if len(rows) == 0 {
+		lines = append(lines, mutedStyle.Render("(no warnings or errors this session)"))
+		return strings.Join(lines, "\n")
+	}
+	visible := maxInt(1, maxLines-len(lines))
+	start := 0
+	if m.logCursor >= visible {
+		start = m.logCursor - visible + 1
+	}
+	end := minInt(len(rows), start+visible)
+	for i := start; i < end; i++ {
+		line := formatLogEntry(rows[i])
+		if i == m.logCursor {
+			line = selectedStyle.Render("> ") + line
+		} else {
+			line = "  " + line
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m Model) renderLogDetails() string {
+	rows := m.logRows()
+	if m.logCursor >= len(rows) {
+		return titleStyle.Render("Message") + "\n" + mutedStyle.Render("(none)")
+	}
+	entry := rows[m.logCursor]
+	lines := []string{titleStyle.Render("Message")}
+	if !entry.At.IsZero() {
+		lines = append(lines, fmt.Sprintf("Time: %s", entry.At.Local().Format("2006-01-02 15:04:05")))
+	}
+	lines = append(lines, fmt.Sprintf("Source: %s", entry.Source))
+	if node, ok := m.st.Nodes[entry.NodeID]; ok {
+		lines = append(lines, fmt.Sprintf("Node: %s (%s to jump)", displayTitle(node), m.keys.Enter.Help().Key))
+	}
+	lines = append(lines, "", entry.Text)
+	return strings.Join(lines, "\n")
+}
+
+func formatLogEntry(entry logEntry) string {
+	stamp := "--:--:--"
+	if !entry.At.IsZero() {
+		stamp = entry.At.Local().Format("15:04:05")
+	}
+	level := staleStyle.Render(entry.Level)
+	if entry.Level == "error" {
+		level = errorStyle.Render(entry.Level)
+	}
+	return fmt.Sprintf("%s %s %s %s", mutedStyle.Render(stamp), level, entry.Source, entry.Text)
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"themis-cli/internal/state"
+)
+
+func TestLogPaneCollectsWarningsAndNodeErrors(t *testing.T) {
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+	st := baseStateForTUI(now)
+	labURL := "https://themis.housing.rug.nl/course/2025-2026/os/lab3"
+	labID, _, _ := state.NodeIDFromURL(labURL)
+	st.Nodes[labID] = state.Node{ID: labID, Title: "Lab 3", Kind: "assignment", CanonicalURL: labURL, ParentIDs: []string{"url:root"}, Status: state.StatusOK}
+	root := st.Nodes["url:root"]
+	root.ChildIDs = append(root.ChildIDs, labID)
+	st.Nodes["url:root"] = root
+	lab2 := st.Nodes["url:lab2"]
+	lab2.Status = state.StatusError
+	lab2.LastError = "fetch page status 500"
+	st.Nodes["url:lab2"] = lab2
+
+	exec := func(_ context.Context, st state.State, req RefreshRequest) RefreshOutcome {
+		return RefreshOutcome{State: st, Scope: req.Scope, TargetNodeID: req.TargetNodeID, Warnings: []string{"[stats] " + labURL + ": stats page status 404"}}
+	}
+	copied := ""
+	clipboard := func(text string) error {
+		copied = text
+		return nil
+	}
+	m, err := NewModel(Config{State: st, RefreshExecutor: exec, Clipboard: clipboard})
+	if err != nil {
+		t.Fatalf("new model failed: %v", err)
+	}
+
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'r'}})
+	m = runCmds(updated.(Model), cmd)
+	if !strings.Contains(m.statusText, "warnings=1") {
+		t.Fatalf("expected warning count in status, got %q", m.statusText)
+	}
+	m.handleDownloadFileResult("https://themis.housing.rug.nl/file/1.in", DownloadOutcome{NodeID: "url:root", Err: errors.New("download status 500")})
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'L'}})
+	m = updated.(Model)
+	rows := m.logRows()
+	if len(rows) != 3 {
+		t.Fatalf("expected warning, download failure and node error, got %+v", rows)
+	}
+	if rows[0].NodeID != labID || rows[1].Source != "download" || rows[2].Source != "node" || !strings.Contains(rows[2].Text, "fetch page status 500") {
+		t.Fatalf("unexpected rows: %+v", rows)
+	}
+	if !strings.Contains(m.renderLog(10), "stats page status 404") {
+		t.Fatalf("expected warning in log pane:\n%s", m.renderLog(10))
+	}
+
+	// The cursor starts on the latest session message.
+	updated, cmd = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'y'}})
+	m = runCmds(updated.(Model), cmd)
+	if !strings.Contains(copied, "download status 500") || m.statusText != "copied message to clipboard" {
+		t.Fatalf("unexpected copy: %q status %q", copied, m.statusText)
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'g'}})
+	m = updated.(Model)
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+	if m.mode != "browse" || m.selectedNodeID != labID {
+		t.Fatalf("expected jump to %s, got mode=%s selected=%s", labID, m.mode, m.selectedNodeID)
+	}
+}
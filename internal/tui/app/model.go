@@ -1,7 +1,9 @@
 package app
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -10,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/charmbracelet/bubbles/key"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 
@@ -28,6 +31,7 @@ var (
 	noneStyle     = lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "244", Dark: "246"})
 	infoStyle     = lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "39", Dark: "81"})
 	selectedStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.AdaptiveColor{Light: "39", Dark: "81"})
+	codeStyle     = lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "130", Dark: "180"})
 )
 
 type RefreshScope string
@@ -43,6 +47,22 @@ type RefreshRequest struct {
 	TargetNodeID string
 	TargetURL    string
 	Depth        int
+	// Progress, when set, is called by the executor as the refresh walks.
+	Progress func(RefreshProgress)
+	// Background marks a revalidation step the executor should not store;
+	// the model saves the nodes of all steps through SaveRevalidated at once.
+	Background bool
+}
+
+// RefreshProgress reports one step of a running refresh. Counters are totals
+// so far; Nodes are copies of nodes the step wrote to the executor's state.
+type RefreshProgress struct {
+	URL     string
+	Fetched int
+	Queued  int
+	Errors  int
+	Err     string
+	Nodes   []state.Node
 }
 
 type RefreshOutcome struct {
@@ -55,7 +75,10 @@ type RefreshOutcome struct {
 	Err          error
 }
 
-type RefreshExecutor func(st state.State, req RefreshRequest) RefreshOutcome
+// RefreshExecutor runs a refresh. When ctx is cancelled or its deadline
+// passes it stops fetching and returns the nodes refreshed so far in State,
+// with an Err wrapping ctx.Err().
+type RefreshExecutor func(ctx context.Context, st state.State, req RefreshRequest) RefreshOutcome
 
 type DownloadRequest struct {
 	NodeID    string
@@ -78,11 +101,22 @@ type DownloadOutcome struct {
 	Err        error
 }
 
-type DownloadExecutor func(st state.State, req DownloadRequest) DownloadOutcome
+// DownloadExecutor downloads req.Assets, giving up when ctx is cancelled.
+type DownloadExecutor func(ctx context.Context, st state.State, req DownloadRequest) DownloadOutcome
 type PersistChoicesFunc func(nodeID string, assetURLs []string, targetDir string) error
 
+// SaveRevalidatedFunc stores the nodes refreshed by background revalidation.
+type SaveRevalidatedFunc func(refreshed state.State) error
+
 type refreshFinishedMsg struct {
-	Outcome RefreshOutcome
+	Outcome    RefreshOutcome
+	Background bool
+}
+
+type refreshProgressMsg struct {
+	Scope    RefreshScope
+	Progress RefreshProgress
+	updates  <-chan RefreshProgress
 }
 
 type downloadFinishedMsg struct {
@@ -90,6 +124,9 @@ type downloadFinishedMsg struct {
 }
 
 type downloadFileFinishedMsg struct {
+	// Batch is the download batch the file belongs to; results of an earlier
+	// batch are dropped.
+	Batch    int
 	AssetURL string
 	Outcome  DownloadOutcome
 }
@@ -99,24 +136,40 @@ type Model struct {
 	rootNodeID          string
 	linkedRootNodeID    string
 	subtreeRefreshDepth int
+	stalePolicy         state.StalePolicy
 	refreshExecutor     RefreshExecutor
 	downloadExecutor    DownloadExecutor
 	persistChoices      PersistChoicesFunc
+	saveRevalidated     SaveRevalidatedFunc
 	defaultDownloadDir  string
 	recentAssetChoices  map[string][]string
 	downloadSelection   map[string]bool
 	downloadCursor      int
 	downloadOffset      int
 	downloadInFlight    bool
+	downloadBatch       int
 	downloadQueue       []state.AssetRef
 	downloadTargetDir   string
-	downloadCurrent     int
+	downloadNext        int
+	downloadActive      int
+	downloadConcurrency int
 	downloadDone        int
 	downloadFailed      int
+	downloadCancelled   int
 	downloadStatus      map[string]string
 	downloadErrorByURL  map[string]string
 	downloadStartedAt   time.Time
 	refreshInFlight     bool
+	refreshProgress     *RefreshProgress
+	pendingRefresh      *RefreshRequest
+	backgroundQueue     []string
+	backgroundInFlight  bool
+	backgroundTotal     int
+	backgroundDone      int
+	backgroundFailed    int
+	revalidated         state.State
+	workCtx             context.Context
+	cancelWork          context.CancelFunc
 	expanded            map[string]bool
 	flat                []treeRow
 	selectedIndex       int
@@ -125,6 +178,22 @@ type Model struct {
 	height              int
 	mode                string
 	filter              string
+	searchMatches       []searchMatch
+	searchCursor        int
+	searchOrigin        string
+	searchExpanded      map[string]bool
+	treeOffset          int
+	logEntries          []logEntry
+	logCursor           int
+	readerOffset        int
+	keys                KeyMap
+	confirmScope        RefreshScope
+	confirmDepth        int
+	confirmReturnMode   string
+	showHelp            bool
+	clipboard           ClipboardFunc
+	opener              OpenFunc
+	downloadedPaths     map[string]string
 	statusText          string
 }
 
@@ -157,22 +226,36 @@ func NewModel(cfg Config) (Model, error) {
 		return Model{}, fmt.Errorf("resolved root node %s not found in state", resolvedRootID)
 	}
 
-	now := time.Now().UTC()
-	_, _ = state.ApplyStateStalePolicy(&st, now, 2*time.Hour)
+	policy := cfg.StalePolicy
+	if policy.Default <= 0 {
+		policy = state.DefaultStalePolicy()
+	}
+	_, _ = state.ApplyStalePolicyByKind(&st, time.Now(), policy)
 
 	depth := cfg.SubtreeRefreshDepth
 	if depth <= 0 {
 		depth = 1
 	}
+	concurrency := cfg.DownloadConcurrency
+	if concurrency < 1 {
+		concurrency = DefaultDownloadConcurrency
+	}
 
 	m := Model{
 		st:                  st,
 		rootNodeID:          resolvedRootID,
 		linkedRootNodeID:    strings.TrimSpace(cfg.LinkedRootNodeID),
 		subtreeRefreshDepth: depth,
+		downloadConcurrency: concurrency,
+		stalePolicy:         policy,
 		refreshExecutor:     cfg.RefreshExecutor,
 		downloadExecutor:    cfg.DownloadExecutor,
 		persistChoices:      cfg.PersistChoices,
+		saveRevalidated:     cfg.SaveRevalidated,
+		clipboard:           cfg.Clipboard,
+		keys:                DefaultKeyMap(),
+		opener:              cfg.Opener,
+		downloadedPaths:     map[string]string{},
 		defaultDownloadDir:  strings.TrimSpace(cfg.DefaultDownloadDir),
 		recentAssetChoices:  cloneChoiceMap(cfg.RecentAssetChoices),
 		downloadSelection:   map[string]bool{},
@@ -191,13 +274,40 @@ func NewModel(cfg Config) (Model, error) {
 		filter:         "",
 		statusText:     "Cached view (refresh actions enabled)",
 	}
+	m.workCtx, m.cancelWork = context.WithCancel(context.Background())
+	if m.clipboard == nil {
+		m.clipboard = SystemClipboard
+	}
+	if m.opener == nil {
+		m.opener = CommandOpener(DefaultOpenerCommand())
+	}
+	if cfg.KeyMap != nil {
+		m.keys = *cfg.KeyMap
+	}
+	if conflicts := m.keys.Conflicts(); len(conflicts) > 0 {
+		for _, c := range conflicts {
+			m.logf("warn", "keys", "", "%s", c)
+		}
+		m.statusText = fmt.Sprintf("%d key binding conflict(s) (%s to view)", len(conflicts), m.keys.Log.Help().Key)
+	}
+	if cfg.AutoRefreshOnOpen && cfg.RefreshExecutor != nil && m.linkedRootNodeID != "" {
+		m.backgroundQueue = state.StaleNodeIDs(st, m.linkedRootNodeID, depth)
+		m.backgroundTotal = len(m.backgroundQueue)
+		if m.backgroundTotal > 0 {
+			m.backgroundInFlight = true
+			m.statusText = fmt.Sprintf("Cached view; revalidating %d stale node(s) in background", m.backgroundTotal)
+		}
+	}
 	m.rebuildFlat()
+	if cfg.Session != nil {
+		m.restoreSession(*cfg.Session)
+	}
 	return m, nil
 }
 
-func (m Model) Init() tea.Cmd { return nil }
+func (m Model) Init() tea.Cmd { return m.backgroundRefreshCmd() }
 
-func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+func (m Model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
@@ -207,33 +317,52 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		return m, nil
 	case refreshFinishedMsg:
+		if msg.Background {
+			return m.finishBackgroundRefresh(msg.Outcome)
+		}
 		m.refreshInFlight = false
+		m.refreshProgress = nil
 		out := msg.Outcome
+		m.logRefreshWarnings(out.Warnings)
+		if reason := interruptedBy(out.Err); reason != "" {
+			m.keepPartialRefresh(out.State)
+			m.statusText = fmt.Sprintf("refresh %s (%s): kept %d updated node(s)", reason, out.Scope, out.UpdatedNodes)
+			return m, m.nextBackgroundRefresh()
+		}
 		if out.Err != nil {
+			m.logf("error", "refresh", out.TargetNodeID, "%s refresh failed: %v", out.Scope, out.Err)
 			m.statusText = fmt.Sprintf("refresh failed (%s): %v", out.Scope, out.Err)
-			return m, nil
+			return m, m.nextBackgroundRefresh()
 		}
 		m.st = out.State
+		_, _ = state.ApplyStalePolicyByKind(&m.st, time.Now(), m.stalePolicy)
 		m.ensureVisible(out.TargetNodeID)
 		m.rebuildFlat()
 		m.selectedNodeID = out.TargetNodeID
 		m.syncSelectedIndex()
 		m.statusText = fmt.Sprintf("refresh finished: scope=%s updated=%d duration=%dms", out.Scope, out.UpdatedNodes, out.DurationMs)
 		if len(out.Warnings) > 0 {
-			m.statusText += fmt.Sprintf(" warnings=%d", len(out.Warnings))
+			m.statusText += fmt.Sprintf(" warnings=%d (%s to view)", len(out.Warnings), m.keys.Log.Help().Key)
 		}
-		return m, nil
+		return m, m.nextBackgroundRefresh()
+	case refreshProgressMsg:
+		if m.refreshInFlight {
+			m.applyRefreshProgress(msg.Scope, msg.Progress)
+		}
+		return m, waitRefreshProgress(msg.Scope, msg.updates)
 	case downloadFinishedMsg:
 		m.downloadInFlight = false
 		m.mode = "browse"
 		out := msg.Outcome
 		if out.Err != nil {
+			m.logf("error", "download", out.NodeID, "download failed: %v", out.Err)
 			m.statusText = fmt.Sprintf("download failed: %v", out.Err)
 			return m, nil
 		}
 		if m.persistChoices != nil {
 			selected := m.selectedAssetURLs()
 			if err := m.persistChoices(out.NodeID, selected, out.TargetDir); err != nil {
+				m.logf("error", "persist", out.NodeID, "save download choices: %v", err)
 				m.statusText = fmt.Sprintf("download finished (%d files), persist failed: %v", out.Downloaded, err)
 				return m, nil
 			}
@@ -242,17 +371,63 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.defaultDownloadDir = out.TargetDir
 		m.statusText = fmt.Sprintf("download finished: %d files to %s in %dms", out.Downloaded, out.TargetDir, out.DurationMs)
 		return m, nil
+	case clipboardCopiedMsg:
+		if msg.Err != nil {
+			m.statusText = fmt.Sprintf("copy failed: %v", msg.Err)
+		} else {
+			m.statusText = "copied " + msg.What + " to clipboard"
+		}
+		return m, nil
+	case openedMsg:
+		if msg.Err != nil {
+			m.statusText = fmt.Sprintf("open %s failed: %v", msg.What, msg.Err)
+		} else {
+			m.statusText = "opened " + msg.What
+		}
+		return m, nil
 	case downloadFileFinishedMsg:
+		if !m.downloadInFlight || msg.Batch != m.downloadBatch {
+			return m, nil
+		}
 		m.handleDownloadFileResult(msg.AssetURL, msg.Outcome)
-		if m.downloadCurrent < len(m.downloadQueue) {
+		if m.downloadNext < len(m.downloadQueue) {
 			return m, m.downloadNextCmd()
 		}
+		if m.downloadActive > 0 {
+			return m, nil
+		}
 		return m.finalizeDownloadBatch(), nil
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "ctrl+c", "q":
+		if m.showHelp {
+			return m.updateHelp(msg)
+		}
+		if m.mode == "search" {
+			return m.updateSearch(msg)
+		}
+		if m.mode == "log" {
+			return m.updateLog(msg)
+		}
+		if m.mode == "reader" {
+			return m.updateReader(msg)
+		}
+		if m.mode == "confirm" {
+			return m.updateConfirm(msg)
+		}
+		switch {
+		case key.Matches(msg, m.keys.Quit):
 			return m, tea.Quit
-		case "up", "k":
+		case key.Matches(msg, m.keys.Help):
+			return m.openHelp()
+		case key.Matches(msg, m.keys.Cancel):
+			if m.workInFlight() {
+				return m.cancelInFlight()
+			}
+			if m.mode == "download" {
+				return m.closeDownloadMode()
+			}
+			m.statusText = "nothing to cancel"
+			return m, nil
+		case key.Matches(msg, m.keys.Up):
 			if m.mode == "download" {
 				if m.downloadCursor > 0 {
 					m.downloadCursor--
@@ -264,7 +439,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.selectedIndex--
 				m.syncSelectedNodeID()
 			}
-		case "down", "j":
+		case key.Matches(msg, m.keys.Down):
 			if m.mode == "download" {
 				assets := m.selectedNodeAssets()
 				if m.downloadCursor < len(assets)-1 {
@@ -277,25 +452,22 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.selectedIndex++
 				m.syncSelectedNodeID()
 			}
-		case "left", "h":
+		case key.Matches(msg, m.keys.Collapse):
 			if m.mode == "download" {
-				m.mode = "browse"
-				m.statusText = "download mode closed"
-				m.resetDownloadProgress()
-				return m, nil
+				return m.closeDownloadMode()
 			}
 			m.collapseOrMoveToParent()
-		case "right", "l":
+		case key.Matches(msg, m.keys.Expand):
 			m.expandSelection()
-		case "g":
+		case key.Matches(msg, m.keys.Top):
 			m.selectedIndex = 0
 			m.syncSelectedNodeID()
-		case "G":
+		case key.Matches(msg, m.keys.Bottom):
 			if len(m.flat) > 0 {
 				m.selectedIndex = len(m.flat) - 1
 				m.syncSelectedNodeID()
 			}
-		case "p":
+		case key.Matches(msg, m.keys.Project):
 			if m.linkedRootNodeID == "" {
 				m.statusText = "no linked project root configured"
 				return m, nil
@@ -308,38 +480,51 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.syncSelectedIndex()
 			m.statusText = "jumped to linked project root"
 			return m, nil
-		case "d":
+		case key.Matches(msg, m.keys.Download):
 			if m.mode == "download" {
-				m.mode = "browse"
-				m.statusText = "download mode closed"
-				m.resetDownloadProgress()
-				return m, nil
+				return m.closeDownloadMode()
 			}
 			return m.openDownloadMode()
-		case " ":
-			if m.mode == "download" {
-				m.toggleDownloadSelectionAtCursor()
-				return m, nil
+		case m.mode == "download" && key.Matches(msg, m.keys.Toggle):
+			m.toggleDownloadSelectionAtCursor()
+			return m, nil
+		case m.mode == "download" && key.Matches(msg, m.keys.SelectAll):
+			for _, asset := range m.selectedNodeAssets() {
+				m.downloadSelection[asset.URL] = true
 			}
-		case "a":
-			if m.mode == "download" {
-				for _, asset := range m.selectedNodeAssets() {
-					m.downloadSelection[asset.URL] = true
-				}
-				return m, nil
+			return m, nil
+		case m.mode == "download" && key.Matches(msg, m.keys.ClearSelection):
+			m.downloadSelection = map[string]bool{}
+			return m, nil
+		case key.Matches(msg, m.keys.Search):
+			if m.mode == "browse" {
+				return m.openSearch()
 			}
-		case "c":
-			if m.mode == "download" {
-				m.downloadSelection = map[string]bool{}
-				return m, nil
+		case key.Matches(msg, m.keys.Log):
+			if m.mode == "browse" {
+				return m.openLog()
+			}
+		case key.Matches(msg, m.keys.Reader):
+			if m.mode == "browse" {
+				return m.openReader()
 			}
-		case "r":
+		case key.Matches(msg, m.keys.OpenPage, m.keys.OpenStats, m.keys.CopyPage, m.keys.CopyStats):
+			return m.openOrCopy(m.keyAction(msg))
+		case key.Matches(msg, m.keys.NextMatch):
+			if m.mode == "browse" {
+				return m.cycleMatch(1)
+			}
+		case key.Matches(msg, m.keys.PrevMatch):
+			if m.mode == "browse" {
+				return m.cycleMatch(-1)
+			}
+		case key.Matches(msg, m.keys.RefreshNode):
 			return m.startRefresh(RefreshScopeNode, 0)
-		case "R":
-			return m.startRefresh(RefreshScopeSubtree, m.subtreeRefreshDepth)
-		case "f":
-			return m.startRefresh(RefreshScopeFull, m.subtreeRefreshDepth)
-		case "enter":
+		case key.Matches(msg, m.keys.RefreshSubtree):
+			return m.requestRefresh(RefreshScopeSubtree, m.subtreeRefreshDepth)
+		case key.Matches(msg, m.keys.RefreshFull):
+			return m.requestRefresh(RefreshScopeFull, m.subtreeRefreshDepth)
+		case key.Matches(msg, m.keys.Enter):
 			if m.mode == "download" {
 				return m.startDownload()
 			}
@@ -376,6 +561,16 @@ func (m Model) View() string {
 
 	panelStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Align(lipgloss.Left, lipgloss.Top)
 	panelFrameW, panelFrameH := panelStyle.GetFrameSize()
+	if m.showHelp || m.mode == "reader" {
+		fullWidth := maxInt(1, availableWidth-panelFrameW)
+		fullHeight := maxInt(1, topHeight-panelFrameH)
+		content := m.renderReader(fullWidth, fullHeight)
+		if m.showHelp {
+			content = m.renderHelp(fullWidth, fullHeight)
+		}
+		fullPane := panelStyle.Width(fullWidth).Height(fullHeight).Render(content)
+		return lipgloss.JoinVertical(lipgloss.Left, fullPane, statusPane)
+	}
 	leftOuterWidth := maxInt(10, availableWidth/2)
 	rightOuterWidth := maxInt(10, availableWidth-leftOuterWidth)
 	leftContentWidth := maxInt(1, leftOuterWidth-panelFrameW)
@@ -390,19 +585,11 @@ func (m Model) View() string {
 }
 
 func (m Model) startRefresh(scope RefreshScope, depth int) (tea.Model, tea.Cmd) {
-	if m.refreshInFlight {
-		m.statusText = "refresh already in progress"
-		return m, nil
-	}
-	if m.refreshExecutor == nil {
-		m.statusText = "refresh unavailable (read-only mode)"
+	if reason := m.refreshUnavailable(); reason != "" {
+		m.statusText = reason
 		return m, nil
 	}
 	node := m.selectedNode()
-	if node == nil {
-		m.statusText = "no selected node"
-		return m, nil
-	}
 	targetID := node.ID
 	targetURL := node.CanonicalURL
 	if scope == RefreshScopeFull {
@@ -415,23 +602,247 @@ func (m Model) startRefresh(scope RefreshScope, depth int) (tea.Model, tea.Cmd)
 	}
 
 	m.refreshInFlight = true
-	m.statusText = fmt.Sprintf("refreshing %s...", scope)
-	stSnapshot := m.st
-	exec := m.refreshExecutor
 	req := RefreshRequest{
 		Scope:        scope,
 		TargetNodeID: targetID,
 		TargetURL:    targetURL,
 		Depth:        depth,
 	}
+	if m.backgroundInFlight {
+		// Refreshes share the executor; run this one after the current
+		// background step so neither overwrites the other's results.
+		m.pendingRefresh = &req
+		m.statusText = fmt.Sprintf("%s refresh queued behind background revalidation", scope)
+		return m, nil
+	}
+	m.statusText = fmt.Sprintf("refreshing %s...", scope)
+	return m, m.refreshCmd(req)
+}
 
-	cmd := func() tea.Msg {
-		out := exec(stSnapshot, req)
+// refreshCmd runs req on a copy of the state and streams its progress back
+// while it runs.
+func (m Model) refreshCmd(req RefreshRequest) tea.Cmd {
+	snapshot, err := state.CloneState(m.st)
+	if err != nil {
+		return func() tea.Msg {
+			return refreshFinishedMsg{Outcome: RefreshOutcome{Scope: req.Scope, TargetNodeID: req.TargetNodeID, Err: err}}
+		}
+	}
+	ctx := m.workCtx
+	exec := m.refreshExecutor
+	updates := make(chan RefreshProgress, 16)
+	req.Progress = func(p RefreshProgress) {
+		select {
+		case updates <- p:
+		case <-ctx.Done():
+		}
+	}
+	run := func() tea.Msg {
+		out := exec(ctx, snapshot, req)
+		close(updates)
 		return refreshFinishedMsg{Outcome: out}
 	}
+	return tea.Batch(run, waitRefreshProgress(req.Scope, updates))
+}
+
+func waitRefreshProgress(scope RefreshScope, updates <-chan RefreshProgress) tea.Cmd {
+	return func() tea.Msg {
+		p, ok := <-updates
+		if !ok {
+			return nil
+		}
+		return refreshProgressMsg{Scope: scope, Progress: p, updates: updates}
+	}
+}
+
+// applyRefreshProgress folds the nodes of a progress step into the view and
+// shows the running totals.
+func (m *Model) applyRefreshProgress(scope RefreshScope, p RefreshProgress) {
+	m.refreshProgress = &p
+	if len(p.Nodes) > 0 {
+		landed := state.State{Nodes: make(map[string]state.Node, len(p.Nodes))}
+		for _, node := range p.Nodes {
+			landed.Nodes[node.ID] = node
+		}
+		if state.MergeRefreshed(&m.st, landed) > 0 {
+			m.rebuildFlat()
+			m.syncSelectedIndex()
+		}
+	}
+	m.statusText = fmt.Sprintf("refreshing %s: %d fetched, %d queued, %d error(s): %s", scope, p.Fetched, p.Queued, p.Errors, p.URL)
+	if p.Err != "" {
+		m.statusText += " failed: " + p.Err
+	}
+}
+
+// backgroundRefreshCmd refreshes the head of the background queue on a copy of
+// the state, leaving the cached view readable meanwhile.
+func (m Model) backgroundRefreshCmd() tea.Cmd {
+	if !m.backgroundInFlight || len(m.backgroundQueue) == 0 || m.refreshExecutor == nil {
+		return nil
+	}
+	node := m.st.Nodes[m.backgroundQueue[0]]
+	snapshot, err := state.CloneState(m.st)
+	if err != nil {
+		return func() tea.Msg {
+			return refreshFinishedMsg{Outcome: RefreshOutcome{Scope: RefreshScopeNode, TargetNodeID: node.ID, Err: err}, Background: true}
+		}
+	}
+	ctx := m.workCtx
+	exec := m.refreshExecutor
+	req := RefreshRequest{Scope: RefreshScopeNode, TargetNodeID: node.ID, TargetURL: node.CanonicalURL, Background: true}
+	return func() tea.Msg {
+		return refreshFinishedMsg{Outcome: exec(ctx, snapshot, req), Background: true}
+	}
+}
+
+// nextBackgroundRefresh starts a queued user refresh first, then the next
+// background node that is still stale.
+func (m *Model) nextBackgroundRefresh() tea.Cmd {
+	if m.backgroundInFlight || m.refreshInFlight && m.pendingRefresh == nil {
+		return nil
+	}
+	if m.pendingRefresh != nil {
+		req := *m.pendingRefresh
+		m.pendingRefresh = nil
+		m.statusText = fmt.Sprintf("refreshing %s...", req.Scope)
+		return m.refreshCmd(req)
+	}
+	for len(m.backgroundQueue) > 0 && m.st.Nodes[m.backgroundQueue[0]].Status != state.StatusStale {
+		m.backgroundQueue = m.backgroundQueue[1:]
+		m.backgroundDone++
+	}
+	if len(m.backgroundQueue) == 0 {
+		return nil
+	}
+	m.backgroundInFlight = true
+	return m.backgroundRefreshCmd()
+}
+
+// interruptedBy names why err ended a refresh early: "cancelled" when it was
+// cancelled, "timed out" when its deadline passed, and "" otherwise.
+func interruptedBy(err error) string {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timed out"
+	default:
+		return ""
+	}
+}
+
+func (m Model) finishBackgroundRefresh(out RefreshOutcome) (tea.Model, tea.Cmd) {
+	m.backgroundInFlight = false
+	if len(m.backgroundQueue) > 0 {
+		m.backgroundQueue = m.backgroundQueue[1:]
+	}
+	m.backgroundDone++
+	if reason := interruptedBy(out.Err); reason != "" {
+		if out.State.Nodes != nil {
+			state.MergeRefreshed(&m.revalidated, out.State)
+			state.MergeRefreshed(&m.st, out.State)
+		}
+		m.keepPartialRefresh(m.st)
+		m.statusText = fmt.Sprintf("background refresh %s: %d of %d stale node(s) revalidated", reason, m.backgroundDone-1-m.backgroundFailed, m.backgroundTotal)
+		cmd := m.nextBackgroundRefresh()
+		m.flushRevalidatedIfDrained()
+		return m, cmd
+	}
+	m.logRefreshWarnings(out.Warnings)
+	if out.Err != nil {
+		m.backgroundFailed++
+		m.logf("error", "revalidate", out.TargetNodeID, "background refresh failed: %v", out.Err)
+	} else {
+		state.MergeRefreshed(&m.revalidated, out.State)
+		state.MergeRefreshed(&m.st, out.State)
+		_, _ = state.ApplyStalePolicyByKind(&m.st, time.Now(), m.stalePolicy)
+		m.rebuildFlat()
+		m.syncSelectedIndex()
+	}
+
+	cmd := m.nextBackgroundRefresh()
+	m.flushRevalidatedIfDrained()
+	if m.backgroundInFlight || m.refreshInFlight {
+		return m, cmd
+	}
+	m.statusText = fmt.Sprintf("background refresh finished: %d stale node(s) revalidated", m.backgroundDone-m.backgroundFailed)
+	if m.backgroundFailed > 0 {
+		m.statusText += fmt.Sprintf(", %d failed", m.backgroundFailed)
+	}
 	return m, cmd
 }
 
+// flushRevalidatedIfDrained saves the revalidated nodes once the background
+// queue is empty, so a whole revalidation pass is a single write.
+func (m *Model) flushRevalidatedIfDrained() {
+	if len(m.backgroundQueue) > 0 || m.backgroundInFlight {
+		return
+	}
+	if err := m.saveRevalidatedNodes(); err != nil {
+		m.logf("error", "revalidate", "", "save revalidated nodes: %v", err)
+	}
+}
+
+// saveRevalidatedNodes hands the nodes revalidated since the last save to
+// SaveRevalidated.
+func (m *Model) saveRevalidatedNodes() error {
+	if m.saveRevalidated == nil || len(m.revalidated.Nodes) == 0 {
+		return nil
+	}
+	refreshed := m.revalidated
+	m.revalidated = state.State{}
+	return m.saveRevalidated(refreshed)
+}
+
+func (m Model) workInFlight() bool {
+	return m.refreshInFlight || m.backgroundInFlight || m.downloadInFlight
+}
+
+// cancelInFlight aborts every running refresh and download. Queued work is
+// dropped; running executors return what they finished, which is reported as
+// their results arrive. Later work runs under a fresh context.
+func (m Model) cancelInFlight() (tea.Model, tea.Cmd) {
+	m.cancelWork()
+	m.workCtx, m.cancelWork = context.WithCancel(context.Background())
+
+	if m.pendingRefresh != nil {
+		// Queued behind a background step and never started.
+		m.pendingRefresh = nil
+		m.refreshInFlight = false
+	}
+	if m.backgroundInFlight {
+		// Keep the running head; finishBackgroundRefresh pops it.
+		m.backgroundQueue = m.backgroundQueue[:minInt(1, len(m.backgroundQueue))]
+	} else {
+		m.backgroundQueue = nil
+	}
+	if m.downloadInFlight {
+		for _, asset := range m.downloadQueue[m.downloadNext:] {
+			m.downloadStatus[asset.URL] = "cancelled"
+			m.downloadCancelled++
+		}
+		m.downloadNext = len(m.downloadQueue)
+		if m.downloadActive == 0 {
+			return m.finalizeDownloadBatch(), nil
+		}
+	}
+	m.statusText = "cancelling..."
+	return m, nil
+}
+
+// keepPartialRefresh shows the nodes a cancelled refresh finished before it
+// stopped; the executor has already saved them.
+func (m *Model) keepPartialRefresh(st state.State) {
+	if st.Nodes == nil {
+		return
+	}
+	m.st = st
+	_, _ = state.ApplyStalePolicyByKind(&m.st, time.Now(), m.stalePolicy)
+	m.rebuildFlat()
+	m.syncSelectedIndex()
+}
+
 func (m Model) openDownloadMode() (tea.Model, tea.Cmd) {
 	if m.downloadInFlight {
 		m.statusText = "download already in progress"
@@ -463,6 +874,19 @@ func (m Model) openDownloadMode() (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// closeDownloadMode returns to browsing. It refuses while a batch is running,
+// since closing would drop the batch without stopping its downloads.
+func (m Model) closeDownloadMode() (tea.Model, tea.Cmd) {
+	if m.downloadInFlight {
+		m.statusText = fmt.Sprintf("download in progress; press %s to cancel it first", m.keys.Cancel.Help().Key)
+		return m, nil
+	}
+	m.mode = "browse"
+	m.statusText = "download mode closed"
+	m.resetDownloadProgress()
+	return m, nil
+}
+
 func (m *Model) toggleDownloadSelectionAtCursor() {
 	assets := m.selectedNodeAssets()
 	if len(assets) == 0 {
@@ -509,22 +933,27 @@ func (m Model) startDownload() (tea.Model, tea.Cmd) {
 	}
 
 	m.downloadInFlight = true
+	m.downloadBatch++
 	m.downloadQueue = append([]state.AssetRef{}, selected...)
 	m.downloadTargetDir = targetDir
-	m.downloadCurrent = 0
+	m.downloadNext = 0
+	m.downloadActive = 0
 	m.downloadDone = 0
 	m.downloadFailed = 0
+	m.downloadCancelled = 0
 	m.downloadStartedAt = time.Now()
 	m.downloadStatus = map[string]string{}
 	m.downloadErrorByURL = map[string]string{}
 	for _, a := range m.downloadQueue {
 		m.downloadStatus[a.URL] = "pending"
 	}
-	if len(m.downloadQueue) > 0 {
-		m.downloadStatus[m.downloadQueue[0].URL] = "active"
-	}
 	m.statusText = fmt.Sprintf("downloading 0/%d to %s", len(selected), targetDir)
-	return m, m.downloadNextCmd()
+
+	cmds := make([]tea.Cmd, 0, m.downloadConcurrency)
+	for m.downloadActive < m.downloadConcurrency && m.downloadNext < len(m.downloadQueue) {
+		cmds = append(cmds, m.downloadNextCmd())
+	}
+	return m, tea.Batch(cmds...)
 }
 
 func (m Model) selectedNodeAssets() []state.AssetRef {
@@ -571,7 +1000,7 @@ func (m *Model) rebuildFlat() {
 			Title:       displayTitle(node),
 			URL:         node.CanonicalURL,
 			Status:      node.Status,
-			ResultLabel: nodeResultLabel(node),
+			ResultLabel: state.ResultLabel(node),
 			HasChildren: len(node.ChildIDs) > 0,
 			Expanded:    m.expanded[nodeID],
 			ParentID:    parentID,
@@ -700,10 +1129,15 @@ func (m *Model) collapseOrMoveToParent() {
 	}
 }
 
-func (m Model) renderTree() string {
-	lines := make([]string, 0, len(m.flat)+1)
+// renderTree renders the title and up to maxRows rows starting at the scroll
+// offset.
+func (m Model) renderTree(maxRows int) string {
+	start := minInt(m.treeOffset, maxInt(0, len(m.flat)-1))
+	end := minInt(len(m.flat), start+maxRows)
+	lines := make([]string, 0, end-start+1)
 	lines = append(lines, titleStyle.Render("Tree"))
-	for i, row := range m.flat {
+	for i := start; i < end; i++ {
+		row := m.flat[i]
 		prefix := "  "
 		if i == m.selectedIndex {
 			prefix = "> "
@@ -732,7 +1166,13 @@ func (m Model) renderTree() string {
 }
 
 func (m Model) renderTreeForHeight(maxLines int) string {
-	return clipTopLines(m.renderTree(), maxLines)
+	if m.mode == "search" {
+		return m.renderSearch(maxLines)
+	}
+	if m.mode == "log" {
+		return m.renderLog(maxLines)
+	}
+	return clipTopLines(m.renderTree(maxInt(1, maxLines-1)), maxLines)
 }
 
 func (m Model) renderDetailsForSize(maxWidth int, maxLines int) string {
@@ -740,6 +1180,12 @@ func (m Model) renderDetailsForSize(maxWidth int, maxLines int) string {
 }
 
 func (m Model) renderDetails(maxWidth int, maxLines int) string {
+	if m.mode == "log" {
+		return m.renderLogDetails()
+	}
+	if m.mode == "confirm" {
+		return m.renderConfirm()
+	}
 	node := m.selectedNode()
 	if node == nil {
 		return titleStyle.Render("Details") + "\n" + mutedStyle.Render("(no selection)")
@@ -752,7 +1198,7 @@ func (m Model) renderDetails(maxWidth int, maxLines int) string {
 		titleStyle.Render("Details"),
 		fmt.Sprintf("Name: %s", displayTitle(*node)),
 		fmt.Sprintf("Type: %s", readableKind(node.Kind)),
-		fmt.Sprintf("Result: %s", colorResultWord(nodeResultLabel(*node))),
+		fmt.Sprintf("Result: %s", colorResultWord(state.ResultLabel(*node))),
 		fmt.Sprintf("Freshness: %s", colorStatusWord(node.Status)),
 	}
 	if node.CanonicalURL != "" {
@@ -781,6 +1227,9 @@ func (m Model) renderDetails(maxWidth int, maxLines int) string {
 
 	if node.LastSuccessAt != nil {
 		lines = append(lines, fmt.Sprintf("Fresh at: %s", node.LastSuccessAt.Local().Format("2006-01-02 15:04")))
+		if age, ok := state.NodeAge(*node, time.Now()); ok {
+			lines = append(lines, fmt.Sprintf("Age: %s (stale after %s)", state.FormatAge(age), state.FormatAge(m.stalePolicy.TTL(node.Kind))))
+		}
 	}
 	if node.LastFetchedAt != nil && node.LastSuccessAt != nil {
 		if node.LastFetchedAt.After(*node.LastSuccessAt) {
@@ -817,18 +1266,30 @@ func (m Model) renderStatus() string {
 		selected = row.Title
 	}
 	inFlight := "idle"
+	if m.backgroundInFlight {
+		inFlight = fmt.Sprintf("revalidating %d/%d", m.backgroundDone+1, m.backgroundTotal)
+	}
 	if m.refreshInFlight {
 		inFlight = "refreshing"
+		if p := m.refreshProgress; p != nil {
+			inFlight = fmt.Sprintf("refreshing %d/%d", p.Fetched, p.Fetched+p.Queued)
+		}
 	}
 	if m.downloadInFlight {
 		inFlight = "downloading"
 	}
-	keys := "j/k move h/l fold enter open r node R subtree f full d download p project q quit"
-	if m.mode == "download" {
-		keys = "j/k move space toggle a all c clear enter download h/d close q quit"
+	keys := m.keys.statusHelp(m.helpMode())
+	if (m.mode == "browse" && (m.refreshInFlight || m.backgroundInFlight)) || m.downloadInFlight {
+		keys = m.keys.Cancel.Help().Key + " cancel " + keys
 	}
-	if m.downloadInFlight {
-		keys = "j/k move (live progress) h/d close q quit"
+	if m.mode == "search" {
+		keys = "type to filter (status: kind: result:) " + m.keys.searchHelp()
+	}
+	if m.mode == "reader" {
+		keys = m.readerPosition() + " " + keys
+	}
+	if m.showHelp {
+		keys = m.keys.Help.Help().Key + "/" + m.keys.Cancel.Help().Key + " close help"
 	}
 	msg := strings.TrimSpace(m.statusText)
 	modeText := titleStyle.Render(strings.ToUpper(m.mode))
@@ -850,7 +1311,7 @@ func (m Model) renderDownloadPanel(node state.Node, maxWidth int, maxLines int)
 		titleStyle.Render("Download"),
 		fmt.Sprintf("Node: %s", displayTitle(node)),
 		fmt.Sprintf("Target dir: %s", m.defaultDownloadDir),
-		mutedStyle.Render("Keys: j/k move, space toggle, a all, c clear, enter download"),
+		mutedStyle.Render("Keys: " + m.keys.keyHints("download", []string{"up", "down", "toggle", "select_all", "clear_selection", "enter"}, ", ")),
 		"",
 	}
 	for i := range header {
@@ -977,6 +1438,13 @@ func displayTitle(node state.Node) string {
 	return node.ID
 }
 
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
 func maxInt(a int, b int) int {
 	if a > b {
 		return a
@@ -1023,19 +1491,26 @@ func (m *Model) adjustDownloadOffset() {
 	}
 }
 
-func (m Model) downloadNextCmd() tea.Cmd {
-	if !m.downloadInFlight || m.downloadCurrent >= len(m.downloadQueue) {
+// downloadNextCmd starts the next pending file of the batch, marking it active.
+func (m *Model) downloadNextCmd() tea.Cmd {
+	if !m.downloadInFlight || m.downloadNext >= len(m.downloadQueue) {
 		return nil
 	}
 	if m.downloadExecutor == nil {
 		return nil
 	}
-	asset := m.downloadQueue[m.downloadCurrent]
 	node := m.selectedNode()
 	if node == nil {
 		return nil
 	}
+	asset := m.downloadQueue[m.downloadNext]
+	m.downloadNext++
+	m.downloadActive++
+	m.downloadStatus[asset.URL] = "active"
+	m.focusDownloadAsset(asset.URL)
 
+	ctx := m.workCtx
+	batch := m.downloadBatch
 	stSnapshot := m.st
 	exec := m.downloadExecutor
 	req := DownloadRequest{
@@ -1044,27 +1519,31 @@ func (m Model) downloadNextCmd() tea.Cmd {
 		Assets:    []state.AssetRef{asset},
 	}
 	return func() tea.Msg {
-		out := exec(stSnapshot, req)
-		return downloadFileFinishedMsg{AssetURL: asset.URL, Outcome: out}
+		out := exec(ctx, stSnapshot, req)
+		return downloadFileFinishedMsg{Batch: batch, AssetURL: asset.URL, Outcome: out}
 	}
 }
 
 func (m *Model) handleDownloadFileResult(assetURL string, out DownloadOutcome) {
-	if out.Err != nil {
+	if errors.Is(out.Err, context.Canceled) {
+		m.downloadStatus[assetURL] = "cancelled"
+		m.downloadCancelled++
+	} else if out.Err != nil {
+		m.logf("error", "download", out.NodeID, "%s: %v", assetURL, out.Err)
 		m.downloadStatus[assetURL] = "error"
 		m.downloadErrorByURL[assetURL] = out.Err.Error()
 		m.downloadFailed++
 	} else {
+		if len(out.Files) > 0 {
+			m.downloadedPaths[assetURL] = out.Files[0].Path
+		}
 		m.downloadStatus[assetURL] = "done"
 		m.downloadDone++
 	}
-	m.downloadCurrent++
-	if m.downloadCurrent < len(m.downloadQueue) {
-		nextURL := m.downloadQueue[m.downloadCurrent].URL
-		m.downloadStatus[nextURL] = "active"
-		m.focusDownloadAsset(nextURL)
+	if m.downloadActive > 0 {
+		m.downloadActive--
 	}
-	m.statusText = fmt.Sprintf("downloading %d/%d to %s", m.downloadDone+m.downloadFailed, len(m.downloadQueue), m.downloadTargetDir)
+	m.statusText = fmt.Sprintf("downloading %d/%d to %s", m.downloadDone+m.downloadFailed+m.downloadCancelled, len(m.downloadQueue), m.downloadTargetDir)
 	m.adjustDownloadOffset()
 }
 
@@ -1076,13 +1555,17 @@ func (m Model) finalizeDownloadBatch() Model {
 	if m.persistChoices != nil {
 		selected := m.selectedAssetURLs()
 		if node := m.selectedNode(); node != nil {
-			if err := m.persistChoices(node.ID, selected, m.downloadTargetDir); err == nil {
+			if err := m.persistChoices(node.ID, selected, m.downloadTargetDir); err != nil {
+				m.logf("error", "persist", node.ID, "save download choices: %v", err)
+			} else {
 				m.recentAssetChoices[node.ID] = selected
 			}
 		}
 	}
 
-	if m.downloadFailed > 0 {
+	if m.downloadCancelled > 0 {
+		m.statusText = fmt.Sprintf("download cancelled: %d ok, %d failed, %d cancelled in %dms", m.downloadDone, m.downloadFailed, m.downloadCancelled, duration)
+	} else if m.downloadFailed > 0 {
 		m.statusText = fmt.Sprintf("download finished: %d ok, %d failed in %dms", m.downloadDone, m.downloadFailed, duration)
 	} else {
 		m.statusText = fmt.Sprintf("download finished: %d files in %dms", m.downloadDone, duration)
@@ -1094,9 +1577,11 @@ func (m *Model) resetDownloadProgress() {
 	m.downloadInFlight = false
 	m.downloadQueue = []state.AssetRef{}
 	m.downloadTargetDir = ""
-	m.downloadCurrent = 0
+	m.downloadNext = 0
+	m.downloadActive = 0
 	m.downloadDone = 0
 	m.downloadFailed = 0
+	m.downloadCancelled = 0
 	m.downloadStatus = map[string]string{}
 	m.downloadErrorByURL = map[string]string{}
 	m.downloadStartedAt = time.Time{}
@@ -1111,6 +1596,8 @@ func (m Model) downloadMarker(assetURL string) string {
 			return "✓"
 		case "error":
 			return "✗"
+		case "cancelled":
+			return "-"
 		case "pending":
 			return "·"
 		}
@@ -1294,51 +1781,6 @@ func readableKind(kind string) string {
 	}
 }
 
-func nodeResultLabel(node state.Node) string {
-	if strings.TrimSpace(strings.ToLower(node.Kind)) != "assignment" {
-		switch node.Status {
-		case state.StatusOK:
-			return "ok"
-		case state.StatusStale:
-			return "stale"
-		case state.StatusError:
-			return "error"
-		case state.StatusNever:
-			return "never"
-		default:
-			return "unknown"
-		}
-	}
-
-	summary := assignmentStatsSummary(node.Details)
-	status := normalizeStatsKey(stringAnyMapGetString(summary, "status"))
-	statusText := normalizeStatsKey(stringAnyMapGetString(summary, "status_text"))
-	combined := strings.TrimSpace(status + " " + statusText)
-
-	if containsAny(combined, "passed", "pass") {
-		return "passed"
-	}
-	if containsAny(combined, "failed", "failing", "wrong", "error", "timeout", "diff", "runtime") {
-		return "failing"
-	}
-	if grade := strings.TrimSpace(stringAnyMapGetString(summary, "grade")); grade != "" {
-		return grade
-	}
-	if statusPageURL(node.Details) != "" {
-		return "not_submitted"
-	}
-	return "unknown"
-}
-
-func containsAny(haystack string, needles ...string) bool {
-	for _, n := range needles {
-		if strings.Contains(haystack, n) {
-			return true
-		}
-	}
-	return false
-}
-
 func isGradeLike(raw string) bool {
 	raw = strings.TrimSpace(raw)
 	if raw == "" {
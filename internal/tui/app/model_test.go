@@ -1,15 +1,24 @@
 package app
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 
+	"themis-cli/internal/discovery"
 	"themis-cli/internal/state"
+	"themis-cli/internal/themis"
 )
 
 func baseStateForTUI(now time.Time) state.State {
@@ -60,6 +69,28 @@ func baseStateForTUI(now time.Time) state.State {
 	return st
 }
 
+// runCmds feeds cmd and every command it produces back into m, expanding
+// batches in order, until nothing is left.
+func runCmds(m Model, cmd tea.Cmd) Model {
+	queue := []tea.Cmd{cmd}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		if next == nil {
+			continue
+		}
+		msg := next()
+		if batch, ok := msg.(tea.BatchMsg); ok {
+			queue = append(queue, batch...)
+			continue
+		}
+		updated, follow := m.Update(msg)
+		m = updated.(Model)
+		queue = append(queue, follow)
+	}
+	return m
+}
+
 func TestNewModelAndNavigation(t *testing.T) {
 	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
 	m, err := NewModel(Config{State: baseStateForTUI(now)})
@@ -109,7 +140,7 @@ func TestCollapseAndExpand(t *testing.T) {
 func TestRefreshKeyFlowAndJumpProjectRoot(t *testing.T) {
 	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
 	executorCalled := false
-	exec := func(st state.State, req RefreshRequest) RefreshOutcome {
+	exec := func(_ context.Context, st state.State, req RefreshRequest) RefreshOutcome {
 		executorCalled = true
 		node := st.Nodes[req.TargetNodeID]
 		node.Title = node.Title + " *"
@@ -127,9 +158,7 @@ func TestRefreshKeyFlowAndJumpProjectRoot(t *testing.T) {
 	if cmd == nil {
 		t.Fatalf("expected refresh command")
 	}
-	msg := cmd()
-	updated, _ = m.Update(msg)
-	m = updated.(Model)
+	m = runCmds(m, cmd)
 	if !executorCalled {
 		t.Fatalf("expected executor to run")
 	}
@@ -146,7 +175,7 @@ func TestRefreshKeyFlowAndJumpProjectRoot(t *testing.T) {
 
 func TestRefreshFailureStatus(t *testing.T) {
 	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
-	exec := func(st state.State, req RefreshRequest) RefreshOutcome {
+	exec := func(_ context.Context, st state.State, req RefreshRequest) RefreshOutcome {
 		return RefreshOutcome{State: st, Scope: req.Scope, TargetNodeID: req.TargetNodeID, Err: errors.New("boom")}
 	}
 
@@ -160,9 +189,7 @@ func TestRefreshFailureStatus(t *testing.T) {
 	if cmd == nil {
 		t.Fatalf("expected refresh command")
 	}
-	msg := cmd()
-	updated, _ = m.Update(msg)
-	m = updated.(Model)
+	m = runCmds(m, cmd)
 	if m.statusText == "" || m.statusText == "Cached view (refresh actions enabled)" {
 		t.Fatalf("expected failure status text")
 	}
@@ -170,7 +197,7 @@ func TestRefreshFailureStatus(t *testing.T) {
 
 func TestDownloadFlow(t *testing.T) {
 	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
-	exec := func(st state.State, req DownloadRequest) DownloadOutcome {
+	exec := func(_ context.Context, st state.State, req DownloadRequest) DownloadOutcome {
 		return DownloadOutcome{
 			NodeID:     req.NodeID,
 			TargetDir:  req.TargetDir,
@@ -213,12 +240,7 @@ func TestDownloadFlow(t *testing.T) {
 		t.Fatalf("expected download command")
 	}
 
-	for cmd != nil {
-		msg := cmd()
-		updated, next := m.Update(msg)
-		m = updated.(Model)
-		cmd = next
-	}
+	m = runCmds(m, cmd)
 
 	if m.mode != "download" {
 		t.Fatalf("expected download mode to remain for progress summary")
@@ -396,7 +418,7 @@ func TestRenderTree_AssignmentResultLabelsAndFreshnessIndicator(t *testing.T) {
 	if err != nil {
 		t.Fatalf("new model failed: %v", err)
 	}
-	tree := m.renderTree()
+	tree := m.renderTree(len(m.flat))
 
 	assertContains := func(needle string) {
 		if !strings.Contains(tree, needle) {
@@ -409,3 +431,472 @@ func TestRenderTree_AssignmentResultLabelsAndFreshnessIndicator(t *testing.T) {
 	assertContains("[not_submitted] Lab 3")
 	assertContains("[17.50] Lab 4")
 }
+
+func TestAutoRefreshOnOpen_RevalidatesStaleNodes(t *testing.T) {
+	now := time.Now().UTC()
+	st := baseStateForTUI(now)
+	old := now.Add(-5 * time.Hour)
+	for _, id := range []string{"url:lab1", "url:lab2"} {
+		node := st.Nodes[id]
+		node.LastSuccessAt = &old
+		st.Nodes[id] = node
+	}
+
+	refreshed := []string{}
+	background := map[string]bool{}
+	exec := func(_ context.Context, st state.State, req RefreshRequest) RefreshOutcome {
+		refreshed = append(refreshed, req.TargetNodeID)
+		background[req.TargetNodeID] = req.Background
+		node := st.Nodes[req.TargetNodeID]
+		fresh := time.Now().UTC()
+		node.Status = state.StatusOK
+		node.LastSuccessAt = &fresh
+		node.UpdatedAt = fresh.Add(time.Second)
+		st.Nodes[req.TargetNodeID] = node
+		return RefreshOutcome{State: st, Scope: req.Scope, TargetNodeID: req.TargetNodeID, UpdatedNodes: 1}
+	}
+	saves := []state.State{}
+
+	m, err := NewModel(Config{
+		State:               st,
+		LinkedRootNodeID:    "url:root",
+		SubtreeRefreshDepth: 1,
+		RefreshExecutor:     exec,
+		AutoRefreshOnOpen:   true,
+		SaveRevalidated: func(refreshed state.State) error {
+			saves = append(saves, refreshed)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("new model failed: %v", err)
+	}
+	if m.st.Nodes["url:lab1"].Status != state.StatusStale {
+		t.Fatalf("expected cached lab1 to be served as stale")
+	}
+	if !strings.Contains(m.renderStatus(), "revalidating 1/2") {
+		t.Fatalf("expected background progress in status line, got %q", m.renderStatus())
+	}
+
+	// A user refresh during a background step waits for it.
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'r'}})
+	m = updated.(Model)
+	if cmd != nil || m.pendingRefresh == nil {
+		t.Fatalf("expected user refresh to be queued")
+	}
+
+	m = runCmds(m, m.Init())
+
+	if len(refreshed) != 3 || refreshed[0] != "url:lab1" || refreshed[1] != "url:root" || refreshed[2] != "url:lab2" {
+		t.Fatalf("unexpected refresh order: %v", refreshed)
+	}
+	for _, id := range []string{"url:lab1", "url:lab2"} {
+		if m.st.Nodes[id].Status != state.StatusOK {
+			t.Fatalf("expected %s revalidated, got %s", id, m.st.Nodes[id].Status)
+		}
+	}
+	if m.backgroundInFlight || m.refreshInFlight {
+		t.Fatalf("expected refreshes to be finished")
+	}
+	if !background["url:lab1"] || !background["url:lab2"] || background["url:root"] {
+		t.Fatalf("expected only revalidation steps to be marked background: %v", background)
+	}
+	// Both background steps are saved in one write once the queue drains.
+	if len(saves) != 1 {
+		t.Fatalf("expected a single save of revalidated nodes, got %d", len(saves))
+	}
+	for _, id := range []string{"url:lab1", "url:lab2"} {
+		if saves[0].Nodes[id].Status != state.StatusOK {
+			t.Fatalf("expected %s in the saved nodes, got %+v", id, saves[0].Nodes[id])
+		}
+	}
+}
+
+func TestDownloadPoolBoundsConcurrency(t *testing.T) {
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+	st := baseStateForTUI(now)
+	root := st.Nodes["url:root"]
+	root.Assets = nil
+	for i := 1; i <= 5; i++ {
+		root.Assets = append(root.Assets, state.AssetRef{
+			Name: fmt.Sprintf("%d.in", i),
+			URL:  fmt.Sprintf("https://themis.housing.rug.nl/file/course/%%40tests/%d.in", i),
+		})
+	}
+	st.Nodes["url:root"] = root
+
+	exec := func(_ context.Context, st state.State, req DownloadRequest) DownloadOutcome {
+		if strings.HasSuffix(req.Assets[0].URL, "/3.in") {
+			return DownloadOutcome{NodeID: req.NodeID, Err: errors.New("boom")}
+		}
+		return DownloadOutcome{NodeID: req.NodeID, TargetDir: req.TargetDir, Downloaded: 1}
+	}
+	m, err := NewModel(Config{State: st, DownloadExecutor: exec, DefaultDownloadDir: "/tmp/tests", DownloadConcurrency: 2})
+	if err != nil {
+		t.Fatalf("new model failed: %v", err)
+	}
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'d'}})
+	m = updated.(Model)
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+
+	if m.downloadActive != 2 || m.downloadNext != 2 {
+		t.Fatalf("expected 2 downloads started, got active=%d next=%d", m.downloadActive, m.downloadNext)
+	}
+	active := 0
+	for _, status := range m.downloadStatus {
+		if status == "active" {
+			active++
+		}
+	}
+	if active != 2 {
+		t.Fatalf("expected 2 active markers, got %d", active)
+	}
+	batch, ok := cmd().(tea.BatchMsg)
+	if !ok || len(batch) != 2 {
+		t.Fatalf("expected a batch of 2 download commands")
+	}
+
+	m = runCmds(m, cmd)
+	if m.downloadInFlight || m.downloadDone != 4 || m.downloadFailed != 1 {
+		t.Fatalf("unexpected totals: inflight=%v done=%d failed=%d", m.downloadInFlight, m.downloadDone, m.downloadFailed)
+	}
+	if m.downloadStatus["https://themis.housing.rug.nl/file/course/%40tests/3.in"] != "error" {
+		t.Fatalf("expected per-file error marker")
+	}
+}
+
+func TestDownloadPoolReauthenticatesThroughSessionProvider(t *testing.T) {
+	// Files are refused until the session has been validated a second
+	// time, as if the login expired right after the first validation.
+	var userHits, fileHits int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/user" {
+			atomic.AddInt64(&userHits, 1)
+			_, _ = w.Write([]byte(`<html><body><section class="border accent"><div class="cfg-container">
+			<div class="cfg-line"><span class="cfg-key">Full name:</span><span class="cfg-val">Test User</span></div>
+			</div></section></body></html>`))
+			return
+		}
+		atomic.AddInt64(&fileHits, 1)
+		if atomic.LoadInt64(&userHits) < 2 {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte("data " + path.Base(r.URL.Path)))
+	}))
+	defer server.Close()
+	t.Setenv("THEMIS_TUI_TEST_COOKIE", "session=abc")
+
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+	st := baseStateForTUI(now)
+	root := st.Nodes["url:root"]
+	root.Assets = nil
+	for i := 1; i <= 5; i++ {
+		root.Assets = append(root.Assets, state.AssetRef{
+			Name: fmt.Sprintf("%d.in", i),
+			URL:  fmt.Sprintf("%s/file/course/%%40tests/%d.in", server.URL, i),
+		})
+	}
+	st.Nodes["url:root"] = root
+
+	// The executor is the one the CLI wires up: every file goes through the
+	// shared provider, which re-opens the session after a rejected download.
+	var opened int64
+	sessions := themis.NewSessionProvider(func() (*themis.Session, error) {
+		atomic.AddInt64(&opened, 1)
+		return themis.NewSessionWithAuthConfig(server.URL, themis.AuthConfig{CookieEnv: "THEMIS_TUI_TEST_COOKIE"})
+	})
+	exec := func(ctx context.Context, _ state.State, req DownloadRequest) DownloadOutcome {
+		out := DownloadOutcome{NodeID: req.NodeID, TargetDir: req.TargetDir}
+		out.Err = sessions.Do(ctx, func(session *themis.Session) error {
+			items, err := discovery.DownloadAssetRefsContext(ctx, session.Client, req.Assets, req.TargetDir)
+			out.Downloaded = len(items)
+			return err
+		})
+		return out
+	}
+	targetDir := t.TempDir()
+	m, err := NewModel(Config{State: st, DownloadExecutor: exec, DefaultDownloadDir: targetDir, DownloadConcurrency: 2})
+	if err != nil {
+		t.Fatalf("new model failed: %v", err)
+	}
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'d'}})
+	m = updated.(Model)
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = runCmds(updated.(Model), cmd)
+
+	if m.downloadInFlight || m.downloadDone != 5 || m.downloadFailed != 0 {
+		t.Fatalf("unexpected totals: inflight=%v done=%d failed=%d status=%q", m.downloadInFlight, m.downloadDone, m.downloadFailed, m.statusText)
+	}
+	for i := 1; i <= 5; i++ {
+		raw, err := os.ReadFile(filepath.Join(targetDir, "tests", fmt.Sprintf("%d.in", i)))
+		if err != nil || string(raw) != fmt.Sprintf("data %d.in", i) {
+			t.Fatalf("unexpected %d.in: %q %v", i, raw, err)
+		}
+	}
+	if opened != 2 || userHits != 2 || fileHits != 6 {
+		t.Fatalf("expected one re-authentication for the rejected file, got opened=%d user=%d files=%d", opened, userHits, fileHits)
+	}
+}
+
+func TestCancelRefreshKeepsPartialResults(t *testing.T) {
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+	calls := 0
+	exec := func(ctx context.Context, st state.State, req RefreshRequest) RefreshOutcome {
+		calls++
+		node := st.Nodes["url:lab1"]
+		node.Title = "Lab 1 (fetched)"
+		st.Nodes["url:lab1"] = node
+		out := RefreshOutcome{State: st, Scope: req.Scope, TargetNodeID: req.TargetNodeID, UpdatedNodes: 1}
+		if err := ctx.Err(); err != nil {
+			out.Err = fmt.Errorf("refresh interrupted: %w", err)
+		}
+		return out
+	}
+	m, err := NewModel(Config{State: baseStateForTUI(now), RefreshExecutor: exec})
+	if err != nil {
+		t.Fatalf("new model failed: %v", err)
+	}
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'f'}})
+	m = updated.(Model)
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+	if !strings.Contains(m.renderStatus(), "esc cancel") {
+		t.Fatalf("expected cancel key in status line, got %q", m.renderStatus())
+	}
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	m = updated.(Model)
+	m = runCmds(m, cmd)
+
+	if m.refreshInFlight {
+		t.Fatalf("expected refresh to be finished after cancel")
+	}
+	if !strings.Contains(m.statusText, "refresh cancelled (full): kept 1 updated node(s)") {
+		t.Fatalf("unexpected status: %q", m.statusText)
+	}
+	if m.st.Nodes["url:lab1"].Title != "Lab 1 (fetched)" {
+		t.Fatalf("expected partial results to be kept")
+	}
+
+	// Work started after a cancel runs under a fresh context.
+	updated, cmd = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'r'}})
+	m = updated.(Model)
+	m = runCmds(m, cmd)
+	if calls != 2 || !strings.HasPrefix(m.statusText, "refresh finished") {
+		t.Fatalf("expected second refresh to finish, calls=%d status=%q", calls, m.statusText)
+	}
+}
+
+func TestRefreshDeadlineKeepsPartialResults(t *testing.T) {
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+	exec := func(_ context.Context, st state.State, req RefreshRequest) RefreshOutcome {
+		node := st.Nodes["url:lab1"]
+		node.Title = "Lab 1 (fetched)"
+		st.Nodes["url:lab1"] = node
+		return RefreshOutcome{
+			State:        st,
+			Scope:        req.Scope,
+			TargetNodeID: req.TargetNodeID,
+			UpdatedNodes: 1,
+			Err:          fmt.Errorf("refresh interrupted: %w", context.DeadlineExceeded),
+		}
+	}
+	m, err := NewModel(Config{State: baseStateForTUI(now), RefreshExecutor: exec})
+	if err != nil {
+		t.Fatalf("new model failed: %v", err)
+	}
+
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'r'}})
+	m = runCmds(updated.(Model), cmd)
+
+	if !strings.Contains(m.statusText, "refresh timed out (node): kept 1 updated node(s)") {
+		t.Fatalf("unexpected status: %q", m.statusText)
+	}
+	if m.st.Nodes["url:lab1"].Title != "Lab 1 (fetched)" {
+		t.Fatalf("expected partial results to be kept after the deadline")
+	}
+}
+
+func TestCancelDownloadSkipsQueuedFiles(t *testing.T) {
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+	st := baseStateForTUI(now)
+	root := st.Nodes["url:root"]
+	root.Assets = nil
+	for i := 1; i <= 5; i++ {
+		root.Assets = append(root.Assets, state.AssetRef{
+			Name: fmt.Sprintf("%d.in", i),
+			URL:  fmt.Sprintf("https://themis.housing.rug.nl/file/course/%%40tests/%d.in", i),
+		})
+	}
+	st.Nodes["url:root"] = root
+
+	calls := 0
+	exec := func(ctx context.Context, st state.State, req DownloadRequest) DownloadOutcome {
+		calls++
+		if err := ctx.Err(); err != nil {
+			return DownloadOutcome{NodeID: req.NodeID, Err: err}
+		}
+		return DownloadOutcome{NodeID: req.NodeID, TargetDir: req.TargetDir, Downloaded: 1}
+	}
+	m, err := NewModel(Config{State: st, DownloadExecutor: exec, DefaultDownloadDir: "/tmp/tests", DownloadConcurrency: 2})
+	if err != nil {
+		t.Fatalf("new model failed: %v", err)
+	}
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'d'}})
+	m = updated.(Model)
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyCtrlX})
+	m = updated.(Model)
+	if m.downloadCancelled != 3 || m.downloadNext != 5 {
+		t.Fatalf("expected queued files cancelled, got cancelled=%d next=%d", m.downloadCancelled, m.downloadNext)
+	}
+
+	m = runCmds(m, cmd)
+	if calls != 2 {
+		t.Fatalf("expected only the 2 started downloads to run, got %d", calls)
+	}
+	if m.downloadInFlight || m.downloadCancelled != 5 || m.downloadFailed != 0 {
+		t.Fatalf("unexpected totals: inflight=%v cancelled=%d failed=%d", m.downloadInFlight, m.downloadCancelled, m.downloadFailed)
+	}
+	if !strings.HasPrefix(m.statusText, "download cancelled: 0 ok, 0 failed, 5 cancelled") {
+		t.Fatalf("unexpected status: %q", m.statusText)
+	}
+}
+
+func TestCloseDownloadModeMidBatch(t *testing.T) {
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+	st := baseStateForTUI(now)
+	root := st.Nodes["url:root"]
+	root.Assets = nil
+	for i := 1; i <= 3; i++ {
+		root.Assets = append(root.Assets, state.AssetRef{
+			Name: fmt.Sprintf("%d.in", i),
+			URL:  fmt.Sprintf("https://themis.housing.rug.nl/file/course/%%40tests/%d.in", i),
+		})
+	}
+	st.Nodes["url:root"] = root
+
+	exec := func(ctx context.Context, st state.State, req DownloadRequest) DownloadOutcome {
+		if err := ctx.Err(); err != nil {
+			return DownloadOutcome{NodeID: req.NodeID, Err: err}
+		}
+		return DownloadOutcome{NodeID: req.NodeID, TargetDir: req.TargetDir, Downloaded: 1}
+	}
+	persistedDirs := []string{}
+	m, err := NewModel(Config{
+		State:               st,
+		DownloadExecutor:    exec,
+		DefaultDownloadDir:  "/tmp/tests",
+		DownloadConcurrency: 1,
+		PersistChoices: func(_ string, _ []string, targetDir string) error {
+			persistedDirs = append(persistedDirs, targetDir)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("new model failed: %v", err)
+	}
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'d'}})
+	m = updated.(Model)
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+	stale := cmd()
+
+	// Closing the mode mid-batch is refused rather than dropping the batch.
+	for _, msg := range []tea.KeyMsg{
+		{Type: tea.KeyRunes, Runes: []rune{'h'}},
+		{Type: tea.KeyRunes, Runes: []rune{'d'}},
+	} {
+		updated, _ = m.Update(msg)
+		m = updated.(Model)
+		if m.mode != "download" || !m.downloadInFlight || m.downloadTargetDir != "/tmp/tests" {
+			t.Fatalf("expected the running batch to keep download mode open, got mode=%s", m.mode)
+		}
+		if !strings.Contains(m.statusText, "download in progress") {
+			t.Fatalf("unexpected status: %q", m.statusText)
+		}
+	}
+
+	m = runCmds(m, func() tea.Msg { return stale })
+	if m.downloadInFlight || m.downloadDone != 3 {
+		t.Fatalf("expected the batch to finish, got inflight=%v done=%d", m.downloadInFlight, m.downloadDone)
+	}
+	if len(persistedDirs) != 1 || persistedDirs[0] != "/tmp/tests" || m.defaultDownloadDir != "/tmp/tests" {
+		t.Fatalf("expected the batch target dir to be kept, got %v default=%q", persistedDirs, m.defaultDownloadDir)
+	}
+
+	// A result of the finished batch does not count towards the next one.
+	updated, cmd = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+	updated, _ = m.Update(stale)
+	m = updated.(Model)
+	if m.downloadDone != 0 || m.downloadActive != 1 {
+		t.Fatalf("expected the stale result to be dropped, got done=%d active=%d", m.downloadDone, m.downloadActive)
+	}
+
+	// Once cancelled and drained, the mode closes.
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyCtrlX})
+	m = runCmds(updated.(Model), cmd)
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'h'}})
+	m = updated.(Model)
+	if m.mode != "browse" || m.statusText != "download mode closed" {
+		t.Fatalf("expected download mode closed after the batch ended, got mode=%s status=%q", m.mode, m.statusText)
+	}
+}
+
+func TestRefreshProgressUpdatesTreeIncrementally(t *testing.T) {
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+	release := make(chan struct{})
+	exec := func(_ context.Context, st state.State, req RefreshRequest) RefreshOutcome {
+		landed := time.Now().Add(time.Minute)
+		root := st.Nodes["url:root"]
+		root.ChildIDs = append(root.ChildIDs, "url:lab3")
+		root.UpdatedAt = landed
+		st.Nodes["url:root"] = root
+		st.Nodes["url:lab3"] = state.Node{ID: "url:lab3", Title: "Lab 3", Kind: "assignment", ParentIDs: []string{"url:root"}, Status: state.StatusNever, UpdatedAt: landed}
+		req.Progress(RefreshProgress{
+			URL:     root.CanonicalURL,
+			Fetched: 1,
+			Queued:  3,
+			Errors:  1,
+			Nodes:   []state.Node{st.Nodes["url:root"], st.Nodes["url:lab3"]},
+		})
+		<-release
+		return RefreshOutcome{State: st, Scope: req.Scope, TargetNodeID: req.TargetNodeID, UpdatedNodes: 2}
+	}
+	m, err := NewModel(Config{State: baseStateForTUI(now), RefreshExecutor: exec})
+	if err != nil {
+		t.Fatalf("new model failed: %v", err)
+	}
+
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'R'}})
+	m = updated.(Model)
+	batch, ok := cmd().(tea.BatchMsg)
+	if !ok || len(batch) != 2 {
+		t.Fatalf("expected refresh and progress commands")
+	}
+	finished := make(chan tea.Msg, 1)
+	go func() { finished <- batch[0]() }()
+
+	updated, _ = m.Update(batch[1]())
+	m = updated.(Model)
+	if len(m.flat) != 4 || m.flat[3].NodeID != "url:lab3" {
+		t.Fatalf("expected landed node in tree before refresh finished, got %+v", m.flat)
+	}
+	if !strings.Contains(m.statusText, "1 fetched, 3 queued, 1 error(s)") {
+		t.Fatalf("unexpected progress status: %q", m.statusText)
+	}
+	if !strings.Contains(m.renderStatus(), "refreshing 1/4") {
+		t.Fatalf("expected progress counter in status line, got %q", m.renderStatus())
+	}
+
+	close(release)
+	updated, _ = m.Update(<-finished)
+	m = updated.(Model)
+	if m.refreshInFlight || m.refreshProgress != nil || !strings.HasPrefix(m.statusText, "refresh finished") {
+		t.Fatalf("expected refresh to finish, status %q", m.statusText)
+	}
+}
@@ -0,0 +1,161 @@
+package app
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/reflow/wordwrap"
+	"github.com/muesli/reflow/wrap"
+
+	"themis-cli/internal/state"
+)
+
+var markdownRefLine = regexp.MustCompile(`^\[\d+\]: `)
+
+// readerBody is the Markdown shown in the reader: the page body stored by
+// refresh, or the short description for nodes fetched before bodies were
+// stored. full reports whether the body was available.
+func readerBody(node state.Node) (body string, full bool) {
+	if raw, ok := node.Details["body_markdown"].(string); ok && strings.TrimSpace(raw) != "" {
+		return raw, true
+	}
+	if raw, ok := node.Details["description"].(string); ok {
+		return strings.TrimSpace(raw), false
+	}
+	return "", false
+}
+
+func (m Model) openReader() (tea.Model, tea.Cmd) {
+	node := m.selectedNode()
+	if node == nil {
+		m.statusText = "no selected node"
+		return m, nil
+	}
+	m.mode = "reader"
+	m.readerOffset = 0
+	if _, full := readerBody(*node); full {
+		m.statusText = "reading " + displayTitle(*node)
+	} else {
+		m.statusText = "no page body stored; press " + m.keys.RefreshNode.Help().Key + " to refresh"
+	}
+	return m, nil
+}
+
+func (m Model) updateReader(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	page := m.panelContentHeight()
+	switch {
+	case key.Matches(msg, m.keys.Quit):
+		return m, tea.Quit
+	case key.Matches(msg, m.keys.Help):
+		return m.openHelp()
+	case key.Matches(msg, m.keys.Cancel, m.keys.Reader):
+		m.mode = "browse"
+		m.statusText = "reader closed"
+		return m, nil
+	case key.Matches(msg, m.keys.Down):
+		m.readerOffset++
+	case key.Matches(msg, m.keys.Up):
+		m.readerOffset--
+	case key.Matches(msg, m.keys.PageDown):
+		m.readerOffset += page
+	case key.Matches(msg, m.keys.PageUp):
+		m.readerOffset -= page
+	case key.Matches(msg, m.keys.Top):
+		m.readerOffset = 0
+	case key.Matches(msg, m.keys.Bottom):
+		m.readerOffset = len(m.readerLines(m.readerWidth()))
+	case key.Matches(msg, m.keys.OpenPage, m.keys.OpenStats, m.keys.CopyPage, m.keys.CopyStats):
+		return m.openOrCopy(m.keyAction(msg))
+	case key.Matches(msg, m.keys.RefreshNode):
+		return m.startRefresh(RefreshScopeNode, 0)
+	}
+	m.readerOffset = minInt(maxInt(0, m.readerOffset), maxInt(0, len(m.readerLines(m.readerWidth()))-page))
+	return m, nil
+}
+
+// readerWidth is the text width of the full-screen reader pane.
+func (m Model) readerWidth() int {
+	panelFrameW, _ := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).GetFrameSize()
+	return maxInt(1, maxInt(20, m.width)-panelFrameW)
+}
+
+// readerLines is the selected node's page body wrapped to width, below a
+// title and URL header.
+func (m Model) readerLines(width int) []string {
+	node := m.selectedNode()
+	if node == nil {
+		return []string{mutedStyle.Render("(no selection)")}
+	}
+	lines := []string{titleStyle.Render(truncateOneLine(displayTitle(*node), width))}
+	if node.CanonicalURL != "" {
+		lines = append(lines, mutedStyle.Render(truncateOneLine(node.CanonicalURL, width)))
+	}
+	lines = append(lines, "")
+	body, full := readerBody(*node)
+	if body == "" {
+		return append(lines, mutedStyle.Render("(no page body stored; press "+m.keys.RefreshNode.Help().Key+" to refresh)"))
+	}
+	lines = append(lines, renderMarkdownLines(body, width)...)
+	if !full {
+		lines = append(lines, "", mutedStyle.Render("(summary only; press "+m.keys.RefreshNode.Help().Key+" to fetch the full page body)"))
+	}
+	return lines
+}
+
+// renderMarkdownLines wraps Markdown to width for the terminal. Prose is
+// word-wrapped; fenced code keeps its indentation and is hard-wrapped so no
+// character is lost.
+func renderMarkdownLines(body string, width int) []string {
+	out := make([]string, 0)
+	fence := ""
+	for _, line := range strings.Split(body, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence == "" && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")) {
+			fence = trimmed[:3]
+			out = append(out, mutedStyle.Render(truncateOneLine(line, width)))
+			continue
+		}
+		if fence != "" {
+			if trimmed == fence {
+				fence = ""
+				out = append(out, mutedStyle.Render(line))
+				continue
+			}
+			code := strings.ReplaceAll(line, "\t", "    ")
+			for _, part := range strings.Split(wrap.String(code, width), "\n") {
+				out = append(out, codeStyle.Render(part))
+			}
+			continue
+		}
+		style := lipgloss.NewStyle()
+		switch {
+		case strings.HasPrefix(line, "#"):
+			style = titleStyle
+		case markdownRefLine.MatchString(line):
+			style = infoStyle
+		}
+		for _, part := range strings.Split(wrap.String(wordwrap.String(line, width), width), "\n") {
+			out = append(out, style.Render(part))
+		}
+	}
+	return out
+}
+
+func (m Model) renderReader(width int, height int) string {
+	lines := m.readerLines(width)
+	offset := minInt(maxInt(0, m.readerOffset), maxInt(0, len(lines)-height))
+	end := minInt(len(lines), offset+height)
+	return strings.Join(lines[offset:end], "\n")
+}
+
+// readerPosition describes the visible line range for the status bar.
+func (m Model) readerPosition() string {
+	total := len(m.readerLines(m.readerWidth()))
+	first := minInt(total, m.readerOffset+1)
+	last := minInt(total, m.readerOffset+m.panelContentHeight())
+	return fmt.Sprintf("lines %d-%d of %d", first, last, total)
+}
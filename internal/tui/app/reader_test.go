@@ -0,0 +1,93 @@
+package app
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestReaderScrollsPageBody(t *testing.T) {
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+	st := baseStateForTUI(now)
+	body := []string{"## Task", "", "Write a shell. See [the spec][1].", "", "```c", "int main(void) {", "\treturn 0;", "}", "```", ""}
+	for i := 0; i < 30; i++ {
+		body = append(body, "Paragraph line.")
+	}
+	body = append(body, "", "[1]: https://themis.housing.rug.nl/file/os/spec.pdf")
+	root := st.Nodes["url:root"]
+	root.Details = map[string]any{"body_markdown": strings.Join(body, "\n")}
+	st.Nodes["url:root"] = root
+
+	m, err := NewModel(Config{State: st})
+	if err != nil {
+		t.Fatalf("new model failed: %v", err)
+	}
+	press := func(key string) {
+		t.Helper()
+		msg := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)}
+		if key == "esc" {
+			msg = tea.KeyMsg{Type: tea.KeyEsc}
+		}
+		updated, _ := m.Update(msg)
+		m = updated.(Model)
+	}
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 60, Height: 20})
+	m = updated.(Model)
+
+	press("v")
+	if m.mode != "reader" {
+		t.Fatalf("expected reader mode, got %q", m.mode)
+	}
+	view := m.View()
+	for _, want := range []string{"Operating Systems", "## Task", "```c", "    return 0;"} {
+		if !strings.Contains(view, want) {
+			t.Fatalf("expected %q in reader view:\n%s", want, view)
+		}
+	}
+
+	press("j")
+	if m.readerOffset != 1 {
+		t.Fatalf("expected offset 1, got %d", m.readerOffset)
+	}
+	press("G")
+	total := len(m.readerLines(m.readerWidth()))
+	if m.readerOffset != total-m.panelContentHeight() {
+		t.Fatalf("expected offset %d, got %d", total-m.panelContentHeight(), m.readerOffset)
+	}
+	if view := m.View(); !strings.Contains(view, "[1]: https://themis.housing.rug.nl/file/os/spec.pdf") {
+		t.Fatalf("expected link list at the bottom:\n%s", view)
+	}
+	press("g")
+	if m.readerOffset != 0 {
+		t.Fatalf("expected offset 0, got %d", m.readerOffset)
+	}
+
+	press("esc")
+	if m.mode != "browse" {
+		t.Fatalf("expected browse mode after esc, got %q", m.mode)
+	}
+}
+
+func TestReaderFallsBackToDescription(t *testing.T) {
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+	st := baseStateForTUI(now)
+	root := st.Nodes["url:root"]
+	root.Details = map[string]any{"description": "Course summary"}
+	st.Nodes["url:root"] = root
+
+	m, err := NewModel(Config{State: st})
+	if err != nil {
+		t.Fatalf("new model failed: %v", err)
+	}
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'v'}})
+	m = updated.(Model)
+	if m.statusText != "no page body stored; press r to refresh" {
+		t.Fatalf("unexpected status: %q", m.statusText)
+	}
+	lines := strings.Join(m.readerLines(40), "\n")
+	if !strings.Contains(lines, "Course summary") || !strings.Contains(lines, "summary only") {
+		t.Fatalf("expected description fallback:\n%s", lines)
+	}
+}
@@ -0,0 +1,297 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sahilm/fuzzy"
+
+	"themis-cli/internal/state"
+)
+
+const breadcrumbSeparator = " / "
+
+// The search prompt moves between matches with the arrow keys only, since
+// printable keys type into the query.
+var (
+	searchPrevKey = binding("↑", "previous match", "up", "ctrl+p")
+	searchNextKey = binding("↓", "next match", "down", "ctrl+n")
+)
+
+// searchHelp is the key hint shown while typing a search.
+func (km KeyMap) searchHelp() string {
+	return searchPrevKey.Help().Key + "/" + searchNextKey.Help().Key + " move " +
+		km.Enter.Help().Key + " jump " + km.Cancel.Help().Key + " cancel"
+}
+
+// searchMatch is a node matched by the / search, with its breadcrumb from the
+// tree root.
+type searchMatch struct {
+	NodeID    string
+	Path      string
+	Ancestors []string
+	// Indexes are the byte offsets in Path matched by the fuzzy text.
+	Indexes []int
+}
+
+// searchQuery is the parsed search input: key:value filters plus free text
+// that is fuzzy-matched against breadcrumbs.
+type searchQuery struct {
+	Text    string
+	Filters map[string][]string
+}
+
+var searchFilterKeys = map[string]bool{"status": true, "kind": true, "result": true}
+
+// parseSearchQuery splits input into filters (status:, kind:, result:) and
+// fuzzy text. Several values for one key are alternatives; different keys
+// must all match.
+func parseSearchQuery(input string) searchQuery {
+	q := searchQuery{Filters: map[string][]string{}}
+	text := make([]string, 0)
+	for _, token := range strings.Fields(input) {
+		key, value, ok := strings.Cut(token, ":")
+		key = strings.ToLower(key)
+		if ok && value != "" && searchFilterKeys[key] {
+			q.Filters[key] = append(q.Filters[key], strings.ToLower(value))
+			continue
+		}
+		text = append(text, token)
+	}
+	q.Text = strings.Join(text, " ")
+	return q
+}
+
+// accepts applies the filters. status: also matches the result label, so
+// status:failing and status:stale both work.
+func (q searchQuery) accepts(node state.Node) bool {
+	result := strings.ToLower(state.ResultLabel(node))
+	for key, values := range q.Filters {
+		matched := false
+		for _, value := range values {
+			switch key {
+			case "status":
+				matched = strings.EqualFold(string(node.Status), value) || result == value
+			case "kind":
+				matched = strings.EqualFold(node.Kind, value)
+			case "result":
+				matched = result == value
+			}
+			if matched {
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+type searchSource []searchMatch
+
+func (s searchSource) String(i int) string { return s[i].Path }
+func (s searchSource) Len() int            { return len(s) }
+
+// searchCandidates lists every node reachable from rootID, breadth-first in
+// tree order, regardless of which rows are expanded.
+func searchCandidates(st state.State, rootID string) []searchMatch {
+	root, ok := st.Nodes[rootID]
+	if !ok {
+		return nil
+	}
+	out := []searchMatch{{NodeID: rootID, Path: displayTitle(root)}}
+	seen := map[string]bool{rootID: true}
+	for i := 0; i < len(out); i++ {
+		parent := out[i]
+		ancestors := append(append([]string{}, parent.Ancestors...), parent.NodeID)
+		for _, childID := range sortedNodeChildren(st, st.Nodes[parent.NodeID].ChildIDs) {
+			if seen[childID] {
+				continue
+			}
+			seen[childID] = true
+			out = append(out, searchMatch{
+				NodeID:    childID,
+				Path:      parent.Path + breadcrumbSeparator + displayTitle(st.Nodes[childID]),
+				Ancestors: ancestors,
+			})
+		}
+	}
+	return out
+}
+
+// findMatches returns the nodes under rootID accepted by input's filters,
+// ranked by fuzzy score when input has text and in tree order otherwise.
+func findMatches(st state.State, rootID string, input string) []searchMatch {
+	q := parseSearchQuery(input)
+	candidates := make(searchSource, 0)
+	for _, c := range searchCandidates(st, rootID) {
+		if q.accepts(st.Nodes[c.NodeID]) {
+			candidates = append(candidates, c)
+		}
+	}
+	if q.Text == "" {
+		return candidates
+	}
+	ranked := fuzzy.FindFrom(q.Text, candidates)
+	out := make([]searchMatch, 0, len(ranked))
+	for _, r := range ranked {
+		match := candidates[r.Index]
+		match.Indexes = r.MatchedIndexes
+		out = append(out, match)
+	}
+	return out
+}
+
+func (m Model) openSearch() (tea.Model, tea.Cmd) {
+	m.mode = "search"
+	m.filter = ""
+	m.searchOrigin = m.selectedNodeID
+	m.searchExpanded = make(map[string]bool, len(m.expanded))
+	for id, open := range m.expanded {
+		m.searchExpanded[id] = open
+	}
+	m.refreshSearch()
+	return m, nil
+}
+
+func (m Model) updateSearch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case msg.Type == tea.KeyCtrlC:
+		return m, tea.Quit
+	case key.Matches(msg, m.keys.Cancel):
+		m.mode = "browse"
+		m.expanded = m.searchExpanded
+		m.searchExpanded = nil
+		m.searchMatches = nil
+		m.selectedNodeID = m.searchOrigin
+		m.rebuildFlat()
+		m.statusText = "search cancelled"
+		return m, nil
+	case key.Matches(msg, m.keys.Enter):
+		m.mode = "browse"
+		m.searchExpanded = nil
+		if len(m.searchMatches) == 0 {
+			m.statusText = fmt.Sprintf("no matches for %q", m.filter)
+			return m, nil
+		}
+		m.jumpToMatch(m.searchCursor)
+		return m, nil
+	case key.Matches(msg, searchPrevKey):
+		if m.searchCursor > 0 {
+			m.jumpToMatch(m.searchCursor - 1)
+		}
+		return m, nil
+	case key.Matches(msg, searchNextKey):
+		if m.searchCursor < len(m.searchMatches)-1 {
+			m.jumpToMatch(m.searchCursor + 1)
+		}
+		return m, nil
+	case msg.Type == tea.KeyBackspace:
+		if runes := []rune(m.filter); len(runes) > 0 {
+			m.filter = string(runes[:len(runes)-1])
+		}
+	case msg.Type == tea.KeyCtrlU:
+		m.filter = ""
+	case msg.Type == tea.KeySpace:
+		m.filter += " "
+	case msg.Type == tea.KeyRunes:
+		m.filter += string(msg.Runes)
+	default:
+		return m, nil
+	}
+	m.refreshSearch()
+	return m, nil
+}
+
+// refreshSearch recomputes matches for the current input and previews the best
+// one in the tree and details panes.
+func (m *Model) refreshSearch() {
+	m.searchMatches = findMatches(m.st, m.rootNodeID, m.filter)
+	m.searchCursor = 0
+	if len(m.searchMatches) == 0 {
+		m.statusText = "no matches"
+		return
+	}
+	m.jumpToMatch(0)
+}
+
+// jumpToMatch expands the ancestors of match i and selects it.
+func (m *Model) jumpToMatch(i int) {
+	if i < 0 || i >= len(m.searchMatches) {
+		return
+	}
+	match := m.searchMatches[i]
+	m.searchCursor = i
+	for _, id := range match.Ancestors {
+		m.expanded[id] = true
+	}
+	m.ensureVisible(match.NodeID)
+	m.rebuildFlat()
+	m.selectedNodeID = match.NodeID
+	m.syncSelectedIndex()
+	m.statusText = fmt.Sprintf("match %d/%d: %s", i+1, len(m.searchMatches), match.Path)
+}
+
+// cycleMatch moves to the next (delta 1) or previous (delta -1) match of the
+// last search, wrapping around.
+func (m Model) cycleMatch(delta int) (tea.Model, tea.Cmd) {
+	if len(m.searchMatches) == 0 {
+		m.statusText = "no active search (press " + m.keys.Search.Help().Key + " to search)"
+		return m, nil
+	}
+	n := len(m.searchMatches)
+	m.jumpToMatch(((m.searchCursor+delta)%n + n) % n)
+	return m, nil
+}
+
+func (m Model) renderSearch(maxLines int) string {
+	lines := []string{
+		titleStyle.Render("Search"),
+		"/" + m.filter + "_",
+	}
+	if len(m.searchMatches) == 0 {
+		lines = append(lines, mutedStyle.Render("(no matches; filters: status:, kind:, result:)"))
+		return clipTopLines(strings.Join(lines, "\n"), maxLines)
+	}
+
+	visible := maxInt(1, maxLines-len(lines))
+	start := 0
+	if m.searchCursor >= visible {
+		start = m.searchCursor - visible + 1
+	}
+	end := minInt(len(m.searchMatches), start+visible)
+	for i := start; i < end; i++ {
+		match := m.searchMatches[i]
+		node := m.st.Nodes[match.NodeID]
+		line := colorResultTag(state.ResultLabel(node), node.Status) + " " + highlightMatch(match.Path, match.Indexes)
+		if i == m.searchCursor {
+			line = selectedStyle.Render("> ") + line
+		} else {
+			line = "  " + line
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func highlightMatch(text string, indexes []int) string {
+	if len(indexes) == 0 {
+		return text
+	}
+	hit := make(map[int]bool, len(indexes))
+	for _, i := range indexes {
+		hit[i] = true
+	}
+	var b strings.Builder
+	for i, r := range text {
+		if hit[i] {
+			b.WriteString(infoStyle.Render(string(r)))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,126 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"themis-cli/internal/state"
+)
+
+func typeKeys(t *testing.T, m Model, keys ...string) Model {
+	t.Helper()
+	for _, k := range keys {
+		var msg tea.KeyMsg
+		switch k {
+		case "enter":
+			msg = tea.KeyMsg{Type: tea.KeyEnter}
+		case "esc":
+			msg = tea.KeyMsg{Type: tea.KeyEsc}
+		case "backspace":
+			msg = tea.KeyMsg{Type: tea.KeyBackspace}
+		case " ":
+			msg = tea.KeyMsg{Type: tea.KeySpace}
+		default:
+			msg = tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+		}
+		updated, _ := m.Update(msg)
+		m = updated.(Model)
+	}
+	return m
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	q := parseSearchQuery("kind:assignment lab status:failing Status:stale url:x")
+	if q.Text != "lab url:x" {
+		t.Fatalf("unexpected text %q", q.Text)
+	}
+	if len(q.Filters["kind"]) != 1 || len(q.Filters["status"]) != 2 || q.Filters["status"][1] != "stale" {
+		t.Fatalf("unexpected filters %#v", q.Filters)
+	}
+}
+
+func TestFindMatches_SearchesCollapsedNodesWithPath(t *testing.T) {
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+	st := baseStateForTUI(now)
+	lab2 := st.Nodes["url:lab2"]
+	lab2.Status = state.StatusStale
+	st.Nodes["url:lab2"] = lab2
+
+	matches := findMatches(st, "url:root", "lab2")
+	if len(matches) == 0 || matches[0].NodeID != "url:lab2" {
+		t.Fatalf("expected lab2 first, got %#v", matches)
+	}
+	if matches[0].Path != "Operating Systems / Lab 2" {
+		t.Fatalf("unexpected path %q", matches[0].Path)
+	}
+	if len(matches[0].Ancestors) != 1 || matches[0].Ancestors[0] != "url:root" {
+		t.Fatalf("unexpected ancestors %v", matches[0].Ancestors)
+	}
+
+	matches = findMatches(st, "url:root", "kind:assignment status:stale")
+	if len(matches) != 1 || matches[0].NodeID != "url:lab2" {
+		t.Fatalf("expected only stale assignment, got %#v", matches)
+	}
+	if got := findMatches(st, "url:root", "kind:course zzz"); len(got) != 0 {
+		t.Fatalf("expected no matches, got %#v", got)
+	}
+}
+
+func TestSearchModeJumpsAndCycles(t *testing.T) {
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+	m, err := NewModel(Config{State: baseStateForTUI(now), RootNodeID: "url:root"})
+	if err != nil {
+		t.Fatalf("new model failed: %v", err)
+	}
+	m = typeKeys(t, m, "h")
+	if len(m.flat) != 1 {
+		t.Fatalf("expected collapsed root")
+	}
+
+	m = typeKeys(t, m, "/", "l", "a", "b", " ", "k", "i", "n", "d", ":", "a", "s", "s", "i", "g", "n", "m", "e", "n", "t")
+	if m.mode != "search" || m.filter != "lab kind:assignment" {
+		t.Fatalf("unexpected search state mode=%s filter=%q", m.mode, m.filter)
+	}
+	if len(m.searchMatches) != 2 {
+		t.Fatalf("expected 2 matches, got %d", len(m.searchMatches))
+	}
+	first := m.searchMatches[0].NodeID
+	if m.selectedNodeID != first || len(m.flat) != 3 {
+		t.Fatalf("expected preview to expand and select first match")
+	}
+
+	m = typeKeys(t, m, "enter")
+	if m.mode != "browse" || m.selectedNodeID != first {
+		t.Fatalf("expected enter to keep first match selected")
+	}
+	m = typeKeys(t, m, "n")
+	if m.selectedNodeID == first {
+		t.Fatalf("expected n to move to next match")
+	}
+	m = typeKeys(t, m, "n")
+	if m.selectedNodeID != first {
+		t.Fatalf("expected n to wrap around")
+	}
+	m = typeKeys(t, m, "N")
+	if m.selectedNodeID == first {
+		t.Fatalf("expected N to move back")
+	}
+}
+
+func TestSearchEscRestoresView(t *testing.T) {
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+	m, err := NewModel(Config{State: baseStateForTUI(now), RootNodeID: "url:root"})
+	if err != nil {
+		t.Fatalf("new model failed: %v", err)
+	}
+	m = typeKeys(t, m, "h", "/", "2")
+	if len(m.flat) != 3 {
+		t.Fatalf("expected preview to expand the tree")
+	}
+	m = typeKeys(t, m, "esc")
+	if m.mode != "browse" || m.selectedNodeID != "url:root" || len(m.flat) != 1 {
+		t.Fatalf("expected esc to restore selection and folding")
+	}
+}
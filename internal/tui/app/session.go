@@ -0,0 +1,85 @@
+package app
+
+import (
+	"sort"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Session is the part of the view that survives restarts: which nodes are
+// expanded, the selected node and how far the tree is scrolled.
+type Session struct {
+	ExpandedNodeIDs []string
+	SelectedNodeID  string
+	ScrollOffset    int
+}
+
+// SaveSessionFunc persists the session when the TUI exits.
+type SaveSessionFunc func(Session) error
+
+// Session returns the current view state; expanded ids are sorted.
+func (m Model) Session() Session {
+	out := Session{
+		ExpandedNodeIDs: make([]string, 0, len(m.expanded)),
+		SelectedNodeID:  m.selectedNodeID,
+		ScrollOffset:    m.treeOffset,
+	}
+	for id, open := range m.expanded {
+		if open {
+			out.ExpandedNodeIDs = append(out.ExpandedNodeIDs, id)
+		}
+	}
+	sort.Strings(out.ExpandedNodeIDs)
+	return out
+}
+
+// restoreSession applies a saved session, skipping nodes that are no longer
+// in state. The selection falls back to the root when its node is gone.
+func (m *Model) restoreSession(s Session) {
+	for _, id := range s.ExpandedNodeIDs {
+		if _, ok := m.st.Nodes[id]; ok {
+			m.expanded[id] = true
+		}
+	}
+	if m.ensureVisible(s.SelectedNodeID) {
+		m.selectedNodeID = s.SelectedNodeID
+	}
+	m.rebuildFlat()
+	m.syncSelectedIndex()
+	m.treeOffset = minInt(maxInt(0, s.ScrollOffset), maxInt(0, len(m.flat)-1))
+}
+
+// treeListHeight is the number of tree rows that fit under the pane title.
+func (m Model) treeListHeight() int {
+	return maxInt(1, m.panelContentHeight()-1)
+}
+
+// adjustTreeOffset scrolls the tree just enough to keep the selection
+// visible. It waits for the first window size so a restored offset is not
+// clamped against an unknown height.
+func (m *Model) adjustTreeOffset() {
+	if m.width <= 0 || m.height <= 0 {
+		return
+	}
+	listHeight := m.treeListHeight()
+	if m.selectedIndex < m.treeOffset {
+		m.treeOffset = m.selectedIndex
+	}
+	if m.selectedIndex >= m.treeOffset+listHeight {
+		m.treeOffset = m.selectedIndex - listHeight + 1
+	}
+	m.treeOffset = minInt(m.treeOffset, maxInt(0, len(m.flat)-listHeight))
+	if m.treeOffset < 0 {
+		m.treeOffset = 0
+	}
+}
+
+// Update handles msg and then keeps the tree selection on screen.
+func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	next, cmd := m.update(msg)
+	if model, ok := next.(Model); ok {
+		model.adjustTreeOffset()
+		return model, cmd
+	}
+	return next, cmd
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"themis-cli/internal/state"
+)
+
+func TestSessionRestoreSkipsMissingNodes(t *testing.T) {
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+	st := baseStateForTUI(now)
+	lab1 := st.Nodes["url:lab1"]
+	lab1.ChildIDs = []string{"url:test1"}
+	st.Nodes["url:lab1"] = lab1
+	st.Nodes["url:test1"] = state.Node{ID: "url:test1", Title: "Test 1", ParentIDs: []string{"url:lab1"}, Status: state.StatusOK}
+
+	m, err := NewModel(Config{State: st, Session: &Session{
+		ExpandedNodeIDs: []string{"url:lab1", "url:gone"},
+		SelectedNodeID:  "url:test1",
+		ScrollOffset:    1,
+	}})
+	if err != nil {
+		t.Fatalf("new model failed: %v", err)
+	}
+	if m.selectedNodeID != "url:test1" || m.selectedIndex != 2 || m.treeOffset != 1 {
+		t.Fatalf("unexpected restore: selected=%s index=%d offset=%d", m.selectedNodeID, m.selectedIndex, m.treeOffset)
+	}
+	got := m.Session()
+	want := Session{ExpandedNodeIDs: []string{"url:lab1", "url:root"}, SelectedNodeID: "url:test1", ScrollOffset: 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected session: %+v", got)
+	}
+
+	m, err = NewModel(Config{State: st, Session: &Session{SelectedNodeID: "url:gone", ScrollOffset: 99}})
+	if err != nil {
+		t.Fatalf("new model failed: %v", err)
+	}
+	if m.selectedNodeID != "url:root" || m.treeOffset != len(m.flat)-1 {
+		t.Fatalf("expected fallback to root, got selected=%s offset=%d", m.selectedNodeID, m.treeOffset)
+	}
+}
+
+func TestTreeScrollsWithSelection(t *testing.T) {
+	now := time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)
+	st := baseStateForTUI(now)
+	root := st.Nodes["url:root"]
+	for i := 3; i <= 30; i++ {
+		id := fmt.Sprintf("url:lab%d", i)
+		root.ChildIDs = append(root.ChildIDs, id)
+		st.Nodes[id] = state.Node{ID: id, Title: fmt.Sprintf("Lab %02d", i), ParentIDs: []string{"url:root"}, Status: state.StatusOK}
+	}
+	st.Nodes["url:root"] = root
+
+	m, err := NewModel(Config{State: st})
+	if err != nil {
+		t.Fatalf("new model failed: %v", err)
+	}
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 100, Height: 16})
+	m = updated.(Model)
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'G'}})
+	m = updated.(Model)
+
+	listHeight := m.treeListHeight()
+	if m.treeOffset != len(m.flat)-listHeight {
+		t.Fatalf("expected offset %d, got %d", len(m.flat)-listHeight, m.treeOffset)
+	}
+	if tree := m.renderTreeForHeight(listHeight + 1); !strings.Contains(tree, "Lab 30") || strings.Contains(tree, "Operating Systems") {
+		t.Fatalf("expected the bottom of the tree to be shown:\n%s", tree)
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'g'}})
+	m = updated.(Model)
+	if m.treeOffset != 0 {
+		t.Fatalf("expected scroll back to top, got %d", m.treeOffset)
+	}
+}